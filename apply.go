@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// responseFile is one file block of a model's answer to a --contract pack.
+type responseFile struct {
+	rel     string
+	mode    iofs.FileMode
+	base    string // sha256 of the file the change starts from, or "new"
+	deleted bool
+	content []byte
+	patch   bool        // content is a unified diff against the file as packed
+	hunks   []patchHunk // of the patch
+	merge   string      // mergedClean or mergedConflicted when --on-stale merge merged it
+	line    int         // of the header, for messages
+}
+
+var (
+	baseRe = regexp.MustCompile(`^(?:[0-9a-f]{64}|new)$`)
+	// elisionRe spots placeholders models write instead of unchanged code.
+	elisionRe = regexp.MustCompile(`(?i)^\s*(?://|#|--|;|/\*|<!--|\*)?\s*(?:\.\.\.|…)\s*\(?\s*(?:rest|remaining|existing|other|unchanged|same|previous)\b`)
+)
+
+// parseResponse reads file blocks strictly: headers must be well formed and
+// carry a base, every block must end, and nothing but blank lines may sit
+// between blocks. Prose before the first block or after the last is
+// skipped with a warning. All problems are reported together.
+func parseResponse(rd io.Reader) ([]responseFile, error) {
+	r := bufio.NewReader(rd)
+	var files []responseFile
+	var problems []string
+	bad := func(line int, format string, a ...any) {
+		problems = append(problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, a...))
+	}
+	seen := map[string]int{}
+	var cur *responseFile
+	var body []string
+	var stray []int // lines of text outside blocks
+	n := 0
+	for {
+		raw, err := readContentLine(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		l := strings.TrimSuffix(raw, "\r")
+		n++
+		if cur == nil && l == footerStart {
+			break // a signature covers nothing after the footer
+		}
+		if cur != nil {
+			if l == endMark {
+				if len(body) > 0 {
+					cur.content = []byte(strings.Join(body, "\n") + "\n")
+				}
+				if cur.deleted && strings.TrimSpace(string(cur.content)) != "" {
+					bad(cur.line, "%s: deleted=true with a non-empty body", cur.rel)
+				}
+				if cur.patch {
+					var err error
+					if cur.hunks, err = parsePatch(cur.content); err != nil {
+						bad(cur.line, "%s: %v", cur.rel, err)
+					}
+				}
+				files = append(files, *cur)
+				cur, body = nil, nil
+				continue
+			}
+			if !strings.HasPrefix(l, startMark+" ") {
+				if elisionRe.MatchString(l) {
+					bad(n, "%s: looks like elided content (%q); the whole file is required", cur.rel, strings.TrimSpace(l))
+				}
+				body = append(body, raw) // a CRLF file keeps its line endings
+				continue
+			}
+			// a new header inside a block: the previous one never ended
+			bad(cur.line, "%s: no %q before the next file", cur.rel, endMark)
+			cur, body = nil, nil
+		}
+		if !strings.HasPrefix(l, startMark+" ") {
+			if strings.TrimSpace(l) != "" {
+				stray = append(stray, n)
+			}
+			continue
+		}
+		switch {
+		case len(stray) > 0 && len(seen) > 0:
+			bad(stray[0], "text between file blocks")
+		case len(stray) > 0:
+			fmt.Fprintf(os.Stderr, "warning: ignoring text before the first file block (line %d)\n", stray[0])
+		}
+		stray = stray[:0]
+		rel, mode, attrs, ok := packprompt.ParseHeader(l)
+		if !ok {
+			bad(n, "malformed header %q", l)
+			continue
+		}
+		f := responseFile{rel: rel, line: n, base: attrs[baseAttr]}
+		if f.mode, err = packprompt.ParseMode(mode); err != nil {
+			bad(n, "%s: invalid mode %q", rel, mode)
+		}
+		if !iofs.ValidPath(rel) || rel == "." || strings.Contains(rel, archiveSep) {
+			bad(n, "%s: path outside the tree", rel)
+		}
+		if !baseRe.MatchString(f.base) {
+			bad(n, "%s: want base=SHA256 or base=new, got %q", rel, f.base)
+		}
+		if v, ok := attrs[deletedAttr]; ok {
+			if v != "true" {
+				bad(n, "%s: want deleted=true, got %q", rel, v)
+			}
+			f.deleted = true
+		}
+		if v, ok := attrs[patchAttr]; ok && v != patchUnified {
+			bad(n, "%s: want patch=%s, got %q", rel, patchUnified, v)
+		} else if ok && f.deleted {
+			bad(n, "%s: a patch cannot delete the file; send deleted=true alone", rel)
+		} else {
+			f.patch = ok
+		}
+		if prev, dup := seen[rel]; dup {
+			bad(n, "%s: also returned at line %d", rel, prev)
+		}
+		seen[rel] = n
+		cur = &f
+	}
+	if cur != nil {
+		bad(cur.line, "%s: response ends inside the file (truncated?)", cur.rel)
+	}
+	if len(stray) > 0 && len(seen) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: ignoring text after the last file block (line %d)\n", stray[0])
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("response does not follow the contract:\n  %s", strings.Join(problems, "\n  "))
+	}
+	if len(files) == 0 {
+		return nil, errors.New("response holds no file blocks")
+	}
+	return files, nil
+}
+
+// applyOptions holds apply's flags.
+type applyOptions struct {
+	in             string
+	root           string
+	force          bool
+	changelog      string
+	changelogTmpl  string
+	source         string
+	gitCommit      bool
+	gitBranch      string
+	gitMessage     string
+	allowProtected bool
+	requireSig     bool
+	keyring        string
+	fuzz           int
+	check          bool
+	onStale        string
+	packs          stringList
+}
+
+// applyFlags declares apply's flags into o.
+func applyFlags(o *applyOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("apply", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "-", "model response to apply (- for stdin)")
+	flg.StringVar(&o.root, "root", ".", "directory the pack was made from")
+	flg.BoolVar(&o.force, "force", false, "write files even when their base no longer matches the local copy")
+	flg.StringVar(&o.changelog, "changelog", "", "append a summary of what was written, and from which response, to this file")
+	flg.StringVar(&o.changelogTmpl, "changelog-template", "", "text/template for --changelog entries, or @FILE (default: a markdown section)")
+	flg.StringVar(&o.source, "source", "", "where the response came from (e.g. a conversation URL), for --changelog and --git-commit")
+	flg.BoolVar(&o.gitCommit, "git-commit", false, "commit the files written and deleted, with the response's hash and --source in the message")
+	flg.StringVar(&o.gitBranch, "git-branch", "", "switch to this new branch first and commit there (implies --git-commit)")
+	flg.StringVar(&o.gitMessage, "git-message", "", "text/template for the --git-commit message, or @FILE (default: the response, the files and Pack-SHA256/Source trailers)")
+	flg.BoolVar(&o.allowProtected, "allow-protected", false, "let the response write into .git, .ssh, .env and the other protected paths")
+	flg.BoolVar(&o.requireSig, "require-signed", false, "apply nothing unless the response carries a footer signed by a key in --keyring, as pack --sign-key writes")
+	flg.StringVar(&o.keyring, "keyring", defaultKeyring(), "keyring whose keys --require-signed trusts")
+	flg.IntVar(&o.fuzz, "fuzz", defaultFuzz, "lines of context at each end of a patch hunk that may be ignored to make it apply")
+	flg.BoolVar(&o.check, "check", false, "only report, per file, whether the response would apply cleanly; write nothing")
+	flg.StringVar(&o.onStale, "on-stale", staleConflict, "for a file changed locally since it was packed: conflict, overwrite it, or merge both changes (needs --pack)")
+	flg.Var(&o.packs, "pack", "the pack the response answers, whose packed versions --on-stale merge merges from; repeatable")
+	return flg
+}
+
+// applyCmd writes a response into the tree and returns what it did, or
+// nil for --check, which writes nothing.
+func applyCmd(args []string) *changeRecord {
+	var o applyOptions
+	flg := applyFlags(&o)
+	parseFlags(flg, args)
+	if o.fuzz < 0 {
+		fatal(fmt.Errorf("invalid --fuzz %d: want 0 or more", o.fuzz))
+	}
+	if o.onStale != staleConflict && o.onStale != staleOverwrite && o.onStale != staleMerge {
+		fatal(fmt.Errorf("invalid --on-stale %q: want conflict, overwrite or merge", o.onStale))
+	}
+	var bases map[string][]byte
+	if len(o.packs) > 0 {
+		var err error
+		if bases, err = packBases(o.packs, nil); err != nil {
+			fatal(err)
+		}
+	}
+
+	var rd io.Reader = os.Stdin
+	if o.in != "-" {
+		f, err := os.Open(o.in)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		rd = f
+	}
+	tmpl, err := parseRecordTemplate("changelog-template", o.changelogTmpl, defaultChangelogTemplate)
+	if err != nil {
+		fatal(err)
+	}
+	git, err := newGitCommitter(o.root, o.gitCommit, o.gitBranch, o.gitMessage)
+	if err != nil {
+		fatal(err)
+	}
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		fatal(err)
+	}
+	if o.requireSig {
+		if err := requireSigned(bytes.NewReader(data), o.keyring); err != nil {
+			fatal(fmt.Errorf("nothing applied; %w", err))
+		}
+	}
+	files, err := parseResponse(bytes.NewReader(data))
+	if err != nil {
+		fatal(err)
+	}
+	if err := resolveStale(o.root, files, o.onStale, bases); err != nil {
+		fatal(err)
+	}
+	if o.check {
+		bad, err := checkResponse(os.Stdout, o.root, files, o.fuzz, o.allowProtected)
+		if err != nil {
+			fatal(err)
+		}
+		if bad > 0 {
+			fatal(fmt.Errorf("%d of %s would not apply cleanly to %s", bad, plural(len(files), "file"), o.root))
+		}
+		fmt.Printf("All %s would apply cleanly to %s\n", plural(len(files), "file"), o.root)
+		return nil
+	}
+
+	if !o.allowProtected {
+		if refused := protectedFiles(files); len(refused) > 0 {
+			fatal(fmt.Errorf("nothing applied; refusing to write (use --allow-protected):\n  %s", strings.Join(refused, "\n  ")))
+		}
+	}
+	conflicts, err := responseConflicts(o.root, files)
+	if err != nil {
+		fatal(err)
+	}
+	if len(conflicts) > 0 && !o.force {
+		fatal(fmt.Errorf("nothing applied; %d conflicts (use --on-stale merge --pack PACK to merge local changes in, or --force to overwrite):\n  %s", len(conflicts), strings.Join(conflicts, "\n  ")))
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "warning: %s (forced)\n", c)
+	}
+	if err := git.start(); err != nil {
+		fatal(err)
+	}
+	res, err := applyResponse(o.root, files, o.fuzz)
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Applied to %s: %d changed, %d added, %d deleted\n", o.root, len(res.Changed), len(res.Added), len(res.Deleted))
+	for _, n := range res.Notes {
+		fmt.Println("  " + n)
+	}
+	// the rest is written; what is left is for a person, so neither logged
+	// nor committed
+	var unfinished []string
+	if len(res.Rejected) > 0 {
+		unfinished = append(unfinished, fmt.Sprintf("%s did not apply in full; merge the .rej files by hand:\n  %s", plural(len(res.Rejected), "patch"), strings.Join(res.Rejected, "\n  ")))
+	}
+	if err := mergeSummary(files); err != nil {
+		unfinished = append(unfinished, err.Error())
+	}
+	if len(unfinished) > 0 {
+		fatal(errors.New(strings.Join(unfinished, "\n")))
+	}
+	rec := newChangeRecord("apply", o.in, contentHash(data), o.source, o.root)
+	rec.Added, rec.Changed, rec.Deleted = res.Added, res.Changed, res.Deleted
+	if o.changelog != "" {
+		if err := appendChangelog(o.changelog, tmpl, rec); err != nil {
+			fatal(err)
+		}
+	}
+	if err := git.commit(rec); err != nil {
+		fatal(err)
+	}
+	return &rec
+}
+
+// protectedFiles lists the files of a response that would write into a
+// protected path, with the pattern each matches.
+func protectedFiles(files []responseFile) []string {
+	var refused []string
+	for _, f := range files {
+		if pat, ok := packprompt.Protected(f.rel); ok {
+			refused = append(refused, fmt.Sprintf("%s: protected path (%s)", f.rel, pat))
+		}
+	}
+	return refused
+}
+
+// responseConflicts checks every file against the tree before anything is
+// written: a changed file must still match its base, a new one must not exist.
+func responseConflicts(root string, files []responseFile) ([]string, error) {
+	var conflicts []string
+	for _, f := range files {
+		cur, err := readLocal(root, f.rel)
+		exists := err == nil
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return nil, err
+		}
+		switch {
+		case f.base == newBase && exists:
+			conflicts = append(conflicts, f.rel+": returned as new but exists")
+		case f.base != newBase && !exists:
+			conflicts = append(conflicts, f.rel+": no longer exists")
+		case f.base != newBase && !f.patch && contentHash(cur) != f.base:
+			// a patch that no longer applies as is is fuzzed or rejected
+			conflicts = append(conflicts, f.rel+": changed since it was packed")
+		}
+	}
+	return conflicts, nil
+}
+
+// checkResponse reports to w, file by file, whether files would apply to
+// root as they are: not protected (unless allowed), bases matching, every
+// patch hunk applying within fuzz. It returns how many would not.
+func checkResponse(w io.Writer, root string, files []responseFile, fuzz int, allowProtected bool) (int, error) {
+	bad := 0
+	for _, f := range files {
+		var problems, notes []string
+		if pat, ok := packprompt.Protected(f.rel); ok && !allowProtected {
+			problems = append(problems, fmt.Sprintf("protected path (%s; use --allow-protected)", pat))
+		}
+		conflicts, err := responseConflicts(root, []responseFile{f})
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range conflicts {
+			problems = append(problems, strings.TrimPrefix(c, f.rel+": "))
+		}
+		if f.patch && len(conflicts) == 0 {
+			cur, err := readLocal(root, f.rel)
+			if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+				return 0, err
+			}
+			p := applyPatch(cur, f.hunks, fuzz)
+			if len(p.rejected) > 0 {
+				problems = append(problems, fmt.Sprintf("%d of %d hunks do not apply", len(p.rejected), len(f.hunks)))
+			}
+			notes = p.notes
+		}
+		if f.merge == mergedConflicted {
+			problems = append(problems, "local and response changes conflict")
+		}
+		status := "ok"
+		switch {
+		case len(problems) > 0:
+			status = "CONFLICT: " + strings.Join(problems, "; ")
+			bad++
+		case f.merge == mergedClean:
+			status = "ok, merged with local changes"
+		case f.deleted:
+			status = "ok, deleted"
+		case f.base == newBase:
+			status = "ok, new"
+		}
+		fmt.Fprintf(w, "%s: %s\n", f.rel, status)
+		for _, n := range notes {
+			fmt.Fprintf(w, "  %s\n", n)
+		}
+	}
+	return bad, nil
+}
+
+// applied lists what applyResponse did, by path.
+type applied struct {
+	Changed  []string `json:"changed"`
+	Added    []string `json:"added"`
+	Deleted  []string `json:"deleted"`
+	Notes    []string `json:"notes"`    // patch hunks applied off their line or with fuzz
+	Rejected []string `json:"rejected"` // patches with hunks that did not apply, saved in .rej files
+}
+
+// applyResponse writes and deletes the files of a response under root,
+// applying patches with up to fuzz lines of context ignored. The hunks of a
+// patch that do not apply go to a .rej file beside it. Nothing outside root
+// is read, written or deleted, even through a symlink in the tree: the
+// response is a model's output.
+func applyResponse(root string, files []responseFile, fuzz int) (applied, error) {
+	res := applied{Changed: []string{}, Added: []string{}, Deleted: []string{}, Notes: []string{}, Rejected: []string{}}
+	for _, f := range files {
+		if f.deleted {
+			if err := removeLocal(root, f.rel); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+				return res, err
+			}
+			res.Deleted = append(res.Deleted, f.rel)
+			continue
+		}
+		content := f.content
+		if f.patch {
+			cur, err := readLocal(root, f.rel)
+			if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+				return res, err
+			}
+			p := applyPatch(cur, f.hunks, fuzz)
+			for _, n := range p.notes {
+				res.Notes = append(res.Notes, f.rel+": "+n)
+			}
+			if len(p.rejected) > 0 {
+				if err := packprompt.WriteBeneath(root, f.rel+".rej", rejectFile(f.rel, p.rejected), 0o644); err != nil {
+					return res, err
+				}
+				res.Rejected = append(res.Rejected, fmt.Sprintf("%s: %d of %d hunks rejected, saved in %s.rej", f.rel, len(p.rejected), len(f.hunks), f.rel))
+				if len(p.rejected) == len(f.hunks) {
+					continue
+				}
+			}
+			content = p.content
+		}
+		if err := packprompt.WriteBeneath(root, f.rel, content, f.mode); err != nil {
+			return res, err
+		}
+		if f.base == newBase {
+			res.Added = append(res.Added, f.rel)
+		} else {
+			res.Changed = append(res.Changed, f.rel)
+		}
+	}
+	return res, nil
+}
+
+// readLocal reads the local copy of rel under root without leaving root.
+func readLocal(root, rel string) ([]byte, error) {
+	f, err := os.OpenInRoot(root, filepath.FromSlash(rel))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// removeLocal deletes rel under root without leaving root.
+func removeLocal(root, rel string) error {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return r.Remove(filepath.FromSlash(rel))
+}
+
+// writeFileAtomic replaces full with data via a temp file of its own beside
+// it.
+func writeFileAtomic(full string, data []byte, mode iofs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+	f, tmp, err := packprompt.CreateTemp(full)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		_ = os.Chmod(tmp, mode)
+		err = os.Rename(tmp, full)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
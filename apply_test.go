@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestApplyConfined checks apply neither writes nor deletes through a
+// symlink in the tree that leads out of --root, even with --force.
+func TestApplyConfined(t *testing.T) {
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "evil.txt")
+	if err := os.WriteFile(victim, []byte("keep\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "lnk")); err != nil {
+		t.Skip("no symlinks:", err)
+	}
+	for name, response := range map[string]string{
+		"new":     "--- FILE path=lnk/e.txt mode=0644 base=new ---\nescaped\n--- END FILE ---\n",
+		"deleted": "--- FILE path=lnk/evil.txt mode=0644 base=" + contentHash([]byte("keep\n")) + " deleted=true ---\n--- END FILE ---\n",
+	} {
+		in := filepath.Join(t.TempDir(), "response.txt")
+		if err := os.WriteFile(in, []byte(response), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if res := runCLI(t, root, "apply", "--force", "--in", in); res.code == 0 {
+			t.Errorf("%s: apply through a symlink out of --root succeeded: %s", name, res.stdout)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "e.txt")); err == nil {
+		t.Errorf("apply wrote outside --root")
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("apply deleted outside --root: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// packedFile is one entry read back from a pack.
+type packedFile struct {
+	rel, mode  string
+	attrs      map[string]string
+	notes      []string // --note lines from the packer
+	meta       []string // --with-meta trailer lines
+	content    []byte   // as stored: possibly encrypted, annotations included
+	attachment bool     // listed after the attachments mark
+}
+
+// readPack calls fn for every entry of a pack in order, in whichever
+// format detectFormat finds it to be; see readPackAs.
+func readPack(rd io.Reader, fn func(packedFile) error) error {
+	r, format, err := sniffReader(rd)
+	if err != nil {
+		return err
+	}
+	return readPackAs(r, format, fn)
+}
+
+// stdinPack is the pack read from stdin for --in -, kept because unpack
+// reads its pack more than once.
+var stdinPack []byte
+
+// readPackData returns the whole of the pack in; "-" is stdin.
+func readPackData(in string) ([]byte, error) {
+	if in != "-" {
+		return os.ReadFile(in)
+	}
+	if stdinPack == nil {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading the pack from stdin: %w", err)
+		}
+		stdinPack = data
+	}
+	return stdinPack, nil
+}
+
+// packSum is the SHA-256 of the pack in, read as a stream.
+func packSum(in string) (string, error) {
+	f, err := openPack(in)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openPack opens the pack in for reading; "-" is stdin.
+func openPack(in string) (io.ReadCloser, error) {
+	if in != "-" {
+		return os.Open(in)
+	}
+	data, err := readPackData(in)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// decode returns the original file content: decrypted when ciph is given,
+// with pack-time annotations removed and base64 decoded. ok is false for an
+// encrypted entry when ciph is nil.
+func (pf packedFile) decode(ciph *entryCipher) (content []byte, ok bool, err error) {
+	content = pf.content
+	if scheme, enc := pf.attrs[encryptedAttr]; enc {
+		if scheme != cryptScheme {
+			return nil, false, fmt.Errorf("%s: unsupported encryption %q", pf.rel, scheme)
+		}
+		if ciph == nil {
+			return nil, false, nil
+		}
+		if content, err = ciph.open(pf.rel, content); err != nil {
+			return nil, false, err
+		}
+	}
+	if scheme, enc := pf.attrs[encodingAttr]; enc {
+		content, err = decodeContent(pf.rel, scheme, content)
+		return content, err == nil, err
+	}
+	return stripAnnotations(pf.rel, content), true, nil
+}
+
+// stripAnnotations drops the provenance banner (first line, or after a
+// shebang) and coverage comments that pack inserted into content.
+func stripAnnotations(rel string, content []byte) []byte {
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	var out bytes.Buffer
+	for n, l := range lines {
+		text := strings.TrimRight(string(l), "\r\n")
+		if (n == 0 || (n == 1 && bytes.HasPrefix(content, []byte("#!")))) && isProvenanceLine(text) {
+			continue
+		}
+		if strings.HasSuffix(rel, ".go") && isCoverageLine(text) {
+			continue
+		}
+		out.Write(l)
+	}
+	return out.Bytes()
+}
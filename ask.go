@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+const askSystemPrompt = `You are given a project packed by packprompt. Each file appears between a
+"--- FILE path=PATH mode=MODE ---" header and a "--- END FILE ---" line; a section at the
+end may list files that were left out. Answer from these files, cite paths where it helps,
+and say so when they do not hold what is needed.`
+
+const summarizePrompt = `Summarize this project: what it is for, how it is laid out (main
+directories and entry points), its key components and how they fit together, notable
+dependencies, and anything unusual. Be concise.`
+
+func askCmd(args []string) { runAsk("ask", args) }
+
+func summarizeCmd(args []string) { runAsk("summarize", args) }
+
+// askOptions holds the flags of ask and summarize.
+type askOptions struct {
+	in          string
+	provider    string
+	url         string
+	model       string
+	contextSize string
+	reserve     string
+}
+
+// askFlags declares the flags of ask or summarize, whichever name is, into o.
+func askFlags(name string, o *askOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet(name, flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file")
+	flg.StringVar(&o.provider, "provider", "openai", "chat backend: openai (or any OpenAI-compatible API), ollama or llamacpp")
+	flg.StringVar(&o.url, "url", "", "API base URL (default per provider: https://api.openai.com/v1, http://localhost:11434, http://localhost:8080)")
+	flg.StringVar(&o.model, "model", "", "model name, e.g. gpt-4o or llama3.1:8b (optional for llamacpp)")
+	flg.StringVar(&o.contextSize, "context", "", "the model's context window in tokens (default: asked from ollama or llamacpp, else known for common models)")
+	flg.StringVar(&o.reserve, "reserve", "4k", "tokens kept free for the answer")
+	return flg
+}
+
+// runAsk sends a pack and a question to a chat model and prints the answer.
+// When the model's context window is known (--context, discovered from an
+// Ollama or llama.cpp server, or listed in modelContexts) a pack that does not fit is cut down to the
+// files that do, in pack order, keeping --reserve tokens for the answer.
+func runAsk(name string, args []string) {
+	var o askOptions
+	flg := askFlags(name, &o)
+	parseFlags(flg, args)
+
+	question := strings.Join(flg.Args(), " ")
+	switch {
+	case name == "summarize" && question != "":
+		question = summarizePrompt + "\nFocus on: " + question
+	case name == "summarize":
+		question = summarizePrompt
+	case question == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fatal(err)
+		}
+		question = string(data)
+	}
+	if strings.TrimSpace(question) == "" {
+		fatal(fmt.Errorf("ask needs a question: packprompt ask [flags] QUESTION (or - for stdin)"))
+	}
+	c, err := newLLMClient(o.provider, o.url, o.model)
+	if err != nil {
+		fatal(err)
+	}
+	reserved, err := parseTokenCount(o.reserve)
+	if err != nil {
+		fatal(fmt.Errorf("invalid --reserve: %w", err))
+	}
+	window := 0
+	if o.contextSize != "" {
+		if window, err = parseTokenCount(o.contextSize); err != nil {
+			fatal(fmt.Errorf("invalid --context: %w", err))
+		}
+	} else if window, err = c.contextWindow(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not discover the context window (%v)\n", err)
+	}
+	if window == 0 {
+		window = knownContext(o.model)
+	}
+	est, err := lookupEstimator(o.model)
+	if err != nil {
+		est = tokenEstimators["generic"]
+	}
+
+	pack, err := os.ReadFile(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	overhead := est.count(askSystemPrompt) + est.count(question) + 16 // role markers
+	need := overhead + est.count(string(pack))
+	if window > 0 {
+		room := window - reserved
+		if room <= overhead {
+			fatal(fmt.Errorf("a %d-token context leaves no room for the pack after --reserve %d", window, reserved))
+		}
+		if need > room {
+			fitted, kept, total, err := fitPack(pack, room-overhead, est)
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s holds ~%d tokens but the model takes %d with %d reserved; sending %d of %d files\n",
+				o.in, need, window, reserved, kept, total)
+			pack = fitted
+			need = overhead + est.count(string(pack))
+		}
+		c.numCtx = min(window, need+reserved)
+	}
+
+	answer, err := c.chat([]chatMessage{
+		{Role: "system", Content: askSystemPrompt},
+		{Role: "user", Content: string(pack) + "\n\n" + question},
+	})
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Println(strings.TrimRight(answer, "\n"))
+}
+
+// fitPack rewrites a pack to the entries that fit in budget tokens, in
+// order, listing the rest as omitted.
+func fitPack(pack []byte, budget int, est tokenEstimator) (fitted []byte, kept, total int, err error) {
+	var entries []entry
+	err = readPack(bytes.NewReader(pack), func(pf packedFile) error {
+		if pf.attachment {
+			return nil
+		}
+		mode, err := packprompt.ParseMode(pf.mode)
+		if err != nil {
+			mode = 0o644
+		}
+		e := entry{rel: pf.rel, data: pf.content, mode: mode, size: int64(len(pf.content)), notes: pf.notes}
+		for k, v := range pf.attrs {
+			if k != notesAttr {
+				e.attrs = append(e.attrs, k+"="+v)
+			}
+		}
+		sort.Strings(e.attrs)
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	om := &omissions{}
+	pw := packWriter{omitted: om}
+	fit, err := fitEntries(&pw, entries, budget, false, est, "the model", om)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var b bytes.Buffer
+	if err := pw.render(&b, fit); err != nil {
+		return nil, 0, 0, err
+	}
+	return b.Bytes(), len(fit), len(entries), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// attachMark opens the section of context documents that follow the tree.
+const attachMark = packprompt.AttachMark
+
+// attachDir prefixes attachment paths so they never collide with tree files.
+const attachDir = "_attachments"
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+var unsafeNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fetchAttachments reads each source (an http(s) URL or a local path) into an
+// entry under _attachments/. Binary documents are rejected.
+func fetchAttachments(sources []string) ([]entry, error) {
+	var out []entry
+	seen := make(map[string]int)
+	for _, src := range sources {
+		var data []byte
+		var name string
+		if u, err := url.Parse(src); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			data, err = httpGet(src, nil)
+			if err != nil {
+				return nil, fmt.Errorf("attach %s: %w", src, err)
+			}
+			name = path.Base(u.Path)
+			if name == "/" || name == "." || name == "" {
+				name = u.Host
+			}
+		} else {
+			data, err = os.ReadFile(src)
+			if err != nil {
+				return nil, fmt.Errorf("attach: %w", err)
+			}
+			name = filepath.Base(src)
+		}
+		if packprompt.IsBinary(data) {
+			return nil, fmt.Errorf("attach %s: binary content is not supported", src)
+		}
+		name = strings.Trim(unsafeNameRe.ReplaceAllString(name, "_"), "_")
+		if name == "" {
+			name = "attachment"
+		}
+		// keep names unique: spec.md, spec-2.md, ...
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			ext := path.Ext(name)
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+		}
+		e := entry{rel: attachDir + "/" + name, mode: 0o644, size: int64(len(data)), data: data}
+		if packprompt.HasEndMark(data) {
+			encodeEndMarks(&e, data)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// baseConfigKey names, in a config file, the HTTPS URL of a shared base
+// config the local files are layered over.
+const baseConfigKey = "base"
+
+// Limits of a base config fetch: it runs before every command.
+const (
+	baseConfigTimeout = 10 * time.Second
+	maxBaseConfig     = 1 << 20
+)
+
+// cachedBaseConfig is a base config as kept in the user cache directory,
+// with what revalidating it takes.
+type cachedBaseConfig struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	MaxAge       int       `json:"max_age,omitempty"` // seconds it is fresh for, from Cache-Control
+	Body         string    `json:"body"`
+}
+
+// configBase returns the base config URL a config file names, if any.
+// A file that is not a JSON object is left for merge to report.
+func configBase(data []byte) (string, error) {
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(data, &raw) != nil {
+		return "", nil
+	}
+	msg, ok := raw[baseConfigKey]
+	if !ok {
+		return "", nil
+	}
+	var url string
+	if err := json.Unmarshal(msg, &url); err != nil {
+		return "", fmt.Errorf("%s: want an https:// URL", baseConfigKey)
+	}
+	return url, nil
+}
+
+// baseConfigCache is where the base config from url is cached, or "" when
+// there is no cache directory.
+func baseConfigCache(url string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	id := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "packprompt", "config-"+hex.EncodeToString(id[:8])+".json")
+}
+
+// fetchBaseConfig returns the base config at url. A cached copy is used
+// while its max-age lasts, then revalidated with its ETag or Last-Modified;
+// when the URL cannot be reached the cached copy is used with a warning.
+func fetchBaseConfig(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("base config %s: only https:// URLs are fetched", url)
+	}
+	path := baseConfigCache(url)
+	var cached *cachedBaseConfig
+	if data, err := os.ReadFile(path); path != "" && err == nil {
+		var c cachedBaseConfig
+		if json.Unmarshal(data, &c) == nil && c.URL == url {
+			cached = &c
+		}
+	}
+	if cached != nil && time.Since(cached.Fetched) < time.Duration(cached.MaxAge)*time.Second {
+		return []byte(cached.Body), nil
+	}
+	fresh, store, err := getBaseConfig(url, cached)
+	if err != nil {
+		if cached == nil {
+			return nil, fmt.Errorf("base config: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: base config: %v; using the copy cached %s\n", err, cached.Fetched.Format(time.RFC3339))
+		return []byte(cached.Body), nil
+	}
+	if path != "" && store {
+		if data, err := json.Marshal(fresh); err == nil {
+			_ = writeFileAtomic(path, data, 0o600)
+		}
+	}
+	return []byte(fresh.Body), nil
+}
+
+// getBaseConfig asks for url, conditionally when there is a cached copy.
+// store is false when the server said not to keep it.
+func getBaseConfig(url string, cached *cachedBaseConfig) (c *cachedBaseConfig, store bool, err error) {
+	client := &http.Client{Timeout: baseConfigTimeout, CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirected to %s, which is not https", req.URL)
+		}
+		return nil
+	}}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", "packprompt/"+toolVersion())
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	maxAge, store := cacheControl(resp.Header.Get("Cache-Control"))
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		fresh := *cached
+		fresh.Fetched, fresh.MaxAge = time.Now(), maxAge
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			fresh.ETag = etag
+		}
+		return &fresh, store, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, false, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBaseConfig+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(body) > maxBaseConfig {
+		return nil, false, fmt.Errorf("GET %s: larger than %d bytes", url, maxBaseConfig)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, false, fmt.Errorf("GET %s: not a JSON config: %w", url, err)
+	}
+	return &cachedBaseConfig{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"),
+		Fetched: time.Now(), MaxAge: maxAge, Body: string(body)}, store, nil
+}
+
+// cacheControl returns the max-age a Cache-Control header gives, 0 to
+// revalidate every time, and whether the response may be kept at all.
+func cacheControl(h string) (maxAge int, store bool) {
+	noCache := false
+	store = true
+	for _, d := range strings.Split(h, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store":
+			store = false
+		case d == "no-cache":
+			noCache = true
+		case strings.HasPrefix(d, "max-age="):
+			if n, err := strconv.Atoi(strings.TrimPrefix(d, "max-age=")); err == nil && n > 0 {
+				maxAge = n
+			}
+		}
+	}
+	if noCache {
+		maxAge = 0
+	}
+	return maxAge, store
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// encodingAttr marks an entry whose content is its file encoded as text:
+// encoding=base64 for binary files packed under --binary base64.
+const (
+	encodingAttr = packprompt.EncodingAttr
+	base64Scheme = packprompt.Base64
+)
+
+// binaryExts are the binary types skipped by the default excludes that
+// --binary base64 packs instead.
+var binaryExts = packprompt.BinaryExts
+
+// encodeBinary reads the file at p as base64 in lines of 76.
+func encodeBinary(p string) ([]byte, error) {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return packprompt.EncodeBase64(raw), nil
+}
+
+// decodeContent undoes the encoding named by an entry's encoding attribute.
+func decodeContent(rel, scheme string, content []byte) ([]byte, error) {
+	if scheme != base64Scheme {
+		return nil, fmt.Errorf("%s: unsupported encoding %q", rel, scheme)
+	}
+	raw, err := packprompt.DecodeBase64(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad base64 content: %w", rel, err)
+	}
+	return raw, nil
+}
+
+// isEncoded reports whether e holds encoded content, which cannot be cut or
+// annotated without corrupting the file it decodes to.
+func isEncoded(e entry) bool {
+	return hasAttr(e.attrs, encodingAttr)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// truncatedAttr marks an entry cut short to fit a budget or --max-file-size:
+// truncated=KEPT/TOTAL lines.
+const truncatedAttr = "truncated"
+
+// dirBudget caps the tokens one directory may use, either as a share of the
+// total budget or as an absolute count.
+type dirBudget struct {
+	dir    string  // slash-terminated prefix
+	share  float64 // fraction of the total; used when tokens < 0
+	tokens int
+	spec   string // as given, for reports
+}
+
+// parseDirBudgets reads "web/=20%,vendor/=0%,docs=5k".
+func parseDirBudgets(spec string) ([]dirBudget, error) {
+	var out []dirBudget
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		dir, val, ok := strings.Cut(part, "=")
+		dir = path.Clean(strings.TrimSpace(strings.ReplaceAll(dir, `\`, "/")))
+		if !ok || dir == "." || dir == "/" || strings.HasPrefix(dir, "../") {
+			return nil, fmt.Errorf("invalid --dir-budget %q: want DIR=PERCENT%% or DIR=TOKENS", part)
+		}
+		b := dirBudget{dir: strings.TrimPrefix(dir, "/") + "/", tokens: -1, spec: part}
+		val = strings.TrimSpace(val)
+		if pct, isPct := strings.CutSuffix(val, "%"); isPct {
+			f, err := strconv.ParseFloat(pct, 64)
+			if err != nil || f < 0 || f > 100 {
+				return nil, fmt.Errorf("invalid --dir-budget %q: percentage must be between 0 and 100", part)
+			}
+			b.share = f / 100
+		} else {
+			n, err := parseTokenCount(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --dir-budget %q: %w", part, err)
+			}
+			b.tokens = n
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// parseTokenCount reads a token count with an optional k or m suffix
+// (powers of 1000, as context windows are quoted).
+func parseTokenCount(s string) (int, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(t, "k"):
+		mult, t = 1e3, strings.TrimSuffix(t, "k")
+	case strings.HasSuffix(t, "m"):
+		mult, t = 1e6, strings.TrimSuffix(t, "m")
+	}
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid token count %q: want e.g. 8000, 128k or 1m", s)
+	}
+	return int(n * mult), nil
+}
+
+func (b dirBudget) limit(total int) int {
+	if b.tokens >= 0 {
+		return b.tokens
+	}
+	return int(math.Floor(b.share * float64(total)))
+}
+
+// budgetFor returns the most specific budget covering rel, or -1.
+func budgetFor(dirs []dirBudget, rel string) int {
+	best := -1
+	for i, b := range dirs {
+		if strings.HasPrefix(rel, b.dir) && (best < 0 || len(b.dir) > len(dirs[best].dir)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// countEntryTokens estimates the tokens of each entry's content.
+func countEntryTokens(entries []entry, est tokenEstimator) ([]int, error) {
+	counts := make([]int, len(entries))
+	err := forEachParallel(len(entries), func(i int) error {
+		f, err := entries[i].open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		counts[i], err = est.countReader(f)
+		return err
+	})
+	return counts, err
+}
+
+// applyBudgets keeps entries, in order, while they fit: total caps the
+// whole pack (0 for no cap) and each directory its own share of it. When
+// no total is given, percentages are of what was selected. A file over a
+// budget is dropped, or with truncate cut at a line boundary to what is
+// left; either way it is reported.
+func applyBudgets(entries []entry, total int, dirs []dirBudget, truncate bool, est tokenEstimator, om *omissions) ([]entry, error) {
+	counts, err := countEntryTokens(entries, est)
+	if err != nil {
+		return nil, err
+	}
+	base := total
+	if total == 0 {
+		for _, n := range counts {
+			base += n
+		}
+	}
+	limits := make([]int, len(dirs))
+	for i, b := range dirs {
+		limits[i] = b.limit(base)
+	}
+	used := make([]int, len(dirs))
+	usedTotal := 0
+	kept := make([]entry, 0, len(entries))
+	for i, e := range entries {
+		room, reason := math.MaxInt, ""
+		if total > 0 {
+			room, reason = total-usedTotal, fmt.Sprintf("over the --token-budget of %d tokens", total)
+		}
+		b := budgetFor(dirs, e.rel)
+		if b >= 0 && limits[b]-used[b] < room {
+			room, reason = limits[b]-used[b], fmt.Sprintf("over --dir-budget %s (%d tokens)", dirs[b].spec, limits[b])
+		}
+		n := counts[i]
+		if n > room {
+			if !truncate || room <= 0 || isEncoded(e) {
+				om.add(e.rel, e.size, reason)
+				continue
+			}
+			cut, keptLines, allLines, err := truncateToTokens(e, room, est)
+			if err != nil {
+				return nil, err
+			}
+			if keptLines == 0 {
+				om.add(e.rel, e.size, reason)
+				continue
+			}
+			om.add(e.rel, e.size, fmt.Sprintf("truncated to %d of %d lines: %s", keptLines, allLines, reason))
+			truncateEntry(&e, cut, keptLines, allLines)
+			n = est.count(string(cut))
+		}
+		usedTotal += n
+		if b >= 0 {
+			used[b] += n
+		}
+		kept = append(kept, e)
+	}
+	return kept, nil
+}
+
+// capFileSize handles the entries larger than limit bytes: dropped, or
+// with truncate cut to the leading whole lines that fit.
+func capFileSize(entries []entry, limit int64, spec string, truncate bool, om *omissions) ([]entry, error) {
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.size <= limit {
+			kept = append(kept, e)
+			continue
+		}
+		reason := maxFileSizeReason(spec)
+		if !truncate || isEncoded(e) {
+			om.add(e.rel, e.size, reason)
+			continue
+		}
+		cut, keptLines, allLines, err := truncateToBytes(e, limit)
+		if err != nil {
+			return nil, err
+		}
+		if keptLines == 0 {
+			om.add(e.rel, e.size, reason)
+			continue
+		}
+		om.add(e.rel, e.size, fmt.Sprintf("truncated to %d of %d lines: %s", keptLines, allLines, reason))
+		truncateEntry(&e, cut, keptLines, allLines)
+		kept = append(kept, e)
+	}
+	return kept, nil
+}
+
+// maxFileSizeReason is why capFileSize leaves out or truncates a file.
+func maxFileSizeReason(spec string) string {
+	return "over --max-file-size " + spec
+}
+
+// truncateToBytes keeps the leading whole lines of e within limit bytes,
+// reading no more of the rest than it takes to count its lines.
+func truncateToBytes(e entry, limit int64) (cut []byte, kept, all int, err error) {
+	f, err := e.open()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+	head := make([]byte, limit+1)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, 0, 0, err
+	}
+	head = head[:n]
+	size := bytes.LastIndexByte(head[:min(int64(n), limit)], '\n') + 1
+	kept = bytes.Count(head[:size], []byte("\n"))
+	all = bytes.Count(head, []byte("\n"))
+	buf := make([]byte, 32<<10)
+	last := byte('\n')
+	if n > 0 {
+		last = head[n-1]
+	}
+	for {
+		m, rerr := f.Read(buf)
+		all += bytes.Count(buf[:m], []byte("\n"))
+		if m > 0 {
+			last = buf[m-1]
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return nil, 0, 0, rerr
+		}
+	}
+	if last != '\n' {
+		all++ // an unterminated last line
+	}
+	return head[:size], kept, all, nil
+}
+
+// truncateToTokens keeps the leading whole lines of e that fit in room tokens.
+func truncateToTokens(e entry, room int, est tokenEstimator) (cut []byte, kept, all int, err error) {
+	data, err := readEntry(e)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	n, size := 0, 0
+	for _, l := range lines {
+		t := est.count(l)
+		if n+t > room {
+			break
+		}
+		n += t
+		size += len(l)
+		kept++
+	}
+	return data[:size], kept, len(lines), nil
+}
+
+// truncateEntry cuts e down to cut, its first kept of all lines.
+func truncateEntry(e *entry, cut []byte, kept, all int) {
+	e.data, e.size = cut, int64(len(cut))
+	e.attrs = append(rehashed(e.attrs, cut), fmt.Sprintf("%s=%d/%d", truncatedAttr, kept, all))
+}
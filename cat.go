@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// catOptions holds cat's flags.
+type catOptions struct {
+	in       string
+	passFile string
+	ids      stringList
+}
+
+// catFlags declares cat's flags into o.
+func catFlags(o *catOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("cat", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the passphrase for encrypted entries from this file (default: $PACKPROMPT_PASSPHRASE)")
+	flg.Var(&o.ids, "id", "print the entry with this id (or a unique prefix of it); repeatable")
+	return flg
+}
+
+// catCmd writes the content of the named entries to stdout, as unpack
+// would write them, without extracting anything.
+func catCmd(args []string) {
+	var o catOptions
+	flg := catFlags(&o)
+	parseFlags(flg, args)
+	if flg.NArg() == 0 && len(o.ids) == 0 {
+		fatal(errors.New("usage: packprompt cat [--in FILE] PATH... | --id ID"))
+	}
+
+	var only *idSelector
+	if len(o.ids) > 0 {
+		var err error
+		if only, err = newIDSelector(o.ids); err != nil {
+			fatal(err)
+		}
+	}
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+	f, err := os.Open(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+
+	wanted := map[string]bool{}
+	for _, p := range flg.Args() {
+		wanted[p] = true
+	}
+	order := flg.Args()
+	found := map[string][]byte{}
+	spans := map[string][2]packprompt.Chunk{} // first and last chunk seen of a chunked file
+	err = readPack(f, func(pf packedFile) error {
+		if !wanted[pf.rel] && (only == nil || !only.match(pf)) {
+			return nil
+		}
+		if !wanted[pf.rel] {
+			wanted[pf.rel] = true
+			order = append(order, pf.rel)
+		}
+		content, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s is encrypted; give its passphrase with --passphrase-file or $PACKPROMPT_PASSPHRASE", pf.rel)
+		}
+		c, chunked, err := packprompt.ParseChunk(pf.attrs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pf.rel, err)
+		}
+		span, inSpan := spans[pf.rel]
+		switch {
+		case chunked && inSpan && c.Index == span[1].Index+1:
+			found[pf.rel] = append(found[pf.rel], content...)
+			spans[pf.rel] = [2]packprompt.Chunk{span[0], c}
+		case chunked:
+			found[pf.rel] = content
+			spans[pf.rel] = [2]packprompt.Chunk{c, c}
+		default:
+			// a path packed twice is the last one, as unpack has it
+			found[pf.rel] = content
+			delete(spans, pf.rel)
+		}
+		return nil
+	})
+	if err == nil && only != nil {
+		err = only.check()
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, p := range order {
+		if _, ok := found[p]; !ok {
+			fatal(fmt.Errorf("%s: no such entry in %s", p, o.in))
+		}
+		if span, ok := spans[p]; ok && (span[0].Index > 1 || span[1].Index < span[1].Count) {
+			held := fmt.Sprintf("chunks %d-%d", span[0].Index, span[1].Index)
+			if span[0].Index == span[1].Index {
+				held = fmt.Sprintf("chunk %d", span[0].Index)
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s: only %s of %d in %s; the rest are in its other parts\n", p, held, span[1].Count, o.in)
+		}
+	}
+	for _, p := range order {
+		if _, err := os.Stdout.Write(found[p]); err != nil {
+			fatal(err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// changeRecord is what a changelog template is given about one unpack or
+// apply.
+type changeRecord struct {
+	Time    time.Time
+	Command string // unpack or apply
+	Pack    string // the pack or response applied, as given
+	SHA256  string // of the pack or response
+	Source  string // --source, e.g. the conversation it came from
+	Dest    string
+	User    string
+	Host    string
+
+	Added, Changed, Deleted, Unchanged []string
+
+	before map[string]string // sha256 of each chunked file before its first chunk
+}
+
+// Files lists every path written or deleted, in order of kind.
+func (r changeRecord) Files() []string {
+	return append(append(append([]string(nil), r.Added...), r.Changed...), r.Deleted...)
+}
+
+// defaultChangelogTemplate renders a markdown section per run.
+const defaultChangelogTemplate = `## {{.Time.Format "2006-01-02 15:04:05 MST"}} {{.Command}} {{.Pack}}
+
+- pack: sha256 {{.SHA256}}
+{{- if .Source}}
+- source: {{.Source}}
+{{- end}}
+- by {{.User}} on {{.Host}} into {{.Dest}}
+{{range .Added}}- added {{.}}
+{{end}}{{range .Changed}}- changed {{.}}
+{{end}}{{range .Deleted}}- deleted {{.}}
+{{end}}{{if not .Files}}- no files changed
+{{end}}
+`
+
+// parseRecordTemplate reads a template over a changeRecord given to flag:
+// the text, or @FILE for one kept in a file; "" is def. join is
+// strings.Join.
+func parseRecordTemplate(flag, spec, def string) (*template.Template, error) {
+	text := def
+	if name, ok := strings.CutPrefix(spec, "@"); ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	} else if spec != "" {
+		text = spec
+	}
+	t, err := template.New(flag).Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", flag, err)
+	}
+	return t, nil
+}
+
+// renderRecord runs t over rec.
+func renderRecord(t *template.Template, rec changeRecord) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, rec); err != nil {
+		return nil, fmt.Errorf("%s template: %w", t.Name(), err)
+	}
+	return b.Bytes(), nil
+}
+
+// newChangeRecord starts the record of a run over pack, whose SHA-256 is sum.
+func newChangeRecord(command, pack, sum, source, dest string) changeRecord {
+	env := currentPackEnv(false)
+	return changeRecord{
+		Time: env.when, Command: command, Pack: pack, SHA256: sum, Source: source, Dest: dest,
+		User: env.user, Host: env.host,
+		Added: []string{}, Changed: []string{}, Deleted: []string{}, Unchanged: []string{},
+	}
+}
+
+// classify files rel under the kind of change writing content to full makes.
+func (r *changeRecord) classify(rel, full string, content []byte) {
+	old, err := os.ReadFile(full)
+	switch {
+	case errors.Is(err, iofs.ErrNotExist):
+		r.Added = append(r.Added, rel)
+	case err == nil && bytes.Equal(old, content):
+		r.Unchanged = append(r.Unchanged, rel)
+	default:
+		r.Changed = append(r.Changed, rel)
+	}
+}
+
+// classifyChunk is classify for a file written chunk by chunk, content
+// being the file so far. The first chunk decides added or changed; a file
+// whose last chunk, in the same run, leaves it as it was is unchanged.
+func (r *changeRecord) classifyChunk(rel, full string, c packprompt.Chunk, content []byte) {
+	if c.Index == 1 {
+		old, err := os.ReadFile(full)
+		if errors.Is(err, iofs.ErrNotExist) {
+			r.Added = append(r.Added, rel)
+			return
+		}
+		r.Changed = append(r.Changed, rel)
+		if err == nil {
+			if r.before == nil {
+				r.before = map[string]string{}
+			}
+			r.before[rel] = contentHash(old)
+		}
+	}
+	if old, ok := r.before[rel]; ok && c.Index == c.Count && old == contentHash(content) {
+		r.Changed = slices.DeleteFunc(r.Changed, func(p string) bool { return p == rel })
+		r.Unchanged = append(r.Unchanged, rel)
+	}
+}
+
+// appendChangelog renders rec with t onto the end of file.
+func appendChangelog(file string, t *template.Template, rec changeRecord) error {
+	text, err := renderRecord(t, rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
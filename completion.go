@@ -0,0 +1,326 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// builtinCommands lists the subcommands for usage and completion.
+var builtinCommands = [][2]string{
+	{"pack", "pack a directory tree into a prompt file"},
+	{"run", "pack with a recipe from the config"},
+	{"unpack", "extract the files of a pack"},
+	{"apply", "write a model's --contract answer into the tree"},
+	{"explain", "show which rule decides whether pack packs a path"},
+	{"hash", "print the tree hash of what pack would pack"},
+	{"request-missing", "prompt a model to resend entries its copy of a pack lost"},
+	{"ask", "ask a chat model a question about a pack"},
+	{"summarize", "have a chat model summarize a pack"},
+	{"serve", "JSON-RPC server on stdio for editor plugins"},
+	{"export", "export a pack as JSONL chunks or documents"},
+	{"list", "list a pack's files without extracting them"},
+	{"cat", "print one file of a pack"},
+	{"verify", "check a pack for truncation and corruption"},
+	{"stats", "summarize a pack by language or directory"},
+	{"view", "browse a pack in the terminal"},
+	{"diff", "compare a pack with a directory tree"},
+	{"keys", "manage the keys that sign packs and the ones trusted"},
+	{"session", "pack and apply over several rounds of a conversation"},
+	{"report", "summarize packing over time from session history, locally"},
+	{"completion", "print a shell completion script"},
+	{"help", "show usage, or a command's flags and details"},
+}
+
+// commandFlags returns the flags of a builtin command, or nil; args name a
+// subcommand for commands that have them.
+func commandFlags(name string, args ...string) *flag.FlagSet {
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	var flg *flag.FlagSet
+	switch name {
+	case "pack", "hash", "explain":
+		flg = packFlags(new(packOptions))
+	case "run":
+		flg = runFlags(new(runOptions))
+	case "unpack":
+		flg = unpackFlags(new(unpackOptions))
+	case "apply":
+		flg = applyFlags(new(applyOptions))
+	case "request-missing":
+		flg = requestFlags(new(requestOptions))
+	case "ask", "summarize":
+		flg = askFlags(name, new(askOptions))
+	case "serve":
+		flg = serveFlags(new(serveOptions))
+	case "export":
+		flg = exportFlags(new(exportOptions))
+	case "list":
+		flg = listFlags(new(listOptions))
+	case "cat":
+		flg = catFlags(new(catOptions))
+	case "verify":
+		flg = verifyFlags(new(verifyOptions))
+	case "stats":
+		flg = statsFlags(new(statsOptions))
+	case "view":
+		flg = viewFlags(new(viewOptions))
+	case "diff":
+		flg = diffFlags(new(diffOptions))
+	case "keys":
+		flg = keysFlags(sub, new(keysOptions))
+	case "session":
+		switch sub {
+		case "start":
+			flg = sessionStartFlags(new(sessionStartOptions))
+		case "pack":
+			flg = packFlags(new(packOptions))
+		case "apply":
+			flg = applyFlags(new(applyOptions))
+		case "status":
+			flg = flag.NewFlagSet("session", flag.ExitOnError)
+		default:
+			return nil
+		}
+	case "report":
+		flg = reportFlags(new(reportOptions))
+	case "completion":
+		flg = flag.NewFlagSet("completion", flag.ExitOnError)
+	default:
+		return nil
+	}
+	addSharedFlags(flg)
+	return flg
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func completionCmd(args []string) {
+	flg := flag.NewFlagSet("completion", flag.ExitOnError)
+	parseFlags(flg, args)
+	scripts := map[string]string{"bash": bashCompletion, "zsh": zshCompletion, "fish": fishCompletion}
+	script, ok := scripts[flg.Arg(0)]
+	if flg.NArg() != 1 || !ok {
+		fatal(fmt.Errorf("usage: packprompt completion bash|zsh|fish"))
+	}
+	fmt.Print(script)
+}
+
+// filesDirective tells the completion scripts to complete file names.
+const filesDirective = ":files"
+
+// completeCmd prints candidates for the last of words (the word being typed,
+// possibly empty), one "value<TAB>description" per line, or filesDirective.
+func completeCmd(words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	var cands [][2]string
+	emit := func(value, desc string) {
+		if strings.HasPrefix(value, cur) {
+			cands = append(cands, [2]string{value, desc})
+		}
+	}
+	defer func() {
+		for _, c := range cands {
+			fmt.Printf("%s\t%s\n", c[0], c[1])
+		}
+	}()
+
+	if len(words) == 1 {
+		for _, c := range builtinCommands {
+			emit(c[0], c[1])
+		}
+		for _, p := range listPlugins() {
+			emit(p, "plugin")
+		}
+		return
+	}
+	cmd := words[0]
+	if cmd == "completion" && len(words) == 2 {
+		for _, sh := range []string{"bash", "zsh", "fish"} {
+			emit(sh, sh+" completion script")
+		}
+		return
+	}
+	if cmd == "help" {
+		if len(words) == 2 {
+			for _, c := range builtinCommands {
+				emit(c[0], c[1])
+			}
+			for _, t := range []string{"config", "output", "plugins"} {
+				emit(t, "help topic")
+			}
+		}
+		return
+	}
+	if cmd == "__complete" {
+		return
+	}
+	if cmd == "run" {
+		// a recipe name, then pack's flags
+		if len(words) == 2 && !strings.HasPrefix(cur, "-") {
+			if cfg, err := loadConfig(os.Getenv("PACKPROMPT_CONFIG")); err == nil {
+				for _, n := range cfg.recipeNames() {
+					desc, _ := cfg.recipes[n][recipeDescription].(string)
+					emit(n, desc)
+				}
+			}
+			return
+		}
+		if len(words) > 2 && !strings.HasPrefix(words[1], "-") {
+			cmd, words = "pack", append([]string{"pack"}, words[2:]...)
+		}
+	}
+	var sub []string
+	if subs, ok := map[string][][2]string{"keys": keysSubcommands, "session": sessionSubcommands}[cmd]; ok {
+		if len(words) == 2 && !strings.HasPrefix(cur, "-") {
+			for _, s := range subs {
+				emit(s[0], s[1])
+			}
+			return
+		}
+		sub = words[1:2]
+	}
+	fs := commandFlags(cmd, sub...)
+	if fs == nil {
+		if sub == nil {
+			fmt.Println(filesDirective) // a plugin's arguments
+		}
+		return
+	}
+	in, cfg := "", ""
+	if f := fs.Lookup("in"); f != nil {
+		in = f.DefValue
+	}
+	for i, w := range words[1 : len(words)-1] {
+		if !strings.HasPrefix(w, "-") {
+			continue
+		}
+		name, val, hasVal := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if !hasVal && i+2 < len(words)-1 {
+			val = words[i+2]
+		}
+		switch name {
+		case "in":
+			in = val
+		case "config":
+			cfg = val
+		}
+	}
+
+	if prev := words[len(words)-2]; strings.HasPrefix(prev, "-") && !strings.Contains(prev, "=") {
+		if f := fs.Lookup(strings.TrimLeft(prev, "-")); f != nil && !isBoolFlag(f) {
+			if f.Name == "profile" {
+				for _, p := range profileNames(cfg) {
+					emit(p, "profile")
+				}
+				return
+			}
+			fmt.Println(filesDirective)
+			return
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		fs.VisitAll(func(f *flag.Flag) { emit("--"+f.Name, f.Usage) })
+		return
+	}
+	if in != "" && fs.Lookup("in") != nil {
+		for _, rel := range packEntries(in) {
+			emit(rel, "entry")
+		}
+	}
+}
+
+func profileNames(cfgPath string) []string {
+	if cfgPath == "" {
+		cfgPath = os.Getenv("PACKPROMPT_CONFIG")
+	}
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for n := range cfg.profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// packEntries lists the paths in a pack; a missing or broken pack just
+// completes nothing.
+func packEntries(in string) []string {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var rels []string
+	_ = readPack(f, func(pf packedFile) error {
+		rels = append(rels, pf.rel)
+		return nil
+	})
+	return rels
+}
+
+// The scripts ask "packprompt __complete WORDS..." for candidates, so they
+// follow the flags and entries of whichever binary is installed.
+
+const bashCompletion = `# bash completion for packprompt; load with: source <(packprompt completion bash)
+_packprompt() {
+    local cur=${COMP_WORDS[COMP_CWORD]} line
+    COMPREPLY=()
+    while IFS= read -r line; do
+        if [[ $line == :files ]]; then
+            compopt -o filenames 2>/dev/null
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+        fi
+        [[ -n $line ]] && COMPREPLY+=("${line%%$'\t'*}")
+    done < <(packprompt __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)
+}
+complete -F _packprompt packprompt
+`
+
+const zshCompletion = `#compdef packprompt
+# zsh completion for packprompt; load with: source <(packprompt completion zsh)
+_packprompt() {
+    local -a cands
+    local line out
+    out=$(packprompt __complete "${(@)words[2,CURRENT]}" 2>/dev/null)
+    for line in "${(@f)out}"; do
+        if [[ $line == :files ]]; then
+            _files
+            return
+        fi
+        [[ -n $line ]] && cands+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+    done
+    _describe 'packprompt' cands
+}
+if [[ $funcstack[1] == _packprompt ]]; then
+    _packprompt "$@"
+else
+    compdef _packprompt packprompt
+fi
+`
+
+const fishCompletion = `# fish completion for packprompt; load with: packprompt completion fish | source
+function __packprompt_complete
+    set -l out (packprompt __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+    if test "$out[1]" = ":files"
+        __fish_complete_path (commandline -ct)
+        return
+    end
+    printf '%s\n' $out
+end
+complete -c packprompt -f -a '(__packprompt_complete)'
+`
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCompleteFlags checks flag completion for commands and subcommands,
+// and that a subcommand-taking command with none given completes nothing.
+func TestCompleteFlags(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		words     []string
+		want, not []string
+	}{
+		{[]string{"pack", "--spl"}, []string{"--split-by", "--split-tokens", "--split-force"}, []string{"--root"}},
+		{[]string{"hash", "--"}, []string{"--root", "--exclude", "--config", "--profile"}, nil},
+		{[]string{"ask", "--"}, []string{"--model", "--context"}, nil},
+		{[]string{"keys", "generate", "--"}, []string{"--keyring", "--name", "--force"}, []string{"--plain"}},
+		{[]string{"keys", "list", "--"}, []string{"--keyring", "--plain"}, []string{"--name"}},
+		{[]string{"session", "start", "--"}, []string{"--root", "--name", "--force"}, nil},
+		{[]string{"session", "pack", "--"}, []string{"--exclude", "--max-file-size"}, nil},
+		{[]string{"session", "apply", "--"}, []string{"--on-stale", "--allow-protected"}, nil},
+		{[]string{"session", "--"}, nil, []string{"--", filesDirective}},
+	} {
+		res := runCLI(t, dir, append([]string{"__complete"}, c.words...)...)
+		if res.code != 0 {
+			t.Errorf("%v: exit %d: %s", c.words, res.code, res.stderr)
+			continue
+		}
+		got := map[string]bool{}
+		for _, line := range strings.Split(strings.TrimSpace(res.stdout), "\n") {
+			value, _, _ := strings.Cut(line, "\t")
+			got[value] = true
+		}
+		for _, w := range c.want {
+			if !got[w] {
+				t.Errorf("%v: no %s in\n%s", c.words, w, res.stdout)
+			}
+		}
+		for _, w := range c.not {
+			if got[w] {
+				t.Errorf("%v: %s in\n%s", c.words, w, res.stdout)
+			}
+		}
+	}
+}
+
+// TestCommandFlags checks every builtin command but help hands
+// completion its flags.
+func TestCommandFlags(t *testing.T) {
+	for _, c := range builtinCommands {
+		name := c[0]
+		var sub []string
+		switch name {
+		case "help":
+			continue
+		case "keys":
+			sub = []string{keysSubcommands[0][0]}
+		case "session":
+			sub = []string{sessionSubcommands[0][0]}
+		}
+		flg := commandFlags(name, sub...)
+		if flg == nil {
+			t.Errorf("%s: no flags", name)
+			continue
+		}
+		if flg.Lookup("config") == nil {
+			t.Errorf("%s: no --config", name)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// projectConfigName is the per-repository config file, read from the
+// working directory.
+const projectConfigName = ".packprompt.json"
+
+// config holds option defaults per command, e.g.
+//
+//	{
+//	  "pack":   {"exclude": ".git,node_modules", "model": "claude"},
+//	  "unpack": {"dest": "out"},
+//	  "profiles": {"ci": {"pack": {"reproducible": true, "footer": true}}},
+//	  "recipes":  {"review": {"exclude": ".git,dist", "out": "review.txt"}},
+//	  "tokens":   {"git.example.com": "EXAMPLE_GITLAB_TOKEN"}
+//	}
+//
+// Keys are flag names; lists set repeatable flags once per element. The
+// user config is read first, then the project's, each overriding the last,
+// both over the shared config at "base" if either names one.
+type config struct {
+	commands map[string]map[string]any
+	profiles map[string]map[string]map[string]any
+	recipes  map[string]map[string]any // pack options by recipe name, see run
+	tokens   map[string]string         // forge host to the variable holding its token, see forgeToken
+	sources  []string                  // files (and base URL) read, lowest precedence first
+	withheld []withheldOption          // trustedOnly options an untrusted layer set
+}
+
+// trustedOnly are the options the project config and the base config cannot
+// set, since a checkout or a server chooses those: they run commands, lift
+// unpack's and apply's safety checks, or say where credentials are sent.
+// Flags, the environment and the user's own config (or one named by
+// --config) still set them, and PACKPROMPT_TRUST_CONFIG=1 trusts every layer.
+var trustedOnly = map[string]bool{
+	"pre-pack": true, "post-pack": true, "pre-unpack": true, "post-unpack": true,
+	"confine": true, "allow-protected": true, "no-verify": true, "force": true, "on-stale": true,
+	"require-signed": true, "keyring": true, "policy": true, "scan": true,
+	"embed-url": true, "url": true,
+}
+
+// withheldOption is a trustedOnly option an untrusted config layer set:
+// where, as "pack", "profiles.ci.pack" or "recipes.review", and from which
+// file or URL.
+type withheldOption struct {
+	where, name, source string
+}
+
+// withheldFor returns the options withheld from the section where, or
+// from its section of profile.
+func (c *config) withheldFor(where, profile string) []withheldOption {
+	var out []withheldOption
+	for _, w := range c.withheld {
+		if w.where == where || profile != "" && w.where == "profiles."+profile+"."+where {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// configPaths lists the config files in increasing precedence: the user's
+// config, then the project's. PACKPROMPT_CONFIG or --config replace both.
+func configPaths(explicit string) []string {
+	if explicit != "" {
+		return []string{explicit}
+	}
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "packprompt", "config.json"))
+	}
+	return append(paths, projectConfigName)
+}
+
+func loadConfig(explicit string) (*config, error) {
+	cfg := &config{commands: map[string]map[string]any{}, profiles: map[string]map[string]map[string]any{},
+		recipes: map[string]map[string]any{}, tokens: map[string]string{}}
+	type layer struct {
+		source  string
+		data    []byte
+		trusted bool
+	}
+	trustAll := os.Getenv("PACKPROMPT_TRUST_CONFIG") == "1"
+	var layers []layer
+	base := os.Getenv("PACKPROMPT_BASE_CONFIG")
+	for _, p := range configPaths(explicit) {
+		data, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) && explicit == "" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer{p, data, trustAll || explicit != "" || p != projectConfigName})
+	}
+	fromEnv := base != ""
+	for _, l := range layers {
+		url, err := configBase(l.data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.source, err)
+		}
+		if url != "" && !fromEnv {
+			base = url // the project's beats the user's
+		}
+	}
+	if base != "" {
+		data, err := fetchBaseConfig(base)
+		if err != nil {
+			return nil, err
+		}
+		layers = append([]layer{{base, data, trustAll}}, layers...)
+	}
+	for _, l := range layers {
+		if err := cfg.merge(l.data, l.source, l.trusted); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.source, err)
+		}
+		cfg.sources = append(cfg.sources, l.source)
+	}
+	return cfg, nil
+}
+
+// merge layers one config file over what was loaded before. An untrusted
+// layer's trustedOnly options are left out and recorded in c.withheld.
+func (c *config) merge(data []byte, source string, trusted bool) error {
+	keep := func(where string, opts map[string]any) map[string]any {
+		if trusted {
+			return opts
+		}
+		for name := range opts {
+			if trustedOnly[name] {
+				c.withheld = append(c.withheld, withheldOption{where, name, source})
+				delete(opts, name)
+			}
+		}
+		return opts
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	for key, msg := range raw {
+		if key == baseConfigKey {
+			continue // see loadConfig; a base config's own is ignored
+		}
+		if key == "profiles" {
+			var profiles map[string]map[string]map[string]any
+			if err := decodeNumbers(msg, &profiles); err != nil {
+				return fmt.Errorf("profiles: %w", err)
+			}
+			for name, p := range profiles {
+				if c.profiles[name] == nil {
+					c.profiles[name] = map[string]map[string]any{}
+				}
+				for cmd, opts := range p {
+					c.profiles[name][cmd] = mergeOptions(c.profiles[name][cmd], keep("profiles."+name+"."+cmd, opts))
+				}
+			}
+			continue
+		}
+		if key == "tokens" {
+			// which host gets which token is where credentials are sent
+			var tokens map[string]string
+			if err := json.Unmarshal(msg, &tokens); err != nil {
+				return fmt.Errorf("tokens: %w", err)
+			}
+			for host, v := range tokens {
+				if !trusted {
+					c.withheld = append(c.withheld, withheldOption{"tokens", host, source})
+					continue
+				}
+				c.tokens[strings.ToLower(host)] = v
+			}
+			continue
+		}
+		if key == "recipes" {
+			var recipes map[string]map[string]any
+			if err := decodeNumbers(msg, &recipes); err != nil {
+				return fmt.Errorf("recipes: %w", err)
+			}
+			for name, r := range recipes {
+				c.recipes[name] = mergeOptions(c.recipes[name], keep("recipes."+name, r))
+			}
+			continue
+		}
+		var opts map[string]any
+		if err := decodeNumbers(msg, &opts); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		c.commands[key] = mergeOptions(c.commands[key], keep(key, opts))
+	}
+	return nil
+}
+
+func decodeNumbers(msg json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func mergeOptions(base, over map[string]any) map[string]any {
+	out := map[string]any{}
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
+	}
+	return out
+}
+
+// options returns the config values for cmd with profile applied on top.
+func (c *config) options(cmd, profile string) (map[string]any, error) {
+	opts := c.commands[cmd]
+	if profile == "" {
+		return opts, nil
+	}
+	p, ok := c.profiles[profile]
+	if !ok {
+		var names []string
+		for n := range c.profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q (known: %s)", profile, strings.Join(names, ", "))
+	}
+	return mergeOptions(opts, p[cmd]), nil
+}
+
+// configValues renders a config value as the strings flag.Set expects.
+func configValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{fmt.Sprint(v)}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case []any:
+		var out []string
+		for _, e := range v {
+			s, err := configValues(e)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s...)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
+
+// sharedEnvFlags are the flags PACKPROMPT_<FLAG> sets for every command
+// that has them, as they mean the same everywhere. Any other flag it sets
+// for pack only, so PACKPROMPT_OUT names the pack without redirecting
+// every command's output; other commands read PACKPROMPT_<CMD>_<FLAG>.
+var sharedEnvFlags = map[string]bool{"exclude": true, "include": true}
+
+// unscopedEnv reads PACKPROMPT_<FLAG> for cmd's flag name, per
+// sharedEnvFlags. A command it does not apply to says it is ignoring it
+// when pack has the flag, since the user likely meant it for cmd too.
+func unscopedEnv(cmd, name string) (string, bool) {
+	v, ok := os.LookupEnv(envName("", name))
+	if !ok || sharedEnvFlags[name] || cmd == "pack" {
+		return v, ok
+	}
+	if packFlags(new(packOptions)).Lookup(name) != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring %s, which sets pack's --%s only; use %s for %s\n", envName("", name), name, envName(cmd, name), cmd)
+	}
+	return "", false
+}
+
+// envName is the environment variable for a flag: PACKPROMPT_EXCLUDE for
+// --exclude, PACKPROMPT_PACK_OUT for pack's --out only.
+func envName(cmd, name string) string {
+	n := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if cmd != "" {
+		return "PACKPROMPT_" + strings.ToUpper(cmd) + "_" + n
+	}
+	return "PACKPROMPT_" + n
+}
+
+// isRepeatable reports whether a flag collects a value per use.
+func isRepeatable(f *flag.Flag) bool {
+	_, ok := f.Value.(*stringList)
+	return ok
+}
+
+// addSharedFlags declares the flags every command has on top of its own.
+func addSharedFlags(flg *flag.FlagSet) (cfgPath, profile, maxMemory *string) {
+	cfgPath = flg.String("config", os.Getenv("PACKPROMPT_CONFIG"), "config file to use instead of the user and project config")
+	profile = flg.String("profile", os.Getenv("PACKPROMPT_PROFILE"), "apply this config profile on top of the defaults")
+	maxMemory = flg.String("max-memory", "", "keep memory use near this target (e.g. 256MB) for small containers, trading speed")
+	return cfgPath, profile, maxMemory
+}
+
+// parseFlags parses a command's flags and fills every flag not given on the
+// command line from, in order of precedence, PACKPROMPT_<CMD>_<FLAG>,
+// PACKPROMPT_<FLAG> (see sharedEnvFlags), the selected config profile and
+// the config files.
+func parseFlags(flg *flag.FlagSet, args []string) {
+	cfgPath, profile, maxMemory := addSharedFlags(flg)
+	_ = flg.Parse(args)
+
+	given := map[string]bool{}
+	flg.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	cfg, err := loadConfig(*cfgPath)
+	if err != nil {
+		fatal(err)
+	}
+	cmd := flg.Name()
+	opts, err := cfg.options(cmd, *profile)
+	if err != nil {
+		fatal(err)
+	}
+	for name := range opts {
+		if flg.Lookup(name) == nil {
+			fmt.Fprintf(os.Stderr, "warning: config: %s has no option %q\n", cmd, name)
+		}
+	}
+	warnWithheld(cfg.withheldFor(cmd, *profile))
+	if cmd == "pack" {
+		warnWithheld(cfg.withheldFor("tokens", ""))
+	}
+	forgeTokens = cfg.tokens
+	flg.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || f.Name == "config" || f.Name == "profile" {
+			return
+		}
+		var values []string
+		env, ok := os.LookupEnv(envName(cmd, f.Name))
+		if !ok {
+			env, ok = unscopedEnv(cmd, f.Name)
+		}
+		if ok {
+			values = []string{env}
+			// repeatable flags take a comma-separated list from the environment
+			if isRepeatable(f) {
+				values = strings.Split(env, ",")
+			}
+		} else if v, ok := opts[f.Name]; ok {
+			if values, err = configValues(v); err != nil {
+				fatal(fmt.Errorf("config: %s %s: %w", cmd, f.Name, err))
+			}
+		} else {
+			return
+		}
+		for _, v := range values {
+			if err := flg.Set(f.Name, v); err != nil {
+				fatal(fmt.Errorf("%s --%s from environment or config: %w", cmd, f.Name, err))
+			}
+		}
+	})
+	if *maxMemory != "" {
+		limit, err := parseSize(*maxMemory)
+		if err != nil || limit <= 0 {
+			fatal(fmt.Errorf("invalid --max-memory %q: want a size, e.g. 256MB", *maxMemory))
+		}
+		setMemoryLimit(limit)
+	}
+}
+
+// warnWithheld says which options an untrusted config layer was not
+// allowed to set.
+func warnWithheld(ws []withheldOption) {
+	for _, w := range ws {
+		fmt.Fprintf(os.Stderr, "warning: config: ignoring %s %q from %s: set it with a flag, the environment or your user config, or trust this config with PACKPROMPT_TRUST_CONFIG=1\n",
+			w.where, w.name, w.source)
+	}
+}
+
+// apiKey finds the credential for an LLM feature: its own variable, then
+// PACKPROMPT_API_KEY, then OPENAI_API_KEY.
+func apiKey(specific string) string {
+	for _, k := range []string{specific, "PACKPROMPT_API_KEY", "OPENAI_API_KEY"} {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
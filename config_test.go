@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEnvFlags checks PACKPROMPT_<FLAG> sets pack's flags and, for other
+// commands, only the shared ones, warning about the rest, and
+// PACKPROMPT_<CMD>_<FLAG> sets any flag of that command.
+func TestEnvFlags(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n", "b.txt": "beta\n"})
+	dir := t.TempDir()
+	stray, scoped := filepath.Join(dir, "stray.txt"), filepath.Join(dir, "scoped.txt")
+
+	res := runCLIEnv(t, src, []string{"PACKPROMPT_OUT=" + stray, "PACKPROMPT_FORMAT=jsonl"}, "pack")
+	if res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	if data, err := os.ReadFile(stray); err != nil || !strings.HasPrefix(string(data), "{") {
+		t.Errorf("PACKPROMPT_OUT and PACKPROMPT_FORMAT did not set pack --out and --format: %v\n%s", err, data)
+	}
+	res = runCLIEnv(t, src, []string{"PACKPROMPT_FORMAT=text"}, "unpack", "--in", stray, "--dest", filepath.Join(dir, "out"))
+	if res.code != 0 || !strings.Contains(res.stderr, "ignoring PACKPROMPT_FORMAT") || !strings.Contains(res.stderr, "PACKPROMPT_UNPACK_FORMAT") {
+		t.Errorf("unpack: exit %d: %s", res.code, res.stderr)
+	}
+
+	res = runCLIEnv(t, src, []string{"PACKPROMPT_PACK_OUT=" + scoped, "PACKPROMPT_EXCLUDE=b.txt,files-prompt.txt"}, "pack")
+	if res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	data, err := os.ReadFile(scoped)
+	if err != nil {
+		t.Fatalf("PACKPROMPT_PACK_OUT: %v", err)
+	}
+	if !strings.Contains(string(data), "path=a.txt") || strings.Contains(string(data), "path=b.txt") {
+		t.Errorf("PACKPROMPT_EXCLUDE=b.txt: pack is\n%s", data)
+	}
+}
+
+// TestProjectConfigTrust checks the project config cannot set hooks,
+// safety options or forge tokens unless PACKPROMPT_TRUST_CONFIG=1, while
+// its other options still apply.
+func TestProjectConfigTrust(t *testing.T) {
+	dir := t.TempDir()
+	hooked := filepath.Join(dir, "hooked")
+	src := writeTree(t, map[string]string{
+		"a.txt":           "alpha\n",
+		projectConfigName: `{"pack": {"pre-pack": ["touch ` + hooked + `"], "out": "project.txt"}, "tokens": {"evil.example": "GITLAB_TOKEN"}}`,
+	})
+	res := runCLI(t, src, "pack")
+	if res.code != 0 || !strings.Contains(res.stderr, `ignoring pack "pre-pack"`) || !strings.Contains(res.stderr, `ignoring tokens "evil.example"`) {
+		t.Errorf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	if _, err := os.Stat(hooked); err == nil {
+		t.Errorf("the project config ran a pre-pack hook")
+	}
+	if _, err := os.Stat(filepath.Join(src, "project.txt")); err != nil {
+		t.Errorf("the project config's --out was not applied: %v", err)
+	}
+
+	if res := runCLIEnv(t, src, []string{"PACKPROMPT_TRUST_CONFIG=1"}, "pack"); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	if _, err := os.Stat(hooked); err != nil {
+		t.Errorf("PACKPROMPT_TRUST_CONFIG=1 did not run the pre-pack hook: %v", err)
+	}
+}
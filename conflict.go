@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// What unpack does with a file already at --dest that the pack would
+// change.
+const (
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+	conflictBackup    = "backup" // keep the old file as FILE.orig
+	conflictPrompt    = "prompt"
+)
+
+const backupSuffix = ".orig"
+
+// conflictPolicy is unpack's --on-conflict. A file's first entry decides
+// for it; its later chunks, or a later copy of it, follow.
+type conflictPolicy struct {
+	mode     string
+	answers  *bufio.Reader     // for prompt
+	decided  map[string]string // by path on disk
+	skipped  []string          // paths on disk
+	backedUp []string
+}
+
+func newConflictPolicy(mode string) (*conflictPolicy, error) {
+	switch mode {
+	case conflictOverwrite, conflictSkip, conflictBackup:
+	case conflictPrompt:
+		if !isTerminal(os.Stdin) {
+			return nil, errors.New("--on-conflict prompt needs a terminal to ask on; use skip, overwrite or backup")
+		}
+	default:
+		return nil, fmt.Errorf("invalid --on-conflict %q: want skip, overwrite, backup or prompt", mode)
+	}
+	return &conflictPolicy{mode: mode, answers: bufio.NewReader(os.Stdin), decided: map[string]string{}}, nil
+}
+
+// allow reports whether unpack may write the entry for rel, content being
+// the file or its first chunk, over what is at full, backing that up first
+// if so decided. A file that is missing or would not change is no conflict.
+func (p *conflictPolicy) allow(dest, rel, full string, content []byte, c packprompt.Chunk, chunked, confine bool) (bool, error) {
+	if d, ok := p.decided[full]; ok {
+		return d != conflictSkip, nil
+	}
+	if chunked && c.Index > 1 {
+		return true, nil // the earlier chunks are already there
+	}
+	cur, err := os.ReadFile(full)
+	if errors.Is(err, iofs.ErrNotExist) || (err == nil && !chunked && bytes.Equal(cur, content)) {
+		p.decided[full] = conflictOverwrite
+		return true, nil
+	}
+	if err != nil {
+		return true, nil // not a file to keep; writing it reports why
+	}
+	mode := p.mode
+	if mode == conflictPrompt {
+		if mode, err = p.ask(filepath.ToSlash(full), len(cur), len(content), chunked); err != nil {
+			return false, err
+		}
+	}
+	p.decided[full] = mode
+	switch mode {
+	case conflictSkip:
+		p.skipped = append(p.skipped, filepath.ToSlash(full))
+		return false, nil
+	case conflictBackup:
+		name, err := backupName(full)
+		if err != nil {
+			return false, err
+		}
+		backup := rel + strings.TrimPrefix(name, full)
+		var perm iofs.FileMode = 0o644
+		if info, err := os.Stat(full); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if confine {
+			err = packprompt.WriteBeneath(dest, backup, cur, perm)
+		} else {
+			err = writeFileAtomic(name, cur, perm)
+		}
+		if err != nil {
+			return false, fmt.Errorf("backing up %s: %w", rel, err)
+		}
+		p.backedUp = append(p.backedUp, filepath.ToSlash(name))
+	}
+	return true, nil
+}
+
+// backupName is full.orig, or full.orig.N for the first N free, so an
+// earlier backup is never lost.
+func backupName(full string) (string, error) {
+	name := full + backupSuffix
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(name); errors.Is(err, iofs.ErrNotExist) {
+			return name, nil
+		} else if err != nil {
+			return "", err
+		}
+		name = full + backupSuffix + "." + strconv.Itoa(n)
+	}
+}
+
+// ask asks on the terminal what to do with the file at path. "a" and "o" settle every
+// file after it too.
+func (p *conflictPolicy) ask(path string, have, want int, chunked bool) (string, error) {
+	size := humanSize(int64(want))
+	if chunked {
+		size = "chunked"
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "%s exists (%s, pack %s). Overwrite? [y]es, [n]o, [b]ackup, [a]ll, n[o]ne, [q]uit: ", path, humanSize(int64(have)), size)
+		line, err := p.answers.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("no answer for %s; unpack stopped, files before it are written", path)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return conflictOverwrite, nil
+		case "n", "no":
+			return conflictSkip, nil
+		case "b", "backup":
+			return conflictBackup, nil
+		case "a", "all":
+			p.mode = conflictOverwrite
+			return conflictOverwrite, nil
+		case "o", "none":
+			p.mode = conflictSkip
+			return conflictSkip, nil
+		case "q", "quit":
+			return "", fmt.Errorf("unpack stopped at %s; files before it are written", path)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// sha256Attr carries the SHA-256 of an entry's content, which unpack checks
+// what it wrote against. With --contract the model echoes it back as
+// base=HASH on files it changes, so apply can tell whether the local file
+// moved on since the pack was made.
+const (
+	sha256Attr  = packprompt.SHA256Attr
+	baseAttr    = "base"
+	deletedAttr = "deleted"
+	newBase     = "new"
+)
+
+const (
+	contractMark = packprompt.ContractMark
+	contractEnd  = packprompt.ContractEnd
+)
+
+// contractText is what --contract appends to a pack: the exact response
+// format apply accepts.
+const contractText = contractMark + `
+Answer with the files you change, add or delete, and nothing else. Write each one as a
+block in packprompt v2 format, one after another with no text, commentary or code fences
+between or around them:
+
+--- FILE path=RELATIVE/PATH mode=0644 base=HASH ---
+the complete new content of the file
+--- END FILE ---
+
+Rules:
+- path is the file's path exactly as in this pack; a new file gets a new relative path.
+- base is the sha256 value from the header of the file as packed above; use base=new for a
+  file that does not exist yet. Do not return entries whose header has converted=,
+  transformed=, truncated=, encoding= or chunk=, whose path has "!/" (inside an archive), or
+  that have no sha256 (encrypted): they are not the file itself.
+- Include only files you change, and always the whole file; never elide code with
+  placeholders such as "... rest unchanged ...". The one exception: for a small change to a
+  long file you may add patch=unified after base and give a unified diff against the file as
+  packed instead, only its hunks (@@ -L,N +L,N @@, with 3 lines of context).
+- To delete a file, send its block with deleted=true after base and an empty body.
+- Keep the mode unless the change needs another one (0755 for new scripts).
+` + contractEnd + "\n"
+
+// contentHash is the hex SHA-256 of b.
+func contentHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashEntries adds sha256=HASH of the content unpack writes to every entry:
+// the file itself, or the derived view (converted, transformed, truncated)
+// packed in its place. Encrypted entries get none, which would let anyone
+// confirm a guess at their content; the cipher's tag guards them instead.
+// Entries that can no longer be read are left out, through om.fail.
+func hashEntries(entries []entry, om *omissions) ([]entry, error) {
+	unreadable := make([]bool, len(entries))
+	err := forEachParallel(len(entries), func(i int) error {
+		e := &entries[i]
+		if e.cipher != nil {
+			return nil
+		}
+		fail := func(err error) error {
+			unreadable[i] = true
+			return om.fail(e.rel, e.size, err)
+		}
+		if isEncoded(*e) {
+			data, err := readEntry(*e)
+			if err != nil {
+				return fail(err)
+			}
+			raw, err := packprompt.DecodeBase64(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", e.rel, err)
+			}
+			e.attrs = append(e.attrs, sha256Attr+"="+contentHash(raw))
+			return nil
+		}
+		f, err := e.open()
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		h := sha256.New()
+		var marks endMarkWriter
+		if _, err := io.Copy(io.MultiWriter(h, &marks), f); err != nil {
+			return fail(err)
+		}
+		if marks.seen() {
+			data, err := readEntry(*e)
+			if err != nil {
+				return fail(err)
+			}
+			encodeEndMarks(e, data)
+		}
+		e.attrs = append(e.attrs, sha256Attr+"="+hex.EncodeToString(h.Sum(nil)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	kept := entries[:0]
+	for i, e := range entries {
+		if !unreadable[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// endMarkWriter watches the content written to it for a line that reads
+// as the end mark, which would end a text pack's entry early on unpack.
+type endMarkWriter struct {
+	line  []byte // the line so far, while it can still be the mark
+	long  bool   // the line is already something else
+	found bool
+}
+
+func (w *endMarkWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch {
+		case b == '\n':
+			w.found = w.found || w.isMark()
+			w.line, w.long = w.line[:0], false
+		case w.long:
+		case len(w.line) < len(endMark) || b == '\r':
+			w.line = append(w.line, b)
+		default:
+			w.long = true
+		}
+	}
+	return len(p), nil
+}
+
+func (w *endMarkWriter) isMark() bool {
+	return !w.long && strings.TrimRight(string(w.line), "\r") == endMark
+}
+
+// seen reports whether any line, the last one included, was the end mark.
+func (w *endMarkWriter) seen() bool {
+	return w.found || w.isMark()
+}
+
+// encodeEndMarks packs e, whose content data has a line reading as the end
+// mark, base64-encoded so the line cannot cut it short. Its sha256 is still
+// that of data.
+func encodeEndMarks(e *entry, data []byte) {
+	fmt.Fprintf(os.Stderr, "warning: %s has a %q line; packing it base64-encoded\n", e.rel, endMark)
+	e.src, e.data, e.banners = "", packprompt.EncodeBase64(data), nil
+	e.size = int64(len(e.data))
+	e.attrs = append(e.attrs, encodingAttr+"="+base64Scheme)
+}
+
+// rehashed returns attrs with their sha256, if any, replaced by that of
+// content, for an entry cut down after it was hashed.
+func rehashed(attrs []string, content []byte) []string {
+	out := make([]string, len(attrs))
+	for i, a := range attrs {
+		if k, _, _ := strings.Cut(a, "="); k == sha256Attr {
+			a = sha256Attr + "=" + contentHash(content)
+		}
+		out[i] = a
+	}
+	return out
+}
+
+// hasAttr reports whether attrs ("key=value") set key.
+func hasAttr(attrs []string, key string) bool {
+	for _, a := range attrs {
+		if k, _, _ := strings.Cut(a, "="); k == key {
+			return true
+		}
+	}
+	return false
+}
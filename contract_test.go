@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPackEndMarkLine packs and unpacks a file holding a line that reads
+// as the end mark, like contract.go's own contract text.
+func TestPackEndMarkLine(t *testing.T) {
+	content := "before\n" + endMark + "\nafter\n"
+	src := writeTree(t, map[string]string{"tricky.txt": content, "crlf.txt": "a\r\n" + endMark + "\r\nb\r\n"})
+	out := filepath.Join(t.TempDir(), "pack.txt")
+	if res := runCLI(t, src, "pack", "--out", out); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	dest := t.TempDir()
+	if res := runCLI(t, src, "unpack", "--in", out, "--dest", dest); res.code != 0 {
+		t.Fatalf("unpack: exit %d: %s", res.code, res.stderr)
+	}
+	for _, name := range []string{"tricky.txt", "crlf.txt"} {
+		want, _ := os.ReadFile(filepath.Join(src, name))
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(got) != string(want) {
+			t.Errorf("%s: unpacked %q (%v), want %q", name, got, err, want)
+		}
+	}
+	if res := runCLI(t, src, "verify", "--in", out); res.code != 0 || !strings.HasPrefix(res.stdout, "OK: ") {
+		t.Errorf("verify: exit %d: %s", res.code, res.stdout)
+	}
+}
+
+func TestEndMarkWriter(t *testing.T) {
+	for content, want := range map[string]bool{
+		"a\n" + endMark + "\nb":     true,
+		"a\n" + endMark:             true,
+		endMark + "\r\r\n":          true,
+		"a\n " + endMark + "\n":     false,
+		"a\n" + endMark + " x\n":    false,
+		"a\n" + endMark + "-\nb\n":  false,
+		strings.Repeat("x", 100000): false,
+	} {
+		var w endMarkWriter
+		// in pieces, as io.Copy writes
+		for i := 0; i < len(content); i += 3 {
+			w.Write([]byte(content[i:min(i+3, len(content))]))
+		}
+		if got := w.seen(); got != want {
+			t.Errorf("%.40q: seen %v, want %v", content, got, want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// convertedAttr names the converter that produced an entry from a file the
+// pack could not otherwise hold; the entry's path is the source path plus ".md".
+const convertedAttr = "converted"
+
+// converter turns a notebook, document or data file into markdown during
+// the walk. convert returns errNotConverted to have the file packed as usual.
+type converter struct {
+	name    string
+	exts    []string
+	convert func(p string) ([]byte, error)
+}
+
+var errNotConverted = errors.New("not converted")
+
+// dataSummary configures the sqlite and csv summarizers.
+type dataSummary struct {
+	rows    int   // sample rows per table
+	csvOver int64 // CSV files up to this size are packed whole
+}
+
+// converterRegistry lists the --convert converters.
+func converterRegistry(ds dataSummary) []converter {
+	return []converter{
+		{"ipynb", []string{".ipynb"}, convertNotebook},
+		{"docx", []string{".docx"}, convertDocx},
+		{"odt", []string{".odt"}, convertODT},
+		{"rtf", []string{".rtf"}, convertRTF},
+		{"pdf", []string{".pdf"}, convertPDF},
+		{"sqlite", []string{".db", ".sqlite", ".sqlite3"}, func(p string) ([]byte, error) { return summarizeSQLite(p, ds.rows) }},
+		{"csv", []string{".csv", ".tsv"}, func(p string) ([]byte, error) { return summarizeCSV(p, ds) }},
+	}
+}
+
+func converterNames() []string {
+	var names []string
+	for _, c := range converterRegistry(dataSummary{}) {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// parseConverters reads --convert: converter names, or all.
+func parseConverters(spec string, ds dataSummary) ([]converter, error) {
+	var out []converter
+	for _, name := range parseExcludes(spec) {
+		found := false
+		for _, c := range converterRegistry(ds) {
+			if name == "all" || name == c.name {
+				out = append(out, c)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown --convert %q (known: %s, all)", name, strings.Join(converterNames(), ", "))
+		}
+	}
+	return out, nil
+}
+
+func findConverter(convs []converter, rel string) *converter {
+	ext := strings.ToLower(path.Ext(rel))
+	for i := range convs {
+		if contains(convs[i].exts, ext) {
+			return &convs[i]
+		}
+	}
+	return nil
+}
+
+// unexclude drops the "*.ext" patterns matching exts.
+func unexclude(excludes, exts []string) []string {
+	var out []string
+	for _, pat := range excludes {
+		if !strings.HasPrefix(pat, "*.") || !contains(exts, pat[1:]) {
+			out = append(out, pat)
+		}
+	}
+	return out
+}
+
+// notebook is the part of the Jupyter format the conversion reads.
+type notebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+type notebookCell struct {
+	CellType string          `json:"cell_type"`
+	Source   json.RawMessage `json:"source"`
+	Outputs  []struct {
+		OutputType string                     `json:"output_type"`
+		Text       json.RawMessage            `json:"text"`
+		Data       map[string]json.RawMessage `json:"data"`
+		Ename      string                     `json:"ename"`
+		Evalue     string                     `json:"evalue"`
+	} `json:"outputs"`
+}
+
+// maxOutputLines keeps noisy cell outputs from swamping the code.
+const maxOutputLines = 20
+
+// notebookText joins a source or text field, which may be a string or a
+// list of lines.
+func notebookText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var lines []string
+	_ = json.Unmarshal(raw, &lines)
+	return strings.Join(lines, "")
+}
+
+// convertNotebook renders markdown cells as they are and code cells as
+// fenced blocks, each followed by its text output.
+func convertNotebook(p string) ([]byte, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("not a Jupyter notebook: %w", err)
+	}
+	lang := nb.Metadata.LanguageInfo.Name
+	if lang == "" {
+		lang = nb.Metadata.Kernelspec.Language
+	}
+	var b strings.Builder
+	for _, c := range nb.Cells {
+		src := strings.TrimRight(notebookText(c.Source), "\n")
+		switch c.CellType {
+		case "markdown", "raw":
+			b.WriteString(src + "\n\n")
+		case "code":
+			fmt.Fprintf(&b, "```%s\n%s\n```\n\n", lang, src)
+			var out []string
+			for _, o := range c.Outputs {
+				switch o.OutputType {
+				case "stream":
+					out = append(out, notebookText(o.Text))
+				case "execute_result", "display_data":
+					if t, ok := o.Data["text/plain"]; ok {
+						out = append(out, notebookText(t))
+					} else if len(o.Data) > 0 {
+						var kinds []string
+						for k := range o.Data {
+							kinds = append(kinds, k)
+						}
+						sort.Strings(kinds)
+						out = append(out, "["+strings.Join(kinds, ", ")+" output]\n")
+					}
+				case "error":
+					out = append(out, o.Ename+": "+o.Evalue+"\n")
+				}
+			}
+			if text := strings.TrimRight(strings.Join(out, ""), "\n"); text != "" {
+				lines := strings.Split(text, "\n")
+				if len(lines) > maxOutputLines {
+					lines = append(lines[:maxOutputLines], fmt.Sprintf("... %d more lines", len(lines)-maxOutputLines))
+				}
+				fmt.Fprintf(&b, "Output:\n```\n%s\n```\n\n", strings.Join(lines, "\n"))
+			}
+		}
+	}
+	return []byte(strings.TrimRight(b.String(), "\n") + "\n"), nil
+}
+
+// rtfSkip lists destinations whose content is not document text.
+var rtfSkip = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true, "pict": true,
+	"header": true, "footer": true, "headerl": true, "headerr": true, "footerl": true, "footerr": true,
+	"listtable": true, "listoverridetable": true, "rsidtbl": true, "generator": true, "xmlnstbl": true,
+	"themedata": true, "colorschememapping": true, "latentstyles": true, "datastore": true, "object": true,
+}
+
+// convertRTF extracts the text of an RTF document, keeping paragraphs.
+func convertRTF(p string) ([]byte, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(`{\rtf`)) {
+		return nil, fmt.Errorf("not an RTF document")
+	}
+	type group struct {
+		skip bool
+		uc   int // characters to skip after \u
+	}
+	stack := []group{{uc: 1}}
+	var b strings.Builder
+	skipChars := 0
+	emit := func(s string) {
+		if !stack[len(stack)-1].skip {
+			b.WriteString(s)
+		}
+	}
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '{':
+			stack = append(stack, stack[len(stack)-1])
+		case '}':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case '\r', '\n':
+		case '\\':
+			if i+1 >= len(data) {
+				break
+			}
+			n := data[i+1]
+			switch {
+			case n == '\\' || n == '{' || n == '}':
+				emit(string(n))
+				i++
+			case n == '~':
+				emit(" ")
+				i++
+			case n == '*':
+				stack[len(stack)-1].skip = true
+				i++
+			case n == '\'' && i+3 < len(data):
+				if v, err := strconv.ParseUint(string(data[i+2:i+4]), 16, 8); err == nil {
+					if skipChars > 0 {
+						skipChars--
+					} else {
+						emit(string(rune(v))) // cp1252 is close enough to Latin-1 for prose
+					}
+				}
+				i += 3
+			case n >= 'a' && n <= 'z' || n >= 'A' && n <= 'Z':
+				j := i + 1
+				for j < len(data) && (data[j] >= 'a' && data[j] <= 'z' || data[j] >= 'A' && data[j] <= 'Z') {
+					j++
+				}
+				word := string(data[i+1 : j])
+				k := j
+				if k < len(data) && (data[k] == '-' || data[k] >= '0' && data[k] <= '9') {
+					k++
+					for k < len(data) && data[k] >= '0' && data[k] <= '9' {
+						k++
+					}
+				}
+				arg, hasArg := 0, k > j
+				if hasArg {
+					arg, _ = strconv.Atoi(string(data[j:k]))
+				}
+				if k < len(data) && data[k] == ' ' {
+					k++
+				}
+				i = k - 1
+				switch {
+				case rtfSkip[word]:
+					stack[len(stack)-1].skip = true
+				case word == "par" || word == "sect":
+					emit("\n\n")
+				case word == "line" || word == "row":
+					emit("\n")
+				case word == "tab" || word == "cell":
+					emit("\t")
+				case word == "uc" && hasArg:
+					stack[len(stack)-1].uc = arg
+				case word == "u" && hasArg:
+					if arg < 0 {
+						arg += 65536
+					}
+					emit(string(rune(arg)))
+					skipChars = stack[len(stack)-1].uc
+				case word == "emdash":
+					emit("—")
+				case word == "endash":
+					emit("–")
+				case word == "bullet":
+					emit("•")
+				case word == "lquote" || word == "rquote":
+					emit("'")
+				case word == "ldblquote" || word == "rdblquote":
+					emit(`"`)
+				}
+			default:
+				i++
+			}
+		default:
+			if skipChars > 0 {
+				skipChars--
+				continue
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				r = rune(c)
+			}
+			emit(string(r))
+			i += size - 1
+		}
+	}
+	return tidyText(b.String()), nil
+}
+
+// tidyText trims trailing spaces and collapses runs of blank lines.
+func tidyText(s string) []byte {
+	var b strings.Builder
+	blank := 0
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimRight(l, " \t")
+		if l == "" {
+			if blank++; blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		b.WriteString(l + "\n")
+	}
+	return []byte(strings.TrimSpace(b.String()) + "\n")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const coverageTag = "packprompt:coverage"
+
+var coverageLineRe = regexp.MustCompile(`^\s*// ` + regexp.QuoteMeta(coverageTag) + `\s.*$`)
+
+// coverBlock is one line of a Go cover profile.
+type coverBlock struct {
+	startLine, endLine int
+	stmts              int
+	count              int
+}
+
+// coverProfile maps profile file names (import path + file) to their blocks.
+type coverProfile map[string][]coverBlock
+
+// readCoverProfile parses the output of `go test -coverprofile`.
+func readCoverProfile(p string) (coverProfile, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	prof := coverProfile{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if (n == 1 && strings.HasPrefix(line, "mode:")) || strings.TrimSpace(line) == "" {
+			continue
+		}
+		// name.go:startLine.startCol,endLine.endCol numStmts count
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("%s:%d: malformed cover profile line", p, n)
+		}
+		fields := strings.Fields(line[colon+1:])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: malformed cover profile line", p, n)
+		}
+		start, end, ok := strings.Cut(fields[0], ",")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: malformed cover profile range", p, n)
+		}
+		var b coverBlock
+		b.startLine, _ = strconv.Atoi(strings.Split(start, ".")[0])
+		b.endLine, _ = strconv.Atoi(strings.Split(end, ".")[0])
+		b.stmts, _ = strconv.Atoi(fields[1])
+		b.count, _ = strconv.Atoi(fields[2])
+		name := line[:colon]
+		prof[name] = append(prof[name], b)
+	}
+	return prof, sc.Err()
+}
+
+// blocksFor finds the profile entry for rel. Profile names are import paths,
+// so the longest name ending in /rel wins.
+func (prof coverProfile) blocksFor(rel string) ([]coverBlock, bool) {
+	if b, ok := prof[rel]; ok {
+		return b, true
+	}
+	var best string
+	for name := range prof {
+		if strings.HasSuffix(name, "/"+rel) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return nil, false
+	}
+	return prof[best], true
+}
+
+func coveredStmts(blocks []coverBlock, from, to int) (covered, total int) {
+	// profiles from merged runs repeat blocks; count each range once
+	seen := map[[2]int]bool{}
+	for _, b := range blocks {
+		if b.startLine < from || b.startLine > to {
+			continue
+		}
+		k := [2]int{b.startLine, b.endLine}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		total += b.stmts
+		if covers(blocks, b) {
+			covered += b.stmts
+		}
+	}
+	return covered, total
+}
+
+func covers(blocks []coverBlock, b coverBlock) bool {
+	for _, o := range blocks {
+		if o.startLine == b.startLine && o.endLine == b.endLine && o.count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func coverageLine(label string, covered, total int) string {
+	if total == 0 {
+		return fmt.Sprintf("// %s %s no statements", coverageTag, label)
+	}
+	return fmt.Sprintf("// %s %s %.1f%% (%d/%d statements)", coverageTag, label,
+		100*float64(covered)/float64(total), covered, total)
+}
+
+// annotateCoverage adds a file-level coverage banner to Go entries found in
+// prof and, when perFunc is set, a coverage comment above every function.
+func annotateCoverage(e *entry, prof coverProfile, perFunc bool) error {
+	if !strings.HasSuffix(e.rel, ".go") || isEncoded(*e) {
+		return nil
+	}
+	blocks, ok := prof.blocksFor(e.rel)
+	if !ok {
+		return nil
+	}
+	covered, total := coveredStmts(blocks, 0, int(^uint(0)>>1))
+	e.banners = append(e.banners, coverageLine("file", covered, total))
+	if !perFunc {
+		return nil
+	}
+
+	src, err := readEntry(*e)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, e.rel, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		// unparsable source still gets the file-level figure
+		return nil
+	}
+	notes := map[int]string{} // line -> comment inserted before it
+	for _, d := range file.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start := fset.Position(fn.Pos()).Line
+		if fn.Doc != nil {
+			start = fset.Position(fn.Doc.Pos()).Line
+		}
+		c, t := coveredStmts(blocks, fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line)
+		notes[start] = coverageLine("func "+fn.Name.Name, c, t)
+	}
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	var out bytes.Buffer
+	for i, l := range lines {
+		if n, ok := notes[i+1]; ok {
+			out.WriteString(n + "\n")
+		}
+		out.Write(l)
+	}
+	e.data = out.Bytes()
+	return nil
+}
+
+func readEntry(e entry) ([]byte, error) {
+	if e.data != nil {
+		return e.data, nil
+	}
+	return os.ReadFile(e.src)
+}
+
+func isCoverageLine(line string) bool {
+	return coverageLineRe.MatchString(line)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// encryptedAttr marks an entry whose content is sealed with aes-256-gcm.
+const encryptedAttr = packprompt.EncryptedAttr
+
+const (
+	cryptScheme = "aes-256-gcm"
+	cryptIter   = 200_000
+	cryptSalt   = 16
+)
+
+// entryCipher seals individual entries with a key derived from a passphrase;
+// every entry gets its own salt and nonce.
+type entryCipher struct {
+	passphrase string
+}
+
+// loadPassphrase reads the passphrase from file (first line) or, when file is
+// "", from PACKPROMPT_PASSPHRASE. It returns "" if neither is set.
+func loadPassphrase(file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		pass, _, _ := strings.Cut(string(data), "\n")
+		pass = strings.TrimRight(pass, "\r")
+		if pass == "" {
+			return "", fmt.Errorf("%s: empty passphrase", file)
+		}
+		return pass, nil
+	}
+	return os.Getenv("PACKPROMPT_PASSPHRASE"), nil
+}
+
+func (c *entryCipher) aead(salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, c.passphrase, salt, cryptIter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plain, binding it to rel, and returns base64 wrapped at 76 columns.
+func (c *entryCipher) seal(rel string, plain []byte) (string, error) {
+	salt := make([]byte, cryptSalt)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := c.aead(salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := append(append(salt, nonce...), aead.Seal(nil, nonce, plain, []byte(rel))...)
+	return wrapLines(base64.StdEncoding.EncodeToString(out), 76), nil
+}
+
+// open reverses seal; text may contain line breaks.
+func (c *entryCipher) open(rel string, text []byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(text)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s: encrypted content is not valid base64: %w", rel, err)
+	}
+	if len(raw) < cryptSalt {
+		return nil, errors.New(rel + ": encrypted content is truncated")
+	}
+	aead, err := c.aead(raw[:cryptSalt])
+	if err != nil {
+		return nil, err
+	}
+	rest := raw[cryptSalt:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New(rel + ": encrypted content is truncated")
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(rel))
+	if err != nil {
+		return nil, fmt.Errorf("%s: cannot decrypt (wrong passphrase or corrupted content)", rel)
+	}
+	return plain, nil
+}
+
+func wrapLines(s string, width int) string {
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width])
+		b.WriteByte('\n')
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEntryCipher checks sealed entries open back to their content, and
+// that every way of getting one wrong fails rather than yielding garbage.
+func TestEntryCipher(t *testing.T) {
+	c := &entryCipher{passphrase: "correct horse"}
+	for name, plain := range map[string][]byte{
+		"empty":  {},
+		"text":   []byte("alpha\nbeta\n"),
+		"binary": {0, 0xff, '\r', '\n', 0x80},
+		"long":   bytes.Repeat([]byte("0123456789"), 100),
+	} {
+		sealed, err := c.seal("dir/a.txt", plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range strings.Split(sealed, "\n") {
+			if len(l) > 76 {
+				t.Errorf("%s: sealed line of %d columns", name, len(l))
+			}
+		}
+		if got, err := c.open("dir/a.txt", []byte(sealed)); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("%s: open = %q, %v; want %q", name, got, err, plain)
+		}
+	}
+
+	sealed, err := c.seal("a.txt", []byte("secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(sealed, "\n", ""))
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-1] ^= 1
+	for _, tc := range []struct {
+		name string
+		c    *entryCipher
+		rel  string
+		text string
+		want string
+	}{
+		{"wrong passphrase", &entryCipher{passphrase: "wrong"}, "a.txt", sealed, "a.txt: cannot decrypt (wrong passphrase or corrupted content)"},
+		{"moved to another path", c, "b.txt", sealed, "b.txt: cannot decrypt"},
+		{"tampered", c, "a.txt", base64.StdEncoding.EncodeToString(tampered), "a.txt: cannot decrypt"},
+		{"not base64", c, "a.txt", "not*base64", "a.txt: encrypted content is not valid base64"},
+		{"no salt", c, "a.txt", base64.StdEncoding.EncodeToString(raw[:cryptSalt-1]), "a.txt: encrypted content is truncated"},
+		{"no nonce", c, "a.txt", base64.StdEncoding.EncodeToString(raw[:cryptSalt+4]), "a.txt: encrypted content is truncated"},
+	} {
+		if got, err := tc.c.open(tc.rel, []byte(tc.text)); err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%s: open = %q, %v; want an error starting %q", tc.name, got, err, tc.want)
+		}
+	}
+
+	again, err := c.seal("a.txt", []byte("secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Errorf("sealing twice gave the same text: salt and nonce are not fresh")
+	}
+}
+
+// TestLoadPassphrase checks the first line of a passphrase file is used,
+// without its line ending, and that the environment is the fallback.
+func TestLoadPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PACKPROMPT_PASSPHRASE", "from env")
+	for content, want := range map[string]string{
+		"one\n":           "one",
+		"two words\r\n":   "two words",
+		"first\nsecond\n": "first",
+		"no newline":      "no newline",
+		"\nlater\n":       "error",
+	} {
+		p := filepath.Join(dir, "pass")
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadPassphrase(p)
+		if err != nil {
+			got = "error"
+		}
+		if got != want {
+			t.Errorf("loadPassphrase(%q) = %q (%v), want %q", content, got, err, want)
+		}
+	}
+	if got, err := loadPassphrase(""); err != nil || got != "from env" {
+		t.Errorf("loadPassphrase(\"\") = %q, %v; want the environment's", got, err)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// archiveSep joins an archive's path to a member's: bundle.zip!/src/main.c.
+const archiveSep = "!/"
+
+// Limits for --descend-archives, so a zip bomb costs a warning, not the
+// machine: members bigger than maxMemberSize are left out, and reading
+// stops once an archive has yielded maxArchiveTotal bytes.
+const (
+	maxMemberSize   = 8 << 20
+	maxArchiveTotal = 256 << 20
+	maxArchiveDepth = 3
+)
+
+var archiveExts = []string{".zip", ".tar", ".gz", ".tgz"}
+
+// archiveKind returns "zip", "tar" or "tgz" for archive names, else "".
+func archiveKind(name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(n, ".zip"):
+		return "zip"
+	case strings.HasSuffix(n, ".tar"):
+		return "tar"
+	case strings.HasSuffix(n, ".tar.gz"), strings.HasSuffix(n, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+// archiveReader is what both zip (ReaderAt) and tar (Reader) need.
+type archiveReader interface {
+	io.Reader
+	io.ReaderAt
+}
+
+// archiveWalk collects the text members of one archive and those nested in it.
+type archiveWalk struct {
+	excludes     []string
+	om           *omissions
+	total        int64
+	entries      []entry
+	base64       bool // pack binary members encoded instead of leaving them out
+	keepArchives bool // treat nested archives as files rather than descending
+}
+
+// readArchive returns the packable members of the archive at p, whose
+// path in the pack is rel.
+func readArchive(p, rel, kind string, excludes []string, om *omissions) ([]entry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	w := &archiveWalk{excludes: excludes, om: om}
+	if err := w.walk(rel, kind, f, info.Size(), 1); err != nil {
+		return nil, err
+	}
+	return w.entries, nil
+}
+
+func (w *archiveWalk) walk(prefix, kind string, r archiveReader, size int64, depth int) error {
+	switch kind {
+	case "zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			if err := w.member(prefix, f.Name, f.Mode(), f.Modified, int64(f.UncompressedSize64), f.Open, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "tar", "tgz":
+		var src io.Reader = r
+		if kind == "tgz" {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			src = gz
+		}
+		tr := tar.NewReader(src)
+		for {
+			h, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if h.Typeflag != tar.TypeReg {
+				continue
+			}
+			open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+			if err := w.member(prefix, h.Name, h.FileInfo().Mode(), h.ModTime, h.Size, open, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("unknown archive kind %q", kind)
+}
+
+// member packs one archive member, descending into it if it is an archive.
+func (w *archiveWalk) member(prefix, name string, mode iofs.FileMode, mod time.Time, size int64,
+	open func() (io.ReadCloser, error), depth int) error {
+	inner := path.Clean(strings.TrimPrefix(strings.ReplaceAll(name, `\`, "/"), "./"))
+	rel := inner
+	if prefix != "" {
+		rel = prefix + archiveSep + inner
+	}
+	if !iofs.ValidPath(inner) || inner == "." {
+		w.om.add(rel, size, "unsafe path inside archive")
+		return nil
+	}
+	// excludes apply to the member's own path, directory by directory
+	parts := strings.Split(inner, "/")
+	for i := range parts {
+		if pat, ok := packprompt.MatchExclude(strings.Join(parts[:i+1], "/"), w.excludes); ok {
+			w.om.add(rel, size, fmt.Sprintf("excluded by %q", pat))
+			return nil
+		}
+	}
+	if size > maxMemberSize {
+		w.om.add(rel, size, "too large inside archive")
+		return nil
+	}
+	if w.total+size > maxArchiveTotal {
+		w.om.add(rel, size, "archive content over "+humanSize(maxArchiveTotal))
+		return nil
+	}
+	rc, err := open()
+	if err != nil {
+		w.om.add(rel, size, "unreadable inside archive")
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxMemberSize+1))
+	rc.Close()
+	if err != nil || int64(len(data)) > maxMemberSize {
+		w.om.add(rel, size, "unreadable inside archive")
+		return nil
+	}
+	w.total += int64(len(data))
+
+	if packprompt.IsPackOutput(data) {
+		w.om.add(rel, size, "earlier packprompt output")
+		return nil
+	}
+	if kind := archiveKind(inner); kind != "" && !w.keepArchives {
+		if depth >= maxArchiveDepth {
+			w.om.add(rel, size, "archive nested too deep")
+			return nil
+		}
+		if err := w.walk(rel, kind, bytes.NewReader(data), int64(len(data)), depth+1); err != nil {
+			w.om.add(rel, size, "unreadable archive: "+err.Error())
+		}
+		return nil
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	if packprompt.IsBinary(data) {
+		if !w.base64 {
+			w.om.add(rel, size, "binary")
+			return nil
+		}
+		enc := packprompt.EncodeBase64(data)
+		w.entries = append(w.entries, entry{rel: rel, data: enc, mode: perm, size: int64(len(enc)), modTime: mod,
+			attrs: []string{encodingAttr + "=" + base64Scheme}})
+		return nil
+	}
+	w.entries = append(w.entries, entry{rel: rel, data: data, mode: perm, size: int64(len(data)), modTime: mod})
+	return nil
+}
+
+// isZipRoot reports whether root, as given to --root, is a zip file to pack
+// the members of rather than a directory.
+func isZipRoot(root string) bool {
+	info, err := os.Stat(root)
+	return err == nil && !info.IsDir() && archiveKind(root) == "zip"
+}
+
+// collectZip is collectEntries for a zip file: its members are packed under
+// the same excludes and binary rules, and nested archives are descended
+// into only with opts.archives. A single directory holding everything, as
+// in a forge's snapshot of a repository, is dropped from the paths.
+func collectZip(p string, excludes []string, opts walkOptions, om *omissions) ([]entry, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	top := zipTopDir(zr.File)
+	w := &archiveWalk{excludes: excludes, om: om, base64: opts.base64, keepArchives: !opts.archives}
+	session := false
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(strings.ReplaceAll(f.Name, `\`, "/"), top)
+		if f.Mode().IsDir() || name == "" {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			om.add(name, int64(f.UncompressedSize64), "not a regular file")
+			continue
+		}
+		if first, _, _ := strings.Cut(name, "/"); first == sessionDir {
+			if !session {
+				om.addDir(sessionDir, "packprompt session")
+				session = true
+			}
+			continue
+		}
+		if err := w.member("", name, f.Mode(), f.Modified, int64(f.UncompressedSize64), f.Open, 1); err != nil {
+			return nil, err
+		}
+	}
+	return w.entries, nil
+}
+
+// zipTopDir returns "DIR/" when every member of a zip is inside DIR.
+func zipTopDir(files []*zip.File) string {
+	top := ""
+	for _, f := range files {
+		first, _, nested := strings.Cut(strings.ReplaceAll(f.Name, `\`, "/"), "/")
+		if !nested || (top != "" && first != top) {
+			return ""
+		}
+		top = first
+	}
+	if top == "" {
+		return ""
+	}
+	return top + "/"
+}
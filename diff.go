@@ -0,0 +1,473 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// edit is one line of a line diff: ' ' kept, '-' only in a, '+' only in b.
+// ai and bi index the line in a and b (-1 when absent).
+type edit struct {
+	op     byte
+	ai, bi int
+}
+
+// maxDiffCost bounds the Myers search (roughly lines changed); beyond it the
+// files are shown as replaced wholesale rather than burning memory.
+const maxDiffCost = 4000
+
+// lineDiff computes a minimal line diff of a and b with Myers' algorithm.
+func lineDiff(a, b []string) []edit {
+	n, m := len(a), len(b)
+	maxD := min(n+m, maxDiffCost)
+	off := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		var out []edit
+		for i := range a {
+			out = append(out, edit{'-', i, -1})
+		}
+		for j := range b {
+			out = append(out, edit{'+', -1, j})
+		}
+		return out
+	}
+	// walk the trace back from (n, m)
+	var rev []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		vd := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && vd[off+k-1] < vd[off+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := vd[off+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, edit{' ', x, y})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, edit{'+', -1, y})
+		} else {
+			x--
+			rev = append(rev, edit{'-', x, -1})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, edit{' ', x, y})
+	}
+	out := make([]edit, len(rev))
+	for i, e := range rev {
+		out[len(rev)-1-i] = e
+	}
+	return out
+}
+
+// hunk is a run of edits with surrounding context.
+type hunk struct {
+	edits        []edit
+	aStart, aLen int
+	bStart, bLen int
+}
+
+func makeHunks(edits []edit, context int) []hunk {
+	var hunks []hunk
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := max(0, i-context)
+		end := i
+		// extend while the next change is within 2*context kept lines
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+		h := hunk{edits: edits[start:end]}
+		h.aStart, h.bStart = lineStart(edits, start)
+		for _, e := range h.edits {
+			if e.op != '+' {
+				h.aLen++
+			}
+			if e.op != '-' {
+				h.bLen++
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// lineStart returns the 1-based a and b line numbers at edits[i].
+func lineStart(edits []edit, i int) (int, int) {
+	a, b := 0, 0
+	for _, e := range edits[:i] {
+		if e.op != '+' {
+			a++
+		}
+		if e.op != '-' {
+			b++
+		}
+	}
+	return a + 1, b + 1
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// fileDiff is the comparison of one pack entry with the tree.
+type fileDiff struct {
+	rel      string
+	status   string // "modified", "added" (only in the pack), "removed" (only in the tree)
+	old, new []string
+	edits    []edit
+	adds     int
+	dels     int
+}
+
+// diffOptions holds diff's flags.
+type diffOptions struct {
+	in         string
+	root       string
+	stat       bool
+	nameStatus bool
+	removed    bool
+	excl       string
+	incl       string
+	sideBySide bool
+	context    int
+	plain      bool
+	passFile   string
+	onlyIDs    stringList
+}
+
+// diffFlags declares diff's flags into o.
+func diffFlags(o *diffOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("diff", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file")
+	flg.StringVar(&o.root, "root", ".", "directory to compare the pack against")
+	flg.BoolVar(&o.stat, "stat", false, "only show a per-file summary of changed lines")
+	flg.BoolVar(&o.nameStatus, "name-status", false, "only list the files added, removed and modified, one per line")
+	flg.BoolVar(&o.removed, "removed", true, "also report files under --root the pack lacks, found as pack would find them with --exclude and --include")
+	flg.StringVar(&o.excl, "exclude", strings.Join(defaultExcludes, ","), "with --removed, comma-separated glob patterns the pack was made excluding")
+	flg.StringVar(&o.incl, "include", "", "with --removed, comma-separated glob patterns the pack was restricted to")
+	flg.BoolVar(&o.sideBySide, "side-by-side", false, "show changes in two columns instead of a unified diff")
+	flg.IntVar(&o.context, "context", 3, "lines of context around each change")
+	flg.BoolVar(&o.plain, "plain", false, "no colors and no pager")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the passphrase for encrypted entries from this file (default: $PACKPROMPT_PASSPHRASE)")
+	flg.Var(&o.onlyIDs, "only-id", "only compare the entry with this id (or a unique prefix of it); repeatable")
+	return flg
+}
+
+func diffCmd(args []string) {
+	var o diffOptions
+	flg := diffFlags(&o)
+	parseFlags(flg, args)
+
+	var only *idSelector
+	if len(o.onlyIDs) > 0 {
+		var err error
+		if only, err = newIDSelector(o.onlyIDs); err != nil {
+			fatal(err)
+		}
+	}
+
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+	f, err := os.Open(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	var diffs []fileDiff
+	packed := map[string]bool{}
+	err = readPack(f, func(pf packedFile) error {
+		if pf.attachment || (only != nil && !only.match(pf)) {
+			return nil
+		}
+		packed[pf.rel] = true
+		if archive, _, ok := strings.Cut(pf.rel, archiveSep); ok {
+			packed[archive] = true
+		}
+		if _, conv := pf.attrs[convertedAttr]; conv {
+			packed[strings.TrimSuffix(pf.rel, ".md")] = true
+		}
+		content, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: skipping encrypted %s (no passphrase)\n", pf.rel)
+			return nil
+		}
+		d := fileDiff{rel: pf.rel, status: "modified", new: splitLines(string(content))}
+		cur, err := os.ReadFile(filepath.Join(o.root, filepath.FromSlash(pf.rel)))
+		switch {
+		case errors.Is(err, iofs.ErrNotExist):
+			d.status = "added"
+		case err != nil:
+			return err
+		case string(cur) == string(content):
+			return nil
+		default:
+			d.old = splitLines(string(cur))
+		}
+		d.edits = lineDiff(d.old, d.new)
+		for _, e := range d.edits {
+			switch e.op {
+			case '+':
+				d.adds++
+			case '-':
+				d.dels++
+			}
+		}
+		diffs = append(diffs, d)
+		return nil
+	})
+	f.Close()
+	if err == nil && only != nil {
+		err = only.check()
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if o.removed && only == nil {
+		gone, err := removedFiles(o.root, o.in, packed, parseExcludes(o.excl), parseExcludes(o.incl))
+		if err != nil {
+			fatal(err)
+		}
+		diffs = append(diffs, gone...)
+	}
+
+	out := newHumanOutput(o.plain)
+	defer out.close()
+	switch {
+	case o.nameStatus:
+		printNameStatus(out, diffs)
+	case o.stat:
+		printDiffStat(out, diffs)
+	case o.sideBySide:
+		width := 160
+		if cols, _, err := terminalSize(os.Stdout.Fd()); err == nil && cols > 40 {
+			width = cols
+		}
+		for _, d := range diffs {
+			printSideBySide(out, d, o.context, width)
+		}
+	default:
+		for _, d := range diffs {
+			printUnified(out, d, o.context)
+		}
+	}
+}
+
+// removedFiles reports the files under root that pack, walking it with
+// excludes and includes, would have packed but the pack does not hold.
+func removedFiles(root, in string, packed map[string]bool, excludes, includes []string) ([]fileDiff, error) {
+	entries, err := collectEntries(root, excludes, walkOptions{outputs: outputPaths(in, "")}, &omissions{})
+	if err != nil {
+		return nil, err
+	}
+	var diffs []fileDiff
+	for _, e := range entries {
+		if packed[e.rel] || (len(includes) > 0 && !included(e, includes)) {
+			continue
+		}
+		cur, err := readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		d := fileDiff{rel: e.rel, status: "removed", old: splitLines(string(cur))}
+		d.edits = lineDiff(d.old, nil)
+		d.dels = len(d.old)
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// printNameStatus lists each file with a status letter, as git diff
+// --name-status does: A added, D removed, M modified.
+func printNameStatus(out *humanOutput, diffs []fileDiff) {
+	for _, d := range diffs {
+		switch d.status {
+		case "added":
+			fmt.Fprintln(out, out.paint(styleGreen, "A")+"\t"+d.rel)
+		case "removed":
+			fmt.Fprintln(out, out.paint(styleRed, "D")+"\t"+d.rel)
+		default:
+			fmt.Fprintln(out, out.paint(styleYellow, "M")+"\t"+d.rel)
+		}
+	}
+}
+
+func printUnified(out *humanOutput, d fileDiff, context int) {
+	from, to := "a/"+d.rel, "b/"+d.rel
+	switch d.status {
+	case "added":
+		from = "/dev/null"
+	case "removed":
+		to = "/dev/null"
+	}
+	fmt.Fprintln(out, out.paint(styleBold, "diff --packprompt a/"+d.rel+" b/"+d.rel))
+	switch d.status {
+	case "added":
+		fmt.Fprintln(out, out.paint(styleBold, "new file"))
+	case "removed":
+		fmt.Fprintln(out, out.paint(styleBold, "deleted file"))
+	}
+	fmt.Fprintln(out, out.paint(styleBold, "--- "+from))
+	fmt.Fprintln(out, out.paint(styleBold, "+++ "+to))
+	for _, h := range makeHunks(d.edits, context) {
+		fmt.Fprintln(out, out.paint(styleCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.aStart, h.aLen, h.bStart, h.bLen)))
+		for _, e := range h.edits {
+			switch e.op {
+			case ' ':
+				fmt.Fprintln(out, " "+d.old[e.ai])
+			case '-':
+				fmt.Fprintln(out, out.paint(styleRed, "-"+d.old[e.ai]))
+			case '+':
+				fmt.Fprintln(out, out.paint(styleGreen, "+"+d.new[e.bi]))
+			}
+		}
+	}
+}
+
+func printSideBySide(out *humanOutput, d fileDiff, context, width int) {
+	col := (width - 3) / 2
+	fmt.Fprintln(out, out.paint(styleBold, fmt.Sprintf("%s (%s)", d.rel, d.status)))
+	for _, h := range makeHunks(d.edits, context) {
+		fmt.Fprintln(out, out.paint(styleCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.aStart, h.aLen, h.bStart, h.bLen)))
+		// pair each run of deletions with the insertions that follow it
+		for i := 0; i < len(h.edits); {
+			if h.edits[i].op == ' ' {
+				l := d.old[h.edits[i].ai]
+				fmt.Fprintln(out, padCol(l, col)+" │ "+clip(l, col))
+				i++
+				continue
+			}
+			var dels, adds []string
+			for i < len(h.edits) && h.edits[i].op == '-' {
+				dels = append(dels, d.old[h.edits[i].ai])
+				i++
+			}
+			for i < len(h.edits) && h.edits[i].op == '+' {
+				adds = append(adds, d.new[h.edits[i].bi])
+				i++
+			}
+			for j := 0; j < max(len(dels), len(adds)); j++ {
+				left, right := padCol("", col), ""
+				if j < len(dels) {
+					left = out.paint(styleRed, padCol(dels[j], col))
+				}
+				if j < len(adds) {
+					right = out.paint(styleGreen, clip(adds[j], col))
+				}
+				mark := " │ "
+				switch {
+				case j < len(dels) && j < len(adds):
+					mark = " " + out.paint(styleYellow, "|") + " "
+				case j < len(dels):
+					mark = " " + out.paint(styleRed, "<") + " "
+				default:
+					mark = " " + out.paint(styleGreen, ">") + " "
+				}
+				fmt.Fprintln(out, left+mark+right)
+			}
+		}
+	}
+	fmt.Fprintln(out)
+}
+
+func padCol(s string, n int) string {
+	s = clip(strings.ReplaceAll(s, "\t", "    "), n)
+	return s + strings.Repeat(" ", n-utf8.RuneCountInString(s))
+}
+
+func printDiffStat(out *humanOutput, diffs []fileDiff) {
+	nameW, maxChange := 0, 0
+	adds, dels := 0, 0
+	for _, d := range diffs {
+		nameW = max(nameW, utf8.RuneCountInString(d.rel))
+		maxChange = max(maxChange, d.adds+d.dels)
+		adds += d.adds
+		dels += d.dels
+	}
+	const barW = 50
+	for _, d := range diffs {
+		plus, minus := d.adds, d.dels
+		if maxChange > barW {
+			// scale like git, keeping at least one mark for any change
+			plus = (d.adds*barW + maxChange - 1) / maxChange
+			minus = (d.dels*barW + maxChange - 1) / maxChange
+		}
+		name := d.rel + strings.Repeat(" ", nameW-utf8.RuneCountInString(d.rel))
+		fmt.Fprintf(out, " %s | %5d %s%s\n", name, d.adds+d.dels,
+			out.paint(styleGreen, strings.Repeat("+", plus)), out.paint(styleRed, strings.Repeat("-", minus)))
+	}
+	// like git: singular for one, and a zero count left out unless both are
+	summary := " " + plural(len(diffs), "file") + " changed"
+	if adds > 0 || dels == 0 {
+		summary += ", " + plural(adds, "insertion") + "(+)"
+	}
+	if dels > 0 || adds == 0 {
+		summary += ", " + plural(dels, "deletion") + "(-)"
+	}
+	fmt.Fprintln(out, summary)
+}
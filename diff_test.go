@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestDiffStatSummary checks --stat's last line counts like git's.
+func TestDiffStatSummary(t *testing.T) {
+	for _, c := range []struct {
+		diffs []fileDiff
+		want  string
+	}{
+		{[]fileDiff{{rel: "a", adds: 1, dels: 1}}, " 1 file changed, 1 insertion(+), 1 deletion(-)"},
+		{[]fileDiff{{rel: "a", adds: 2}, {rel: "b", adds: 1}}, " 2 files changed, 3 insertions(+)"},
+		{[]fileDiff{{rel: "a", dels: 1}}, " 1 file changed, 1 deletion(-)"},
+		{[]fileDiff{{rel: "a"}}, " 1 file changed, 0 insertions(+), 0 deletions(-)"},
+	} {
+		var b strings.Builder
+		printDiffStat(&humanOutput{w: &b}, c.diffs)
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		if got := lines[len(lines)-1]; got != c.want {
+			t.Errorf("summary is %q, want %q", got, c.want)
+		}
+	}
+}
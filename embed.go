@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Chunks are what gets embedded; a file scores as its best chunk.
+const (
+	embedChunkLines = 60
+	embedChunkBytes = 6000
+	embedBatch      = 64
+)
+
+// embedder talks to an OpenAI-compatible /embeddings endpoint. That covers
+// hosted APIs as well as local servers such as Ollama or llama.cpp
+// (http://localhost:11434/v1).
+type embedder struct {
+	url, model, key string
+
+	cachePath string
+	cache     map[string][]float32 // sha256(chunk) -> vector
+	dirty     bool
+}
+
+func newEmbedder(url, model string) *embedder {
+	e := &embedder{
+		url:   strings.TrimRight(url, "/"),
+		model: model,
+		key:   apiKey("PACKPROMPT_EMBED_KEY"),
+		cache: map[string][]float32{},
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		id := sha256.Sum256([]byte(e.url + "\x00" + e.model))
+		e.cachePath = filepath.Join(dir, "packprompt", "embeddings-"+hex.EncodeToString(id[:8])+".json")
+		if data, err := os.ReadFile(e.cachePath); err == nil {
+			_ = json.Unmarshal(data, &e.cache)
+		}
+	}
+	return e
+}
+
+// embed returns one vector per text, asking the endpoint only for texts
+// missing from the cache.
+func (e *embedder) embed(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	var todo []int
+	for i, t := range texts {
+		if v, ok := e.cache[chunkKey(t)]; ok {
+			out[i] = v
+		} else {
+			todo = append(todo, i)
+		}
+	}
+	for len(todo) > 0 {
+		n := min(len(todo), embedBatch)
+		batch := todo[:n]
+		todo = todo[n:]
+		inputs := make([]string, len(batch))
+		for j, i := range batch {
+			inputs[j] = texts[i]
+		}
+		vecs, err := e.request(inputs)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range batch {
+			out[i] = vecs[j]
+			e.cache[chunkKey(texts[i])] = vecs[j]
+			e.dirty = true
+		}
+	}
+	return out, nil
+}
+
+func (e *embedder) request(inputs []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": e.model, "input": inputs})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if e.key != "" {
+		headers["Authorization"] = "Bearer " + e.key
+	}
+	data, err := httpPost(e.url+"/embeddings", body, headers)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("embeddings: %w", err)
+	}
+	if len(resp.Data) != len(inputs) {
+		return nil, fmt.Errorf("embeddings: got %d vectors for %d inputs", len(resp.Data), len(inputs))
+	}
+	vecs := make([][]float32, len(inputs))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(inputs) {
+			return nil, fmt.Errorf("embeddings: vector index %d out of range", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
+
+// save writes new vectors back to the cache; failures only cost a re-embed.
+func (e *embedder) save() {
+	if !e.dirty || e.cachePath == "" {
+		return
+	}
+	data, err := json.Marshal(e.cache)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.cachePath), 0o755); err != nil {
+		return
+	}
+	tmp := e.cachePath + ".tmp"
+	if os.WriteFile(tmp, data, 0o644) == nil {
+		_ = os.Rename(tmp, e.cachePath)
+	}
+}
+
+func chunkKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkText splits content into pieces of at most embedChunkLines lines and
+// embedChunkBytes bytes, each prefixed by the path so the model sees where it
+// comes from.
+func chunkText(rel string, data []byte) []string {
+	var chunks []string
+	lines := strings.SplitAfter(string(data), "\n")
+	var b strings.Builder
+	count := 0
+	flush := func() {
+		if strings.TrimSpace(b.String()) != "" {
+			chunks = append(chunks, rel+"\n"+b.String())
+		}
+		b.Reset()
+		count = 0
+	}
+	for _, l := range lines {
+		if len(l) > embedChunkBytes {
+			l = l[:embedChunkBytes]
+		}
+		if count == embedChunkLines || b.Len()+len(l) > embedChunkBytes {
+			flush()
+		}
+		b.WriteString(l)
+		count++
+	}
+	flush()
+	if len(chunks) == 0 {
+		chunks = []string{rel}
+	}
+	return chunks
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// selectByEmbedding keeps the top files most similar to query, best first.
+// A file's similarity is that of its closest chunk.
+func selectByEmbedding(entries []entry, query string, top int, emb *embedder, om *omissions) ([]entry, error) {
+	defer emb.save()
+	var texts []string
+	owner := []int{}
+	for i, e := range entries {
+		data, err := readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range chunkText(e.rel, data) {
+			texts = append(texts, c)
+			owner = append(owner, i)
+		}
+	}
+	vecs, err := emb.embed(append(texts, query))
+	if err != nil {
+		return nil, err
+	}
+	q := vecs[len(vecs)-1]
+	best := make([]float64, len(entries))
+	for i := range best {
+		best[i] = -2
+	}
+	for c, v := range vecs[:len(texts)] {
+		best[owner[c]] = math.Max(best[owner[c]], cosine(q, v))
+	}
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return best[idx[a]] > best[idx[b]] })
+	kept := make([]entry, 0, min(top, len(entries)))
+	for n, i := range idx {
+		if n >= top {
+			om.add(entries[i].rel, entries[i].size, fmt.Sprintf("below the top %d files by embedding similarity", top))
+			continue
+		}
+		kept = append(kept, entries[i])
+	}
+	return kept, nil
+}
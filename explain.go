@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// explainCmd reports, for each PATH, the rules pack checks in order and the
+// one that decided whether the file is packed, like git check-ignore -v.
+// It selects through selectEntries, so the answer comes from the same
+// walk, filters and config pack uses, and writes nothing.
+func explainCmd(args []string) {
+	var o packOptions
+	flg := packFlags(&o)
+	parseFlags(flg, args)
+	if flg.NArg() == 0 {
+		fatal(errors.New("usage: packprompt explain [pack flags] PATH..."))
+	}
+	sel := selectEntries(&o)
+	pw := newPackWriter(&o, flg, sel, nil, nil)
+	fitSelection(&o, &pw, sel)
+	x := &explainer{root: o.root, excludes: sel.excludes, walkOptions: sel.walk, entries: sel.entries, om: sel.om}
+	for _, p := range flg.Args() {
+		if err := x.explain(os.Stdout, p); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// explainer answers for one pack run: its excludes, how it walked the tree
+// and what it kept and left out.
+type explainer struct {
+	root     string
+	excludes []string
+	walkOptions
+	entries []entry
+	om      *omissions
+}
+
+// resolve turns a command-line path into one relative to the pack root:
+// paths under the root as given, anything else as already root-relative.
+func (x *explainer) resolve(p string) (string, error) {
+	absRoot, err := filepath.Abs(x.root)
+	if err != nil {
+		return "", err
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		if rel, ok := relToRoot(abs, absRoot); ok {
+			return rel, nil
+		}
+	}
+	if rel, ok := relToRoot(p, absRoot); ok && !filepath.IsAbs(p) {
+		return rel, nil
+	}
+	return "", fmt.Errorf("%s is outside --root %s", p, x.root)
+}
+
+func (x *explainer) explain(w io.Writer, p string) error {
+	rel, err := x.resolve(p)
+	if err != nil {
+		return err
+	}
+	verdict := x.verdict(rel)
+	fmt.Fprintf(w, "%s: %s\n", rel, verdict)
+	step := 0
+	rule := func(name, result string) {
+		step++
+		fmt.Fprintf(w, "  %d. %-10s %s\n", step, name, result)
+	}
+
+	// the walk, in collectEntries' order
+	dirs := strings.Split(rel, "/")
+	excluded := ""
+	for i := range dirs {
+		sub := strings.Join(dirs[:i+1], "/")
+		if pat, ok := packprompt.MatchExclude(sub, x.excludes); ok {
+			what := "path"
+			if i < len(dirs)-1 {
+				what = "directory " + sub + "/"
+			}
+			excluded = fmt.Sprintf("%s matches %q", what, pat)
+			break
+		}
+	}
+	if excluded != "" {
+		rule("exclude", excluded+" (--exclude)")
+		return nil
+	}
+	rule("exclude", fmt.Sprintf("none of the %d patterns matches", len(x.excludes)))
+
+	full := filepath.Join(x.root, filepath.FromSlash(rel))
+	info, err := os.Lstat(full)
+	if err == nil {
+		if kind, ok := isLinkEntry(full, iofs.FileInfoToDirEntry(info)); ok {
+			target, terr := os.Stat(full)
+			switch {
+			case x.links == linksSkip:
+				rule("link", "a "+kind+", left out (--links skip)")
+				return nil
+			case x.links != linksFollow:
+				rule("link", "a "+kind+", listed in the omitted section, not followed (--links record)")
+				return nil
+			case terr != nil:
+				rule("link", "a "+kind+" to a missing or unreadable target")
+				return nil
+			case target.IsDir():
+				rule("link", "a "+kind+" to a directory, walked under "+rel+"/ unless the walk already covers it (--links follow)")
+				return nil
+			}
+			rule("link", "a "+kind+", its target packed (--links follow)")
+			info = target
+		}
+	}
+	switch {
+	case err != nil:
+		rule("file", "not found under --root")
+		return nil
+	case !info.Mode().IsRegular():
+		rule("file", "not a regular file ("+info.Mode().Type().String()+")")
+		return nil
+	}
+	if abs, err := filepath.Abs(full); err == nil {
+		for _, o := range x.outputs {
+			if abs == o || abs == o+lockSuffix || abs == o+tmpSuffix {
+				rule("output", "is the pack being written (--out)")
+				return nil
+			}
+		}
+	}
+	rule("file", fmt.Sprintf("regular file, %s", humanSize(info.Size())))
+	if c := findConverter(x.convs, rel); c != nil {
+		rule("convert", "packed as its "+c.name+" conversion "+rel+".md (--convert), when it converts")
+		return x.pipeline(rule, rel+".md")
+	}
+	head, err := sniffFile(full)
+	switch {
+	case err != nil:
+		rule("content", "unreadable: "+err.Error())
+		return nil
+	case packprompt.IsPackOutput(head):
+		rule("content", "an earlier packprompt output")
+		return nil
+	}
+	if kind := archiveKind(rel); x.archives && kind != "" {
+		rule("archive", "a "+kind+" archive; its members are packed under "+rel+archiveSep+" (--descend-archives)")
+		return nil
+	}
+	switch {
+	case packprompt.IsBinary(head) && x.base64:
+		rule("content", "binary, packed base64-encoded (--binary base64)")
+		return x.pipeline(rule, rel)
+	case packprompt.IsBinary(head):
+		rule("content", "binary")
+		return nil
+	}
+	rule("content", "text")
+	return x.pipeline(rule, rel)
+}
+
+// pipeline reports the selection filters, budgets and rewrites after the walk.
+func (x *explainer) pipeline(rule func(string, string), rel string) error {
+	if o, ok := x.omission(rel); ok {
+		rule("select", o.Reason)
+		return nil
+	}
+	for _, e := range x.entries {
+		if e.rel == rel {
+			result := "kept by every filter and budget"
+			if len(e.attrs) > 0 {
+				result += " (" + strings.Join(e.attrs, " ") + ")"
+			}
+			rule("select", result)
+			return nil
+		}
+	}
+	rule("select", "not reached: the walk did not get there (e.g. --pr or --files-from lists other files)")
+	return nil
+}
+
+// verdict is the outcome the pack run recorded for rel.
+func (x *explainer) verdict(rel string) string {
+	for _, e := range x.entries {
+		if e.rel == rel || e.rel == rel+".md" || strings.HasPrefix(e.rel, rel+archiveSep) {
+			return "packed"
+		}
+	}
+	if o, ok := x.omission(rel); ok {
+		return "left out: " + o.Reason
+	}
+	return "not packed"
+}
+
+// omission finds why rel, or a directory holding it, was left out.
+func (x *explainer) omission(rel string) (omission, bool) {
+	for _, o := range x.om.list {
+		if o.Path == rel || o.Path == rel+".md" || (strings.HasSuffix(o.Path, "/") && strings.HasPrefix(rel, o.Path)) {
+			return o, true
+		}
+	}
+	return omission{}, false
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExplain checks explain reports the deciding rule for a packed and
+// an excluded path, without running hooks, fetching attachments or
+// writing a skip report.
+func TestExplain(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n", "vendor/v.go": "package v\n"})
+	dir := t.TempDir()
+	report, hooked := filepath.Join(dir, "skipped.txt"), filepath.Join(dir, "hooked")
+	res := runCLI(t, src, "explain", "--exclude", "vendor", "--pre-pack", "touch "+hooked,
+		"--attach", filepath.Join(src, "missing.md"), "--skip-report", report, "a.txt", "vendor/v.go")
+	if res.code != 0 {
+		t.Fatalf("explain: exit %d: %s", res.code, res.stderr)
+	}
+	for _, want := range []string{"a.txt: packed", `vendor/v.go: left out: excluded by "vendor"`} {
+		if !strings.Contains(res.stdout, want) {
+			t.Errorf("no %q in\n%s", want, res.stdout)
+		}
+	}
+	for _, p := range []string{report, hooked} {
+		if _, err := os.Stat(p); err == nil {
+			t.Errorf("explain wrote %s", filepath.Base(p))
+		}
+	}
+	if res := runCLI(t, src, "explain"); res.code != 1 || !strings.Contains(res.stderr, "usage: packprompt explain") {
+		t.Errorf("explain without a path: exit %d: %s", res.code, res.stderr)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// chunk is one piece of a file as written by export --format chunks.
+type chunk struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Language  string `json:"language,omitempty"`
+	Index     int    `json:"chunk"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+	Text      string `json:"text"`
+}
+
+// exportOptions holds export's flags.
+type exportOptions struct {
+	in              string
+	out             string
+	format          string
+	chunkTokens     int
+	overlap         int
+	withAttachments bool
+	passFile        string
+}
+
+// exportFlags declares export's flags into o.
+func exportFlags(o *exportOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("export", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file")
+	flg.StringVar(&o.out, "out", "-", "output file (- for stdout)")
+	flg.StringVar(&o.format, "format", "chunks", "output format: chunks, langchain or llamaindex (all JSON lines)")
+	flg.IntVar(&o.chunkTokens, "chunk-tokens", 800, "approximate tokens per chunk (langchain/llamaindex: whole files unless set)")
+	flg.IntVar(&o.overlap, "overlap", 100, "approximate tokens shared between consecutive chunks")
+	flg.BoolVar(&o.withAttachments, "attachments", false, "also export attached context documents")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the passphrase for encrypted entries from this file (default: $PACKPROMPT_PASSPHRASE)")
+	return flg
+}
+
+func exportCmd(args []string) {
+	var o exportOptions
+	flg := exportFlags(&o)
+	parseFlags(flg, args)
+
+	if o.format != "chunks" && o.format != "langchain" && o.format != "llamaindex" {
+		fatal(fmt.Errorf("invalid --format %q: want chunks, langchain or llamaindex", o.format))
+	}
+	split := o.format == "chunks"
+	flg.Visit(func(f *flag.Flag) {
+		if f.Name == "chunk-tokens" {
+			split = true
+		}
+	})
+	if o.chunkTokens <= 0 || o.overlap < 0 || o.overlap >= o.chunkTokens {
+		fatal(fmt.Errorf("invalid chunking: want --chunk-tokens > --overlap >= 0"))
+	}
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+
+	f, err := os.Open(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = os.Stdout
+	if o.out != "-" {
+		outf, err := os.Create(o.out)
+		if err != nil {
+			fatal(err)
+		}
+		defer outf.Close()
+		w = outf
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	n := 0
+	err = readPack(f, func(pf packedFile) error {
+		if pf.attachment && !o.withAttachments {
+			return nil
+		}
+		content, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: skipping encrypted %s (no passphrase)\n", pf.rel)
+			return nil
+		}
+		size := o.chunkTokens
+		if !split {
+			size = int(^uint(0) >> 1)
+		}
+		for _, c := range chunkFile(pf.rel, string(content), size, o.overlap) {
+			if err := enc.Encode(exportRecord(o.format, c)); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if o.out != "-" {
+		fmt.Printf("Exported %d chunks to %s\n", n, o.out)
+	}
+}
+
+// exportRecord shapes a chunk for format: chunks as is, langchain as a
+// Document (page_content + metadata), llamaindex as a TextNode (id_, text,
+// metadata).
+func exportRecord(format string, c chunk) any {
+	meta := map[string]any{
+		"source":     c.Path,
+		"chunk":      c.Index,
+		"start_line": c.StartLine,
+		"end_line":   c.EndLine,
+	}
+	if c.Language != "" {
+		meta["language"] = c.Language
+	}
+	switch format {
+	case "langchain":
+		return map[string]any{"page_content": c.Text, "metadata": meta, "type": "Document"}
+	case "llamaindex":
+		meta["file_path"] = c.Path
+		return map[string]any{"id_": c.ID, "text": c.Text, "metadata": meta}
+	}
+	return c
+}
+
+// chunkFile splits content on line boundaries into chunks of about size
+// tokens; each chunk repeats up to overlap tokens of trailing lines from the
+// previous one. A single line longer than size becomes its own chunk.
+func chunkFile(rel, content string, size, overlap int) []chunk {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	tok := make([]int, len(lines))
+	for i, l := range lines {
+		tok[i] = estimateTokens(l)
+	}
+	lang := detectLanguage(rel)
+	var chunks []chunk
+	for start := 0; start < len(lines); {
+		end, sum := start, 0
+		for end < len(lines) && (end == start || sum+tok[end] <= size) {
+			sum += tok[end]
+			end++
+		}
+		text := strings.Join(lines[start:end], "")
+		chunks = append(chunks, chunk{
+			ID:        fmt.Sprintf("%s#%d", rel, len(chunks)),
+			Path:      rel,
+			Language:  lang,
+			Index:     len(chunks),
+			StartLine: start + 1,
+			EndLine:   end,
+			Tokens:    estimateTokens(text),
+			Text:      text,
+		})
+		if end == len(lines) {
+			break
+		}
+		next, shared := end, 0
+		for next > start+1 && shared+tok[next-1] <= overlap {
+			shared += tok[next-1]
+			next--
+		}
+		start = next
+	}
+	return chunks
+}
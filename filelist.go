@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// readFileList reads newline-separated paths from src ("-" for stdin) and
+// returns them relative to root, slash-separated. Bazel labels (//pkg:file)
+// are accepted too, so query output can be piped in directly.
+func readFileList(src, root string) (map[string]bool, error) {
+	var r io.Reader = os.Stdin
+	if src != "-" {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		p := strings.TrimSpace(sc.Text())
+		if p == "" || strings.HasPrefix(p, "@") {
+			continue
+		}
+		if lp, ok := bazelLabelPath(p); ok {
+			set[lp] = true
+			continue
+		}
+		if rel, ok := relToRoot(p, absRoot); ok {
+			set[rel] = true
+		}
+	}
+	return set, sc.Err()
+}
+
+func relToRoot(p, absRoot string) (string, bool) {
+	if filepath.IsAbs(p) {
+		rel, err := filepath.Rel(absRoot, p)
+		if err != nil {
+			return "", false
+		}
+		p = rel
+	}
+	p = path.Clean(filepath.ToSlash(strings.TrimPrefix(p, "./")))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+// bazelSources asks bazel for the source files of target's transitive deps
+// within the main repository, as paths relative to root.
+func bazelSources(root, target string) (map[string]bool, error) {
+	out, err := runIn(root, "bazel", "query", "--output=label", fmt.Sprintf(`kind("source file", deps(%s))`, target))
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	for _, label := range strings.Split(out, "\n") {
+		if p, ok := bazelLabelPath(strings.TrimSpace(label)); ok {
+			set[p] = true
+		}
+	}
+	return set, nil
+}
+
+// bazelLabelPath turns //pkg/sub:file.go into pkg/sub/file.go. Labels in
+// external repositories (@foo//...) are not part of this tree.
+func bazelLabelPath(label string) (string, bool) {
+	if !strings.HasPrefix(label, "//") {
+		return "", false
+	}
+	pkg, name, ok := strings.Cut(strings.TrimPrefix(label, "//"), ":")
+	if !ok {
+		return "", false
+	}
+	return path.Join(pkg, name), true
+}
+
+// restrictTo keeps only listed entries and reports listed paths left out.
+func restrictTo(entries []entry, listed map[string]bool, om *omissions, reason string) []entry {
+	entries = filterEntries(entries, om, reason, func(e entry) bool { return listed[e.rel] })
+	warnUnlisted(listed, entries)
+	return entries
+}
+
+// warnUnlisted reports listed paths that did not make it into the pack.
+func warnUnlisted(listed map[string]bool, entries []entry) {
+	packed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		packed[e.rel] = true
+	}
+	var missing []string
+	for p := range listed {
+		if !packed[p] {
+			missing = append(missing, p)
+		}
+	}
+	sort.Strings(missing)
+	for _, p := range missing {
+		fmt.Fprintf(os.Stderr, "Warning: listed file not packed (missing, excluded or binary): %s\n", p)
+	}
+}
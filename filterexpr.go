@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// A --filter expression is checked per file, after the walk and the other
+// selection filters:
+//
+//	size < 100KB && lang == "go" && !path.contains("mock")
+//
+// Fields are path, name, dir, ext and lang (strings), size, lines and age
+// (numbers; age in seconds since modification) and converted (bool).
+// Numbers take size units (B, KB, MB, GB) or age units (s, h, d, w), so
+// age < 3d works. Strings have contains, startsWith, endsWith, glob and
+// matches (a regexp) methods. Operators are ! && || == != < <= > >= and
+// parentheses. Expressions are type-checked when parsed.
+
+type exprKind int
+
+const (
+	kindString exprKind = iota
+	kindNumber
+	kindBool
+)
+
+func (k exprKind) String() string {
+	return [...]string{"string", "number", "bool"}[k]
+}
+
+// fileFacts is what an expression sees of one file; lines is counted on
+// first use.
+type fileFacts struct {
+	e     entry
+	now   time.Time
+	lines int
+}
+
+func (f *fileFacts) field(name string) any {
+	switch name {
+	case "path":
+		return f.e.rel
+	case "name":
+		return path.Base(f.e.rel)
+	case "dir":
+		return path.Dir(f.e.rel)
+	case "ext":
+		return strings.TrimPrefix(path.Ext(f.e.rel), ".")
+	case "lang":
+		return detectLanguage(f.e.rel)
+	case "size":
+		return float64(f.e.size)
+	case "age":
+		return f.now.Sub(f.e.modTime).Seconds()
+	case "converted":
+		return hasAttr(f.e.attrs, convertedAttr)
+	case "lines":
+		if f.lines < 0 {
+			f.lines = 0
+			if data, err := readEntry(f.e); err == nil && len(data) > 0 {
+				f.lines = bytes.Count(data, []byte("\n"))
+				if data[len(data)-1] != '\n' {
+					f.lines++
+				}
+			}
+		}
+		return float64(f.lines)
+	}
+	panic("unknown field " + name)
+}
+
+var exprFields = map[string]exprKind{
+	"path": kindString, "name": kindString, "dir": kindString, "ext": kindString, "lang": kindString,
+	"size": kindNumber, "lines": kindNumber, "age": kindNumber, "converted": kindBool,
+}
+
+// exprNode is a compiled expression.
+type exprNode struct {
+	kind exprKind
+	eval func(*fileFacts) any
+}
+
+// fileFilter is a parsed --filter.
+type fileFilter struct {
+	src  string
+	root exprNode
+}
+
+func (f *fileFilter) match(e entry, now time.Time) bool {
+	return f.root.eval(&fileFacts{e: e, now: now, lines: -1}).(bool)
+}
+
+func parseFilter(src string) (*fileFilter, error) {
+	toks, err := lexFilter(src)
+	if err != nil {
+		return nil, fmt.Errorf("--filter: %w", err)
+	}
+	p := &filterParser{toks: toks}
+	n, err := p.or()
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.errorf("unexpected %s", p.peek())
+	}
+	if err == nil && n.kind != kindBool {
+		err = fmt.Errorf("the expression is a %s, not a condition", n.kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("--filter %q: %w", src, err)
+	}
+	return &fileFilter{src: src, root: n}, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type exprToken struct {
+	kind tokKind
+	text string
+	num  float64
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+var exprUnits = map[string]float64{
+	"": 1, "b": 1, "k": 1 << 10, "kb": 1 << 10, "m": 1 << 20, "mb": 1 << 20, "g": 1 << 30, "gb": 1 << 30,
+	"s": 1, "h": 3600, "d": 86400, "w": 7 * 86400,
+}
+
+func lexFilter(src string) ([]exprToken, error) {
+	var toks []exprToken
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(src) && rune(src[j]) != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				b.WriteByte(src[j])
+			}
+			if j == len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i+1)
+			}
+			toks = append(toks, exprToken{kind: tokString, text: b.String(), pos: i})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			k := j
+			for k < len(src) && unicode.IsLetter(rune(src[k])) {
+				k++
+			}
+			n, err := strconv.ParseFloat(src[i:j], 64)
+			unit, ok := exprUnits[strings.ToLower(src[j:k])]
+			if err != nil || !ok {
+				return nil, fmt.Errorf("bad number %q at %d", src[i:k], i+1)
+			}
+			toks = append(toks, exprToken{kind: tokNumber, text: src[i:k], num: n * unit, pos: i})
+			i = k
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			toks = append(toks, exprToken{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ".", ","} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i+1)
+			}
+			toks = append(toks, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, exprToken{kind: tokEOF, pos: len(src)}), nil
+}
+
+type filterParser struct {
+	toks []exprToken
+	i    int
+}
+
+func (p *filterParser) peek() exprToken { return p.toks[p.i] }
+
+func (p *filterParser) next() exprToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) or() (exprNode, error) {
+	return p.logical("||", p.and)
+}
+
+func (p *filterParser) and() (exprNode, error) {
+	return p.logical("&&", p.unary)
+}
+
+// logical parses operand (op operand)*, short-circuiting like Go.
+func (p *filterParser) logical(op string, operand func() (exprNode, error)) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return left, err
+	}
+	for p.accept(op) {
+		right, err := operand()
+		if err != nil {
+			return right, err
+		}
+		if left.kind != kindBool || right.kind != kindBool {
+			return left, p.errorf("%s needs conditions on both sides", op)
+		}
+		l, r := left.eval, right.eval
+		if op == "&&" {
+			left.eval = func(f *fileFacts) any { return l(f).(bool) && r(f).(bool) }
+		} else {
+			left.eval = func(f *fileFacts) any { return l(f).(bool) || r(f).(bool) }
+		}
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (exprNode, error) {
+	if p.accept("!") {
+		n, err := p.unary()
+		if err != nil {
+			return n, err
+		}
+		if n.kind != kindBool {
+			return n, p.errorf("! needs a condition, not a %s", n.kind)
+		}
+		inner := n.eval
+		return exprNode{kindBool, func(f *fileFacts) any { return !inner(f).(bool) }}, nil
+	}
+	return p.comparison()
+}
+
+func (p *filterParser) comparison() (exprNode, error) {
+	left, err := p.primary()
+	if err != nil {
+		return left, err
+	}
+	t := p.peek()
+	if t.kind != tokOp || !contains([]string{"==", "!=", "<", "<=", ">", ">="}, t.text) {
+		return left, nil
+	}
+	p.next()
+	right, err := p.primary()
+	if err != nil {
+		return right, err
+	}
+	if left.kind != right.kind {
+		return left, fmt.Errorf("at %d: cannot compare a %s with a %s", t.pos+1, left.kind, right.kind)
+	}
+	if left.kind == kindBool && t.text != "==" && t.text != "!=" {
+		return left, fmt.Errorf("at %d: %s does not apply to conditions", t.pos+1, t.text)
+	}
+	l, r, op := left.eval, right.eval, t.text
+	return exprNode{kindBool, func(f *fileFacts) any { return compareValues(l(f), r(f), op) }}, nil
+}
+
+func compareValues(a, b any, op string) bool {
+	var c int
+	switch a := a.(type) {
+	case string:
+		c = strings.Compare(a, b.(string))
+	case float64:
+		switch b := b.(float64); {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	case bool:
+		if a != b.(bool) {
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func (p *filterParser) primary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return exprNode{kindNumber, func(*fileFacts) any { return t.num }}, nil
+	case tokString:
+		return exprNode{kindString, func(*fileFacts) any { return t.text }}, nil
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.or()
+			if err != nil {
+				return n, err
+			}
+			if !p.accept(")") {
+				return n, p.errorf("missing )")
+			}
+			return n, nil
+		}
+	case tokIdent:
+		if t.text == "true" || t.text == "false" {
+			v := t.text == "true"
+			return exprNode{kindBool, func(*fileFacts) any { return v }}, nil
+		}
+		kind, ok := exprFields[t.text]
+		if !ok {
+			return exprNode{}, fmt.Errorf("at %d: unknown field %q (fields: path, name, dir, ext, lang, size, lines, age, converted)", t.pos+1, t.text)
+		}
+		name := t.text
+		n := exprNode{kind, func(f *fileFacts) any { return f.field(name) }}
+		for p.accept(".") {
+			var err error
+			if n, err = p.method(n); err != nil {
+				return n, err
+			}
+		}
+		return n, nil
+	}
+	return exprNode{}, fmt.Errorf("at %d: unexpected %s", t.pos+1, t)
+}
+
+// method parses a string method call after the dot.
+func (p *filterParser) method(recv exprNode) (exprNode, error) {
+	t := p.next()
+	if t.kind != tokIdent {
+		return recv, fmt.Errorf("at %d: want a method name after .", t.pos+1)
+	}
+	if recv.kind != kindString {
+		return recv, fmt.Errorf("at %d: a %s has no methods", t.pos+1, recv.kind)
+	}
+	if !p.accept("(") {
+		return recv, p.errorf("want ( after %s", t.text)
+	}
+	arg := p.next()
+	if arg.kind != tokString {
+		return recv, fmt.Errorf("at %d: %s takes a string", arg.pos+1, t.text)
+	}
+	if !p.accept(")") {
+		return recv, p.errorf("%s takes one argument", t.text)
+	}
+	s, want := recv.eval, arg.text
+	var test func(string) bool
+	switch t.text {
+	case "contains":
+		test = func(v string) bool { return strings.Contains(v, want) }
+	case "startsWith":
+		test = func(v string) bool { return strings.HasPrefix(v, want) }
+	case "endsWith":
+		test = func(v string) bool { return strings.HasSuffix(v, want) }
+	case "glob":
+		test = func(v string) bool { return packprompt.Match(want, v) }
+	case "matches":
+		re, err := regexp.Compile(want)
+		if err != nil {
+			return recv, fmt.Errorf("at %d: %w", arg.pos+1, err)
+		}
+		test = re.MatchString
+	default:
+		return recv, fmt.Errorf("at %d: unknown method %q (methods: contains, startsWith, endsWith, glob, matches)", t.pos+1, t.text)
+	}
+	return exprNode{kindBool, func(f *fileFacts) any { return test(s(f).(string)) }}, nil
+}
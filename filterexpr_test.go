@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFilterExpr checks --filter expressions against one file, and the
+// errors for those that do not parse or type-check.
+func TestFilterExpr(t *testing.T) {
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	e := entry{
+		rel:     "pkg/api/handler_test.go",
+		data:    []byte("package api\n\nfunc f() {}"),
+		size:    150 << 10,
+		modTime: now.Add(-36 * time.Hour),
+	}
+	for _, c := range []struct {
+		src  string
+		want bool
+	}{
+		{`lang == "go"`, true},
+		{`ext == "go" && name == "handler_test.go" && dir == "pkg/api"`, true},
+		{`size > 100KB && size < 1mb`, true},
+		{`size == 153600`, true},
+		{`age > 1d && age < 2d`, true},
+		{`age <= 36h`, true},
+		{`lines == 3`, true},
+		{`path.contains("api") && path.startsWith("pkg/") && path.endsWith("_test.go")`, true},
+		{`path.glob("pkg/**/*_test.go")`, true},
+		{`name.matches('^handler_[a-z]+\.go$')`, true},
+		{`!path.contains("mock")`, true},
+		{`!!converted`, false},
+		{`converted == false`, true},
+		{`"a" < "b"`, true},
+		{`name == "it's"`, false},
+		{`name == 'say "hi"'`, false},
+		{`name == "a\"b"`, false},
+		{`false || lang == "go" && size < 1KB`, false},
+		{`(false || lang == "go") && size > 1KB`, true},
+		{`lang != "go" || size >= 150KB`, true},
+	} {
+		f, err := parseFilter(c.src)
+		if err != nil {
+			t.Errorf("parseFilter(%s): %v", c.src, err)
+			continue
+		}
+		if got := f.match(e, now); got != c.want {
+			t.Errorf("%s = %v, want %v", c.src, got, c.want)
+		}
+	}
+}
+
+func TestFilterExprErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		`size`:                   "the expression is a number, not a condition",
+		`size < "big"`:           "at 6: cannot compare a number with a string",
+		`converted < true`:       "at 11: < does not apply to conditions",
+		`size && true`:           "&& needs conditions on both sides",
+		`!name`:                  "! needs a condition, not a string",
+		`owner == "me"`:          `at 1: unknown field "owner"`,
+		`size < 3days`:           `bad number "3days" at 8`,
+		`size < 1.2.3`:           `bad number "1.2.3" at 8`,
+		`name == "open`:          "unterminated string at 9",
+		`size # 1`:               `unexpected '#' at 6`,
+		`(size > 1`:              "missing )",
+		`size > 1)`:              `at 9: unexpected ")"`,
+		`name.upper("x")`:        `unknown method "upper"`,
+		`size.contains("1")`:     "a number has no methods",
+		`name.contains(1)`:       "contains takes a string",
+		`name.contains("a","b")`: "contains takes one argument",
+		`name.contains`:          "want ( after contains",
+		`name.matches("(")`:      "missing closing )",
+		`lang ==`:                "unexpected end of expression",
+		``:                       "unexpected end of expression",
+	} {
+		_, err := parseFilter(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseFilter(%s) = %v, want an error containing %q", src, err, want)
+		}
+	}
+}
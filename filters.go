@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// filterEntries keeps the entries for which keep returns true, preserving
+// order, and records the rest in om with reason.
+func filterEntries(entries []entry, om *omissions, reason string, keep func(entry) bool) []entry {
+	out := entries[:0]
+	for _, e := range entries {
+		if keep(e) {
+			out = append(out, e)
+		} else {
+			om.add(e.rel, e.size, reason)
+		}
+	}
+	return out
+}
+
+// included reports whether e matches one of the --include patterns. A
+// converted entry is matched under its original name.
+func included(e entry, patterns []string) bool {
+	rel := e.rel
+	if hasAttr(e.attrs, convertedAttr) {
+		rel = strings.TrimSuffix(rel, ".md")
+	}
+	for _, p := range patterns {
+		if packprompt.Match(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSince accepts a duration back from now ("72h", "3d", "2w") or an
+// absolute date ("2024-06-01", "2024-06-01 15:04", RFC 3339).
+func parseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if n := len(s); n > 1 {
+		if k, err := strconv.Atoi(s[:n-1]); err == nil {
+			switch s[n-1] {
+			case 'd':
+				return now.AddDate(0, 0, -k), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*k), nil
+			}
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: want a duration (72h, 3d, 2w) or a date (2024-06-01)", s)
+}
+
+// gitChangedSince lists files under dir changed in commits after t, plus any
+// uncommitted or untracked files, relative to dir.
+func gitChangedSince(dir string, t time.Time) (map[string]bool, error) {
+	logged, err := gitOutput(dir, "log", "--since="+t.Format(time.RFC3339), "--name-only", "--pretty=format:", "--relative")
+	if err != nil {
+		return nil, err
+	}
+	set := linesToSet(logged)
+	if err := addWorkingChanges(dir, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// gitRecentCommitFiles lists files under dir touched by the last n commits on
+// HEAD, plus any uncommitted or untracked files, relative to dir.
+func gitRecentCommitFiles(dir string, n int) (map[string]bool, error) {
+	logged, err := gitOutput(dir, "log", "-n", strconv.Itoa(n), "--name-only", "--pretty=format:", "--relative", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	set := linesToSet(logged)
+	if err := addWorkingChanges(dir, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// addWorkingChanges adds modified-but-uncommitted and untracked files to set.
+func addWorkingChanges(dir string, set map[string]bool) error {
+	dirty, err := gitOutput(dir, "diff", "--name-only", "--relative", "HEAD")
+	if err != nil {
+		return err
+	}
+	untracked, err := gitOutput(dir, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return err
+	}
+	for p := range linesToSet(dirty + "\n" + untracked) {
+		set[p] = true
+	}
+	return nil
+}
+
+func linesToSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			set[l] = true
+		}
+	}
+	return set
+}
+
+// gitFileAuthors maps each file under dir to the author who last touched it
+// or, with most, to the author with the most commits touching it.
+func gitFileAuthors(dir string, most bool) (map[string]string, error) {
+	out, err := gitOutput(dir, "log", "--no-merges", "--pretty=format:%x00%an <%ae>", "--name-only", "--relative")
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[string]string)
+	counts := make(map[string]map[string]int)
+	var author string
+	for _, l := range strings.Split(out, "\n") {
+		if strings.HasPrefix(l, "\x00") {
+			author = l[1:]
+			continue
+		}
+		if l = strings.TrimSpace(l); l == "" {
+			continue
+		}
+		// log is newest first, so the first author seen is the last to touch it
+		if _, ok := last[l]; !ok {
+			last[l] = author
+		}
+		if counts[l] == nil {
+			counts[l] = make(map[string]int)
+		}
+		counts[l][author]++
+	}
+	if !most {
+		return last, nil
+	}
+	top := make(map[string]string, len(counts))
+	for p, byAuthor := range counts {
+		// ties go to the most recent author, then alphabetically
+		best, bestN := last[p], byAuthor[last[p]]
+		for a, n := range byAuthor {
+			if n > bestN || (n == bestN && best != last[p] && a < best) {
+				best, bestN = a, n
+			}
+		}
+		top[p] = best
+	}
+	return top, nil
+}
+
+// pathFilter is unpack's --include and --exclude: an entry is kept when it
+// matches an include, if any are given, and no exclude. A pattern matching
+// a directory takes in everything beneath it, so "testdata" skips every
+// testdata tree and "cmd" keeps all of cmd.
+type pathFilter struct{ includes, excludes []string }
+
+func (p pathFilter) active() bool {
+	return len(p.includes) > 0 || len(p.excludes) > 0
+}
+
+func (p pathFilter) keeps(rel string) bool {
+	if len(p.includes) > 0 && !matchesTree(p.includes, rel) {
+		return false
+	}
+	return !matchesTree(p.excludes, rel)
+}
+
+// matchesTree reports whether rel, or a directory it is in, matches one
+// of patterns.
+func matchesTree(patterns []string, rel string) bool {
+	for {
+		if packprompt.MatchAny(patterns, rel) {
+			return true
+		}
+		i := strings.LastIndex(rel, "/")
+		if i < 0 {
+			return false
+		}
+		rel = rel[:i]
+	}
+}
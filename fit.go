@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// modelContexts are context windows in tokens, matched by longest name
+// prefix, so "llama3.1:70b" is llama3.1 and "claude-3.7-sonnet" claude-3.7.
+var modelContexts = map[string]int{
+	"gpt-4o": 128_000, "gpt-4o-mini": 128_000, "gpt-4.1": 1_047_576, "gpt-4-turbo": 128_000,
+	"gpt-4": 8_192, "gpt-3.5-turbo": 16_385, "gpt-5": 400_000, "o1": 200_000, "o3": 200_000, "o4-mini": 200_000,
+	"claude": 200_000, "claude-3": 200_000, "claude-3.5": 200_000, "claude-3.7": 200_000,
+	"claude-sonnet-4": 200_000, "claude-opus-4": 200_000, "sonnet": 200_000, "opus": 200_000, "haiku": 200_000,
+	"llama2": 4_096, "llama3": 8_192, "llama3.1": 131_072, "llama3.2": 131_072, "llama3.3": 131_072,
+	"llama-3": 8_192, "llama-3.1": 131_072, "llama-3.3": 131_072,
+	"mistral": 32_768, "mixtral": 32_768, "qwen2.5": 32_768, "qwen3": 40_960, "gemma2": 8_192, "gemma3": 131_072,
+	"deepseek-r1": 131_072, "deepseek-coder-v2": 163_840, "phi3": 4_096, "phi4": 16_384,
+}
+
+// knownContext returns the context window of a model from modelContexts, or 0.
+func knownContext(model string) int {
+	m := strings.ToLower(strings.TrimSpace(model))
+	best, n := "", 0
+	for k, v := range modelContexts {
+		if strings.HasPrefix(m, k) && len(k) > len(best) {
+			best, n = k, v
+		}
+	}
+	return n
+}
+
+// lookupContext finds a model's context window: from modelContexts, else
+// by asking a local Ollama ($OLLAMA_HOST or localhost:11434) about it.
+func lookupContext(model string) (int, error) {
+	if n := knownContext(model); n > 0 {
+		return n, nil
+	}
+	url := os.Getenv("OLLAMA_HOST")
+	if url != "" && !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	c, err := newLLMClient("ollama", url, model)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.contextWindow()
+	if err == nil && n == 0 {
+		err = fmt.Errorf("no context size in its metadata")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unknown context window for --fit-model %q (%v); give --token-budget instead", model, err)
+	}
+	return n, nil
+}
+
+// defaultFitReserve is the headroom for the question and the answer: a
+// tenth of the window, between 2k and 32k tokens.
+func defaultFitReserve(window int) int {
+	return min(max(window/10, 2048), 32768)
+}
+
+// margin is the estimator's stated error as a fraction ("±15%" -> 0.15).
+func (t tokenEstimator) margin() float64 {
+	if t.bpe.loaded() {
+		return 0
+	}
+	v, err := strconv.ParseFloat(strings.Trim(t.accuracy, "±%"), 64)
+	if err != nil {
+		return 0.25
+	}
+	return v / 100
+}
+
+// fitEntries keeps entries, in order, while the whole pack as pw renders
+// it (headers, annotations, encryption, omitted list) stays within target
+// tokens, shrinking the content budget until it does. What is left out
+// goes to om.
+func fitEntries(pw *packWriter, entries []entry, target int, truncate bool, est tokenEstimator, model string, om *omissions) ([]entry, error) {
+	budget := target
+	for round := 0; round < 10 && budget > 0; round++ {
+		dropped := &omissions{}
+		kept, err := applyBudgets(entries, budget, nil, truncate, est, dropped)
+		if err != nil {
+			return nil, err
+		}
+		for i := range dropped.list {
+			dropped.list[i].Reason = fmt.Sprintf("over the %d tokens that fit %s", target, model)
+		}
+		trial := *pw
+		if pw.omitted != nil {
+			trial.omitted = &omissions{list: append(append([]omission(nil), om.list...), dropped.list...)}
+		}
+		s := newTokenStream(est)
+		if err := trial.render(s, kept); err != nil {
+			return nil, err
+		}
+		n := s.total()
+		if n <= target {
+			om.list = append(om.list, dropped.list...)
+			return kept, nil
+		}
+		budget -= n - target
+	}
+	return nil, fmt.Errorf("cannot fit the pack into %d tokens for %s", target, model)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+const (
+	footerStart = packprompt.FooterMark
+	footerEnd   = "--- END PROVENANCE ---"
+)
+
+// version is overridden at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+func toolVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+	return version
+}
+
+// explicitFlags renders the flags the user actually set, in a form that can be
+// pasted back onto the command line to reproduce the pack.
+func explicitFlags(flg *flag.FlagSet) string {
+	var parts []string
+	flg.Visit(func(f *flag.Flag) {
+		parts = append(parts, "--"+f.Name+"="+shellQuote(f.Value.String()))
+	})
+	return strings.Join(parts, " ")
+}
+
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`*?[]{}();&|<>!#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// packEnv is the environment-dependent metadata recorded in a pack.
+type packEnv struct {
+	user string
+	host string
+	when time.Time
+}
+
+// currentPackEnv describes this run. In reproducible mode user and host are
+// withheld and the time comes from SOURCE_DATE_EPOCH (or the Unix epoch).
+func currentPackEnv(reproducible bool) packEnv {
+	if reproducible {
+		when := time.Unix(0, 0)
+		if s := os.Getenv("SOURCE_DATE_EPOCH"); s != "" {
+			if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+				when = time.Unix(secs, 0)
+			}
+		}
+		return packEnv{user: "unknown", host: "unknown", when: when.UTC()}
+	}
+	env := packEnv{user: "unknown", host: "unknown", when: time.Now().UTC()}
+	if u, err := user.Current(); err == nil {
+		env.user = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		env.host = h
+	}
+	return env
+}
+
+// provenanceFooter builds the archive trailer; bodySum is the SHA-256 of every
+// byte written before it. When key is non-nil the trailer is signed.
+func provenanceFooter(bodySum []byte, options string, env packEnv, key ed25519.PrivateKey) string {
+	var b strings.Builder
+	b.WriteString(footerStart + "\n")
+	fmt.Fprintf(&b, "tool=packprompt %s\n", toolVersion())
+	fmt.Fprintf(&b, "user=%s\n", env.user)
+	fmt.Fprintf(&b, "host=%s\n", env.host)
+	fmt.Fprintf(&b, "time=%s\n", env.when.Format(time.RFC3339))
+	fmt.Fprintf(&b, "options=%s\n", options)
+	fmt.Fprintf(&b, "sha256=%s\n", hex.EncodeToString(bodySum))
+	if key != nil {
+		pub := key.Public().(ed25519.PublicKey)
+		fmt.Fprintf(&b, "key=%s\n", keyFingerprint(pub))
+		sig := ed25519.Sign(key, []byte(b.String()))
+		fmt.Fprintf(&b, "signature=ed25519:%s\n", base64.StdEncoding.EncodeToString(sig))
+	}
+	b.WriteString(footerEnd + "\n")
+	return b.String()
+}
+
+func keyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// loadSigningKey reads a PEM-encoded PKCS#8 Ed25519 private key
+// (as produced by `openssl genpkey -algorithm ed25519`).
+func loadSigningKey(p string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	blk, _ := pem.Decode(data)
+	if blk == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", p)
+	}
+	k, err := x509.ParsePKCS8PrivateKey(blk.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	ek, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New(p + ": not an ed25519 private key")
+	}
+	return ek, nil
+}
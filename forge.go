@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// changeRequest is a pull/merge request on some forge.
+type changeRequest interface {
+	// describe returns the title, body and web URL.
+	describe() (title, body, webURL string, err error)
+	// changedFiles lists paths present after the change (removed files are omitted).
+	changedFiles() ([]string, error)
+	// content returns a file's content at the head of the change.
+	content(path string) ([]byte, error)
+	// diff returns the whole change as a unified diff.
+	diff() ([]byte, error)
+	// id is a short label such as "PR-12" or "MR-12".
+	id() string
+}
+
+var (
+	shortPRRe  = regexp.MustCompile(`^([\w.-]+)/([\w.-]+)#(\d+)$`)
+	shortMRRe  = regexp.MustCompile(`^([\w./-]+)!(\d+)$`)
+	githubURL  = regexp.MustCompile(`^/([^/]+)/([^/]+)/pull/(\d+)/?$`)
+	gitlabURL  = regexp.MustCompile(`^/(.+?)/-/merge_requests/(\d+)/?$`)
+	giteaURL   = regexp.MustCompile(`^/([^/]+)/([^/]+)/pulls/(\d+)/?$`)
+	forgeKinds = []string{"github", "gitlab", "gitea"}
+)
+
+// forgeTokens maps a forge host to the environment variable holding the
+// token for it, from the tokens section of a trusted config.
+var forgeTokens map[string]string
+
+// forgeToken returns the token to send to the forge API at api. A host
+// the config's tokens section names gets its variable; otherwise the first
+// of vars set goes only to the hosts of homes, the URLs those variables
+// are meant for, so a --pr URL naming any other host never receives it.
+func forgeToken(api string, homes []string, vars ...string) string {
+	host := urlHost(api)
+	if host == "" {
+		return ""
+	}
+	if v, ok := forgeTokens[host]; ok {
+		return os.Getenv(v)
+	}
+	for _, h := range homes {
+		if h == "" || urlHost(h) != host {
+			continue
+		}
+		for _, v := range vars {
+			if tok := os.Getenv(v); tok != "" {
+				return tok
+			}
+		}
+	}
+	return ""
+}
+
+// urlHost is the host (and port) of a URL, lowercased; "" if it has none.
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// parseChangeRequest resolves a reference to a change request. ref may be a
+// web URL, "org/repo#123" (GitHub, or Gitea with forge=gitea) or
+// "group/project!12" (GitLab). forge forces the provider when not "".
+func parseChangeRequest(ref, forge string) (changeRequest, error) {
+	if forge != "" && !contains(forgeKinds, forge) {
+		return nil, fmt.Errorf("invalid --forge %q: want %s", forge, strings.Join(forgeKinds, ", "))
+	}
+	ref = strings.TrimSpace(ref)
+	if u, err := url.Parse(ref); err == nil && (u.Scheme == "https" || u.Scheme == "http") {
+		host := u.Scheme + "://" + u.Host
+		if m := gitlabURL.FindStringSubmatch(u.Path); m != nil && (forge == "" || forge == "gitlab") {
+			n, _ := strconv.Atoi(m[2])
+			return newGitLabMR(host, m[1], n), nil
+		}
+		if m := githubURL.FindStringSubmatch(u.Path); m != nil && (forge == "" || forge == "github") {
+			n, _ := strconv.Atoi(m[3])
+			api := host + "/api/v3"
+			if u.Host == "github.com" {
+				api = githubAPIBase()
+			}
+			return newGitHubPR(api, m[1], m[2], n), nil
+		}
+		if m := giteaURL.FindStringSubmatch(u.Path); m != nil && (forge == "" || forge == "gitea") {
+			n, _ := strconv.Atoi(m[3])
+			return newGiteaPR(host, m[1], m[2], n), nil
+		}
+		return nil, fmt.Errorf("unrecognised pull/merge request URL %q", ref)
+	}
+
+	if m := shortMRRe.FindStringSubmatch(ref); m != nil && (forge == "" || forge == "gitlab") {
+		n, _ := strconv.Atoi(m[2])
+		return newGitLabMR(envOr("GITLAB_URL", "https://gitlab.com"), m[1], n), nil
+	}
+	if m := shortPRRe.FindStringSubmatch(ref); m != nil {
+		n, _ := strconv.Atoi(m[3])
+		switch forge {
+		case "", "github":
+			return newGitHubPR(githubAPIBase(), m[1], m[2], n), nil
+		case "gitea":
+			host := os.Getenv("GITEA_URL")
+			if host == "" {
+				return nil, fmt.Errorf("GITEA_URL must be set to use %q with --forge gitea", ref)
+			}
+			return newGiteaPR(host, m[1], m[2], n), nil
+		case "gitlab":
+			return newGitLabMR(envOr("GITLAB_URL", "https://gitlab.com"), m[1]+"/"+m[2], n), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid pull/merge request %q: want a URL, org/repo#123 or group/project!12", ref)
+}
+
+// fetchChangeRequest builds pack entries for a change request. include selects
+// any of "description" (title and body), "content" (changed files at the head
+// commit) and "diff" (the whole change as a unified diff).
+func fetchChangeRequest(cr changeRequest, include map[string]bool, excludes []string, om *omissions) ([]entry, error) {
+	var entries []entry
+	if include["description"] {
+		title, body, webURL, err := cr.describe()
+		if err != nil {
+			return nil, err
+		}
+		desc := fmt.Sprintf("# %s\n\n%s\n\n%s\n", title, webURL, strings.TrimSpace(body))
+		entries = append(entries, entry{rel: cr.id() + ".md", mode: 0o644, size: int64(len(desc)), data: []byte(desc)})
+	}
+	if include["content"] {
+		files, err := cr.changedFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if excludedPath(f, excludes) {
+				om.add(f, 0, "excluded by pattern")
+				continue
+			}
+			data, err := cr.content(f)
+			if err != nil {
+				return nil, err
+			}
+			if packprompt.IsBinary(data) {
+				om.add(f, int64(len(data)), "binary")
+				continue
+			}
+			entries = append(entries, entry{rel: f, mode: 0o644, size: int64(len(data)), data: data})
+		}
+	}
+	if include["diff"] {
+		d, err := cr.diff()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{rel: cr.id() + ".diff", mode: 0o644, size: int64(len(d)), data: d})
+	}
+	return entries, nil
+}
+
+// escapePath escapes each segment of a slash-separated path for use in a URL.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+// TestForgeToken checks a token goes only to the hosts its variable is
+// for, or that the config pairs it with.
+func TestForgeToken(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "gl")
+	t.Setenv("GITLAB_URL", "https://git.corp.example")
+	t.Setenv("OTHER_TOKEN", "other")
+	defer func(saved map[string]string) { forgeTokens = saved }(forgeTokens)
+	forgeTokens = map[string]string{"git.other.example": "OTHER_TOKEN"}
+	homes := []string{"https://gitlab.com", "https://git.corp.example"}
+	for api, want := range map[string]string{
+		"https://gitlab.com/api/v4":         "gl",
+		"https://git.corp.example/api/v4":   "gl",
+		"https://GitLab.com/api/v4":         "gl",
+		"https://evil.example/api/v4":       "",
+		"https://gitlab.com.evil/api/v4":    "",
+		"https://git.other.example/api/v4":  "other",
+		"https://git.corp.example:8443/api": "",
+	} {
+		if got := forgeToken(api, homes, "GITLAB_TOKEN"); got != want {
+			t.Errorf("%s: token %q, want %q", api, got, want)
+		}
+	}
+}
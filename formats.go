@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// Pack formats, for pack and unpack --format.
+const (
+	formatText     = "text"     // the marker format, --- FILE ... --- END FILE ---
+	formatJSONL    = "jsonl"    // one JSON object per entry
+	formatMarkdown = "markdown" // a heading and a fenced code block per entry
+	formatXML      = "xml"      // a <document> element per entry
+	formatTar      = "tar"      // a tar archive, gzipped with pack --gzip
+	formatAuto     = "auto"     // unpack: whichever the pack turns out to be
+)
+
+// sniffSize is how much of a pack detectFormat looks at.
+const sniffSize = 64 << 10
+
+func checkFormat(format string) error {
+	switch format {
+	case formatText, formatJSONL, formatMarkdown, formatXML, formatTar:
+		return nil
+	}
+	return fmt.Errorf("invalid --format %q: want text, jsonl, markdown, xml or tar", format)
+}
+
+// sniffFormat reads the start of the pack in ("-" is stdin) and returns
+// its format.
+func sniffFormat(in string) (string, error) {
+	f, err := openPack(in)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, format, err := sniffReader(f)
+	return format, err
+}
+
+// sniffReader returns the format of the pack rd holds, and a reader that
+// still yields the whole of it.
+func sniffReader(rd io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(rd, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err
+	}
+	return br, detectFormat(head), nil
+}
+
+// detectFormat tells the format of a pack from its start: a tar archive or
+// gzip stream is a tar pack, and JSON Lines open with an object; otherwise
+// the first line only one format has decides, an entry header, a
+// <document> element, or a markdown heading followed by a comment or
+// fence. Anything else is read as text.
+func detectFormat(head []byte) string {
+	if packprompt.IsTar(head) {
+		return formatTar
+	}
+	head = bytes.TrimPrefix(head, []byte("\ufeff"))
+	if bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("{")) {
+		return formatJSONL
+	}
+	heading := false
+	for _, line := range strings.Split(string(head), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, packprompt.StartMark+" "):
+			return formatText
+		case strings.HasPrefix(line, "<"+packprompt.XMLRoot+">"), strings.HasPrefix(line, "<document "), strings.HasPrefix(line, "<document>"):
+			return formatXML
+		case heading && (strings.HasPrefix(line, "<!--") || strings.HasPrefix(line, "```")):
+			return formatMarkdown
+		case strings.HasPrefix(line, packprompt.MarkdownHeading):
+			heading = true
+		case strings.TrimSpace(line) != "":
+			heading = false
+		}
+	}
+	return formatText
+}
+
+// readPackAs is readPack for a pack in format.
+func readPackAs(rd io.Reader, format string, fn func(packedFile) error) error {
+	var read func(io.Reader, func(packprompt.File) error) error
+	switch format {
+	case formatText:
+		read = packprompt.ReadPack
+	case formatJSONL:
+		read = packprompt.ReadJSONL
+	case formatMarkdown:
+		read = packprompt.ReadMarkdown
+	case formatXML:
+		read = packprompt.ReadXML
+	case formatTar:
+		read = packprompt.ReadTar
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	return read(rd, func(f packprompt.File) error {
+		return fn(packedFile{rel: f.Path, mode: f.Mode, attrs: f.Attrs, notes: f.Notes, meta: f.Meta, content: f.Content, attachment: f.Attachment})
+	})
+}
+
+// renderJSONL writes the entries, then the attachments, as JSON Lines. The
+// tree, the omitted section and the response contract are text and have
+// no place there.
+func (pw *packWriter) renderJSONL(w io.Writer, entries []entry) error {
+	for _, e := range entries {
+		if err := writeEntryJSONL(w, e, false); err != nil {
+			return err
+		}
+	}
+	for _, e := range pw.attachments {
+		if err := writeEntryJSONL(w, e, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeEntryJSONL(w io.Writer, e entry, attachment bool) error {
+	f, ok, err := storedFile(e, attachment)
+	if !ok || err != nil {
+		return err
+	}
+	return packprompt.WriteJSONL(w, f)
+}
+
+// renderMarkdown writes the entries, then the attachments and the omitted
+// section under headings of their own, as markdown.
+func (pw *packWriter) renderMarkdown(w io.Writer, entries []entry) error {
+	for _, e := range entries {
+		if err := writeEntryMarkdown(w, e, false); err != nil {
+			return err
+		}
+	}
+	if len(pw.attachments) > 0 {
+		if _, err := io.WriteString(w, packprompt.MarkdownAttachMark+"\n\n"); err != nil {
+			return err
+		}
+		for _, e := range pw.attachments {
+			if err := writeEntryMarkdown(w, e, true); err != nil {
+				return err
+			}
+		}
+	}
+	return pw.omitted.writeMarkdown(w)
+}
+
+// writeEntryMarkdown writes e with its code block tagged by language;
+// encoded and encrypted content gets no tag.
+func writeEntryMarkdown(w io.Writer, e entry, attachment bool) error {
+	f, ok, err := storedFile(e, attachment)
+	if !ok || err != nil {
+		return err
+	}
+	lang := detectLanguage(e.rel)
+	if e.cipher != nil || isEncoded(e) {
+		lang = ""
+	}
+	return packprompt.WriteMarkdown(w, f, lang)
+}
+
+// renderXML writes the entries in a <documents> root, with the attachments
+// and the omitted section in elements of their own. Documents are numbered
+// from 1 across both.
+func (pw *packWriter) renderXML(w io.Writer, entries []entry) error {
+	if _, err := io.WriteString(w, "<"+packprompt.XMLRoot+">\n"); err != nil {
+		return err
+	}
+	index := 0
+	for _, e := range entries {
+		if err := writeEntryXML(w, e, false, &index); err != nil {
+			return err
+		}
+	}
+	if len(pw.attachments) > 0 {
+		if _, err := io.WriteString(w, "<"+packprompt.XMLAttachments+">\n"); err != nil {
+			return err
+		}
+		for _, e := range pw.attachments {
+			if err := writeEntryXML(w, e, true, &index); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "</"+packprompt.XMLAttachments+">\n"); err != nil {
+			return err
+		}
+	}
+	if err := pw.omitted.writeXML(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</"+packprompt.XMLRoot+">\n")
+	return err
+}
+
+// writeEntryXML writes e as the next document, counting it in index.
+func writeEntryXML(w io.Writer, e entry, attachment bool, index *int) error {
+	f, ok, err := storedFile(e, attachment)
+	if !ok || err != nil {
+		return err
+	}
+	*index++
+	return packprompt.WriteXML(w, f, *index)
+}
+
+// renderTar writes the entries, then the attachments, as a tar archive,
+// gzipped with pw.gzip. The omitted section has no place there.
+func (pw *packWriter) renderTar(w io.Writer, entries []entry) error {
+	var gz *gzip.Writer
+	if pw.gzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		if err := pw.writeEntryTar(tw, e, false); err != nil {
+			return err
+		}
+	}
+	for _, e := range pw.attachments {
+		if err := pw.writeEntryTar(tw, e, true); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// writeEntryTar writes e as a member holding the file itself: base64
+// content is decoded, unless it is encrypted too.
+func (pw *packWriter) writeEntryTar(tw *tar.Writer, e entry, attachment bool) error {
+	f, ok, err := storedFile(e, attachment)
+	if !ok || err != nil {
+		return err
+	}
+	if scheme, enc := f.Attrs[encodingAttr]; enc && e.cipher == nil {
+		if f.Content, err = decodeContent(e.rel, scheme, f.Content); err != nil {
+			return err
+		}
+		delete(f.Attrs, encodingAttr)
+	}
+	mod := e.modTime
+	if !pw.mtime.IsZero() {
+		mod = pw.mtime
+	}
+	return packprompt.WriteTar(tw, f, mod)
+}
+
+// storedFile is e as the structured formats store it. ok is false for a
+// file gone since the walk, skipped as in writeEntry.
+func storedFile(e entry, attachment bool) (packprompt.File, bool, error) {
+	rc, err := e.open()
+	if err != nil {
+		return packprompt.File{}, false, nil
+	}
+	defer rc.Close()
+	r, err := e.body(rc)
+	if err != nil {
+		return packprompt.File{}, false, err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return packprompt.File{}, false, err
+	}
+	attrs := map[string]string{}
+	for _, a := range e.headerAttrs() {
+		k, v, _ := strings.Cut(a, "=")
+		attrs[k] = v
+	}
+	return packprompt.File{Path: e.rel, Mode: fmt.Sprintf("%04o", e.mode), Attrs: attrs,
+		Notes: e.notes, Meta: e.meta, Content: content, Attachment: attachment}, true, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReadersDetectFormat packs a tree in each format and reads it back
+// with the commands that take a pack, which must see its entries rather
+// than an empty text pack.
+func TestReadersDetectFormat(t *testing.T) {
+	for name, flags := range map[string][]string{
+		formatText:     {"--format", formatText},
+		formatJSONL:    {"--format", formatJSONL},
+		formatMarkdown: {"--format", formatMarkdown},
+		formatXML:      {"--format", formatXML},
+		formatTar:      {"--format", formatTar},
+		"tgz":          {"--format", formatTar, "--gzip"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := writeTree(t, map[string]string{"a.txt": "alpha\n", "dir/b.go": "package b\n"})
+			out := filepath.Join(t.TempDir(), "pack."+name)
+			if res := runCLI(t, src, append([]string{"pack", "--out", out}, flags...)...); res.code != 0 {
+				t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+			}
+
+			res := runCLI(t, src, "verify", "--in", out)
+			if res.code != 0 || !strings.HasPrefix(res.stdout, "OK: ") || !strings.Contains(res.stdout, "2 entries, 2 with checksums") {
+				t.Errorf("verify: exit %d: %s%s", res.code, res.stdout, res.stderr)
+			}
+			res = runCLI(t, src, "list", "--plain", "--in", out)
+			if res.code != 0 || !strings.Contains(res.stdout, "dir/b.go") || !strings.Contains(res.stdout, "2 files") {
+				t.Errorf("list: exit %d: %s%s", res.code, res.stdout, res.stderr)
+			}
+			res = runCLI(t, src, "cat", "--in", out, "a.txt")
+			if res.code != 0 || res.stdout != "alpha\n" {
+				t.Errorf("cat: exit %d: %q%s", res.code, res.stdout, res.stderr)
+			}
+			res = runCLI(t, src, "diff", "--plain", "--name-status", "--in", out, "--root", src)
+			if res.code != 0 || strings.TrimSpace(res.stdout) != "" {
+				t.Errorf("diff of an unchanged tree: exit %d: %q%s", res.code, res.stdout, res.stderr)
+			}
+		})
+	}
+}
+
+// TestVerifyStructuredCorrupt checks verify fails a structured pack whose
+// content no longer matches its checksum.
+func TestVerifyStructuredCorrupt(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n"})
+	out := filepath.Join(t.TempDir(), "pack.jsonl")
+	if res := runCLI(t, src, "pack", "--format", formatJSONL, "--out", out); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out, []byte(strings.Replace(string(data), "alpha", "omega", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res := runCLI(t, src, "verify", "--in", out)
+	if res.code != 1 || !strings.Contains(res.stdout, "CORRUPT") {
+		t.Errorf("verify: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+}
+
+// TestVerifyTarCutOff checks verify fails a tar pack cut off at a block
+// boundary, which the tar reader takes for its end.
+func TestVerifyTarCutOff(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n", "b.txt": "beta\n"})
+	out := filepath.Join(t.TempDir(), "pack.tar")
+	if res := runCLI(t, src, "pack", "--format", formatTar, "--out", out); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(out, data[:len(data)-1024], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res := runCLI(t, src, "verify", "--in", out)
+	if res.code != 1 || !strings.Contains(res.stdout, "cut off") {
+		t.Errorf("verify: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+}
+
+// TestPackLeavesOutEarlierPacks checks a pack written into the tree, in
+// any format, is left out of the next pack rather than nested in it.
+func TestPackLeavesOutEarlierPacks(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n"})
+	for name, flags := range map[string][]string{
+		formatText:     {"--format", formatText},
+		formatJSONL:    {"--format", formatJSONL},
+		formatMarkdown: {"--format", formatMarkdown},
+		formatXML:      {"--format", formatXML},
+		formatTar:      {"--format", formatTar},
+		"tgz":          {"--format", formatTar, "--gzip"},
+	} {
+		if res := runCLI(t, src, append([]string{"pack", "--out", "earlier." + name}, flags...)...); res.code != 0 {
+			t.Fatalf("pack %s: exit %d: %s", name, res.code, res.stderr)
+		}
+	}
+	out := filepath.Join(t.TempDir(), "pack.txt")
+	if res := runCLI(t, src, "pack", "--binary", "base64", "--out", out); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	res := runCLI(t, src, "list", "--plain", "--in", out)
+	if res.code != 0 || strings.Contains(res.stdout, "earlier.") || !strings.Contains(res.stdout, "1 file") {
+		t.Errorf("list: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+}
+
+// TestListStdinPrint0 checks list reads a pack from stdin and -z prints
+// only its paths, NUL-terminated.
+func TestListStdinPrint0(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n", "dir/b.go": "package b\n"})
+	out := filepath.Join(t.TempDir(), "pack.txt")
+	if res := runCLI(t, src, "pack", "--out", out); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	res := runCLI(t, src, "list", "-z", "--in", out)
+	if res.code != 0 || res.stdout != "a.txt\x00dir/b.go\x00" {
+		t.Errorf("list -z: exit %d: %q%s", res.code, res.stdout, res.stderr)
+	}
+	pack, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pack.Close()
+	res = runCLIStdin(t, src, pack, "list", "--plain", "--in", "-")
+	if res.code != 0 || !strings.Contains(res.stdout, "dir/b.go") || !strings.Contains(res.stdout, "2 files") {
+		t.Errorf("list --in -: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+}
+
+// TestCRLFRoundTrip checks a file with CRLF line endings unpacks byte for
+// byte, and verifies, in every format.
+func TestCRLFRoundTrip(t *testing.T) {
+	const crlf = "line\r\nCRLF\r\n"
+	for _, format := range []string{formatText, formatJSONL, formatMarkdown, formatXML, formatTar} {
+		t.Run(format, func(t *testing.T) {
+			src := writeTree(t, map[string]string{"crlf.txt": crlf, "lf.txt": "lf\n"})
+			out := filepath.Join(t.TempDir(), "pack."+format)
+			if res := runCLI(t, src, "pack", "--format", format, "--out", out); res.code != 0 {
+				t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+			}
+			if res := runCLI(t, src, "verify", "--in", out); res.code != 0 {
+				t.Errorf("verify: exit %d: %s", res.code, res.stdout)
+			}
+			dest := t.TempDir()
+			if res := runCLI(t, src, "unpack", "--in", out, "--dest", dest); res.code != 0 {
+				t.Fatalf("unpack: exit %d: %s", res.code, res.stderr)
+			}
+			if got, err := os.ReadFile(filepath.Join(dest, "crlf.txt")); err != nil || string(got) != crlf {
+				t.Errorf("unpacked crlf.txt is %q (%v), want %q", got, err, crlf)
+			}
+		})
+	}
+}
+
+// TestWhitespacePaths checks a path with whitespace round-trips in the
+// formats whose entries do not carry the path in a header line, and is
+// left out of text and markdown packs, which do.
+func TestWhitespacePaths(t *testing.T) {
+	for _, format := range []string{formatText, formatJSONL, formatMarkdown, formatXML, formatTar} {
+		t.Run(format, func(t *testing.T) {
+			src := writeTree(t, map[string]string{"sp ace.txt": "alpha\n"})
+			out := filepath.Join(t.TempDir(), "pack."+format)
+			res := runCLI(t, src, "pack", "--format", format, "--out", out)
+			if res.code != 0 {
+				t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+			}
+			headers := format == formatText || format == formatMarkdown
+			if left := strings.Contains(res.stderr, `leaving out "sp ace.txt"`); left != headers {
+				t.Errorf("pack left out \"sp ace.txt\": %v, want %v: %s", left, headers, res.stderr)
+			}
+			if headers {
+				return
+			}
+			dest := t.TempDir()
+			if res := runCLI(t, src, "unpack", "--in", out, "--dest", dest); res.code != 0 {
+				t.Fatalf("unpack: exit %d: %s", res.code, res.stderr)
+			}
+			if got, err := os.ReadFile(filepath.Join(dest, "sp ace.txt")); err != nil || string(got) != "alpha\n" {
+				t.Errorf("unpacked \"sp ace.txt\" is %q (%v)", got, err)
+			}
+		})
+	}
+}
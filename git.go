@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// gitOutput runs git in dir and returns trimmed stdout.
+func gitOutput(dir string, args ...string) (string, error) {
+	return runIn(dir, "git", args...)
+}
+
+// runIn runs a command in dir and returns trimmed stdout; stderr becomes the error.
+func runIn(dir, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitHead returns the short commit hash checked out in dir, or "" outside a repo.
+func gitHead(dir string) string {
+	out, err := gitOutput(dir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return out
+}
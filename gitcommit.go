@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// defaultCommitTemplate is the message of a --git-commit commit: what was
+// done, then the pack as trailers.
+const defaultCommitTemplate = `packprompt {{.Command}} {{.Pack}}
+
+{{range .Added}}Add {{.}}
+{{end}}{{range .Changed}}Update {{.}}
+{{end}}{{range .Deleted}}Delete {{.}}
+{{end}}
+Pack-SHA256: {{.SHA256}}
+{{- if .Source}}
+Source: {{.Source}}
+{{- end}}
+`
+
+// gitCommitter turns what an unpack or apply writes into a commit, on a
+// new branch when one is named, so it goes through review like any change.
+type gitCommitter struct {
+	dir     string // where the files are written, inside the work tree
+	branch  string
+	message *template.Template
+}
+
+// newGitCommitter checks that dir is in a git work tree and that branch,
+// if any, can be created, before anything is written. It returns nil when
+// neither --git-commit nor --git-branch was given.
+func newGitCommitter(dir string, commit bool, branch, message string) (*gitCommitter, error) {
+	if !commit && branch == "" {
+		return nil, nil
+	}
+	t, err := parseRecordTemplate("git-message", message, defaultCommitTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gitOutput(existingAncestor(dir), "rev-parse", "--show-toplevel"); err != nil {
+		return nil, fmt.Errorf("--git-commit: %s is not in a git work tree", dir)
+	}
+	if branch != "" {
+		if _, err := gitOutput(existingAncestor(dir), "check-ref-format", "--branch", branch); err != nil {
+			return nil, fmt.Errorf("invalid --git-branch %q", branch)
+		}
+		if _, err := gitOutput(existingAncestor(dir), "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return nil, fmt.Errorf("--git-branch %s already exists", branch)
+		}
+	}
+	return &gitCommitter{dir: dir, branch: branch, message: t}, nil
+}
+
+// existingAncestor is dir, or its nearest parent that exists yet.
+func existingAncestor(dir string) string {
+	for {
+		if _, err := os.Stat(dir); !errors.Is(err, iofs.ErrNotExist) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// start switches to the new branch, carrying any local changes over.
+func (g *gitCommitter) start() error {
+	if g == nil || g.branch == "" {
+		return nil
+	}
+	if _, err := gitOutput(existingAncestor(g.dir), "switch", "--quiet", "--create", g.branch); err != nil {
+		return err
+	}
+	fmt.Printf("Switched to a new branch %s\n", g.branch)
+	return nil
+}
+
+// commit stages the files rec added, changed and deleted, and commits just
+// those, leaving anything else already staged alone.
+func (g *gitCommitter) commit(rec changeRecord) error {
+	if g == nil {
+		return nil
+	}
+	files := rec.Files()
+	if len(files) == 0 {
+		fmt.Println("Nothing to commit: no files changed")
+		return nil
+	}
+	msg, err := renderRecord(g.message, rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "packprompt-commit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(msg); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if _, err := gitOutput(g.dir, append([]string{"add", "--all", "--"}, files...)...); err != nil {
+		return fmt.Errorf("files written but not committed: %w", err)
+	}
+	args := append([]string{"commit", "--quiet", "--file", f.Name(), "--"}, files...)
+	if _, err := gitOutput(g.dir, args...); err != nil {
+		return fmt.Errorf("files written and staged but not committed: %w", err)
+	}
+	where := ""
+	if g.branch != "" {
+		where = " on " + g.branch
+	}
+	fmt.Printf("Committed %d files as %s%s\n", len(files), gitHead(g.dir), where)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// giteaHeaders also serves Forgejo, which keeps the Gitea API. The token
+// is GITEA_TOKEN or FORGEJO_TOKEN for GITEA_URL's host, or the config's
+// token for the host of api.
+func giteaHeaders(api string) map[string]string {
+	h := map[string]string{"Accept": "application/json"}
+	if tok := forgeToken(api, []string{os.Getenv("GITEA_URL")}, "GITEA_TOKEN", "FORGEJO_TOKEN"); tok != "" {
+		h["Authorization"] = "token " + tok
+	}
+	return h
+}
+
+type giteaPR struct {
+	api, owner, repo string
+	number           int
+
+	loaded bool
+	info   struct {
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+		Head    struct {
+			SHA  string `json:"sha"`
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	}
+}
+
+func newGiteaPR(host, owner, repo string, number int) *giteaPR {
+	return &giteaPR{api: strings.TrimRight(host, "/") + "/api/v1", owner: owner, repo: repo, number: number}
+}
+
+func (p *giteaPR) id() string { return fmt.Sprintf("PR-%d", p.number) }
+
+func (p *giteaPR) base() string {
+	return fmt.Sprintf("%s/repos/%s/%s/pulls/%d", p.api, p.owner, p.repo, p.number)
+}
+
+func (p *giteaPR) load() error {
+	if p.loaded {
+		return nil
+	}
+	raw, err := httpGet(p.base(), giteaHeaders(p.api))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &p.info); err != nil {
+		return fmt.Errorf("decoding pull request: %w", err)
+	}
+	p.loaded = true
+	return nil
+}
+
+func (p *giteaPR) describe() (string, string, string, error) {
+	if err := p.load(); err != nil {
+		return "", "", "", err
+	}
+	return p.info.Title, p.info.Body, p.info.HTMLURL, nil
+}
+
+func (p *giteaPR) changedFiles() ([]string, error) {
+	var out []string
+	for page := 1; ; page++ {
+		raw, err := httpGet(fmt.Sprintf("%s/files?limit=50&page=%d", p.base(), page), giteaHeaders(p.api))
+		if err != nil {
+			return nil, err
+		}
+		var files []struct {
+			Filename string `json:"filename"`
+			Status   string `json:"status"`
+		}
+		if err := json.Unmarshal(raw, &files); err != nil {
+			return nil, fmt.Errorf("decoding pull request files: %w", err)
+		}
+		for _, f := range files {
+			if f.Status != "removed" && f.Status != "deleted" {
+				out = append(out, f.Filename)
+			}
+		}
+		if len(files) < 50 {
+			return out, nil
+		}
+	}
+}
+
+func (p *giteaPR) content(path string) ([]byte, error) {
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	headRepo := p.info.Head.Repo.FullName
+	if headRepo == "" {
+		headRepo = p.owner + "/" + p.repo
+	}
+	return httpGet(fmt.Sprintf("%s/repos/%s/raw/%s?ref=%s",
+		p.api, headRepo, escapePath(path), url.QueryEscape(p.info.Head.SHA)), giteaHeaders(p.api))
+}
+
+func (p *giteaPR) diff() ([]byte, error) {
+	return httpGet(p.base()+".diff", giteaHeaders(p.api))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func githubAPIBase() string {
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "https://api.github.com"
+}
+
+// githubHeaders authenticates to the API at api with GITHUB_TOKEN or
+// GH_TOKEN, for GITHUB_API_URL's host (default api.github.com), or the
+// config's token for the host.
+func githubHeaders(api, accept string) map[string]string {
+	h := map[string]string{
+		"Accept":               accept,
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+	if tok := forgeToken(api, []string{githubAPIBase()}, "GITHUB_TOKEN", "GH_TOKEN"); tok != "" {
+		h["Authorization"] = "Bearer " + tok
+	}
+	return h
+}
+
+type githubPR struct {
+	api, owner, repo string
+	number           int
+
+	loaded bool
+	info   struct {
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+		Head    struct {
+			SHA  string `json:"sha"`
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	}
+}
+
+func newGitHubPR(api, owner, repo string, number int) *githubPR {
+	return &githubPR{api: strings.TrimRight(api, "/"), owner: owner, repo: repo, number: number}
+}
+
+func (p *githubPR) id() string { return fmt.Sprintf("PR-%d", p.number) }
+
+func (p *githubPR) base() string {
+	return fmt.Sprintf("%s/repos/%s/%s/pulls/%d", p.api, p.owner, p.repo, p.number)
+}
+
+func (p *githubPR) load() error {
+	if p.loaded {
+		return nil
+	}
+	raw, err := httpGet(p.base(), githubHeaders(p.api, "application/vnd.github+json"))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &p.info); err != nil {
+		return fmt.Errorf("decoding pull request: %w", err)
+	}
+	p.loaded = true
+	return nil
+}
+
+func (p *githubPR) describe() (string, string, string, error) {
+	if err := p.load(); err != nil {
+		return "", "", "", err
+	}
+	return p.info.Title, p.info.Body, p.info.HTMLURL, nil
+}
+
+func (p *githubPR) changedFiles() ([]string, error) {
+	var out []string
+	for page := 1; ; page++ {
+		raw, err := httpGet(fmt.Sprintf("%s/files?per_page=100&page=%d", p.base(), page), githubHeaders(p.api, "application/vnd.github+json"))
+		if err != nil {
+			return nil, err
+		}
+		var files []struct {
+			Filename string `json:"filename"`
+			Status   string `json:"status"`
+		}
+		if err := json.Unmarshal(raw, &files); err != nil {
+			return nil, fmt.Errorf("decoding pull request files: %w", err)
+		}
+		for _, f := range files {
+			if f.Status != "removed" {
+				out = append(out, f.Filename)
+			}
+		}
+		if len(files) < 100 {
+			return out, nil
+		}
+	}
+}
+
+func (p *githubPR) content(path string) ([]byte, error) {
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	headRepo := p.info.Head.Repo.FullName
+	if headRepo == "" {
+		// head fork was deleted; fall back to the base repository
+		headRepo = p.owner + "/" + p.repo
+	}
+	return httpGet(fmt.Sprintf("%s/repos/%s/contents/%s?ref=%s",
+		p.api, headRepo, escapePath(path), url.QueryEscape(p.info.Head.SHA)),
+		githubHeaders(p.api, "application/vnd.github.raw"))
+}
+
+func (p *githubPR) diff() ([]byte, error) {
+	return httpGet(p.base(), githubHeaders(p.api, "application/vnd.github.diff"))
+}
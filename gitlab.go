@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gitlabHeaders authenticates to the API at api with GITLAB_TOKEN, for
+// gitlab.com and GITLAB_URL's host, or the config's token for the host.
+// It goes as a bearer token, which a redirect to another host drops.
+func gitlabHeaders(api string) map[string]string {
+	h := map[string]string{"Accept": "application/json"}
+	if tok := forgeToken(api, []string{"https://gitlab.com", os.Getenv("GITLAB_URL")}, "GITLAB_TOKEN"); tok != "" {
+		h["Authorization"] = "Bearer " + tok
+	}
+	return h
+}
+
+type gitlabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	NewFile     bool   `json:"new_file"`
+	DeletedFile bool   `json:"deleted_file"`
+	Diff        string `json:"diff"`
+}
+
+type gitlabMR struct {
+	api     string // https://host/api/v4
+	project string // group/subgroup/project
+	iid     int
+
+	loaded bool
+	info   struct {
+		Title           string `json:"title"`
+		Description     string `json:"description"`
+		WebURL          string `json:"web_url"`
+		SHA             string `json:"sha"`
+		SourceProjectID int    `json:"source_project_id"`
+	}
+	diffs []gitlabDiff
+}
+
+func newGitLabMR(host, project string, iid int) *gitlabMR {
+	return &gitlabMR{api: strings.TrimRight(host, "/") + "/api/v4", project: project, iid: iid}
+}
+
+func (m *gitlabMR) id() string { return fmt.Sprintf("MR-%d", m.iid) }
+
+func (m *gitlabMR) base() string {
+	return fmt.Sprintf("%s/projects/%s/merge_requests/%d", m.api, url.PathEscape(m.project), m.iid)
+}
+
+func (m *gitlabMR) load() error {
+	if m.loaded {
+		return nil
+	}
+	raw, err := httpGet(m.base(), gitlabHeaders(m.api))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &m.info); err != nil {
+		return fmt.Errorf("decoding merge request: %w", err)
+	}
+	m.loaded = true
+	return nil
+}
+
+func (m *gitlabMR) loadDiffs() error {
+	if m.diffs != nil {
+		return nil
+	}
+	m.diffs = []gitlabDiff{}
+	for page := 1; ; page++ {
+		raw, err := httpGet(fmt.Sprintf("%s/diffs?per_page=100&page=%d", m.base(), page), gitlabHeaders(m.api))
+		if err != nil {
+			return err
+		}
+		var batch []gitlabDiff
+		if err := json.Unmarshal(raw, &batch); err != nil {
+			return fmt.Errorf("decoding merge request diffs: %w", err)
+		}
+		m.diffs = append(m.diffs, batch...)
+		if len(batch) < 100 {
+			return nil
+		}
+	}
+}
+
+func (m *gitlabMR) describe() (string, string, string, error) {
+	if err := m.load(); err != nil {
+		return "", "", "", err
+	}
+	return m.info.Title, m.info.Description, m.info.WebURL, nil
+}
+
+func (m *gitlabMR) changedFiles() ([]string, error) {
+	if err := m.loadDiffs(); err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, d := range m.diffs {
+		if !d.DeletedFile {
+			out = append(out, d.NewPath)
+		}
+	}
+	return out, nil
+}
+
+func (m *gitlabMR) content(path string) ([]byte, error) {
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	// files come from the source project so MRs from forks resolve
+	project := url.PathEscape(m.project)
+	if m.info.SourceProjectID != 0 {
+		project = fmt.Sprint(m.info.SourceProjectID)
+	}
+	return httpGet(fmt.Sprintf("%s/projects/%s/repository/files/%s/raw?ref=%s",
+		m.api, project, url.PathEscape(path), url.QueryEscape(m.info.SHA)), gitlabHeaders(m.api))
+}
+
+// diff reassembles a unified diff; the API only returns per-file hunks.
+func (m *gitlabMR) diff() ([]byte, error) {
+	if err := m.loadDiffs(); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, d := range m.diffs {
+		oldName, newName := "a/"+d.OldPath, "b/"+d.NewPath
+		if d.NewFile {
+			oldName = "/dev/null"
+		}
+		if d.DeletedFile {
+			newName = "/dev/null"
+		}
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- %s\n+++ %s\n", d.OldPath, d.NewPath, oldName, newName)
+		b.WriteString(d.Diff)
+		if !strings.HasSuffix(d.Diff, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// goListPackage is the subset of `go list -json` output naming source files.
+type goListPackage struct {
+	Dir        string
+	Standard   bool
+	Module     *struct{ Dir string }
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	CXXFiles   []string
+	MFiles     []string
+	HFiles     []string
+	FFiles     []string
+	SFiles     []string
+	SwigFiles  []string
+	SysoFiles  []string
+	EmbedFiles []string
+	Error      *struct{ Err string }
+}
+
+// goDepsFiles resolves patterns (space-separated, e.g. "./...") with
+// `go list -deps` and returns every file under root that the build reads:
+// Go, cgo and assembly sources, headers, syso objects and embedded files,
+// plus the go.mod/go.work that define the build.
+func goDepsFiles(root, patterns string) (map[string]bool, error) {
+	args := append([]string{"list", "-deps", "-json"}, strings.Fields(patterns)...)
+	out, err := runIn(root, "go", args...)
+	if err != nil {
+		return nil, err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	set := map[string]bool{}
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var pkg goListPackage
+		if err := dec.Decode(&pkg); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding go list output: %w", err)
+		}
+		if pkg.Error != nil {
+			return nil, fmt.Errorf("go list: %s", pkg.Error.Err)
+		}
+		if pkg.Standard {
+			continue
+		}
+		for _, list := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.MFiles,
+			pkg.HFiles, pkg.FFiles, pkg.SFiles, pkg.SwigFiles, pkg.SysoFiles, pkg.EmbedFiles} {
+			for _, f := range list {
+				// dependencies in the module cache are outside the tree
+				if rel, ok := relToRoot(filepath.Join(pkg.Dir, f), absRoot); ok {
+					set[rel] = true
+				}
+			}
+		}
+		if pkg.Module != nil && pkg.Module.Dir != "" {
+			if rel, ok := relToRoot(filepath.Join(pkg.Module.Dir, "go.mod"), absRoot); ok {
+				set[rel] = true
+			}
+		}
+	}
+	if gw, err := runIn(root, "go", "env", "GOWORK"); err == nil && gw != "" && gw != "off" {
+		if rel, ok := relToRoot(gw, absRoot); ok {
+			set[rel] = true
+		}
+	}
+	return set, nil
+}
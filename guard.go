@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkMinimums fails a pack that kept fewer than minFiles files or
+// minTokens tokens of content, which usually means an exclude or filter
+// caught far more than intended. The error names the commonest reasons
+// files were left out.
+func checkMinimums(entries []entry, minFiles, minTokens int, est tokenEstimator, om *omissions) error {
+	var short string
+	if len(entries) < minFiles {
+		short = fmt.Sprintf("the pack would hold %d files, fewer than --min-files %d", len(entries), minFiles)
+	} else if minTokens > 0 {
+		counts, err := countEntryTokens(entries, est)
+		if err != nil {
+			return err
+		}
+		tokens := 0
+		for _, n := range counts {
+			tokens += n
+		}
+		if tokens < minTokens {
+			short = fmt.Sprintf("the pack would hold ~%d tokens of content, fewer than --min-tokens %d (%s)", tokens, minTokens, est.label())
+		}
+	}
+	if short == "" {
+		return nil
+	}
+	if om == nil || len(om.list) == 0 {
+		return fmt.Errorf("%s; nothing was left out, so check --root", short)
+	}
+	left := plural(len(om.list), "path") + " were"
+	if len(om.list) == 1 {
+		left = "1 path was"
+	}
+	return fmt.Errorf("%s; %s left out, mostly %s (see --skip-report)", short, left, topReasons(om, 3))
+}
+
+// topReasons lists the n most frequent omission reasons with their counts.
+func topReasons(om *omissions, n int) string {
+	counts := map[string]int{}
+	for _, o := range om.list {
+		counts[o.Reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for r := range counts {
+		reasons = append(reasons, r)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	if len(reasons) > n {
+		reasons = reasons[:n]
+	}
+	parts := make([]string, len(reasons))
+	for i, r := range reasons {
+		parts[i] = fmt.Sprintf("%d %s", counts[r], r)
+	}
+	return strings.Join(parts, ", ")
+}
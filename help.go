@@ -0,0 +1,543 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// helpText is what help NAME prints besides the flags: a command's synopsis
+// and the details usage leaves out. Topics other than commands have no
+// synopsis.
+type helpText struct{ synopsis, details string }
+
+// commandHelp holds the help of each builtin command and topic.
+var commandHelp = map[string]helpText{
+	"pack": {"pack [flags]", `  - Skips binary files and all non-regular files (FIFOs, sockets, devices, symlinks).
+  - Default excludes: ` + strings.Join(defaultExcludes, ",") + `
+  - --include "*.go,cmd/**" packs only the files matching one of the patterns, checked after the
+    excludes; patterns without '/' match base names, others the whole path with ** for any
+    depth. Converted files match under their original name, archive members by member path.
+  - --max-file-size 200KB leaves out larger files (generated dumps, fixtures), listed in the
+    omitted section; with --size-overflow truncate they are cut at the last line boundary
+    within the limit instead and marked truncated=KEPT/TOTAL lines, like budget truncation.
+  - --scan warn|fail checks the files to pack for the credentials and personal data unpack
+    --scan looks for, before anything is written: warn prints each, masked, with its line; fail
+    writes nothing if there are any. --scan-report FILE (or - for stdout) also writes them, and
+    the files --max-file-size left out or cut, as SARIF 2.1.0 or, with --scan-report-format
+    github, GitHub Actions annotations, for a pre-share gate in CI.
+  - Stores file mode and restores on unpack.
+  - Never packs its own output: --out and its .lock/.tmp~pp files are skipped, and earlier packs
+    found in the tree are left out with a warning. Writes go to a temp file renamed into place
+    under a lock, so concurrent runs on the same --out fail fast instead of interleaving.
+  - Ends with an omitted section listing every path left out (size and reason) so the reader
+    knows the pack is partial, or that only the default excludes matched; --no-omitted drops
+    it.
+  - Moves key files (README*, ARCHITECTURE*, CONTRIBUTING*, Makefile, main entry points)
+    to the front of the pack unless --no-promote is given.
+  - --provenance adds a one-line comment (commit, time, path) to the top of each file
+    with known comment syntax; unpack strips it again.
+  - --footer appends tool version, user, host, time, the flags used and a SHA-256 of the
+    pack body; --sign-key additionally signs it with an Ed25519 key, a PEM file or the name
+    of a key in the keyring.
+  - --reproducible gives byte-identical output for identical trees: paths sorted, modes
+    normalized to 0644/0755, time taken from SOURCE_DATE_EPOCH (default 1970-01-01), no user/host.
+  - --since keeps only files changed after a date (2024-06-01) or age (72h, 3d, 2w), judged by
+    mtime or, with --since-by git, by commit history plus uncommitted changes.
+  - --author keeps only files whose last committer (or, with --author-by most, most frequent
+    committer) matches a case-insensitive regexp against "name <email>".
+  - --commits N keeps only files touched by the last N commits on HEAD, plus uncommitted changes.
+  - --filter EXPR keeps only files the expression accepts, after the filters above, e.g.
+    --filter 'size < 100KB && lang == "go" && !path.contains("mock")'. Fields: path, name, dir,
+    ext, lang (strings), size, lines, age (numbers; age in seconds, so age < 3d) and converted;
+    numbers take B/KB/MB/GB and s/h/d/w units. Strings have contains, startsWith, endsWith, glob
+    and matches (regexp). Operators: ! && || == != < <= > >= and parentheses.
+  - --pr packs a pull/merge request through the forge API instead of walking --root: its
+    description, the changed files at the head commit and/or the full diff. REF is a web URL,
+    org/repo#123 (GitHub; Gitea with --forge gitea) or group/project!12 (GitLab).
+    Tokens come from GITHUB_TOKEN/GH_TOKEN, GITLAB_TOKEN and GITEA_TOKEN/FORGEJO_TOKEN; hosts
+    from GITHUB_API_URL, GITLAB_URL (default gitlab.com) and GITEA_URL. Each token is sent only
+    to its variable's host; for others the user config's tokens section names the variable
+    holding each host's token: {"tokens": {"git.example.com": "EXAMPLE_TOKEN"}}.
+  - --workspace packs one member of a monorepo (by name or directory) plus the members it
+    depends on, using go.work, pnpm-workspace.yaml, package.json workspaces, Nx or Cargo
+    workspaces; root-level workspace manifests are kept for context.
+  - --files-from packs exactly the listed paths or bazel labels (one per line, - for stdin), e.g.
+    bazel query 'kind("source file", deps(//app))' | packprompt pack --files-from -;
+    --bazel-target runs that query itself. Listed files that cannot be packed are reported.
+  - --go-deps ./... packs exactly the files go list -deps reports for the build inside the tree:
+    Go, cgo and assembly sources, headers, syso objects, embedded files and go.mod/go.work.
+  - --seed (repeatable) packs a JS/TS or Python file plus its transitive local imports, following
+    relative paths, tsconfig baseUrl/paths, index files and Python packages.
+  - --coverprofile adds "// packprompt:coverage" comments with statement coverage to Go files:
+    one per file, and with --cover-detail func one above each function. Unpack strips them.
+  - --split-by dir writes one pack per top-level directory next to --out (files-prompt.cmd.txt,
+    files-prompt.internal.txt, ...; root files go to files-prompt._root.txt), each opening with
+    a tree of the whole selection. --split-by lang groups by detected language instead
+    (files-prompt.go.txt, files-prompt.typescript.txt, ...; unrecognised files in .other).
+  - --split-tokens N (e.g. 100k) writes files-prompt.part1.txt, part2, ... each under N tokens
+    for --model, whole entries in order with the tree in part 1 only, and removes parts left
+    over from an earlier, longer split. A file too big for a part fails the pack unless
+    --split-force cuts it at line boundaries across parts, each piece marked chunk=K/N (and
+    offset=BYTES); unpack the parts in order and each piece is joined onto the ones before.
+  - --map (repeatable) packs files from other locations under a chosen archive prefix, e.g.
+    --map ../shared-lib=vendor/shared-lib; unpack recreates them under that prefix.
+  - --attach (repeatable) appends design docs, issue exports or specs, read from a path or
+    fetched over HTTP, in a separate attachments section under _attachments/. Unpack skips
+    them unless --attachments is given.
+  - --note (repeatable) attaches a remark to the files matching a glob, e.g.
+    --note "pkg/auth/*.go=this is the suspicious area": each becomes a "--- NOTE text ---" line
+    between the entry header (which counts them in notes=N) and the content, so the model reads
+    it first. view shows an entry's notes; unpack never writes them into files.
+  - --with-meta ends each entry with "--- META ... ---" lines (counted in meta=N) giving its
+    size, modification time (not with --reproducible), and the hash, subject, date and author
+    of the last commit touching it, for audits and reviews. unpack strips them.
+  - --contract ends the pack with a response contract telling the model exactly how to answer:
+    only the files it changes, each whole, as packprompt v2 file blocks whose header echoes the
+    sha256=HASH every packed file carries as base=HASH (base=new for new files, deleted=true
+    to delete), and tells it to leave derived entries (converted, transformed, truncated,
+    encoded, chunked, archive members) alone.
+  - --relevant-to orders files by BM25 relevance to a question (words in the path count double,
+    identifiers are split on camelCase and _), most pertinent first; --relevant-top N and
+    --relevant-budget 200k keep only the best matches. Ties keep the key-file order.
+  - --embed-query keeps the --embed-top files (default 20) whose chunks are most similar to the
+    query, best first, using an OpenAI-compatible embeddings API (--embed-url, or a local Ollama
+    at http://localhost:11434/v1; key from PACKPROMPT_EMBED_KEY, PACKPROMPT_API_KEY or OPENAI_API_KEY). Vectors are
+    cached per model in the user cache directory, so repeat runs only embed changed chunks.
+  - --convert packs Jupyter notebooks (markdown cells, fenced code cells and their text output)
+    and .docx/.odt/.rtf documents (headings, lists, tables and text) as markdown entries named
+    after the source plus .md (report.docx.md), marked converted=NAME in the header, instead of
+    raw JSON or skipping them as binary. --convert pdf extracts the text layer of PDFs (pages
+    marked <!-- page N -->, opening with a note that the conversion is lossy); scanned and
+    encrypted PDFs are reported as not converted. Converting a type overrides the default
+    exclude for it (*.pdf). --convert sqlite and csv summarize data instead of dumping it: the
+    schema of .db/.sqlite files (read directly, no sqlite3 needed) with row counts and
+    --sample-rows rows per table, and for CSV/TSV files over --csv-summary-over (default 256k)
+    the header, row count, inferred column types and sample rows.
+  - --descend-archives treats .zip, .tar, .tar.gz and .tgz files as directories: their text
+    members are packed under pseudo-paths like bundle.zip!/src/main.c (nested archives too, up
+    to three deep), with the same excludes and binary detection, and the default *.zip/*.tar/*.gz
+    excludes lifted. Unpack writes them under a bundle.zip! directory.
+  - --root project.zip packs the members of a zip file, such as a repository snapshot, without
+    extracting it: the same excludes, --include and binary detection apply (--binary base64
+    too), archives inside are descended into only with --descend-archives, and a single
+    directory holding everything is dropped from the paths. Members are read into memory, so
+    the --descend-archives size limits apply; --convert and the git-based selections need a
+    directory.
+  - --links sets what the walk does with symlinks, and on Windows junctions and other reparse
+    points: record (the default) leaves them out and lists each, with its target, in the
+    omitted section; skip leaves them out unlisted; follow packs a linked file under the
+    link's path and walks a linked directory there. A directory already walked, or one that
+    contains or sits inside a tree already walked, is not walked again, so cycles and
+    duplicate trees are listed in the omitted section instead.
+  - --binary base64 packs binary files (small images, golden fixtures) base64-encoded in lines
+    of 76 with encoding=base64 in their header, instead of leaving them out; the default
+    excludes for images and *.bin are lifted. unpack, diff and export decode them, so pack and
+    unpack round-trip the tree byte for byte. Encoded entries are dropped, never truncated,
+    by --max-file-size and the budgets, and get no provenance comment or contract hash.
+  - --auto-transform rewrites common non-code files before they are counted and packed:
+    json-pretty indents minified .json, yaml-blobs collapses long base64 values in .yaml/.yml to
+    a placeholder, strip-ansi drops terminal escape codes from .log/.out files. Rewritten
+    entries carry transformed=NAMES in their header, since they no longer match the original.
+  - --token-budget 128k keeps files in pack order (key files, then relevance order if ranked)
+    while they fit, counted with the --model estimator; --dir-budget web/=20%,vendor/=0%,docs/=5k
+    caps a directory's tokens as a share of that budget (or of the whole selection without one)
+    or as a count, the most specific directory winning. Files over a budget are dropped, or with
+    --budget-overflow truncate cut at a line boundary to what is left (marked truncated=KEPT/TOTAL
+    in the header); both show in the omitted section.
+  - --fit-model gpt-4o|claude-3.7|llama3:70b|... guarantees the pack fits that model: it looks
+    up the context window (a built-in table, else a local Ollama via $OLLAMA_HOST), keeps
+    --fit-reserve tokens free for the question and answer (default a tenth of the window,
+    2k-32k), allows for the estimator's error, and then drops files in pack order (or truncates
+    them with --budget-overflow truncate) until the whole written pack, headers and omitted
+    section included, is within that. It combines with --token-budget and --dir-budget.
+  - --min-files N and --min-tokens N make pack fail, writing nothing, when fewer files or
+    tokens of content are left after every filter and budget, so automation notices an
+    exclude or filter that caught (nearly) everything; the error names the commonest reasons
+    paths were left out. --skip-report is still written and --dry-run fails the same way.
+  - Files and directories pack selected but cannot read (permissions, a file gone mid-run,
+    I/O errors) are left out and listed in the omitted section; the pack is still written,
+    then pack names them on stderr and exits 3, so automation can tell a partial pack from a
+    complete one. --fail-fast stops at the first instead, exiting 1 without writing.
+  - pack checks every path for what will not unpack elsewhere: characters Windows refuses
+    (<>:"|?*\), trailing dots and spaces, device names (CON, AUX, COM1, ...) and paths that
+    differ only in case, which collide on Windows and macOS. --portable-paths warn (the
+    default) warns about each and, in the text and markdown formats, leaves out paths with
+    whitespace or control characters, which an entry header cannot carry; rewrite packs them under portable names instead (_ for
+    bad characters, ~N for clashes) with a NOTE giving the real name; off skips the check.
+  - --dry-run prints the paths that would be packed, one per line, without writing anything;
+    --skip-report writes the paths left out with their reasons (path<TAB>reason). With -z/--print0
+    both end each path with NUL instead (skip reports then hold paths only), for xargs -0.
+  - --count-tokens reports the pack's size in tokens for --model (default gpt-4o) and how much
+    of that model's context window it takes. With the model's vocabulary in $PACKPROMPT_TOKENIZERS
+    (default packprompt/tokenizers under the user cache directory) the count is the tokenizer's
+    own: o200k_base.tiktoken for gpt-4o, gpt-4.1, gpt-5 and o-series, cl100k_base.tiktoken for
+    gpt-4 and gpt-3.5 (both from openaipublic.blob.core.windows.net/encodings/), llama3.tiktoken
+    (Llama 3's tokenizer.model) for llama. Otherwise, and always for claude, whose tokenizer is
+    not published, the counts are offline estimates that mimic each family's tokenizer (gpt-4o
+    and gpt-4 within about 10%, claude and llama about 15%, generic four bytes per token about
+    25%). Neither needs the network. Counting streams over files and the written pack, so memory
+    does not grow with file size; budgets and --fit-model count the same way.
+  - --encrypt-paths encrypts matching files (AES-256-GCM, key derived from a passphrase with
+    PBKDF2) while the rest of the pack stays readable; patterns without '/' match base names,
+    others the full path with ** for any depth. The passphrase comes from --passphrase-file or
+    PACKPROMPT_PASSPHRASE, on pack and unpack; without one unpack skips encrypted files.
+  - --pre-pack, --post-pack, --pre-unpack and --post-unpack run shell commands (sh -c, in order,
+    output on stderr) around pack and unpack, usually set in the user config (not the project's;
+    see packprompt help config):
+    {"pack": {"pre-pack": "go generate ./...", "post-pack": ["wc -c \"$PACKPROMPT_HOOK_OUTPUT\""]}}.
+    A failing pre hook aborts the command and a failing post hook makes it exit non-zero. Hooks
+    get PACKPROMPT_HOOK (the hook's name) and PACKPROMPT_HOOK_ROOT and _OUTPUT for pack (one
+    path per line with --split-by), plus _FILES, _TOKENS and _MODEL after it; _INPUT and _DEST
+    for unpack, plus _FILES (the files written) after it. --dry-run skips post-pack.
+  - --manifest FILE also writes a JSON manifest of the pack: each entry's path, id, mode, size
+    and the SHA-256 of its packed content, for request-missing and verify --manifest. With
+    --if-changed, pack first compares the tree hash of what it would pack (paths, modes and
+    contents after every filter, as hash prints) and its options with those the manifest
+    recorded, and exits without writing anything, hooks included, when both match and the
+    packs it lists still exist; for cron and CI jobs that republish packs.
+  - Every entry header carries id=ID, eight hex digits hashed from its path, so the same file
+    has the same ID in every pack and a short, unambiguous name in a conversation. Commands
+    taking IDs accept any unique prefix of four or more digits.
+  - pack --format jsonl writes one JSON object per line for each file instead of the text
+    markers: {"path", "mode", "content", "sha256"}, plus "id", "encoding" (base64, also used
+    for content that is not UTF-8), "notes", "meta", "attachment" and any other header
+    attributes under "attrs". It has no tree or omitted section (--skip-report lists what was
+    left out) and cannot carry --contract or a --footer. unpack --format jsonl reads it.
+  - pack --format markdown writes each file as a "### path" heading, an HTML comment with its
+    mode and header attributes, its notes as quoted lines, and a fenced code block tagged with
+    its language, fenced with more backticks than any run in the content; --with-meta lines
+    follow the block, quoted. Attachments and the omitted section get "## Attachments" and
+    "## Omitted" headings. As with jsonl there is no tree, --contract or --footer, and unpack
+    --format markdown reads it back.
+  - pack --format tar writes a tar archive (gzipped with --gzip) of the selected files as they
+    are, binary ones included when --binary base64 lets them in, for tools that speak tar. The
+    header attributes, notes and meta go in PAX records as user.packprompt.* extended
+    attributes, which tar ignores unless extracting with --xattrs; each member has its file's
+    modification time, or the --reproducible one. There is no tree, omitted section, --contract,
+    --footer or token count. unpack reads it, gzipped or not, and tars from other tools too:
+    regular files only, with --include, --exclude and the other checks applying as usual.
+  - pack --format xml writes the files as <document index path mode ...> elements in a
+    <documents> root, the layout models are prompted with, each with its header attributes,
+    <note> and <meta> elements and its content, escaped, in <document_content>. Content XML
+    cannot hold (control characters, invalid UTF-8) is base64 encoded. Attachments and the
+    omitted section get <attachments> and <omitted> elements; there is no tree, --contract or
+    --footer. unpack --format xml reads it back, and also documents naming their file in a
+    <source> element instead of a path attribute.
+  - pack --out - writes the pack to stdout and unpack --in - reads it from stdin, for
+    pipelines such as packprompt pack --out - | pbcopy or curl URL | packprompt unpack --in -;
+    pack then reports on stderr, and cannot split or write a --manifest.
+`},
+	"run": {"run RECIPE [pack flags] | run --list", `  - Recipes are named pack definitions in the config's "recipes" section: pack options keyed
+    by flag name, plus an optional description and extends (a recipe name or list whose options
+    come first):
+      {"recipes": {"review": {"description": "code review", "exclude": ".git,dist", "auto-transform": true},
+                   "review-web": {"extends": "review", "root": "web", "out": "web-review.txt"}}}
+  - A recipe's options beat the environment, profiles and the pack section; flags after the
+    recipe name beat the recipe. run --list lists the recipes with their descriptions.
+`},
+	"unpack": {"unpack [flags]", `  - unpack keeps its progress in DEST/.packprompt-unpack.state (entries done and their SHA-256)
+    until it finishes; after an interruption --resume skips files already extracted intact.
+    Each file is written through a temp file of its own beside it (NAME.PID-RANDOM.tmp~ftp,
+    created exclusively) and renamed into place, so concurrent unpacks never share one; temp
+    files left in a directory by a process that no longer exists are removed, with a warning,
+    the first time unpack writes there.
+  - unpack never writes outside --dest: paths with "..", absolute paths and, on Windows,
+    drive letters are refused, and so are writes through a symlink in --dest that leads out
+    of it (the kernel enforces this with openat2 RESOLVE_BENEATH on Linux 5.6+; elsewhere each
+    directory is checked first). A symlink where a file goes is replaced, not written through.
+    --confine=false follows symlinks wherever they lead, as before.
+  - unpack --preview draws the tree unpacking would write under --dest, each file marked new,
+    modified or unchanged against what is there (green, yellow, dim), with a count of each,
+    and writes nothing; run it again without --preview to extract.
+  - unpack --route PATTERN=DEST (repeatable) fans one pack out into several trees: each entry
+    goes to the first route whose glob matches, less the directories the pattern names before
+    its first wildcard, so --route 'infra/**=../infra-repo' --route '**=.' writes
+    infra/main.tf as ../infra-repo/main.tf (undoing pack --map ../infra-repo=infra) and the
+    rest into the current directory. Entries no route matches are left out and counted. The
+    checks, --on-conflict and --dry-run apply per destination; --preview and --git-commit
+    cannot be combined with it, and the --resume progress file stays in --dest.
+  - unpack --on-conflict says what to do with a file already in --dest that the pack would
+    change (one with the same content is no conflict): overwrite it (the default), skip it,
+    backup (keep the old file as FILE.orig, or FILE.orig.N if that is taken) or prompt, asking
+    per file on the terminal: yes, no, backup, all (overwrite the rest) or none (skip the
+    rest). A file's first entry decides for its later chunks; --dry-run marks such files
+    keep, backup or ask.
+  - unpack detects the format from the start of the pack: JSON Lines open with an object, and
+    otherwise the first entry header, <document> element or markdown heading followed by a
+    comment or fence decides, falling back to text. --format names it instead.
+  - unpack --dry-run lists, in pack order, every file it would create or overwrite with its
+    size, and for a file already there its size or "same content", then totals them. It runs
+    the protected-path, policy and --scan checks first, so it fails as the unpack would, but
+    writes nothing, not even --dest.
+  - unpack refuses, writing nothing, a pack with entries in version-control internals (.git,
+    .hg, .svn, whose hooks would run code), .ssh, .gnupg, .env, .env.local, .envrc or .netrc,
+    at any depth, unless --allow-protected is given; apply refuses them the same way.
+  - unpack --scan warn|fail scans incoming files for hard-coded credentials (private keys,
+    cloud, GitHub, GitLab, Slack, Stripe and model API keys, tokens, passwords in URLs and
+    assignments) and personal data (card numbers passing the Luhn check, US SSNs), skipping
+    what the file at --dest already holds. warn prints each, masked, with its line; fail writes
+    nothing if there are any.
+  - unpack --scan-report FILE (or - for stdout) also writes what the protected-path, policy and
+    --scan checks found, as SARIF 2.1.0 for code-scanning uploads or, with --scan-report-format
+    github, as GitHub Actions annotations against each file and line. Errors are what refuse the
+    unpack; --scan warn findings are warnings. The report is written even when nothing is found.
+  - unpack and apply --changelog FILE append an audit entry per run once everything is written:
+    when, who, the pack (and its SHA-256), --source (say, the conversation it came from) and
+    each file added, changed or deleted. --changelog-template replaces the markdown default
+    with a Go text/template over .Time .Command .Pack .SHA256 .Source .Dest .User .Host
+    .Added .Changed .Deleted .Unchanged and .Files (with join, as in {{join .Files ", "}}),
+    given inline or as @FILE.
+  - Every entry header carries sha256=HASH of the content unpack writes (the file, or the
+    converted, transformed or truncated view packed instead; a chunk's own bytes), except
+    encrypted entries, which their cipher guards. unpack reads back each file it writes and
+    checks it against the hash, and if any differ, as when a model or a copy and paste mangled
+    the pack on the way, it names them and exits 1 after writing, without logging, committing
+    or running post-unpack hooks; --no-verify skips the check.
+  - unpack and apply --git-commit stage exactly the files they added, changed or deleted and
+    commit them, leaving anything else staged alone; --git-branch NAME first switches to a new
+    branch (refusing one that exists) so the change can go through a pull request and CI. The
+    message names the pack and files, with Pack-SHA256 and Source trailers; --git-message takes
+    a template over the same fields as --changelog-template.
+  - unpack --include and --exclude take comma-separated globs (as pack's, ** spans
+    directories) to extract part of a pack, e.g. --include 'cmd/**' or --exclude testdata; a
+    pattern matching a directory covers everything in it. --preview and the checks before
+    writing see only the entries selected.
+  - unpack enforces a policy from --policy FILE, or --dest/.packprompt-policy.yaml if there is
+    one: allow (path prefixes), deny (globs, e.g. .github/workflows/**), max-file-size, and
+    restore-modes / allow-exec (false writes 0644 / drops executable bits), and require-signed
+    (true acts as --require-signed). Every entry is
+    checked first and a pack breaking any rule writes nothing; nor can it replace the policy.
+`},
+	"apply": {"apply [flags]", `  - apply writes a model's answer to a --contract pack into --root. Parsing is strict: malformed
+    or unterminated blocks, a missing base, text between blocks, duplicate paths and elided
+    content ("... rest unchanged") reject the whole response. A file whose base no longer
+    matches the local copy is a conflict; nothing is written unless all files are clean or
+    --force is given. apply --check writes nothing: it reports each file as ok (new, deleted)
+    or CONFLICT with why (protected path, stale base, exists already, hunks that do not
+    apply even with --fuzz), and exits 1 if any would not apply cleanly.
+  - Each file's packed sha256 is the base apply compares the local copy with. --on-stale says
+    what to do when they differ: conflict (the default), overwrite (as --force does for these
+    files), or merge: a three-way merge, like git's, of the local changes and the response's
+    onto the packed version read from --pack (the pack the response answers; repeatable, the
+    version is found by its sha256). Changes to
+    different lines both apply; overlapping ones are written between <<<<<<< local and
+    >>>>>>> response markers, and apply names those files and exits 1, without logging or
+    committing. A file both sides added merges from empty; stale deletes still conflict.
+  - A response block with patch=unified holds a unified diff against the packed file instead
+    of the whole file. Like patch(1), apply finds each hunk where it says, allowing for the
+    drift of the hunks before it, then at the nearest place its lines match (ignoring trailing
+    whitespace), then with up to --fuzz lines (default 2) of context at each end ignored, and
+    reports hunks that moved or needed fuzz. A stale base is no conflict for a patch; hunks
+    that still do not apply go to FILE.rej, and apply then names them and exits 1 after
+    writing the rest, without logging or committing.
+`},
+	"explain": {"explain [pack flags] PATH...", `  - explain shows why pack would pack or leave out each PATH, like git check-ignore -v: the
+    rules in the order pack applies them (--exclude patterns on the path and its directories,
+    file type, the output being written, --convert, --descend-archives, binary and earlier-pack
+    detection, then the selection filters and budgets) and the one that decided. It takes
+    pack's flags and config section, so pass the same flags as the pack in question.
+`},
+	"hash": {"hash [pack flags]", `  - hash prints a deterministic hash of the tree pack would pack (sha256:HEX over the sorted
+    paths, modes and contents left after every filter), taking pack's flags and its config
+    section, for build systems deciding whether to regenerate a pack. It writes nothing (no
+    --skip-report either), runs no hooks, fetches no --attach documents and ignores --dry-run.
+`},
+	"request-missing": {"request-missing [flags]", `  - request-missing checks a copy of a pack against the manifest pack --manifest wrote
+    (typically a model's answer that stopped short) and, when entries are missing, cut off
+    before their end line or changed, prints a ready-to-send follow-up prompt asking for
+    exactly those entries again, with their header lines. It prints nothing when the copy is
+    complete.
+`},
+	"ask": {"ask [flags] QUESTION|-", `  - ask sends the pack and a question to a chat model and prints the answer; summarize asks for
+    an overview of the project (optionally with a FOCUS). --provider openai works with any
+    OpenAI-compatible API (key from PACKPROMPT_API_KEY or OPENAI_API_KEY); ollama and llamacpp
+    talk to local servers and discover the model's context window from them (Ollama's num_ctx
+    or context_length, llama.cpp's n_ctx), falling back to the --fit-model table of common models;
+    --context N overrides both. When the pack does not
+    fit the window minus --reserve (default 4k) tokens for the answer, only the files that fit
+    are sent, in pack order, and the rest listed as omitted. Ollama is asked to load the model
+    with a context large enough for the prompt instead of its small default.
+`},
+	"summarize": {"summarize [flags] [FOCUS]", `  - summarize asks a chat model for an overview of the project, optionally with a FOCUS,
+    and takes the same flags as ask; see packprompt help ask.
+`},
+	"serve": {"serve [flags]", `  - serve is a JSON-RPC 2.0 server on stdin/stdout for editor plugins, framed like LSP
+    (Content-Length headers) or one message per line. Methods: packSelection {files, root,
+    model, contract} packs the given paths; packSymbol {name, ...} packs the files defining a
+    function, type or class of that name and lists the definitions; both return text, files
+    and a token count. applyResponse {text, root, force, allowProtected} applies a --contract answer like
+    apply, refusing protected paths unless allowProtected, and returns what changed or the
+    conflicts. initialize, shutdown and exit are accepted too.
+`},
+	"export": {"export [flags]", `  - export --format chunks turns a pack into JSON lines for vector-store ingestion: each file is
+    split on line boundaries into chunks of about --chunk-tokens tokens (default 800), sharing
+    --overlap tokens (default 100) with the previous chunk, with id, path, language and line
+    range metadata. --format langchain writes LangChain Documents (page_content, metadata) and
+    --format llamaindex LlamaIndex TextNodes (id_, text, metadata), with source path, language and
+    line range; they hold whole files unless --chunk-tokens is given.
+`},
+	"list": {"list [flags]", `  - list prints each entry of a pack, extracting nothing: its ID, mode, size and line count as
+    unpack would write it, marking binary, encrypted (sized as stored without a passphrase),
+    attachment, chunk and truncated entries, then the totals. -z (--print0) prints only the
+    paths, each ended with NUL, for xargs -0. --in - reads the pack from stdin.
+`},
+	"cat": {"cat [flags] PATH... | --id ID ...", `  - cat prints the content of the entries named by path (or --id ID) to stdout, one after
+    another, as unpack would write them: decoded, decrypted with a passphrase, annotations
+    stripped and chunks joined, so one file can be read or piped on without unpacking.
+`},
+	"verify": {"verify [flags]", `  - verify re-reads a pack and checks every header, note and META count and end line, base64
+    and encryption (with a passphrase), per-entry sha256 checksums and the footer's digest and
+    signature; it prints each problem and exits 1 if the pack is cut off or corrupt. --manifest
+    also checks that every file the manifest lists is present and intact.
+`},
+	"stats": {"stats [flags]", `  - stats summarises a pack per language or top-level directory: files, lines, size, estimated
+    tokens and share of the total.
+`},
+	"view": {"view [flags]", `  - view browses a pack in the terminal without unpacking it: a tree of entries, the selected
+    file with syntax highlighting, and search across paths and contents (/, n, N). Keys: arrows
+    or j/k move, tab switches pane, space/b page, g/G top/bottom, q quits.
+`},
+	"diff": {"diff [flags]", `  - diff compares a pack with the files under --root as colored unified diffs (like git diff),
+    two columns with --side-by-side, a per-file summary of changed lines with --stat, or just
+    the files added (only in the pack), removed (only under --root) and modified with
+    --name-status. Removed files are those pack would find under --root, with the default
+    excludes or the --exclude and --include the pack was made with, that the pack lacks;
+    --removed=false leaves them out. --only-id ID (repeatable) limits it to those entries.
+`},
+	"keys": {"keys generate [NAME]|list|trust KEY.pub [flags]", `  - keys manages the keyring (--keyring, default $PACKPROMPT_KEYRING or packprompt/keys under
+    the user config directory): keys generate [NAME] creates an Ed25519 signing key NAME.key
+    (NAME or --name, default the user name) with NAME.pub beside it to hand out, keys trust KEY.pub records a signer's
+    public key under trusted/, e.g. CI's, and keys list shows both with fingerprints, the
+    key= value of signed footers. verify, unpack and apply --require-signed fail, writing
+    nothing, unless the footer is signed by a key in the keyring over a body that still
+    matches its digest; a pack with no footer, an unsigned footer or an untrusted signer fails.
+`},
+	"session": {"session start|pack|apply|status [flags]", `  - session keeps a conversation of several rounds in .packprompt/session.json at the root of
+    the tree (found from the current directory or above, like .git). session start begins one;
+    session pack packs the tree with --contract into .packprompt/round-N.txt and records the
+    sha256 of each file packed (with --dry-run it lists the paths and records nothing);
+    session apply keeps a copy of the response, refuses one applied before, and applies it
+    with --on-stale merge and --pack for every round, so a response that builds on an earlier
+    one or answers an earlier pack still merges; session status lists the rounds and the
+    files changed since the last pack, by a response or locally. Pack and apply
+    flags pass through, except --root and --out (and --split-*), which the session sets. pack
+    never packs .packprompt.
+`},
+	"report": {"report [flags] [DIR ...]", `  - report summarises the sessions of the trees DIR... (default: the current one) per day,
+    week or month: packs, responses applied, and average files, size and tokens per pack, with
+    the trend in tokens from one period to the next. It reads only the session files and the
+    packs kept beside them; nothing is collected or sent anywhere.
+`},
+	"completion": {"completion bash|zsh|fish", `  - Load with source <(packprompt completion bash), source <(packprompt completion zsh) or
+    packprompt completion fish | source. Completes commands, plugins, flags, --profile names
+    from the config and, for commands reading a pack, entry paths inside the --in pack.
+`},
+	"help": {"help [COMMAND|TOPIC]", ""},
+	"config": {"", `Options not given as flags come from, in order: PACKPROMPT_<COMMAND>_<FLAG> (PACKPROMPT_PACK_OUT,
+PACKPROMPT_ASK_MODEL; lists comma-separated), then PACKPROMPT_<FLAG>: PACKPROMPT_EXCLUDE and
+PACKPROMPT_INCLUDE for every command with --exclude or --include, any other for pack only
+(PACKPROMPT_OUT, PACKPROMPT_FORMAT; other commands warn they ignore it), then
+the --profile (or PACKPROMPT_PROFILE) section of the config, the config itself, then the defaults.
+Config is JSON, keyed by command and flag name, read from $XDG_CONFIG_HOME/packprompt/config.json
+(or the OS equivalent) and then ./.packprompt.json; --config (or PACKPROMPT_CONFIG) replaces both:
+  {"pack": {"exclude": ".git,dist", "model": "claude"},
+   "profiles": {"ci": {"pack": {"reproducible": true, "footer": true}}}}
+A shared base config, say an organisation's default excludes and policies, comes from the
+https:// URL in "base" (or PACKPROMPT_BASE_CONFIG), and the local files are layered over it.
+It is cached under the user cache directory, used as is while its Cache-Control max-age lasts
+and then revalidated with its ETag or Last-Modified; when the URL cannot be reached the cached
+copy is used, with a warning. Recipes for run go in the config too; see packprompt help run.
+API keys for LLM features: PACKPROMPT_EMBED_KEY, else PACKPROMPT_API_KEY, else OPENAI_API_KEY.
+A checkout or a server chooses the project and base configs, so they cannot set the hooks
+(pre-pack, post-pack, pre-unpack, post-unpack), the safety options (confine, allow-protected,
+no-verify, force, on-stale, require-signed, keyring, policy, scan) or where keys are sent
+(url, embed-url, tokens); those are ignored, with a warning, unless PACKPROMPT_TRUST_CONFIG=1.
+
+--max-memory SIZE (e.g. 256MB), taken by every command, is a target for peak memory in small CI
+containers. It sets the Go runtime's soft memory limit, so the collector works harder rather
+than the heap growing, and runs fewer parallel workers. Hashing and token counting stream, and
+verify, --require-signed, --changelog and --git-commit read a pack file an entry at a time;
+conversions, archive members, a tar pack under verify and a pack on stdin (--in -, which unpack
+reads more than once) are still held whole.
+`},
+	"output": {"", `Output meant for people (stats, diff, unpack --preview, keys list) is colored, column-aligned
+and paged through $PAGER (default less -FRX) on a terminal; NO_COLOR disables colors and --plain
+both colors and pager.
+`},
+	"plugins": {"", `packprompt NAME [ARGS...] runs packprompt-NAME from PATH with ARGS when NAME is not built in.
+Stdin, stdout, stderr and the exit status pass straight through. The plugin gets
+PACKPROMPT_BIN (this executable), PACKPROMPT_VERSION, PACKPROMPT_PLUGIN and
+PACKPROMPT_PLUGIN_CONTEXT, a JSON object with version, executable, plugin, args, dir, profile,
+config (the config section named after the plugin, with the profile applied) and config_files.
+`},
+}
+
+// helpCmd prints usage, or the help of the command or topic named.
+func helpCmd(args []string) {
+	if len(args) == 0 {
+		usage()
+		return
+	}
+	name := args[0]
+	h, ok := commandHelp[name]
+	if !ok {
+		fatal(fmt.Errorf("help: no command or topic %q (see packprompt help)", name))
+	}
+	if h.synopsis == "" {
+		fmt.Print(h.details)
+		return
+	}
+	fmt.Printf("usage: packprompt %s\n", h.synopsis)
+	if subs, ok := map[string][][2]string{"keys": keysSubcommands, "session": sessionSubcommands}[name]; ok {
+		fmt.Print("\nSubcommands:\n")
+		for _, s := range subs {
+			fmt.Printf("  %-10s %s\n", s[0], s[1])
+		}
+		for _, s := range subs {
+			printFlags(name+" "+s[0], commandFlags(name, s[0]))
+		}
+	} else {
+		printFlags(name, commandFlags(name))
+	}
+	if h.details != "" {
+		fmt.Printf("\nDetails:\n%s", h.details)
+	}
+}
+
+// printFlags lists a command's flags one per line, leaving out the ones
+// every command takes. A command taking another's flags is pointed there.
+func printFlags(title string, flg *flag.FlagSet) {
+	if flg == nil {
+		return
+	}
+	if cmd, _, _ := strings.Cut(title, " "); flg.Name() != cmd {
+		fmt.Printf("\n%s takes %s's flags (see packprompt help %s).\n", title, flg.Name(), flg.Name())
+		return
+	}
+	shared := flag.NewFlagSet("", flag.ContinueOnError)
+	addSharedFlags(shared)
+	var names, usages []string
+	width := 0
+	flg.VisitAll(func(f *flag.Flag) {
+		if shared.Lookup(f.Name) != nil {
+			return
+		}
+		kind, usage := flag.UnquoteUsage(f)
+		name := strings.TrimSpace("--" + f.Name + " " + kind)
+		switch f.DefValue {
+		case "", "false", "0", "[]":
+		default:
+			usage += fmt.Sprintf(" (default %q)", f.DefValue)
+		}
+		names, usages = append(names, name), append(usages, usage)
+		width = max(width, len(name))
+	})
+	if len(names) == 0 {
+		return
+	}
+	fmt.Printf("\n%s flags:\n", title)
+	for i, name := range names {
+		fmt.Printf("  %-*s  %s\n", width, name, usages[i])
+	}
+}
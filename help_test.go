@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestHelp checks usage lists each command on one line, help CMD gives a
+// command's flags and details, and every builtin command has help.
+func TestHelp(t *testing.T) {
+	dir := t.TempDir()
+	res := runCLI(t, dir, "help")
+	if res.code != 0 || strings.Count(res.stdout, "\n") > len(builtinCommands)+10 {
+		t.Errorf("help: exit %d, %d lines:\n%s", res.code, strings.Count(res.stdout, "\n"), res.stdout)
+	}
+	res = runCLI(t, dir, "help", "pack")
+	for _, want := range []string{"usage: packprompt pack", "--split-tokens string", "Details:", "Default excludes"} {
+		if !strings.Contains(res.stdout, want) {
+			t.Errorf("help pack: no %q in\n%s", want, res.stdout)
+		}
+	}
+	if strings.Contains(res.stdout, "--max-memory") {
+		t.Errorf("help pack lists the shared flags")
+	}
+	if res := runCLI(t, dir, "help", "hash"); !strings.Contains(res.stdout, "hash takes pack's flags") {
+		t.Errorf("help hash:\n%s", res.stdout)
+	}
+	if res := runCLI(t, dir, "help", "nope"); res.code != 1 {
+		t.Errorf("help nope: exit %d", res.code)
+	}
+	for _, c := range builtinCommands {
+		if commandHelp[c[0]].synopsis == "" {
+			t.Errorf("%s: no help", c[0])
+		}
+	}
+}
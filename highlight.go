@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keywords per language for the viewer's syntax highlighting
+var langKeywords = map[string]string{
+	"go": "break case chan const continue default defer else fallthrough for func go goto if import " +
+		"interface map package range return select struct switch type var nil true false iota",
+	"python": "and as assert async await break class continue def del elif else except finally for from " +
+		"global if import in is lambda nonlocal not or pass raise return try while with yield None True False self",
+	"javascript": "async await break case catch class const continue debugger default delete do else export " +
+		"extends finally for from function if import in instanceof let new of return static super switch this " +
+		"throw try typeof var void while yield null undefined true false",
+	"rust": "as async await break const continue crate dyn else enum extern fn for if impl in let loop match " +
+		"mod move mut pub ref return self Self static struct super trait type unsafe use where while true false",
+	"java": "abstract boolean break byte case catch char class continue default do double else enum extends " +
+		"final finally float for if implements import instanceof int interface long new package private " +
+		"protected public return short static super switch this throw throws try void while null true false",
+	"c": "auto break case char const continue default do double else enum extern float for goto if inline int " +
+		"long register return short signed sizeof static struct switch typedef union unsigned void volatile while " +
+		"class namespace template typename public private protected virtual nullptr true false",
+	"shell": "if then else elif fi case esac for while until do done in function return local export",
+	"ruby": "alias and begin break case class def defined do else elsif end ensure false for if in module next " +
+		"nil not or redo rescue retry return self super then true undef unless until when while yield",
+}
+
+// languages sharing another's keyword list
+var keywordAlias = map[string]string{
+	"typescript": "javascript", "cpp": "c", "csharp": "java", "kotlin": "java", "scala": "java",
+	"swift": "rust", "dart": "java", "objectivec": "c",
+}
+
+var keywordSets = map[string]map[string]bool{}
+
+func init() {
+	for lang, words := range langKeywords {
+		set := map[string]bool{}
+		for _, w := range strings.Fields(words) {
+			set[w] = true
+		}
+		keywordSets[lang] = set
+	}
+	for lang, base := range keywordAlias {
+		keywordSets[lang] = keywordSets[base]
+	}
+}
+
+// highlighter colors source lines one at a time, carrying block-comment
+// state from line to line.
+type highlighter struct {
+	keywords            map[string]bool
+	line                string // line comment prefix
+	blockOpen, blockEnd string
+	quotes              bool // highlight string literals; off for prose
+	backtick            bool // ` delimits strings
+	inBlock             bool
+}
+
+func newHighlighter(rel string) *highlighter {
+	lang := detectLanguage(rel)
+	h := &highlighter{keywords: keywordSets[lang]}
+	if cs, ok := commentStyle(rel); ok {
+		if cs[1] == "" {
+			h.line = cs[0]
+		} else {
+			h.blockOpen, h.blockEnd = cs[0], strings.TrimSpace(cs[1])
+		}
+	}
+	switch lang {
+	case "go", "javascript", "typescript", "c", "cpp", "java", "csharp", "kotlin", "scala", "rust", "swift", "dart", "css", "scss", "less":
+		h.blockOpen, h.blockEnd = "/*", "*/"
+	}
+	h.quotes = lang != "" && lang != "markdown" && lang != "rst" && lang != "latex" && lang != "text"
+	h.backtick = lang == "go" || lang == "javascript" || lang == "typescript" || lang == "shell"
+	return h
+}
+
+// span is a run of a line in one style ("" for plain).
+type span struct {
+	text, style string
+}
+
+func (h *highlighter) spans(line string) []span {
+	var out []span
+	emit := func(text, style string) {
+		if text == "" {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].style == style {
+			out[n-1].text += text
+			return
+		}
+		out = append(out, span{text, style})
+	}
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		switch {
+		case h.inBlock:
+			end := strings.Index(rest, h.blockEnd)
+			if end < 0 {
+				emit(rest, styleDim)
+				return out
+			}
+			emit(rest[:end+len(h.blockEnd)], styleDim)
+			i += end + len(h.blockEnd)
+			h.inBlock = false
+		case h.blockOpen != "" && strings.HasPrefix(rest, h.blockOpen):
+			emit(h.blockOpen, styleDim)
+			i += len(h.blockOpen)
+			h.inBlock = true
+		case h.line != "" && strings.HasPrefix(rest, h.line):
+			emit(rest, styleDim)
+			return out
+		case h.quotes && (rest[0] == '"' || rest[0] == '\'' || (rest[0] == '`' && h.backtick)):
+			end := stringEnd(rest)
+			emit(rest[:end], styleGreen)
+			i += end
+		case rest[0] >= '0' && rest[0] <= '9':
+			j := 1
+			for j < len(rest) && (isWordByte(rest[j]) || rest[j] == '.') {
+				j++
+			}
+			emit(rest[:j], styleYellow)
+			i += j
+		case isWordByte(rest[0]) || rest[0] >= utf8.RuneSelf:
+			j := 0
+			for j < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[j:])
+				if !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+					break
+				}
+				j += size
+			}
+			if j == 0 {
+				_, j = utf8.DecodeRuneInString(rest)
+			}
+			style := ""
+			if h.keywords[rest[:j]] {
+				style = styleBlue
+			}
+			emit(rest[:j], style)
+			i += j
+		default:
+			emit(rest[:1], "")
+			i++
+		}
+	}
+	return out
+}
+
+// stringEnd finds the end of the string literal opening s, honouring
+// backslash escapes; unterminated strings run to the end of the line.
+func stringEnd(s string) int {
+	q := s[0]
+	for j := 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			if q != '`' {
+				j++
+			}
+		case q:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// hookEnv is what a hook learns about the run, as PACKPROMPT_HOOK_<KEY>
+// variables; PACKPROMPT_HOOK names the hook itself. The prefix keeps them
+// apart from the PACKPROMPT_<FLAG> options a nested packprompt would read.
+type hookEnv map[string]string
+
+// runHooks runs each command of a hook through sh -c in order, with its
+// output on stderr so it never mixes with packprompt's own stdout. The
+// first failure stops the run.
+func runHooks(hook string, cmds []string, env hookEnv) error {
+	vars := []string{"PACKPROMPT_HOOK=" + hook}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		vars = append(vars, "PACKPROMPT_HOOK_"+k+"="+env[k])
+	}
+	for _, c := range cmds {
+		cmd := exec.Command("sh", "-c", c)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+		cmd.Env = append(os.Environ(), vars...)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q: %w", hook, c, err)
+		}
+	}
+	return nil
+}
+
+// packedStats counts the entries and estimated tokens of written packs,
+// for post-pack hooks.
+func packedStats(paths []string, est tokenEstimator) (files, tokens int) {
+	for _, p := range paths {
+		n, err := est.countFile(p)
+		if err != nil {
+			continue
+		}
+		tokens += n
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		_ = readPack(f, func(packedFile) error { files++; return nil })
+		f.Close()
+	}
+	return files, tokens
+}
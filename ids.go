@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// Every entry header carries id=ID, a short hash of its path, so a
+// conversation can name a file briefly and unambiguously; the same path
+// gets the same ID in every pack.
+const (
+	idAttr = packprompt.IDAttr
+	// minIDPrefix is the shortest abbreviation of an ID commands accept.
+	minIDPrefix = 4
+)
+
+// id is the entry's ID, derived from its path for packs written before IDs.
+func (pf packedFile) id() string {
+	if id, ok := pf.attrs[idAttr]; ok {
+		return id
+	}
+	return packprompt.EntryID(pf.rel)
+}
+
+// idSelector matches entries against IDs given on the command line; each
+// may be abbreviated to minIDPrefix characters.
+type idSelector struct {
+	ids  []string
+	seen map[string][]string // id -> paths it matched
+}
+
+func newIDSelector(ids []string) (*idSelector, error) {
+	s := &idSelector{seen: map[string][]string{}}
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if len(id) < minIDPrefix || strings.Trim(id, "0123456789abcdef") != "" {
+			return nil, fmt.Errorf("invalid entry id %q: want at least %d hex digits", id, minIDPrefix)
+		}
+		s.ids = append(s.ids, id)
+	}
+	return s, nil
+}
+
+func (s *idSelector) match(pf packedFile) bool {
+	id, ok := pf.id(), false
+	for _, want := range s.ids {
+		if strings.HasPrefix(id, want) {
+			s.seen[want] = append(s.seen[want], pf.rel)
+			ok = true
+		}
+	}
+	return ok
+}
+
+// check reports IDs that matched no entry or, abbreviated, several.
+func (s *idSelector) check() error {
+	var problems []string
+	for _, want := range s.ids {
+		switch paths := s.seen[want]; {
+		case len(paths) == 0:
+			problems = append(problems, fmt.Sprintf("no entry has id %s", want))
+		case len(paths) > 1:
+			sort.Strings(paths)
+			problems = append(problems, fmt.Sprintf("id %s is ambiguous: %s", want, strings.Join(paths, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
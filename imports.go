@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// a specifier never spans lines, so a string that merely mentions import
+	// does not swallow the statements after it
+	jsImportRe = regexp.MustCompile(`(?m)(?:^|[^\w$.])(?:import|export)\s[^'"]*?from\s*['"]([^'"\n]+)['"]` +
+		`|(?:^|[^\w$.])import\s*['"]([^'"\n]+)['"]` +
+		`|(?:^|[^\w$.])(?:require|import)\s*\(\s*['"]([^'"\n]+)['"]\s*\)`)
+	pyImportRe = regexp.MustCompile(`(?m)^\s*import\s+([\w.]+(?:\s*,\s*[\w.]+)*)`)
+	// names run to the end of the line, or to the closing parenthesis
+	pyFromImportRe = regexp.MustCompile(`(?m)^\s*from\s+(\.*[\w.]*)\s+import\s+(?:\(([\w\s,*]+)\)|([\w \t,*]+))`)
+
+	jsExts = []string{".ts", ".tsx", ".d.ts", ".mts", ".cts", ".js", ".jsx", ".mjs", ".cjs", ".json", ".vue", ".svelte"}
+)
+
+// importGraph resolves local imports for JS/TS and Python files under root.
+type importGraph struct {
+	root    string
+	baseURL string              // tsconfig compilerOptions.baseUrl, relative to root
+	paths   map[string][]string // tsconfig compilerOptions.paths
+}
+
+func newImportGraph(root string) *importGraph {
+	g := &importGraph{root: root}
+	g.loadTSConfig("tsconfig.json")
+	return g
+}
+
+// loadTSConfig reads baseUrl and paths, following a relative "extends".
+func (g *importGraph) loadTSConfig(rel string) {
+	data, err := os.ReadFile(filepath.Join(g.root, filepath.FromSlash(rel)))
+	if err != nil {
+		return
+	}
+	var cfg struct {
+		Extends         string `json:"extends"`
+		CompilerOptions struct {
+			BaseURL string              `json:"baseUrl"`
+			Paths   map[string][]string `json:"paths"`
+		} `json:"compilerOptions"`
+	}
+	if json.Unmarshal(jsonc(data), &cfg) != nil {
+		return
+	}
+	if strings.HasPrefix(cfg.Extends, ".") {
+		g.loadTSConfig(path.Join(path.Dir(rel), cfg.Extends))
+	}
+	if cfg.CompilerOptions.BaseURL != "" {
+		g.baseURL = path.Join(path.Dir(rel), cfg.CompilerOptions.BaseURL)
+	}
+	if cfg.CompilerOptions.Paths != nil {
+		g.paths = cfg.CompilerOptions.Paths
+		if g.baseURL == "" {
+			g.baseURL = path.Dir(rel)
+		}
+	}
+}
+
+var (
+	jsonBlockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	jsonLineComment  = regexp.MustCompile(`(?m)^\s*//.*$|([,{\[]\s*)//[^\n"]*$`)
+	jsonTrailComma   = regexp.MustCompile(`,(\s*[}\]])`)
+)
+
+// jsonc strips the comments and trailing commas tsconfig files allow.
+func jsonc(data []byte) []byte {
+	data = jsonBlockComment.ReplaceAll(data, nil)
+	data = jsonLineComment.ReplaceAll(data, []byte("$1"))
+	return jsonTrailComma.ReplaceAll(data, []byte("$1"))
+}
+
+func (g *importGraph) isFile(rel string) bool {
+	info, err := os.Stat(filepath.Join(g.root, filepath.FromSlash(rel)))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// closure returns seeds plus every local file they transitively import.
+func (g *importGraph) closure(seeds []string) (map[string]bool, error) {
+	seen := map[string]bool{}
+	queue := make([]string, 0, len(seeds))
+	for _, s := range seeds {
+		rel, ok := relToRoot(s, mustAbs(g.root))
+		if !ok || !g.isFile(rel) {
+			return nil, fmt.Errorf("--seed %s: not a file under the root", s)
+		}
+		if !isJSFile(rel) && !isPyFile(rel) {
+			return nil, fmt.Errorf("--seed %s: only JavaScript/TypeScript and Python are supported", s)
+		}
+		queue = append(queue, rel)
+	}
+	for len(queue) > 0 {
+		rel := queue[0]
+		queue = queue[1:]
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		data, err := os.ReadFile(filepath.Join(g.root, filepath.FromSlash(rel)))
+		if err != nil {
+			continue
+		}
+		var deps []string
+		switch {
+		case isJSFile(rel):
+			deps = g.jsImports(rel, string(data))
+		case isPyFile(rel):
+			deps = g.pyImports(rel, string(data))
+		}
+		for _, d := range deps {
+			if !seen[d] {
+				queue = append(queue, d)
+			}
+		}
+	}
+	return seen, nil
+}
+
+func isJSFile(rel string) bool {
+	for _, ext := range jsExts {
+		if strings.HasSuffix(rel, ext) && ext != ".json" {
+			return true
+		}
+	}
+	return false
+}
+
+func isPyFile(rel string) bool {
+	return strings.HasSuffix(rel, ".py") || strings.HasSuffix(rel, ".pyi")
+}
+
+func (g *importGraph) jsImports(from, src string) []string {
+	var out []string
+	for _, m := range jsImportRe.FindAllStringSubmatch(src, -1) {
+		spec := m[1] + m[2] + m[3]
+		if p, ok := g.resolveJS(from, spec); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (g *importGraph) resolveJS(from, spec string) (string, bool) {
+	var candidates []string
+	switch {
+	case strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") || spec == "." || spec == "..":
+		candidates = append(candidates, path.Join(path.Dir(from), spec))
+	case strings.HasPrefix(spec, "/"):
+		return "", false
+	default:
+		for pattern, targets := range g.paths {
+			prefix, suffix, wild := strings.Cut(pattern, "*")
+			if !wild {
+				if spec == pattern {
+					for _, t := range targets {
+						candidates = append(candidates, path.Join(g.baseURL, t))
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(spec, prefix) && strings.HasSuffix(spec, suffix) && len(spec) >= len(prefix)+len(suffix) {
+				star := spec[len(prefix) : len(spec)-len(suffix)]
+				for _, t := range targets {
+					candidates = append(candidates, path.Join(g.baseURL, strings.Replace(t, "*", star, 1)))
+				}
+			}
+		}
+		// bare specifiers resolve against baseUrl before node_modules
+		if g.baseURL != "" {
+			candidates = append(candidates, path.Join(g.baseURL, spec))
+		}
+	}
+	for _, c := range candidates {
+		if p, ok := g.resolveJSFile(c); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// resolveJSFile applies Node/TypeScript resolution: exact file, added
+// extension, TS sources for .js specifiers, then directory index files.
+func (g *importGraph) resolveJSFile(p string) (string, bool) {
+	if strings.HasPrefix(p, "../") || p == ".." {
+		return "", false
+	}
+	if g.isFile(p) {
+		return p, true
+	}
+	for _, ext := range jsExts {
+		if g.isFile(p + ext) {
+			return p + ext, true
+		}
+	}
+	// ESM TypeScript imports "./x.js" for a source file x.ts
+	for js, tsList := range map[string][]string{".js": {".ts", ".tsx"}, ".mjs": {".mts"}, ".cjs": {".cts"}, ".jsx": {".tsx"}} {
+		if strings.HasSuffix(p, js) {
+			for _, ts := range tsList {
+				if c := strings.TrimSuffix(p, js) + ts; g.isFile(c) {
+					return c, true
+				}
+			}
+		}
+	}
+	for _, ext := range jsExts {
+		if c := path.Join(p, "index"+ext); g.isFile(c) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func (g *importGraph) pyImports(from, src string) []string {
+	var out []string
+	for _, m := range pyImportRe.FindAllStringSubmatch(src, -1) {
+		for _, mod := range strings.Split(m[1], ",") {
+			out = append(out, g.resolvePy(from, strings.TrimSpace(mod), nil)...)
+		}
+	}
+	for _, m := range pyFromImportRe.FindAllStringSubmatch(src, -1) {
+		var names []string
+		for _, n := range strings.Split(m[2]+m[3], ",") {
+			if f := strings.Fields(n); len(f) > 0 && f[0] != "*" {
+				names = append(names, f[0])
+			}
+		}
+		out = append(out, g.resolvePy(from, m[1], names)...)
+	}
+	return out
+}
+
+// resolvePy maps a module (possibly relative, like "..pkg") to its file and
+// package __init__ files; names imported from it may be submodules.
+func (g *importGraph) resolvePy(from, mod string, names []string) []string {
+	var bases []string
+	if strings.HasPrefix(mod, ".") {
+		dots := len(mod) - len(strings.TrimLeft(mod, "."))
+		dir := path.Dir(from)
+		for i := 1; i < dots; i++ {
+			dir = path.Dir(dir)
+		}
+		bases = []string{path.Join(dir, strings.ReplaceAll(strings.TrimLeft(mod, "."), ".", "/"))}
+	} else {
+		modPath := strings.ReplaceAll(mod, ".", "/")
+		// absolute imports resolve from the root, a src/ layout, or above the importing package
+		for _, sr := range []string{".", "src", g.pySourceRoot(from)} {
+			bases = append(bases, path.Join(sr, modPath))
+		}
+	}
+
+	var out []string
+	for _, base := range bases {
+		var found []string
+		if g.isFile(base + ".py") {
+			found = append(found, base+".py")
+		} else if g.isFile(path.Join(base, "__init__.py")) {
+			found = append(found, path.Join(base, "__init__.py"))
+			for _, n := range names {
+				if c := path.Join(base, n+".py"); g.isFile(c) {
+					found = append(found, c)
+				} else if c := path.Join(base, n, "__init__.py"); g.isFile(c) {
+					found = append(found, c)
+				}
+			}
+		} else if base == path.Dir(from) || strings.TrimLeft(mod, ".") == "" {
+			// "from . import x" names sibling modules directly
+			for _, n := range names {
+				if c := path.Join(base, n+".py"); g.isFile(c) {
+					found = append(found, c)
+				}
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+		// parent packages run their __init__ on import too
+		for d := path.Dir(base); d != "." && d != "/" && !strings.HasPrefix(d, ".."); d = path.Dir(d) {
+			if c := path.Join(d, "__init__.py"); g.isFile(c) {
+				found = append(found, c)
+			}
+		}
+		out = append(out, found...)
+		break
+	}
+	sort.Strings(out)
+	return out
+}
+
+// pySourceRoot climbs out of the packages containing from.
+func (g *importGraph) pySourceRoot(from string) string {
+	d := path.Dir(from)
+	for d != "." && g.isFile(path.Join(d, "__init__.py")) {
+		d = path.Dir(d)
+	}
+	return d
+}
+
+func mustAbs(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	return abs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestImportClosure checks --seed follows the local imports of JS/TS and
+// Python files, in each form the resolvers understand, and nothing else.
+func TestImportClosure(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		files map[string]string
+		seed  string
+		want  []string
+	}{
+		{"typescript", map[string]string{
+			"tsconfig.json": `{
+  // the base config
+  "extends": "./tsconfig.base.json",
+  "compilerOptions": {"paths": {"@lib/*": ["src/lib/*"], "config": ["src/config.ts"],},},
+}`,
+			"tsconfig.base.json": `{"compilerOptions": {"baseUrl": "."}}`,
+			"src/main.ts": `import { a } from './a'
+import './side.js'
+const u = require("../util")
+export * from '@lib/c'
+import cfg from "config"
+import React from 'react'
+const lazy = await import('./lazy')
+foo.import('./not-an-import')
+import type { T } from "src/types"
+`,
+			"src/a.tsx":             "export const a = 1\n",
+			"src/side.ts":           "import { b } from './b.mjs'\n",
+			"src/b.mts":             "export const b = 2\n",
+			"util/index.js":         "module.exports = {}\n",
+			"src/lib/c.ts":          "export const c = 3\n",
+			"src/config.ts":         "export default {}\n",
+			"src/lazy.mjs":          "export default 4\n",
+			"src/types.d.ts":        "export type T = string\n",
+			"src/not-an-import.ts":  "",
+			"node_modules/react.js": "",
+		}, "src/main.ts", []string{
+			"src/a.tsx", "src/b.mts", "src/config.ts", "src/lazy.mjs", "src/lib/c.ts",
+			"src/main.ts", "src/side.ts", "src/types.d.ts", "util/index.js",
+		}},
+		{"python", map[string]string{
+			"app/__init__.py": "",
+			"app/main.py": `import os, app.util
+from . import models
+from .sub import (
+    helper,
+    thing as t,
+)
+from .sub.deep import *
+import pkgx
+`,
+			"app/util.py":           "",
+			"app/models.py":         "",
+			"app/unused.py":         "",
+			"app/sub/__init__.py":   "from .. import util\n",
+			"app/sub/helper.py":     "",
+			"app/sub/thing.py":      "",
+			"app/sub/deep.py":       "",
+			"app/sub/other.py":      "",
+			"src/pkgx/__init__.py":  "",
+			"src/pkgx/unrelated.py": "",
+		}, "app/main.py", []string{
+			"app/__init__.py", "app/main.py", "app/models.py", "app/sub/__init__.py", "app/sub/deep.py",
+			"app/sub/helper.py", "app/sub/thing.py", "app/util.py", "src/pkgx/__init__.py",
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			root := writeTree(t, c.files)
+			got, err := newImportGraph(root).closure([]string{filepath.Join(root, c.seed)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rels := slices.Sorted(maps.Keys(got)); !reflect.DeepEqual(rels, c.want) {
+				t.Errorf("closure = %q, want %q", rels, c.want)
+			}
+		})
+	}
+}
+
+// TestImportClosureSeeds checks seeds that cannot be followed are refused.
+func TestImportClosureSeeds(t *testing.T) {
+	root := writeTree(t, map[string]string{"main.go": "package main\n", "a.ts": ""})
+	for seed, want := range map[string]string{
+		"main.go":    "only JavaScript/TypeScript and Python are supported",
+		"missing.ts": "not a file under the root",
+		"../a.ts":    "not a file under the root",
+	} {
+		_, err := newImportGraph(root).closure([]string{filepath.Join(root, seed)})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("--seed %s: %v, want %q", seed, err, want)
+		}
+	}
+}
+
+func TestJSONC(t *testing.T) {
+	in := "{\n  // a comment\n  \"url\": \"http://example.com\", /* block */\n  \"list\": [1, 2,],\n}\n"
+	want := "{\n  \n  \"url\": \"http://example.com\", \n  \"list\": [1, 2]\n}\n"
+	if got := string(jsonc([]byte(in))); got != want {
+		t.Errorf("jsonc = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The keyring holds signing keys (NAME.key, with NAME.pub beside it to hand
+// out) and the public keys of signers this machine trusts (trusted/NAME.pub).
+const (
+	privateKeyExt = ".key"
+	publicKeyExt  = ".pub"
+	trustedDir    = "trusted"
+)
+
+// keysSubcommands lists keys' subcommands for completion.
+var keysSubcommands = [][2]string{
+	{"generate", "create a signing key"},
+	{"list", "list signing and trusted keys"},
+	{"trust", "trust a signer's public key"},
+}
+
+// defaultKeyring is $PACKPROMPT_KEYRING, or the keyring under the user
+// config directory.
+func defaultKeyring() string {
+	if dir := os.Getenv("PACKPROMPT_KEYRING"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "packprompt", "keys")
+}
+
+// keysOptions holds the flags of the keys subcommands.
+type keysOptions struct {
+	keyring, name string
+	force, plain  bool
+}
+
+// keysFlags declares the flags of keys sub into o; an unknown sub has only
+// --keyring.
+func keysFlags(sub string, o *keysOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("keys", flag.ExitOnError)
+	flg.StringVar(&o.keyring, "keyring", defaultKeyring(), "keyring directory")
+	switch sub {
+	case "generate":
+		flg.StringVar(&o.name, "name", "", "key name (default: the user name)")
+		flg.BoolVar(&o.force, "force", false, "replace an existing key of that name")
+	case "trust":
+		flg.StringVar(&o.name, "name", "", "name to trust the key as (default: the file name)")
+		flg.BoolVar(&o.force, "force", false, "replace a trusted key of that name")
+	case "list":
+		flg.BoolVar(&o.plain, "plain", false, "no colors and no pager")
+	}
+	return flg
+}
+
+// keysCmd manages the keyring used to sign packs and to decide whose
+// signatures to trust.
+func keysCmd(args []string) {
+	sub := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	var o keysOptions
+	flg := keysFlags(sub, &o)
+	parseFlags(flg, args)
+	switch sub {
+	case "generate":
+		switch {
+		case flg.NArg() > 1 || flg.NArg() == 1 && o.name != "" && o.name != flg.Arg(0):
+			fatal(errors.New("usage: packprompt keys generate [--force] [NAME], or --name NAME"))
+		case flg.NArg() == 1:
+			o.name = flg.Arg(0)
+		}
+		if o.name == "" {
+			o.name = currentPackEnv(false).user
+		}
+		if err := generateKey(o.keyring, o.name, o.force); err != nil {
+			fatal(err)
+		}
+	case "trust":
+		if flg.NArg() != 1 {
+			fatal(errors.New("usage: packprompt keys trust [--name NAME] KEY.pub"))
+		}
+		if err := trustKey(o.keyring, flg.Arg(0), o.name, o.force); err != nil {
+			fatal(err)
+		}
+	case "list":
+		if flg.NArg() > 0 {
+			fatal(errors.New("usage: packprompt keys list [--plain]"))
+		}
+		if err := listKeys(o.keyring, o.plain); err != nil {
+			fatal(err)
+		}
+	default:
+		fatal(errors.New("usage: packprompt keys generate|list|trust [flags]"))
+	}
+}
+
+// validKeyName keeps key names usable as file names everywhere.
+func validKeyName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\:*?"<>| `) {
+		return fmt.Errorf("invalid key name %q", name)
+	}
+	return nil
+}
+
+// generateKey writes a new Ed25519 signing key and its public half.
+func generateKey(keyring, name string, force bool) error {
+	if err := validKeyName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(keyring, 0o700); err != nil {
+		return err
+	}
+	priv := filepath.Join(keyring, name+privateKeyExt)
+	if _, err := os.Stat(priv); err == nil && !force {
+		return fmt.Errorf("%s already exists (use --force to replace it)", priv)
+	}
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(priv, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	pubPath := filepath.Join(keyring, name+publicKeyExt)
+	if err := writePublicKey(pubPath, pub); err != nil {
+		return err
+	}
+	fmt.Printf("Generated %s (%s)\n  sign with: packprompt pack --sign-key %s\n  share:     %s\n", name, keyFingerprint(pub), name, pubPath)
+	return nil
+}
+
+func writePublicKey(p string, pub ed25519.PublicKey) error {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644)
+}
+
+// loadPublicKey reads a PEM Ed25519 public key; a private key file gives
+// its public half.
+func loadPublicKey(p string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	blk, _ := pem.Decode(data)
+	if blk == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", p)
+	}
+	if blk.Type == "PRIVATE KEY" {
+		key, err := loadSigningKey(p)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	k, err := x509.ParsePKIXPublicKey(blk.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	pub, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New(p + ": not an ed25519 public key")
+	}
+	return pub, nil
+}
+
+// trustKey adds the public key in file to the trusted keys.
+func trustKey(keyring, file, name string, force bool) error {
+	pub, err := loadPublicKey(file)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if err := validKeyName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(keyring, trustedDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	dest := filepath.Join(dir, name+publicKeyExt)
+	if old, err := loadPublicKey(dest); err == nil && !force {
+		if old.Equal(pub) {
+			fmt.Printf("%s (%s) is already trusted\n", name, keyFingerprint(pub))
+			return nil
+		}
+		return fmt.Errorf("a different key is trusted as %s (%s; use --force to replace it)", name, keyFingerprint(old))
+	}
+	if err := writePublicKey(dest, pub); err != nil {
+		return err
+	}
+	fmt.Printf("Trusted %s (%s)\n", name, keyFingerprint(pub))
+	return nil
+}
+
+// keyringKey is a key found in the keyring.
+type keyringKey struct {
+	name, fingerprint string
+	trusted           bool // under trusted/, rather than one of ours
+	pub               ed25519.PublicKey
+}
+
+// readKeyring lists the signing keys and then the trusted keys, by name.
+// A missing keyring is empty.
+func readKeyring(keyring string) ([]keyringKey, error) {
+	var keys []keyringKey
+	for _, trusted := range []bool{false, true} {
+		dir, ext := keyring, privateKeyExt
+		if trusted {
+			dir, ext = filepath.Join(keyring, trustedDir), publicKeyExt
+		}
+		files, err := os.ReadDir(dir)
+		if errors.Is(err, iofs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var group []keyringKey
+		for _, f := range files {
+			name, ok := strings.CutSuffix(f.Name(), ext)
+			if !ok || f.IsDir() {
+				continue
+			}
+			pub, err := loadPublicKey(filepath.Join(dir, f.Name()))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: keyring: %v\n", err)
+				continue
+			}
+			group = append(group, keyringKey{name: name, fingerprint: keyFingerprint(pub), trusted: trusted, pub: pub})
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].name < group[j].name })
+		keys = append(keys, group...)
+	}
+	return keys, nil
+}
+
+func listKeys(keyring string, plain bool) error {
+	keys, err := readKeyring(keyring)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		fmt.Printf("No keys in %s; create one with packprompt keys generate\n", keyring)
+		return nil
+	}
+	out := newHumanOutput(plain)
+	defer out.close()
+	rows := [][]cell{{{text: "NAME", style: styleBold}, {text: "FINGERPRINT", style: styleBold}, {text: "USE", style: styleBold}}}
+	for _, k := range keys {
+		use, style := "signing", styleGreen
+		if k.trusted {
+			use, style = "trusted", styleCyan
+		}
+		rows = append(rows, []cell{{text: k.name}, {text: k.fingerprint, style: styleDim}, {text: use, style: style}})
+	}
+	return out.table(rows)
+}
+
+// signingKeyPath resolves --sign-key: a file, or else the name of a key in
+// the keyring.
+func signingKeyPath(spec string) string {
+	if _, err := os.Stat(spec); err == nil || strings.ContainsAny(spec, `/\`) || validKeyName(spec) != nil {
+		return spec
+	}
+	return filepath.Join(defaultKeyring(), spec+privateKeyExt)
+}
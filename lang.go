@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// language names double as markdown fence tags
+var langByExt = map[string]string{
+	".go": "go", ".py": "python", ".pyi": "python", ".ipynb": "json",
+	".js": "javascript", ".jsx": "javascript", ".mjs": "javascript", ".cjs": "javascript",
+	".ts": "typescript", ".tsx": "typescript", ".mts": "typescript", ".cts": "typescript",
+	".rs": "rust", ".java": "java", ".kt": "kotlin", ".kts": "kotlin", ".scala": "scala",
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hpp": "cpp", ".hh": "cpp",
+	".cs": "csharp", ".fs": "fsharp", ".swift": "swift", ".m": "objectivec", ".mm": "objectivec",
+	".rb": "ruby", ".php": "php", ".pl": "perl", ".pm": "perl", ".lua": "lua", ".r": "r",
+	".dart": "dart", ".ex": "elixir", ".exs": "elixir", ".erl": "erlang", ".hs": "haskell",
+	".clj": "clojure", ".el": "lisp", ".zig": "zig", ".nim": "nim", ".jl": "julia",
+	".sh": "shell", ".bash": "shell", ".zsh": "shell", ".fish": "shell", ".ps1": "powershell",
+	".sql": "sql", ".graphql": "graphql", ".gql": "graphql", ".proto": "protobuf",
+	".html": "html", ".htm": "html", ".vue": "vue", ".svelte": "svelte",
+	".css": "css", ".scss": "scss", ".sass": "sass", ".less": "less",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml", ".xml": "xml",
+	".ini": "ini", ".cfg": "ini", ".tf": "hcl", ".hcl": "hcl",
+	".md": "markdown", ".markdown": "markdown", ".rst": "rst", ".tex": "latex",
+	".mk": "makefile", ".cmake": "cmake", ".gradle": "groovy", ".groovy": "groovy",
+}
+
+var langByName = map[string]string{
+	"makefile": "makefile", "gnumakefile": "makefile", "dockerfile": "dockerfile",
+	"containerfile": "dockerfile", "cmakelists.txt": "cmake", "gemfile": "ruby", "rakefile": "ruby",
+	"go.mod": "go", "go.sum": "text", "go.work": "go", "jenkinsfile": "groovy", "vagrantfile": "ruby",
+	"build": "starlark", "build.bazel": "starlark", "workspace": "starlark",
+}
+
+// detectLanguage guesses a file's language from its name; "" when unknown.
+func detectLanguage(rel string) string {
+	base := strings.ToLower(path.Base(rel))
+	if l, ok := langByName[base]; ok {
+		return l
+	}
+	if strings.HasPrefix(base, "dockerfile.") {
+		return "dockerfile"
+	}
+	return langByExt[path.Ext(base)]
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// What pack does with symbolic links and junctions it meets (--links).
+const (
+	linksSkip   = "skip"   // leave them out, unlisted
+	linksRecord = "record" // leave them out, listed with their target in the omitted section
+	linksFollow = "follow" // pack what they point to, once
+)
+
+func checkLinks(policy string) error {
+	switch policy {
+	case linksSkip, linksRecord, linksFollow:
+		return nil
+	}
+	return fmt.Errorf("invalid --links %q: want skip, record or follow", policy)
+}
+
+// recordLink lists the link at p in the omitted section with its target.
+func recordLink(p, rel, kind string, om *omissions) {
+	target, err := os.Readlink(p)
+	if err != nil {
+		target = "an unreadable target"
+	}
+	reason := packprompt.LinkReason(kind, target)
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		om.addDir(rel, reason)
+	} else if err == nil {
+		om.add(rel, info.Size(), reason)
+	} else {
+		om.add(rel, 0, reason)
+	}
+}
+
+// within reports whether path p is dir or inside it.
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// coveredBy returns the tree already walked that the directory real is
+// in, or that is in it: following a link there would pack files twice or
+// never end.
+func coveredBy(real string, walked []string) (string, bool) {
+	for _, w := range walked {
+		if within(real, w) || within(w, real) {
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// skipLink is what the walk returns after handling the link d: junctions
+// are listed as directories, which WalkDir would otherwise descend into.
+func skipLink(d iofs.DirEntry) error {
+	if d.IsDir() {
+		return iofs.SkipDir
+	}
+	return nil
+}
+
+// isLinkEntry reports whether d, met in a walk, is a link of some kind.
+func isLinkEntry(p string, d iofs.DirEntry) (kind string, ok bool) {
+	kind = linkKind(p, d)
+	return kind, kind != ""
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import iofs "io/fs"
+
+// linkKind names the link d at p is: "symlink", or "" for anything else.
+func linkKind(p string, d iofs.DirEntry) string {
+	if d.Type()&iofs.ModeSymlink != 0 {
+		return "symlink"
+	}
+	return ""
+}
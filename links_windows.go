@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	iofs "io/fs"
+	"syscall"
+)
+
+// ioReparseTagMountPoint tags a junction (or a mounted volume).
+const ioReparseTagMountPoint = 0xA0000003
+
+// linkKind names the link d at p is: "symlink", "junction", or "" for
+// anything else. Junctions show up in a walk as irregular directories.
+func linkKind(p string, d iofs.DirEntry) string {
+	t := d.Type()
+	if t&(iofs.ModeSymlink|iofs.ModeIrregular) == 0 {
+		return ""
+	}
+	switch reparseTag(p) {
+	case ioReparseTagMountPoint:
+		return "junction"
+	case syscall.IO_REPARSE_TAG_SYMLINK:
+		return "symlink"
+	}
+	if t&iofs.ModeSymlink != 0 {
+		return "symlink"
+	}
+	return ""
+}
+
+// reparseTag is the reparse point tag of p, 0 for a file that is none.
+func reparseTag(p string) uint32 {
+	name, err := syscall.UTF16PtrFromString(p)
+	if err != nil {
+		return 0
+	}
+	var fd syscall.Win32finddata
+	h, err := syscall.FindFirstFile(name, &fd)
+	if err != nil {
+		return 0
+	}
+	syscall.FindClose(h)
+	if fd.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT == 0 {
+		return 0
+	}
+	return fd.Reserved0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// listOptions holds list's flags.
+type listOptions struct {
+	in       string
+	passFile string
+	plain    bool
+	print0   bool
+}
+
+// listFlags declares list's flags into o.
+func listFlags(o *listOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("list", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file (- for stdin)")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the passphrase for encrypted entries from this file (default: $PACKPROMPT_PASSPHRASE)")
+	flg.BoolVar(&o.plain, "plain", false, "no colors and no pager")
+	flg.BoolVar(&o.print0, "print0", false, "print only the paths, each ended with NUL instead of a table (for xargs -0)")
+	flg.BoolVar(&o.print0, "z", false, "shorthand for --print0")
+	return flg
+}
+
+// listCmd prints a pack's entries without extracting anything.
+func listCmd(args []string) {
+	var o listOptions
+	flg := listFlags(&o)
+	parseFlags(flg, args)
+
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+	f, err := openPack(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+	if o.print0 {
+		var paths []string
+		err := readPack(f, func(pf packedFile) error {
+			paths = append(paths, pf.rel)
+			return nil
+		})
+		if err == nil {
+			err = writeList(os.Stdout, paths, true)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	table := [][]cell{{
+		{text: "ID", style: styleBold}, {text: "MODE", style: styleBold},
+		{text: "SIZE", style: styleBold, numeric: true}, {text: "LINES", style: styleBold, numeric: true},
+		{text: "PATH", style: styleBold},
+	}}
+	var files, lines, sealed int
+	var size int64
+	err = readPack(f, func(pf packedFile) error {
+		content, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		var notes []string
+		style := styleCyan
+		sizeText, lineText := "", "-"
+		switch {
+		case !ok:
+			// the model sees the stored form, so that is what is sized
+			sizeText, style = humanSize(int64(len(pf.content))), styleDim
+			notes = append(notes, "encrypted")
+			sealed++
+		default:
+			sizeText = humanSize(int64(len(content)))
+			size += int64(len(content))
+			if _, enc := pf.attrs[encodingAttr]; enc {
+				notes = append(notes, "binary")
+			} else {
+				n := bytes.Count(content, []byte("\n"))
+				if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+					n++
+				}
+				lineText = strconv.Itoa(n)
+				lines += n
+			}
+		}
+		if pf.attachment {
+			notes = append(notes, "attachment")
+		}
+		if c, ok, _ := packprompt.ParseChunk(pf.attrs); ok {
+			notes = append(notes, fmt.Sprintf("chunk %d/%d", c.Index, c.Count))
+		}
+		if kept, cut := pf.attrs[truncatedAttr]; cut {
+			notes = append(notes, "truncated to "+strings.Replace(kept, "/", " of ", 1)+" lines")
+		}
+		name := pf.rel
+		if len(notes) > 0 {
+			name += " (" + strings.Join(notes, ", ") + ")"
+		}
+		table = append(table, []cell{
+			{text: packprompt.EntryID(pf.rel), style: styleDim},
+			{text: pf.mode},
+			{text: sizeText, numeric: true},
+			{text: lineText, numeric: true},
+			{text: name, style: style},
+		})
+		files++
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	out := newHumanOutput(o.plain)
+	defer out.close()
+	if err := out.table(table); err != nil {
+		fatal(err)
+	}
+	summary := fmt.Sprintf("%d files, %s, %d lines", files, humanSize(size), lines)
+	if sealed > 0 {
+		summary += fmt.Sprintf(" (%d encrypted not counted; give a passphrase to count them)", sealed)
+	}
+	fmt.Fprintln(out, out.paint(styleDim, summary))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// llmHTTPClient allows for local models that take minutes over a large pack.
+var llmHTTPClient = &http.Client{Timeout: 20 * time.Minute}
+
+// llmProviders are the chat backends, with their default base URLs.
+var llmProviders = map[string]string{
+	"openai":   "https://api.openai.com/v1",
+	"ollama":   "http://localhost:11434",
+	"llamacpp": "http://localhost:8080",
+}
+
+// llmClient talks to one chat model: an OpenAI-compatible API, an Ollama
+// server (native API, so the context size can be set per request) or a
+// llama.cpp server.
+type llmClient struct {
+	provider, url, model, key string
+	numCtx                    int // ollama: context size to load the model with
+}
+
+func newLLMClient(provider, url, model string) (*llmClient, error) {
+	def, ok := llmProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown --provider %q: want openai, ollama or llamacpp", provider)
+	}
+	if url == "" {
+		url = def
+	}
+	if model == "" && provider != "llamacpp" {
+		return nil, fmt.Errorf("--model is required for --provider %s", provider)
+	}
+	c := &llmClient{provider: provider, url: strings.TrimRight(url, "/"), model: model}
+	if provider == "openai" {
+		c.key = apiKey("PACKPROMPT_API_KEY")
+	}
+	return c, nil
+}
+
+func (c *llmClient) post(path string, req any) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	if c.key != "" {
+		headers["Authorization"] = "Bearer " + c.key
+	}
+	return httpDo(llmHTTPClient, http.MethodPost, c.url+path, body, headers)
+}
+
+// contextWindow asks the server how many tokens the model takes: Ollama's
+// /api/show (a num_ctx parameter of the model, else the architecture's
+// context_length) or llama.cpp's /props. 0 means the server cannot say.
+func (c *llmClient) contextWindow() (int, error) {
+	switch c.provider {
+	case "ollama":
+		data, err := c.post("/api/show", map[string]string{"model": c.model})
+		if err != nil {
+			return 0, fmt.Errorf("ollama: %w", err)
+		}
+		var show struct {
+			Parameters string                     `json:"parameters"`
+			ModelInfo  map[string]json.RawMessage `json:"model_info"`
+		}
+		if err := json.Unmarshal(data, &show); err != nil {
+			return 0, fmt.Errorf("ollama: %w", err)
+		}
+		for _, l := range strings.Split(show.Parameters, "\n") {
+			if f := strings.Fields(l); len(f) == 2 && f[0] == "num_ctx" {
+				if n, err := strconv.Atoi(f[1]); err == nil && n > 0 {
+					return n, nil
+				}
+			}
+		}
+		for k, v := range show.ModelInfo {
+			if strings.HasSuffix(k, ".context_length") {
+				var n int
+				if json.Unmarshal(v, &n) == nil && n > 0 {
+					return n, nil
+				}
+			}
+		}
+		return 0, nil
+	case "llamacpp":
+		data, err := httpDo(llmHTTPClient, http.MethodGet, c.url+"/props", nil, nil)
+		if err != nil {
+			return 0, fmt.Errorf("llama.cpp: %w", err)
+		}
+		var props struct {
+			NCtx     int `json:"n_ctx"`
+			Defaults struct {
+				NCtx int `json:"n_ctx"`
+			} `json:"default_generation_settings"`
+		}
+		if err := json.Unmarshal(data, &props); err != nil {
+			return 0, fmt.Errorf("llama.cpp: %w", err)
+		}
+		if props.Defaults.NCtx > 0 {
+			return props.Defaults.NCtx, nil // per slot, which is what one request gets
+		}
+		return props.NCtx, nil
+	}
+	return 0, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chat sends one conversation and returns the model's reply.
+func (c *llmClient) chat(messages []chatMessage) (string, error) {
+	if c.provider == "ollama" {
+		req := map[string]any{"model": c.model, "messages": messages, "stream": false}
+		if c.numCtx > 0 {
+			// Ollama otherwise loads models with a small default and cuts the prompt silently
+			req["options"] = map[string]int{"num_ctx": c.numCtx}
+		}
+		data, err := c.post("/api/chat", req)
+		if err != nil {
+			return "", fmt.Errorf("ollama: %w", err)
+		}
+		var resp struct {
+			Message chatMessage `json:"message"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return "", fmt.Errorf("ollama: %w", err)
+		}
+		return resp.Message.Content, nil
+	}
+	path := "/chat/completions"
+	if c.provider == "llamacpp" {
+		path = "/v1/chat/completions"
+	}
+	req := map[string]any{"messages": messages}
+	if c.model != "" {
+		req["model"] = c.model
+	}
+	data, err := c.post(path, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", c.provider, err)
+	}
+	var resp struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", fmt.Errorf("%s: %w", c.provider, err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("%s: no answer in the response", c.provider)
+	}
+	return resp.Choices[0].Message.Content, nil
+}
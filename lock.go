@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Suffixes of the files pack keeps next to --out while writing it.
+const (
+	lockSuffix = ".lock"
+	tmpSuffix  = ".tmp~pp"
+)
+
+// lockOutput takes an exclusive lock on out for the duration of a write so
+// two concurrent runs cannot interleave; a lock left by a process that no
+// longer exists is taken over.
+func lockOutput(out string) (unlock func(), err error) {
+	lock := out + lockSuffix
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { _ = os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		data, _ := os.ReadFile(lock)
+		pid, perr := strconv.Atoi(strings.TrimSpace(string(data)))
+		if perr == nil && pid > 0 && processAlive(pid) {
+			return nil, fmt.Errorf("%s is being written by another packprompt (pid %d); remove %s if that is wrong", out, pid, lock)
+		}
+		fmt.Fprintf(os.Stderr, "warning: removing stale lock %s\n", lock)
+		_ = os.Remove(lock)
+	}
+	return nil, fmt.Errorf("cannot lock %s", out)
+}
+
+// outputPaths lists the absolute paths a pack run writes. Split parts are
+// named after groups not known before the walk; earlier ones are caught by
+// isPackOutput instead. Stdout is no path.
+func outputPaths(out, splitBy string) []string {
+	abs, err := filepath.Abs(out)
+	if err != nil || splitBy != "" || out == "-" {
+		return nil
+	}
+	return []string{abs}
+}
@@ -9,233 +9,1463 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/ed25519"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	iofs "io/fs"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"unicode"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
 )
 
 const (
-	startMark = "--- FILE"
-	endMark   = "--- END FILE ---"
+	startMark = packprompt.StartMark
+	endMark   = packprompt.EndMark
 )
 
-var defaultExcludes = []string{
-	".git", ".svn", ".hg", ".idea", ".vscode", "node_modules", ".venv", ".DS_Store",
-	"*.png", "*.jpg", "*.jpeg", "*.gif", "*.webp", "*.ico",
-	"*.pdf", "*.zip", "*.tar", "*.gz", "*.xz", "*.7z", "*.rar", "*.jar", "*.war",
-	"*.class", "*.so", "*.dll", "*.dylib", "*.bin", "*.exe",
-}
+var defaultExcludes = packprompt.DefaultExcludes
 
 func main() {
 	if len(os.Args) < 2 {
 		usage()
 		os.Exit(1)
 	}
-	switch os.Args[1] {
+	if !runCommand(os.Args[1], os.Args[2:]) {
+		if p := findPlugin(os.Args[1]); p != "" {
+			runPlugin(p, os.Args[1], os.Args[2:])
+		}
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
+		usage()
+		os.Exit(1)
+	}
+}
+
+// runCommand runs a builtin command, reporting false if there is none by that name.
+func runCommand(name string, args []string) bool {
+	switch name {
 	case "pack":
-		packCmd(os.Args[2:])
+		if packCmd(args) {
+			os.Exit(exitPartial)
+		}
 	case "unpack":
-		unpackCmd(os.Args[2:])
-	case "-h", "--help", "help":
+		unpackCmd(args)
+	case "run":
+		runCmd(args)
+	case "apply":
+		applyCmd(args)
+	case "explain":
+		explainCmd(args)
+	case "hash":
+		hashCmd(args)
+	case "request-missing":
+		requestMissingCmd(args)
+	case "ask":
+		askCmd(args)
+	case "summarize":
+		summarizeCmd(args)
+	case "serve":
+		serveCmd(args)
+	case "export":
+		exportCmd(args)
+	case "list":
+		listCmd(args)
+	case "cat":
+		catCmd(args)
+	case "verify":
+		verifyCmd(args)
+	case "stats":
+		statsCmd(args)
+	case "view":
+		viewCmd(args)
+	case "diff":
+		diffCmd(args)
+	case "keys":
+		keysCmd(args)
+	case "session":
+		sessionCmd(args)
+	case "report":
+		reportCmd(args)
+	case "completion":
+		completionCmd(args)
+	case "__complete":
+		completeCmd(args)
+	case "-h", "--help":
 		usage()
+	case "help":
+		helpCmd(args)
 	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
-		usage()
-		os.Exit(1)
+		return false
 	}
+	return true
 }
 
+// usage prints the commands, one per line; help CMD has the rest.
 func usage() {
-	fmt.Print(`packprompt
-
-Commands:
-  pack   [--root DIR] [--out FILE] [--exclude PAT1,PAT2,...]
-  unpack [--in FILE]  [--dest DIR]
-
-Details:
-  - Skips binary files and all non-regular files (FIFOs, sockets, devices, symlinks).
-  - Default excludes: ` + strings.Join(defaultExcludes, ",") + `
-  - Stores file mode and restores on unpack.
+	fmt.Print("usage: packprompt COMMAND [flags]\n\nCommands:\n")
+	for _, c := range builtinCommands {
+		fmt.Printf("  %-16s %s\n", c[0], c[1])
+	}
+	fmt.Print(`
+Every command also takes --config FILE, --profile NAME and --max-memory SIZE.
+packprompt help COMMAND shows a command's flags and details; packprompt help config, help
+output and help plugins cover configuration, terminal output and plugins.
+Any other COMMAND runs the executable packprompt-COMMAND from PATH.
 `)
+	if plugins := listPlugins(); len(plugins) > 0 {
+		fmt.Printf("Installed plugins: %s\n", strings.Join(plugins, ", "))
+	}
+}
+
+// packOptions holds pack's flags.
+type packOptions struct {
+	root                string
+	out                 string
+	excl                string
+	incl                string
+	noPromote           bool
+	provenance          bool
+	footer              bool
+	signKey             string
+	reproducible        bool
+	since               string
+	sinceBy             string
+	author              string
+	authorBy            string
+	commits             int
+	prRef               string
+	githubPR            string
+	forge               string
+	prInclude           string
+	wsName              string
+	filesFrom           string
+	bazelTarget         string
+	goDeps              string
+	coverprofile        string
+	coverDetail         string
+	filterExpr          string
+	seeds               stringList
+	portable            string
+	format              string
+	gzipTar             bool
+	noOmitted           bool
+	splitBy             string
+	splitTokens         string
+	splitForce          bool
+	maps                stringList
+	attach              stringList
+	preHooks, postHooks stringList
+	contract            bool
+	manifestOut         string
+	ifChanged           bool
+	withMeta            bool
+	noteSpecs           stringList
+	encryptPaths        string
+	passFile            string
+	relevantTo          string
+	relevantTop         int
+	relevantBudget      string
+	embedQuery          string
+	embedTop            int
+	embedURL            string
+	embedModel          string
+	countTokens         bool
+	model               string
+	tokenBudget         string
+	convert             string
+	sampleRows          int
+	csvSummaryOver      string
+	archives            bool
+	binary              string
+	links               string
+	autoXform           bool
+	dirBudgets          string
+	budgetOverflow      string
+	maxFileSize         string
+	sizeOverflow        string
+	fitModel            string
+	fitReserve          string
+	minFiles            int
+	minTokens           string
+	dryRun              bool
+	failFast            bool
+	skipReport          string
+	print0              bool
+	scan                string
+	scanReport          string
+	scanReportFormat    string
 }
 
-func packCmd(args []string) {
+// packFlags declares pack's flags into o. Completion asks each command's
+// constructor for its flags, so they are declared nowhere else.
+func packFlags(o *packOptions) *flag.FlagSet {
 	flg := flag.NewFlagSet("pack", flag.ExitOnError)
-	root := flg.String("root", ".", "root directory to walk")
-	out := flg.String("out", "files-prompt.txt", "output prompt file")
-	excl := flg.String("exclude", strings.Join(defaultExcludes, ","), "comma-separated glob patterns to exclude")
-	_ = flg.Parse(args)
+	flg.StringVar(&o.root, "root", ".", "root directory to walk, or a zip file to pack the members of")
+	flg.StringVar(&o.out, "out", "files-prompt.txt", "output prompt file (- for stdout)")
+	flg.StringVar(&o.excl, "exclude", strings.Join(defaultExcludes, ","), "comma-separated glob patterns to exclude")
+	flg.StringVar(&o.incl, "include", "", "comma-separated globs; only pack matching files, after excludes (e.g. \"*.go,cmd/**\")")
+	flg.BoolVar(&o.noPromote, "no-promote", false, "keep walk order instead of moving key files (README, Makefile, entry points) to the front")
+	flg.BoolVar(&o.provenance, "provenance", false, "insert a provenance comment (commit, time, path) at the top of each file")
+	flg.BoolVar(&o.footer, "footer", false, "append an archive provenance footer (version, user, host, time, options, digest)")
+	flg.StringVar(&o.signKey, "sign-key", "", "PEM Ed25519 private key, or the name of one in the keyring, used to sign the footer (implies --footer)")
+	flg.BoolVar(&o.reproducible, "reproducible", false, "byte-identical output for identical trees: sorted paths, fixed time, normalized modes, no user/host")
+	flg.StringVar(&o.since, "since", "", "only files modified after this time (2024-06-01, 72h, 3d)")
+	flg.StringVar(&o.sinceBy, "since-by", "mtime", "how --since decides a file changed: mtime or git")
+	flg.StringVar(&o.author, "author", "", "only files whose git author matches this regexp (name <email>, case-insensitive)")
+	flg.StringVar(&o.authorBy, "author-by", "last", "which author --author matches: last (last commit) or most (most commits)")
+	flg.IntVar(&o.commits, "commits", 0, "only files touched by the last N commits on HEAD (plus uncommitted changes)")
+	flg.StringVar(&o.prRef, "pr", "", "pack a pull/merge request (URL, org/repo#123 or group/project!12) instead of walking --root")
+	flg.StringVar(&o.githubPR, "github-pr", "", "shorthand for --pr REF --forge github")
+	flg.StringVar(&o.forge, "forge", "", "forge hosting --pr: github, gitlab or gitea (default: inferred from the reference)")
+	flg.StringVar(&o.prInclude, "pr-include", "description,content", "what to pack from a pull request: description,content,diff")
+	flg.StringVar(&o.wsName, "workspace", "", "only pack this monorepo workspace (go.work, pnpm, npm/yarn, Nx/Turbo, Cargo) and its local dependencies")
+	flg.StringVar(&o.filesFrom, "files-from", "", "only pack the paths listed in this file, one per line (- for stdin)")
+	flg.StringVar(&o.bazelTarget, "bazel-target", "", "only pack the source files of this bazel target and its deps")
+	flg.StringVar(&o.goDeps, "go-deps", "", "only pack files the Go build of these packages uses (e.g. ./...), via go list -deps")
+	flg.StringVar(&o.coverprofile, "coverprofile", "", "annotate Go files with coverage from this go test -coverprofile output")
+	flg.StringVar(&o.coverDetail, "cover-detail", "file", "coverage annotation detail: file (one line per file) or func (also one per function)")
+	flg.StringVar(&o.filterExpr, "filter", "", "only pack files matching this expression, e.g. 'size < 100KB && lang == \"go\" && !path.contains(\"mock\")'")
+	flg.Var(&o.seeds, "seed", "only pack this JS/TS or Python file and its transitive local imports; repeatable")
+	flg.StringVar(&o.portable, "portable-paths", portableWarn, "paths that will not unpack on Windows or macOS (\":\", trailing dots and spaces, CON, case clashes): warn, rewrite them, or off")
+	flg.StringVar(&o.format, "format", formatText, "pack format: text (FILE/END FILE markers), jsonl (one JSON object per file: path, mode, content, sha256), markdown (a heading and fenced code block per file), xml (a <document> element per file) or tar")
+	flg.BoolVar(&o.gzipTar, "gzip", false, "with --format tar, gzip the archive")
+	flg.BoolVar(&o.noOmitted, "no-omitted", false, "do not append the section listing files left out and why")
+	flg.StringVar(&o.splitBy, "split-by", "", "write one pack per group instead of one file: dir (top-level directory) or lang (language)")
+	flg.StringVar(&o.splitTokens, "split-tokens", "", "write parts files-prompt.part1.txt, part2, ... each under this many tokens for --model (e.g. 100k)")
+	flg.BoolVar(&o.splitForce, "split-force", false, "with --split-tokens, cut a file too big for one part across parts instead of failing")
+	flg.Var(&o.maps, "map", "also pack hostpath under packprefix (e.g. ../shared-lib=vendor/shared-lib); repeatable")
+	flg.Var(&o.attach, "attach", "append a context document (URL or path) in an attachments section; repeatable")
+	flg.Var(&o.preHooks, "pre-pack", "shell command to run before packing (e.g. go generate ./...); repeatable")
+	flg.Var(&o.postHooks, "post-pack", "shell command to run after the pack is written, told about it in PACKPROMPT_HOOK_* variables; repeatable")
+	flg.BoolVar(&o.contract, "contract", false, "append instructions for answering with changed files in the format apply reads, and hash each entry")
+	flg.StringVar(&o.manifestOut, "manifest", "", "also write a JSON manifest of the packed entries (path, id, mode, size, sha256) to this file")
+	flg.BoolVar(&o.ifChanged, "if-changed", false, "with --manifest, skip writing when the tree and options match the last pack's manifest")
+	flg.BoolVar(&o.withMeta, "with-meta", false, "end each entry with its size, modification time, last commit subject and author")
+	flg.Var(&o.noteSpecs, "note", "annotate the files matching a glob for the reader (e.g. \"pkg/auth/*.go=the suspicious area\"); repeatable")
+	flg.StringVar(&o.encryptPaths, "encrypt-paths", "", "comma-separated globs of files to encrypt inside the pack (e.g. config/**,*.env.example)")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the --encrypt-paths passphrase from this file (default: $PACKPROMPT_PASSPHRASE)")
+	flg.StringVar(&o.relevantTo, "relevant-to", "", "order files by BM25 relevance to this query text, best first")
+	flg.IntVar(&o.relevantTop, "relevant-top", 0, "with --relevant-to, keep only the N most relevant files")
+	flg.StringVar(&o.relevantBudget, "relevant-budget", "", "with --relevant-to, keep the most relevant files up to this much content (e.g. 200k)")
+	flg.StringVar(&o.embedQuery, "embed-query", "", "keep the files most similar to this query by embedding similarity")
+	flg.IntVar(&o.embedTop, "embed-top", 20, "with --embed-query, how many files to keep")
+	flg.StringVar(&o.embedURL, "embed-url", "https://api.openai.com/v1", "OpenAI-compatible embeddings API base (e.g. http://localhost:11434/v1 for Ollama)")
+	flg.StringVar(&o.embedModel, "embed-model", "text-embedding-3-small", "embedding model name")
+	flg.BoolVar(&o.countTokens, "count-tokens", false, "report the token count of the written pack")
+	flg.StringVar(&o.model, "model", "gpt-4o", "tokenizer family for --count-tokens and budgets: gpt-4o, gpt-4, claude, llama or generic")
+	flg.StringVar(&o.tokenBudget, "token-budget", "", "keep files, in pack order, up to this many tokens in total (e.g. 128k)")
+	flg.StringVar(&o.convert, "convert", "", "pack notebooks and documents as markdown: comma-separated "+strings.Join(converterNames(), ", ")+", or all")
+	flg.IntVar(&o.sampleRows, "sample-rows", 5, "with --convert sqlite or csv, sample rows shown per table")
+	flg.StringVar(&o.csvSummaryOver, "csv-summary-over", "256k", "with --convert csv, summarize only CSV files larger than this")
+	flg.BoolVar(&o.archives, "descend-archives", false, "pack the text files inside zip and tar archives under ARCHIVE!/member paths")
+	flg.StringVar(&o.binary, "binary", "skip", "what to do with binary files: skip, or base64 to embed them encoded")
+	flg.StringVar(&o.links, "links", linksRecord, "what to do with symlinks and junctions: skip, record them in the omitted section, or follow them")
+	flg.BoolVar(&o.autoXform, "auto-transform", false, "rewrite common non-code files to read cheaper: "+strings.Join(transformNames(), ", "))
+	flg.StringVar(&o.dirBudgets, "dir-budget", "", "cap directories' share of the token budget, e.g. web/=20%,vendor/=0%,docs/=5k")
+	flg.StringVar(&o.budgetOverflow, "budget-overflow", "drop", "what to do with a file over a budget: drop, or truncate it to what is left")
+	flg.StringVar(&o.maxFileSize, "max-file-size", "", "leave out files larger than this (e.g. 200KB), or cut them with --size-overflow truncate")
+	flg.StringVar(&o.sizeOverflow, "size-overflow", "drop", "what to do with a file over --max-file-size: drop, or truncate it at a line boundary")
+	flg.StringVar(&o.fitModel, "fit-model", "", "keep the pack within this model's context window (e.g. gpt-4o, claude-3.7, llama3:70b), with headroom")
+	flg.StringVar(&o.fitReserve, "fit-reserve", "", "with --fit-model, tokens left for the question and answer (default: a tenth of the window, 2k-32k)")
+	flg.IntVar(&o.minFiles, "min-files", 0, "fail instead of writing when fewer than N files are left to pack (e.g. 1 to catch an exclude that matches everything)")
+	flg.StringVar(&o.minTokens, "min-tokens", "", "fail instead of writing when the packed files hold fewer than N tokens (e.g. 2k), in --model's estimate")
+	flg.BoolVar(&o.dryRun, "dry-run", false, "list the paths that would be packed instead of writing the pack")
+	flg.BoolVar(&o.failFast, "fail-fast", false, "stop at the first file that cannot be read instead of leaving it out and exiting 3 after packing the rest")
+	flg.StringVar(&o.skipReport, "skip-report", "", "write the paths left out and why to this file (- for stdout)")
+	flg.StringVar(&o.scan, "scan", "", "scan the files to pack for credentials and personal data: warn, or fail to write nothing")
+	flg.StringVar(&o.scanReport, "scan-report", "", "also write what --scan and --max-file-size found to this file (- for stdout)")
+	flg.StringVar(&o.scanReportFormat, "scan-report-format", reportSARIF, "format of --scan-report: sarif or github")
+	flg.BoolVar(&o.print0, "print0", false, "end --dry-run and --skip-report lines with NUL instead of newline (for xargs -0); skip reports then hold paths only")
+	flg.BoolVar(&o.print0, "z", false, "shorthand for --print0")
+	return flg
+}
+
+// packSelection is what pack would write: the entries left after every
+// filter, budget and rewrite, and the files left out on the way.
+type packSelection struct {
+	entries  []entry
+	om       *omissions
+	excludes []string    // the --exclude patterns in effect
+	walk     walkOptions // how the tree was walked
+	env      packEnv
+}
 
-	excludes := parseExcludes(*excl)
-	outf, err := os.Create(*out)
+// selectEntries walks and filters the tree as o asks, without fetching
+// attachments, running hooks or writing anything. pack, hash and explain
+// all select through it, so they agree on what pack would pack.
+func selectEntries(o *packOptions) *packSelection {
+	var ciph *entryCipher
+	if o.encryptPaths != "" {
+		pass, err := loadPassphrase(o.passFile)
+		if err != nil {
+			fatal(err)
+		}
+		if pass == "" {
+			fatal(errors.New("--encrypt-paths needs a passphrase: set PACKPROMPT_PASSPHRASE or --passphrase-file"))
+		}
+		ciph = &entryCipher{passphrase: pass}
+	}
+
+	csvOver, err := parseSize(o.csvSummaryOver)
+	if err != nil {
+		fatal(fmt.Errorf("invalid --csv-summary-over: %w", err))
+	}
+	convs, err := parseConverters(o.convert, dataSummary{rows: o.sampleRows, csvOver: csvOver})
 	if err != nil {
 		fatal(err)
 	}
-	defer outf.Close()
-	w := bufio.NewWriter(outf)
-	defer w.Flush()
-
-	err = filepath.WalkDir(*root, func(p string, d iofs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
+	if o.binary != "skip" && o.binary != base64Scheme {
+		fatal(fmt.Errorf("invalid --binary %q: want skip or base64", o.binary))
+	}
+	if err := checkLinks(o.links); err != nil {
+		fatal(err)
+	}
+	var filter *fileFilter
+	if o.filterExpr != "" {
+		if filter, err = parseFilter(o.filterExpr); err != nil {
+			fatal(err)
+		}
+	}
+	excludes := parseExcludes(o.excl)
+	if o.excl == strings.Join(defaultExcludes, ",") {
+		// asking to convert or descend into a type overrides the default that skips it
+		var exts []string
+		for _, c := range convs {
+			exts = append(exts, c.exts...)
+		}
+		if o.archives {
+			exts = append(exts, archiveExts...)
 		}
-		rel, err := filepath.Rel(*root, p)
+		if o.binary == base64Scheme {
+			exts = append(exts, binaryExts...)
+		}
+		excludes = unexclude(excludes, exts)
+	}
+	om := &omissions{failFast: o.failFast}
+	walk := walkOptions{outputs: outputPaths(o.out, o.splitBy+o.splitTokens), convs: convs, archives: o.archives, base64: o.binary == base64Scheme, links: o.links}
+	// the manifest and skip report change every run; packing them would
+	// make every tree look changed to --if-changed
+	for _, p := range []string{o.manifestOut, o.skipReport} {
+		if abs, err := filepath.Abs(p); err == nil && p != "" && p != "-" {
+			walk.outputs = append(walk.outputs, abs)
+		}
+	}
+	var entries []entry
+	if o.githubPR != "" {
+		o.prRef, o.forge = o.githubPR, "github"
+	}
+	if o.prRef != "" {
+		var cr changeRequest
+		if cr, err = parseChangeRequest(o.prRef, o.forge); err == nil {
+			entries, err = fetchChangeRequest(cr, csvSet(o.prInclude), excludes, om)
+		}
+	} else {
+		entries, err = collectEntries(o.root, excludes, walk, om)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if includes := parseExcludes(o.incl); len(includes) > 0 {
+		entries = filterEntries(entries, om, "not matched by --include", func(e entry) bool { return included(e, includes) })
+	}
+	if o.maxFileSize != "" {
+		limit, err := parseSize(o.maxFileSize)
 		if err != nil {
-			return err
+			fatal(fmt.Errorf("invalid --max-file-size: %w", err))
 		}
-		rel = filepath.ToSlash(rel)
-		if rel == "." {
-			return nil
+		if o.sizeOverflow != "drop" && o.sizeOverflow != "truncate" {
+			fatal(fmt.Errorf("invalid --size-overflow %q: want drop or truncate", o.sizeOverflow))
 		}
-
-		// Exclusions first
-		if excluded(rel, d, excludes) {
-			if d.IsDir() {
-				return iofs.SkipDir
+		if entries, err = capFileSize(entries, limit, o.maxFileSize, o.sizeOverflow == "truncate", om); err != nil {
+			fatal(err)
+		}
+	}
+	if o.wsName != "" {
+		all, err := discoverWorkspaces(o.root)
+		if err != nil {
+			fatal(err)
+		}
+		dirs, err := selectWorkspace(all, o.wsName)
+		if err != nil {
+			fatal(err)
+		}
+		entries = filterEntries(entries, om, "outside workspace "+o.wsName, func(e entry) bool { return inWorkspaces(e.rel, dirs) })
+	}
+	if o.filesFrom != "" {
+		listed, err := readFileList(o.filesFrom, o.root)
+		if err != nil {
+			fatal(err)
+		}
+		entries = restrictTo(entries, listed, om, "not in --files-from")
+	}
+	if o.bazelTarget != "" {
+		listed, err := bazelSources(o.root, o.bazelTarget)
+		if err != nil {
+			fatal(err)
+		}
+		entries = restrictTo(entries, listed, om, "not a source of "+o.bazelTarget)
+	}
+	if o.goDeps != "" {
+		listed, err := goDepsFiles(o.root, o.goDeps)
+		if err != nil {
+			fatal(err)
+		}
+		entries = restrictTo(entries, listed, om, "not used by the Go build")
+	}
+	if len(o.seeds) > 0 {
+		listed, err := newImportGraph(o.root).closure(o.seeds)
+		if err != nil {
+			fatal(err)
+		}
+		entries = restrictTo(entries, listed, om, "not imported from --seed files")
+	}
+	for _, spec := range o.maps {
+		mapped, err := collectMapped(spec, excludes, walk, om)
+		if err != nil {
+			fatal(err)
+		}
+		entries = mergeEntries(entries, mapped, om)
+	}
+	if o.since != "" {
+		t, err := parseSince(o.since, time.Now())
+		if err != nil {
+			fatal(err)
+		}
+		switch o.sinceBy {
+		case "mtime":
+			entries = filterEntries(entries, om, "not modified since "+o.since, func(e entry) bool { return e.modTime.After(t) })
+		case "git":
+			changed, err := gitChangedSince(o.root, t)
+			if err != nil {
+				fatal(err)
 			}
-			return nil
+			entries = filterEntries(entries, om, "not changed in git since "+o.since, func(e entry) bool { return changed[e.rel] })
+		default:
+			fatal(fmt.Errorf("invalid --since-by %q: want mtime or git", o.sinceBy))
 		}
-
-		// Only process regular files; skip dirs, symlinks, sockets, devices, FIFOs, etc.
-		if !d.Type().IsRegular() {
-			return nil
+	}
+	if o.author != "" {
+		re, err := regexp.Compile("(?i)" + o.author)
+		if err != nil {
+			fatal(fmt.Errorf("invalid --author: %w", err))
 		}
-
-		// Binary check (only on regular files)
-		bin, err := isBinaryFile(p)
+		if o.authorBy != "last" && o.authorBy != "most" {
+			fatal(fmt.Errorf("invalid --author-by %q: want last or most", o.authorBy))
+		}
+		authors, err := gitFileAuthors(o.root, o.authorBy == "most")
 		if err != nil {
-			// unreadable -> skip quietly
-			return nil
+			fatal(err)
 		}
-		if bin {
-			return nil
+		entries = filterEntries(entries, om, "author does not match "+o.author, func(e entry) bool {
+			a, ok := authors[e.rel]
+			return ok && re.MatchString(a)
+		})
+	}
+	if o.commits > 0 {
+		touched, err := gitRecentCommitFiles(o.root, o.commits)
+		if err != nil {
+			fatal(err)
 		}
-
-		f, err := os.Open(p)
+		entries = filterEntries(entries, om, fmt.Sprintf("not touched in the last %d commits", o.commits), func(e entry) bool { return touched[e.rel] })
+	}
+	if filter != nil {
+		now := time.Now()
+		entries = filterEntries(entries, om, "does not match --filter", func(e entry) bool { return filter.match(e, now) })
+	}
+	if entries, err = portablePaths(entries, o.portable, o.format, om); err != nil {
+		fatal(err)
+	}
+	env := currentPackEnv(o.reproducible)
+	if o.reproducible {
+		normalizeEntries(entries)
+	}
+	if !o.noPromote {
+		packprompt.PromoteKeyFiles(entries, func(e entry) string { return e.rel })
+	}
+	if o.autoXform {
+		if err := autoTransform(entries); err != nil {
+			fatal(err)
+		}
+	}
+	if o.relevantTo != "" {
+		var budget int64
+		if o.relevantBudget != "" {
+			if budget, err = parseSize(o.relevantBudget); err != nil {
+				fatal(err)
+			}
+		}
+		if entries, err = rankByRelevance(entries, o.relevantTo, o.relevantTop, budget, om); err != nil {
+			fatal(err)
+		}
+	}
+	if o.embedQuery != "" {
+		if o.embedTop <= 0 {
+			fatal(fmt.Errorf("invalid --embed-top %d: want a positive count", o.embedTop))
+		}
+		if entries, err = selectByEmbedding(entries, o.embedQuery, o.embedTop, newEmbedder(o.embedURL, o.embedModel), om); err != nil {
+			fatal(err)
+		}
+	}
+	if o.tokenBudget != "" || o.dirBudgets != "" {
+		total := 0
+		if o.tokenBudget != "" {
+			if total, err = parseTokenCount(o.tokenBudget); err != nil {
+				fatal(fmt.Errorf("invalid --token-budget: %w", err))
+			}
+		}
+		dirs, err := parseDirBudgets(o.dirBudgets)
 		if err != nil {
-			return nil
+			fatal(err)
 		}
-		defer f.Close()
-
-		info, err := d.Info()
+		if o.budgetOverflow != "drop" && o.budgetOverflow != "truncate" {
+			fatal(fmt.Errorf("invalid --budget-overflow %q: want drop or truncate", o.budgetOverflow))
+		}
+		t, err := lookupEstimator(o.model)
 		if err != nil {
-			return nil
+			fatal(err)
 		}
-		mode := info.Mode().Perm()
-
-		if _, err := fmt.Fprintf(w, "%s path=%s mode=%04o ---\n", startMark, rel, mode); err != nil {
-			return err
+		if entries, err = applyBudgets(entries, total, dirs, o.budgetOverflow == "truncate", t, om); err != nil {
+			fatal(err)
 		}
-
-		if _, err := io.Copy(w, f); err != nil {
-			return err
+	}
+	if o.provenance {
+		commit := gitHead(o.root)
+		when := env.when.Format(time.RFC3339)
+		for i := range entries {
+			if isEncoded(entries[i]) {
+				continue
+			}
+			if b := provenanceBanner(entries[i].rel, commit, when); b != "" {
+				entries[i].banners = append(entries[i].banners, b)
+			}
 		}
-		if _, err := io.WriteString(w, "\n"+endMark+"\n"); err != nil {
-			return err
+	}
+	if len(o.noteSpecs) > 0 {
+		notes, err := parseNotes(o.noteSpecs)
+		if err != nil {
+			fatal(err)
 		}
-		return nil
-	})
+		applyNotes(entries, notes)
+	}
+	if o.withMeta {
+		commits := gitLastCommits(o.root)
+		for i := range entries {
+			entries[i].meta = entryMeta(entries[i], commits, o.reproducible)
+		}
+	}
+	if ciph != nil {
+		patterns := parseExcludes(o.encryptPaths)
+		for i := range entries {
+			if packprompt.MatchAny(patterns, entries[i].rel) {
+				entries[i].cipher = ciph
+			}
+		}
+	}
+	if entries, err = hashEntries(entries, om); err != nil {
+		fatal(err)
+	}
+	if o.coverprofile != "" {
+		if o.coverDetail != "file" && o.coverDetail != "func" {
+			fatal(fmt.Errorf("invalid --cover-detail %q: want file or func", o.coverDetail))
+		}
+		prof, err := readCoverProfile(o.coverprofile)
+		if err != nil {
+			fatal(err)
+		}
+		for i := range entries {
+			if err := annotateCoverage(&entries[i], prof, o.coverDetail == "func"); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	return &packSelection{entries: entries, om: om, excludes: excludes, walk: walk, env: env}
+}
+
+// newPackWriter sets up the writer of o's pack of sel, with attachments
+// after the entries and key, if any, signing the footer.
+func newPackWriter(o *packOptions, flg *flag.FlagSet, sel *packSelection, attachments []entry, key ed25519.PrivateKey) packWriter {
+	pw := packWriter{attachments: attachments, omitted: sel.om, contract: o.contract, format: o.format, gzip: o.gzipTar}
+	if o.noOmitted {
+		pw.omitted = nil
+	}
+	if o.footer {
+		pw.footer, pw.options, pw.env, pw.key = true, explicitFlags(flg), sel.env, key
+	}
+	if o.reproducible {
+		pw.mtime = sel.env.when
+	}
+	return pw
+}
+
+// fitSelection drops entries of sel until the pack pw renders of them
+// fits in --fit-model's context window, leaving --fit-reserve free.
+func fitSelection(o *packOptions, pw *packWriter, sel *packSelection) {
+	if o.fitModel == "" {
+		return
+	}
+	window, err := lookupContext(o.fitModel)
 	if err != nil {
 		fatal(err)
 	}
-	fmt.Printf("Packed to %s\n", *out)
+	reserve := defaultFitReserve(window)
+	if o.fitReserve != "" {
+		if reserve, err = parseTokenCount(o.fitReserve); err != nil {
+			fatal(fmt.Errorf("invalid --fit-reserve: %w", err))
+		}
+	}
+	est, err := lookupEstimator(o.fitModel)
+	if err != nil {
+		est = tokenEstimators["generic"]
+	}
+	// the estimate may be low by its stated error
+	target := int(float64(window-reserve) / (1 + est.margin()))
+	if target <= 0 {
+		fatal(fmt.Errorf("--fit-reserve %d leaves nothing of the %d-token window of %s", reserve, window, o.fitModel))
+	}
+	if sel.entries, err = fitEntries(pw, sel.entries, target, o.budgetOverflow == "truncate", est, o.fitModel, sel.om); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "Fitting %s: %d-token window, %d reserved, pack kept under ~%d tokens (%s)\n",
+		o.fitModel, window, reserve, target, est.label())
 }
 
-func unpackCmd(args []string) {
-	flg := flag.NewFlagSet("unpack", flag.ExitOnError)
-	in := flg.String("in", "files-prompt.txt", "input prompt file")
-	dest := flg.String("dest", ".", "destination directory to unpack into")
-	_ = flg.Parse(args)
+// packCmd reports whether the pack is partial: files it had selected could
+// not be read.
+func packCmd(args []string) (partial bool) {
+	var o packOptions
+	flg := packFlags(&o)
+	parseFlags(flg, args)
 
-	if err := os.MkdirAll(*dest, 0o755); err != nil {
+	var key ed25519.PrivateKey
+	if o.signKey != "" {
+		k, err := loadSigningKey(signingKeyPath(o.signKey))
+		if err != nil {
+			fatal(err)
+		}
+		key = k
+		o.footer = true
+	}
+
+	if o.splitBy != "" && o.splitTokens != "" {
+		fatal(errors.New("--split-by and --split-tokens cannot be combined"))
+	}
+	if o.ifChanged && o.manifestOut == "" {
+		fatal(errors.New("--if-changed needs --manifest, where the last pack's tree hash is kept"))
+	}
+	if err := checkFormat(o.format); err != nil {
 		fatal(err)
 	}
-	f, err := os.Open(*in)
+	if o.gzipTar && o.format != formatTar {
+		fatal(errors.New("--gzip compresses a --format tar pack"))
+	}
+	if o.format == formatTar && (o.countTokens || o.splitTokens != "") {
+		fatal(errors.New("--format tar is no text to count tokens in; --count-tokens and --split-tokens need another format"))
+	}
+	if o.format != formatText && (o.contract || o.footer) {
+		fatal(fmt.Errorf("--format %s cannot carry --contract or a --footer; they are part of the text format", o.format))
+	}
+	if o.out == "-" && (o.splitBy != "" || o.splitTokens != "" || o.manifestOut != "" || o.skipReport == "-" || o.scanReport == "-") {
+		fatal(errors.New("--out - writes one pack to stdout; it cannot be combined with --split-by, --split-tokens, --manifest, --skip-report - or --scan-report -"))
+	}
+	if o.scan != "" && o.scan != "warn" && o.scan != "fail" {
+		fatal(fmt.Errorf("invalid --scan %q: want warn or fail", o.scan))
+	}
+	if err := checkReportFormat(o.scanReportFormat); err != nil {
+		fatal(err)
+	}
+
+	if err := runHooks("pre-pack", o.preHooks, hookEnv{"ROOT": o.root, "OUTPUT": o.out}); err != nil {
+		fatal(err)
+	}
+
+	var est *tokenEstimator
+	if o.countTokens {
+		t, err := lookupEstimator(o.model)
+		if err != nil {
+			fatal(err)
+		}
+		est = &t
+	}
+
+	sel := selectEntries(&o)
+	defer func() { partial = sel.om.reportFailures() }()
+	attachments, err := fetchAttachments(o.attach)
 	if err != nil {
 		fatal(err)
 	}
-	defer f.Close()
-	r := bufio.NewReader(f)
+	pw := newPackWriter(&o, flg, sel, attachments, key)
+	fitSelection(&o, &pw, sel)
+	entries, om := sel.entries, sel.om
 
-	headerRe := regexp.MustCompile(`^--- FILE path=([^[:space:]]+)\ mode=([0-7]{3,4}) ---$`)
+	if o.skipReport != "" {
+		if err := writeSkipReport(o.skipReport, om, o.print0); err != nil {
+			fatal(err)
+		}
+	}
+	if o.scan != "" || o.scanReport != "" {
+		if err := checkPack(entries, om, &o); err != nil {
+			fatal(err)
+		}
+	}
+	if o.minFiles > 0 || o.minTokens != "" {
+		least := 0
+		if o.minTokens != "" {
+			if least, err = parseTokenCount(o.minTokens); err != nil {
+				fatal(fmt.Errorf("invalid --min-tokens: %w", err))
+			}
+		}
+		t, err := lookupEstimator(o.model)
+		if err != nil {
+			fatal(err)
+		}
+		if err := checkMinimums(entries, o.minFiles, least, t, om); err != nil {
+			fatal(err)
+		}
+	}
+	if o.dryRun {
+		paths := make([]string, 0, len(entries)+len(attachments))
+		for _, e := range append(entries, attachments...) {
+			paths = append(paths, e.rel)
+		}
+		if err := writeList(os.Stdout, paths, o.print0); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
-	for {
-		line, err := readLine(r)
-		if err == io.EOF {
-			break
+	var tree string
+	if o.manifestOut != "" {
+		if tree, err = treeHash(entries); err != nil {
+			fatal(err)
+		}
+	}
+	if o.ifChanged && unchangedSince(o.manifestOut, tree, explicitFlags(flg)) {
+		fmt.Printf("Unchanged since the last pack (%s); nothing written\n", o.manifestOut)
+		return
+	}
+
+	written := []string{o.out}
+	if o.splitTokens != "" {
+		limit, err := parseTokenCount(o.splitTokens)
+		if err != nil || limit == 0 {
+			fatal(fmt.Errorf("invalid --split-tokens %q: want e.g. 100000 or 100k", o.splitTokens))
+		}
+		t, err := lookupEstimator(o.model)
+		if err != nil {
+			fatal(err)
+		}
+		pw.preamble = renderTree(entries)
+		parts, err := splitByTokens(&pw, entries, limit, o.splitForce, t)
+		if err != nil {
+			fatal(err)
+		}
+		if est == nil {
+			est = &t
+		}
+		written = nil
+		for i, part := range parts {
+			if i == 1 {
+				pw.preamble = ""
+			}
+			p := splitPath(o.out, part.name)
+			if err := pw.write(p, part.entries); err != nil {
+				fatal(err)
+			}
+			written = append(written, p)
+			fmt.Printf("Packed %s to %s%s\n", plural(len(part.entries), "file"), p, tokenReport(p, est, o.model))
+		}
+		removeStaleParts(o.out, len(parts))
+	} else if o.splitBy == "" {
+		if err := pw.write(o.out, entries); err != nil {
+			fatal(err)
+		}
+		if o.out == "-" {
+			// stdout carries the pack
+			fmt.Fprintf(os.Stderr, "Packed %s to stdout\n", plural(len(entries), "file"))
+		} else {
+			fmt.Printf("Packed to %s%s\n", o.out, tokenReport(o.out, est, o.model))
 		}
+	} else {
+		parts, err := splitEntries(entries, o.splitBy)
 		if err != nil {
 			fatal(err)
 		}
-		if !strings.HasPrefix(line, startMark) {
-			continue
+		pw.preamble = renderTree(entries)
+		written = nil
+		for _, part := range parts {
+			p := splitPath(o.out, part.name)
+			if err := pw.write(p, part.entries); err != nil {
+				fatal(err)
+			}
+			written = append(written, p)
+			fmt.Printf("Packed %s to %s%s\n", plural(len(part.entries), "file"), p, tokenReport(p, est, o.model))
 		}
-		m := headerRe.FindStringSubmatch(line)
-		if m == nil {
-			fatal(fmt.Errorf("malformed header: %q", line))
+	}
+	if o.manifestOut != "" {
+		m, err := buildManifest(written)
+		if err != nil {
+			fatal(err)
 		}
-		rel := m[1]
-		modeStr := m[2]
-		if strings.Contains(rel, "..") && !safeRel(rel) {
-			fatal(fmt.Errorf("unsafe path in archive: %q", rel))
+		m.Tree, m.Options = tree, explicitFlags(flg)
+		if err := writeManifest(o.manifestOut, m); err != nil {
+			fatal(err)
 		}
-		full := filepath.Join(*dest, filepath.FromSlash(rel))
-		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+	}
+	if len(o.postHooks) > 0 {
+		t, err := lookupEstimator(o.model)
+		if err != nil {
+			t = tokenEstimators["generic"]
+		}
+		files, tokens := packedStats(written, t)
+		env := hookEnv{"ROOT": o.root, "OUTPUT": strings.Join(written, "\n"), "FILES": strconv.Itoa(files),
+			"TOKENS": strconv.Itoa(tokens), "MODEL": t.name}
+		if err := runHooks("post-pack", o.postHooks, env); err != nil {
 			fatal(err)
 		}
+	}
+	return
+}
+
+// normalizeEntries removes filesystem- and umask-dependent variation: entries
+// are ordered by byte-wise path and modes collapse to 0644 or 0755.
+func normalizeEntries(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].rel < entries[j].rel })
+	for i := range entries {
+		if entries[i].mode&0o111 != 0 {
+			entries[i].mode = 0o755
+		} else {
+			entries[i].mode = 0o644
+		}
+	}
+}
+
+// entry is a file selected for packing; content is read when it is written.
+type entry struct {
+	rel     string // slash-separated path inside the archive
+	src     string // path on disk; unused when data is set
+	data    []byte // content fetched from somewhere other than disk
+	mode    iofs.FileMode
+	size    int64
+	modTime time.Time
+	banners []string     // optional lines inserted at the top of the content
+	attrs   []string     // extra header attributes, "key=value"
+	notes   []string     // --note lines written between header and content
+	meta    []string     // --with-meta lines written after the content
+	cipher  *entryCipher // when set, the content is written encrypted
+}
+
+// walkOptions are the collectEntries settings beyond root and excludes.
+type walkOptions struct {
+	outputs  []string    // absolute paths of the files pack is writing, never packed themselves
+	convs    []converter // file types packed as their markdown conversion
+	archives bool        // descend into zip and tar archives
+	base64   bool        // pack binary files base64-encoded instead of leaving them out
+	links    string      // what to do with symlinks and junctions, per --links; "" records them
+}
 
-		var contentBuf bytes.Buffer
-		for {
-			l, err := readLine(r)
+// collectEntries walks root for packable files. Earlier packs found in the
+// tree are left out, like the outputs being written. A root that is a zip
+// file is read by collectZip. Symlinks and junctions are handled per
+// opts.links; a directory one leads to is walked under the link's path.
+func collectEntries(root string, excludes []string, opts walkOptions, om *omissions) ([]entry, error) {
+	if isZipRoot(root) {
+		return collectZip(root, excludes, opts, om)
+	}
+	var entries []entry
+	var walked []string // real paths of the trees walked, so --links follow packs each once
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		if real, err := filepath.Abs(real); err == nil {
+			walked = append(walked, real)
+		}
+	}
+	// walk packs the tree at dir as if it were at prefix in root.
+	var walk func(dir, prefix string) error
+	walk = func(dir, prefix string) error {
+		return filepath.WalkDir(dir, func(p string, d iofs.DirEntry, walkErr error) error {
+			rel, err := filepath.Rel(dir, p)
 			if err != nil {
-				fatal(err)
+				return err
+			}
+			rel = path.Join(prefix, filepath.ToSlash(rel))
+			top := p == dir
+			if walkErr != nil {
+				if top && prefix == "" || d == nil {
+					return walkErr
+				}
+				// a directory that cannot be listed, or an entry gone since
+				if d.IsDir() {
+					return om.fail(rel+"/", -1, walkErr)
+				}
+				return om.fail(rel, entrySize(d), walkErr)
+			}
+			if top {
+				return nil
+			}
+
+			// Exclusions first
+			if pat, ok := packprompt.MatchExclude(rel, excludes); ok {
+				if d.IsDir() {
+					om.addDir(rel, fmt.Sprintf("excluded by %q", pat))
+					return iofs.SkipDir
+				}
+				om.add(rel, entrySize(d), fmt.Sprintf("excluded by %q", pat))
+				return nil
+			}
+
+			if rel == sessionDir && d.IsDir() {
+				om.addDir(rel, "packprompt session")
+				return iofs.SkipDir
+			}
+
+			if kind, ok := isLinkEntry(p, d); ok {
+				if opts.links != linksFollow {
+					if opts.links != linksSkip {
+						recordLink(p, rel, kind, om)
+					}
+					return skipLink(d)
+				}
+				info, err := os.Stat(p)
+				if err != nil {
+					om.add(rel, 0, kind+" to a missing or unreadable target: "+err.Error())
+					return skipLink(d)
+				}
+				if info.IsDir() {
+					real, err := filepath.EvalSymlinks(p)
+					if err == nil {
+						real, err = filepath.Abs(real)
+					}
+					if err != nil {
+						if err := om.fail(rel+"/", -1, err); err != nil {
+							return err
+						}
+						return skipLink(d)
+					}
+					if w, ok := coveredBy(real, walked); ok {
+						om.addDir(rel, fmt.Sprintf("%s into %s, which the walk already covers", kind, w))
+						return skipLink(d)
+					}
+					walked = append(walked, real)
+					if err := walk(real, rel); err != nil {
+						return err
+					}
+					return skipLink(d)
+				}
+				d = iofs.FileInfoToDirEntry(info)
+			}
+
+			// Only process regular files; skip dirs, symlinks, sockets, devices, FIFOs, etc.
+			if !d.Type().IsRegular() {
+				if !d.IsDir() {
+					om.add(rel, entrySize(d), "not a regular file")
+				}
+				return nil
+			}
+
+			// our own output and its lock/temp files never go into the pack
+			if abs, err := filepath.Abs(p); err == nil {
+				for _, o := range opts.outputs {
+					if abs == o || abs == o+lockSuffix || abs == o+tmpSuffix {
+						om.add(rel, entrySize(d), "packprompt output being written")
+						return nil
+					}
+				}
+			}
+			if strings.HasSuffix(rel, tmpSuffix) || packprompt.IsTemp(rel) {
+				om.add(rel, entrySize(d), "packprompt temp file")
+				return nil
+			}
+
+			if c := findConverter(opts.convs, rel); c != nil {
+				data, err := c.convert(p)
+				switch {
+				case errors.Is(err, errNotConverted):
+					// packed as it is below
+				case err != nil:
+					fmt.Fprintf(os.Stderr, "warning: could not convert %s: %v\n", rel, err)
+					om.add(rel, entrySize(d), "could not convert: "+err.Error())
+					return nil
+				default:
+					info, err := d.Info()
+					if err != nil {
+						return om.fail(rel, 0, err)
+					}
+					entries = append(entries, entry{rel: rel + ".md", data: data, mode: 0o644, size: int64(len(data)), modTime: info.ModTime(),
+						attrs: []string{convertedAttr + "=" + c.name}})
+					return nil
+				}
+			}
+
+			// Earlier packs in any format, tar included, before archives and binaries
+			head, err := sniffFile(p)
+			if err != nil {
+				return om.fail(rel, entrySize(d), err)
+			}
+			if packprompt.IsPackOutput(head) {
+				fmt.Fprintf(os.Stderr, "warning: leaving out %s: it is an earlier packprompt output\n", rel)
+				om.add(rel, entrySize(d), "earlier packprompt output")
+				return nil
+			}
+
+			if kind := archiveKind(rel); opts.archives && kind != "" {
+				members, err := readArchive(p, rel, kind, excludes, om)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "warning: could not read archive %s: %v\n", rel, err)
+					om.add(rel, entrySize(d), "unreadable archive: "+err.Error())
+					return nil
+				}
+				entries = append(entries, members...)
+				return nil
+			}
+
+			// Binary check (only on regular files)
+			if packprompt.IsBinary(head) {
+				if !opts.base64 {
+					om.add(rel, entrySize(d), "binary")
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil {
+					return om.fail(rel, 0, err)
+				}
+				data, err := encodeBinary(p)
+				if err != nil {
+					return om.fail(rel, info.Size(), err)
+				}
+				entries = append(entries, entry{rel: rel, data: data, mode: info.Mode().Perm(), size: int64(len(data)), modTime: info.ModTime(),
+					attrs: []string{encodingAttr + "=" + base64Scheme}})
+				return nil
 			}
-			if l == endMark {
-				break
+
+			info, err := d.Info()
+			if err != nil {
+				return om.fail(rel, 0, err)
 			}
-			contentBuf.WriteString(l)
-			contentBuf.WriteString("\n")
+			entries = append(entries, entry{rel: rel, src: p, mode: info.Mode().Perm(), size: info.Size(), modTime: info.ModTime()})
+			return nil
+		})
+	}
+	err := walk(root, "")
+	return entries, err
+}
+
+// open returns the entry's content stream.
+func (e entry) open() (io.ReadCloser, error) {
+	if e.data != nil {
+		return io.NopCloser(bytes.NewReader(e.data)), nil
+	}
+	return os.Open(e.src)
+}
+
+func writeEntry(w io.Writer, e entry) error {
+	f, err := e.open()
+	if err != nil {
+		// vanished since hashEntries read it -> skip quietly
+		return nil
+	}
+	defer f.Close()
+
+	attrs := e.headerAttrs()
+	if len(e.notes) > 0 {
+		attrs = append(attrs, fmt.Sprintf("%s=%d", notesAttr, len(e.notes)))
+	}
+	if len(e.meta) > 0 {
+		attrs = append(attrs, fmt.Sprintf("%s=%d", metaAttr, len(e.meta)))
+	}
+	if _, err := io.WriteString(w, packprompt.FormatHeader(e.rel, e.mode, attrs)+"\n"); err != nil {
+		return err
+	}
+	for _, n := range e.notes {
+		if _, err := io.WriteString(w, formatNote(n)+"\n"); err != nil {
+			return err
+		}
+	}
+	r, err := e.body(f)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	trailer := "\n"
+	for _, m := range e.meta {
+		trailer += formatMeta(m) + "\n"
+	}
+	if _, err := io.WriteString(w, trailer+endMark+"\n"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// headerAttrs are the attributes every format records for e: its ID, its
+// own attributes and whether it is encrypted.
+func (e entry) headerAttrs() []string {
+	attrs := append([]string{idAttr + "=" + packprompt.EntryID(e.rel)}, e.attrs...)
+	if e.cipher != nil {
+		attrs = append(attrs, encryptedAttr+"="+cryptScheme)
+	}
+	return attrs
+}
+
+// body is the content of e as stored, read from f: banners first, sealed
+// when encrypted.
+func (e entry) body(f io.Reader) (io.Reader, error) {
+	r := f
+	if len(e.banners) > 0 {
+		br := bufio.NewReader(f)
+		var head strings.Builder
+		// keep a shebang as the first line so the script still runs
+		if peek, _ := br.Peek(2); string(peek) == "#!" {
+			shebang, err := br.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			head.WriteString(strings.TrimRight(shebang, "\n") + "\n")
 		}
+		head.WriteString(strings.Join(e.banners, "\n") + "\n")
+		r = io.MultiReader(strings.NewReader(head.String()), br)
+	}
+	if e.cipher != nil {
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := e.cipher.seal(e.rel, plain)
+		if err != nil {
+			return nil, err
+		}
+		r = strings.NewReader(sealed)
+	}
+	return r, nil
+}
 
-		tmp := full + ".tmp~ftp"
-		outf, err := os.Create(tmp)
+// unpackOptions holds unpack's flags.
+type unpackOptions struct {
+	in                  string
+	format              string
+	dest                string
+	withAttachments     bool
+	passFile            string
+	resume              bool
+	preview             bool
+	plain               bool
+	dryRun              bool
+	routeSpecs          stringList
+	onConflict          string
+	confine             bool
+	changelog           string
+	changelogTmpl       string
+	source              string
+	gitCommit           bool
+	gitBranch           string
+	gitMessage          string
+	scan                string
+	scanReport          string
+	scanReportFormat    string
+	allowProtected      bool
+	policyFile          string
+	requireSig          bool
+	keyring             string
+	noVerify            bool
+	include             string
+	exclude             string
+	preHooks, postHooks stringList
+}
+
+// unpackFlags declares unpack's flags into o.
+func unpackFlags(o *unpackOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("unpack", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file (- for stdin)")
+	flg.StringVar(&o.format, "format", formatAuto, "format of the pack: text, jsonl, markdown, xml or tar, gzipped or not (default: detected from its start)")
+	flg.StringVar(&o.dest, "dest", ".", "destination directory to unpack into")
+	flg.BoolVar(&o.withAttachments, "attachments", false, "also extract attached context documents (into _attachments/)")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the passphrase for encrypted entries from this file (default: $PACKPROMPT_PASSPHRASE)")
+	flg.BoolVar(&o.resume, "resume", false, "continue an interrupted unpack into --dest, skipping files it already completed")
+	flg.BoolVar(&o.preview, "preview", false, "show the destination tree with new, modified and unchanged files instead of unpacking")
+	flg.BoolVar(&o.plain, "plain", false, "with --preview, no colors and no pager")
+	flg.BoolVar(&o.dryRun, "dry-run", false, "list every file unpack would create or overwrite, with sizes, and write nothing")
+	flg.Var(&o.routeSpecs, "route", "unpack entries matching PATTERN into DEST instead (PATTERN=DEST, e.g. infra/**=../infra); repeatable, first match wins")
+	flg.StringVar(&o.onConflict, "on-conflict", conflictOverwrite, "for a file already at --dest that the pack changes: overwrite, skip, backup (keep it as FILE.orig) or prompt")
+	flg.BoolVar(&o.confine, "confine", true, "refuse to write outside --dest, even through symlinks in it (openat2 RESOLVE_BENEATH on Linux)")
+	flg.StringVar(&o.changelog, "changelog", "", "append a summary of what was written, and from which pack, to this file")
+	flg.StringVar(&o.changelogTmpl, "changelog-template", "", "text/template for --changelog entries, or @FILE (default: a markdown section)")
+	flg.StringVar(&o.source, "source", "", "where the pack came from (e.g. a conversation URL), for --changelog and --git-commit")
+	flg.BoolVar(&o.gitCommit, "git-commit", false, "commit the files written, with the pack's hash and --source in the message")
+	flg.StringVar(&o.gitBranch, "git-branch", "", "switch to this new branch first and commit there (implies --git-commit)")
+	flg.StringVar(&o.gitMessage, "git-message", "", "text/template for the --git-commit message, or @FILE (default: the pack, the files and Pack-SHA256/Source trailers)")
+	flg.StringVar(&o.scan, "scan", "", "scan incoming files for credentials and personal data: warn, or fail to unpack nothing")
+	flg.StringVar(&o.scanReport, "scan-report", "", "also write the checks' findings to this file (- for stdout)")
+	flg.StringVar(&o.scanReportFormat, "scan-report-format", reportSARIF, "format of --scan-report: sarif or github")
+	flg.BoolVar(&o.allowProtected, "allow-protected", false, "let entries write into .git, .ssh, .env and the other protected paths")
+	flg.StringVar(&o.policyFile, "policy", "", "enforce this unpack policy (default: --dest/"+policyName+" if present)")
+	flg.BoolVar(&o.requireSig, "require-signed", false, "unpack nothing unless the pack's footer is signed by a key in --keyring")
+	flg.StringVar(&o.keyring, "keyring", defaultKeyring(), "keyring whose keys --require-signed trusts")
+	flg.BoolVar(&o.noVerify, "no-verify", false, "do not check each file written against the sha256 in its header")
+	flg.StringVar(&o.include, "include", "", "comma-separated globs; only unpack entries matching one (e.g. cmd/**)")
+	flg.StringVar(&o.exclude, "exclude", "", "comma-separated globs of entries not to unpack (e.g. testdata/**)")
+	flg.Var(&o.preHooks, "pre-unpack", "shell command to run before unpacking; repeatable")
+	flg.Var(&o.postHooks, "post-unpack", "shell command to run after unpacking (e.g. go mod tidy), told about it in PACKPROMPT_HOOK_* variables; repeatable")
+	return flg
+}
+
+func unpackCmd(args []string) {
+	var o unpackOptions
+	flg := unpackFlags(&o)
+	parseFlags(flg, args)
+
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+	if o.format == formatAuto {
+		detected, err := sniffFormat(o.in)
+		if err != nil {
+			fatal(err)
+		}
+		o.format = detected
+	} else if err := checkFormat(o.format); err != nil {
+		fatal(err)
+	}
+	filter := pathFilter{includes: parseExcludes(o.include), excludes: parseExcludes(o.exclude)}
+	var routes unpackRoutes
+	for _, spec := range o.routeSpecs {
+		r, err := parseRoute(spec)
+		if err != nil {
+			fatal(err)
+		}
+		routes = append(routes, r)
+	}
+	if len(routes) > 0 && (o.preview || o.gitCommit || o.gitBranch != "") {
+		fatal(errors.New("--route writes into several trees; it cannot be combined with --preview (use --dry-run) or --git-commit"))
+	}
+	if o.preview {
+		out := newHumanOutput(o.plain)
+		err := previewUnpack(out, o.in, o.format, o.dest, o.withAttachments, filter, ciph)
+		out.close()
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	policy, err := loadPolicy(o.policyFile, o.dest)
+	if err != nil {
+		fatal(err)
+	}
+	if o.requireSig || policy != nil && policy.requireSigned {
+		f, err := openPack(o.in)
+		if err != nil {
+			fatal(err)
+		}
+		err = requireSigned(f, o.keyring)
+		f.Close()
+		if err != nil {
+			fatal(fmt.Errorf("nothing unpacked; %w", err))
+		}
+	}
+	if o.scan != "" && o.scan != "warn" && o.scan != "fail" {
+		fatal(fmt.Errorf("invalid --scan %q: want warn or fail", o.scan))
+	}
+	if err := checkReportFormat(o.scanReportFormat); err != nil {
+		fatal(err)
+	}
+	if o.in == "-" && o.onConflict == conflictPrompt {
+		fatal(errors.New("--on-conflict prompt asks on stdin, which carries the pack with --in -; use skip, overwrite or backup"))
+	}
+	conflicts, err := newConflictPolicy(o.onConflict)
+	if err != nil {
+		fatal(err)
+	}
+	var rec *changeRecord
+	tmpl, err := parseRecordTemplate("changelog-template", o.changelogTmpl, defaultChangelogTemplate)
+	if err != nil {
+		fatal(err)
+	}
+	git, err := newGitCommitter(o.dest, o.gitCommit, o.gitBranch, o.gitMessage)
+	if err != nil {
+		fatal(err)
+	}
+	if o.changelog != "" || git != nil {
+		sum, err := packSum(o.in)
 		if err != nil {
 			fatal(err)
 		}
-		contentBytes := contentBuf.Bytes()
-		// Remove trailing newline if present
-		if len(contentBytes) > 0 && contentBytes[len(contentBytes)-1] == '\n' {
-			contentBytes = contentBytes[:len(contentBytes)-1]
+		r := newChangeRecord("unpack", o.in, sum, o.source, o.dest)
+		rec = &r
+	}
+	checks := unpackChecks{dest: o.dest, attachments: o.withAttachments, policy: policy, allowProtected: o.allowProtected, scan: o.scan, filter: filter, routes: routes, format: o.format,
+		report: o.scanReport, reportFormat: o.scanReportFormat}
+	if checks.active() {
+		if err := checkUnpack(o.in, ciph, checks); err != nil {
+			fatal(err)
 		}
-		if _, err := outf.Write(contentBytes); err != nil {
-			_ = outf.Close()
-			_ = os.Remove(tmp)
+	}
+	if o.dryRun {
+		if err := dryRunUnpack(os.Stdout, o.in, o.format, o.dest, o.withAttachments, filter, routes, o.onConflict, ciph); err != nil {
 			fatal(err)
 		}
-		if err := outf.Close(); err != nil {
-			_ = os.Remove(tmp)
+		return
+	}
+
+	if err := runHooks("pre-unpack", o.preHooks, hookEnv{"INPUT": o.in, "DEST": o.dest}); err != nil {
+		fatal(err)
+	}
+
+	if err := git.start(); err != nil {
+		fatal(err)
+	}
+	for _, d := range append([]string{o.dest}, routes.dests()...) {
+		if err := os.MkdirAll(d, 0o755); err != nil {
 			fatal(err)
 		}
+	}
+	f, err := openPack(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+	state, err := openUnpackState(o.dest, o.in, o.resume)
+	if err != nil {
+		fatal(err)
+	}
 
+	index, skipped, written, left, unrouted := -1, 0, 0, 0, 0
+	var damaged []string
+	err = readPackAs(f, o.format, func(pf packedFile) error {
+		index++
+		if pf.attachment && !o.withAttachments {
+			return nil
+		}
+		if !filter.keeps(pf.rel) {
+			left++
+			return nil
+		}
+		to, rel, routed := routes.place(o.dest, pf.rel)
+		if !routed {
+			unrouted++
+			return nil
+		}
+		name := routes.display(to, rel)
+		full := filepath.Join(to, filepath.FromSlash(rel))
+		if state.completed(index, full) {
+			skipped++
+			return nil
+		}
+		contentBytes, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: skipping encrypted %s (no passphrase)\n", name)
+			return nil
+		}
+		c, chunked, err := packprompt.ParseChunk(pf.attrs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if ok, err := conflicts.allow(to, rel, full, contentBytes, c, chunked, o.confine); err != nil || !ok {
+			return err
+		}
+		var offset int64
+		if chunked {
+			if contentBytes, err = packprompt.JoinChunk(to, rel, c, contentBytes); err != nil {
+				return err
+			}
+			offset = c.Offset
+		}
+		if lines, cut := pf.attrs[truncatedAttr]; cut {
+			fmt.Fprintf(os.Stderr, "warning: %s was truncated to fit a token budget when packed (%s lines)\n", name, lines)
+		}
 		var mode iofs.FileMode = 0o644
-		if m, perr := parseOctal(modeStr); perr == nil {
+		if m, perr := packprompt.ParseMode(pf.mode); perr == nil {
 			mode = m
 		}
-		_ = os.Chmod(tmp, mode)
-		if err := os.Rename(tmp, full); err != nil {
+		if m := policy.mode(mode); m != mode {
+			if mode&0o111 != 0 && m&0o111 == 0 {
+				fmt.Fprintf(os.Stderr, "warning: %s: not restoring mode %04o (policy %s)\n", name, mode, policy.name)
+			}
+			mode = m
+		}
+		if rec != nil {
+			if c, ok, _ := packprompt.ParseChunk(pf.attrs); ok {
+				rec.classifyChunk(name, full, c, contentBytes)
+			} else {
+				rec.classify(name, full, contentBytes)
+			}
+		}
+		state.sweep(to, rel, o.confine)
+		if o.confine {
+			err = packprompt.WriteBeneath(to, rel, contentBytes, mode)
+		} else {
+			err = writeFileAtomic(full, contentBytes, mode)
+		}
+		if err != nil {
+			return err
+		}
+		written++
+		if want, ok := pf.attrs[sha256Attr]; ok && !o.noVerify {
+			if err := checkWritten(full, offset, want); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s: %v\n", name, err)
+				damaged = append(damaged, name)
+			}
+		}
+		return state.record(index, contentBytes)
+	})
+	if err != nil {
+		fatal(err)
+	}
+	if err := state.finish(); err != nil {
+		fatal(err)
+	}
+	if skipped > 0 {
+		fmt.Printf("Resumed: %d files were already complete\n", skipped)
+	}
+	if filter.active() {
+		fmt.Printf("Left out %s not selected by --include/--exclude\n", plural(left, "entry"))
+	}
+	if unrouted > 0 {
+		fmt.Printf("Left out %s no --route matches\n", plural(unrouted, "entry"))
+	}
+	if len(conflicts.skipped) > 0 {
+		fmt.Printf("Kept %s already there: %s\n", plural(len(conflicts.skipped), "file"), strings.Join(conflicts.skipped, ", "))
+	}
+	if len(conflicts.backedUp) > 0 {
+		fmt.Printf("Backed up %s: %s\n", plural(len(conflicts.backedUp), "file"), strings.Join(conflicts.backedUp, ", "))
+	}
+	if len(routes) > 0 {
+		fmt.Printf("Unpacked into %s\n", strings.Join(routes.dests(), ", "))
+	} else {
+		fmt.Printf("Unpacked into %s\n", o.dest)
+	}
+	if len(damaged) > 0 {
+		// written all the same so the damage can be seen, but neither
+		// logged, committed nor handed to the post-unpack hooks
+		fatal(fmt.Errorf("the pack was changed on its way here: the sha256 in the header does not match %s written: %s (unpack --no-verify skips this check)", plural(len(damaged), "file"), strings.Join(damaged, ", ")))
+	}
+	if o.changelog != "" {
+		if err := appendChangelog(o.changelog, tmpl, *rec); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Logged %d added, %d changed to %s\n", len(rec.Added), len(rec.Changed), o.changelog)
+	}
+	if git != nil {
+		if err := git.commit(*rec); err != nil {
 			fatal(err)
 		}
 	}
-	fmt.Printf("Unpacked into %s\n", *dest)
+	env := hookEnv{"INPUT": o.in, "DEST": o.dest, "FILES": strconv.Itoa(written)}
+	if err := runHooks("post-unpack", o.postHooks, env); err != nil {
+		fatal(err)
+	}
 }
 
 func readLine(r *bufio.Reader) (string, error) {
@@ -249,6 +1479,19 @@ func readLine(r *bufio.Reader) (string, error) {
 	return strings.TrimRight(s, "\r\n"), nil
 }
 
+// readContentLine is readLine for a line of file content, keeping its CR:
+// the file's own line ending, which its sha256 covers.
+func readContentLine(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString('\n')
+	if errors.Is(err, io.EOF) && len(s) > 0 {
+		return strings.TrimSuffix(s, "\n"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(s, "\n"), nil
+}
+
 func parseExcludes(csv string) []string {
 	if strings.TrimSpace(csv) == "" {
 		return nil
@@ -266,104 +1509,51 @@ func parseExcludes(csv string) []string {
 
 // patterns with '/' match whole relative path; otherwise match basename
 func excluded(rel string, d iofs.DirEntry, patterns []string) bool {
-	base := path.Base(rel)
-	for _, pat := range patterns {
-		pat = strings.TrimSpace(pat)
-		if pat == "" {
-			continue
-		}
-		if strings.Contains(pat, "/") {
-			if ok, _ := path.Match(pat, rel); ok {
-				return true
-			}
-		} else {
-			if ok, _ := path.Match(pat, base); ok {
-				return true
-			}
-			if !strings.ContainsAny(pat, "*?[]") && base == pat {
-				return true
-			}
+	_, ok := packprompt.MatchExclude(rel, patterns)
+	return ok
+}
+
+// excludedPath is excluded for paths that were not reached by walking, so
+// every ancestor directory is checked as well as the file itself.
+func excludedPath(rel string, patterns []string) bool {
+	for p := rel; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if excluded(p, nil, patterns) {
+			return true
 		}
 	}
 	return false
 }
 
-func safeRel(rel string) bool {
-	clean := path.Clean("/" + rel)
-	return !strings.HasPrefix(clean, "/../") && clean != "/.."
+func csvSet(csv string) map[string]bool {
+	set := make(map[string]bool)
+	for _, p := range strings.Split(csv, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			set[p] = true
+		}
+	}
+	return set
 }
 
 // Only called for regular files now; read a small sniff to classify
 func isBinaryFile(p string) (bool, error) {
-	f, err := os.Open(p)
+	head, err := sniffFile(p)
 	if err != nil {
 		return false, err
 	}
-	defer f.Close()
-
-	const sniff = 8192
-	buf := make([]byte, sniff)
-	n, _ := io.ReadAtLeast(f, buf, 1) // read at least 1 byte; don't block for full 8K
-	buf = buf[:n]
-	if n == 0 {
-		return false, nil
-	}
-
-	// Heuristic 1: NUL byte
-	if bytes.IndexByte(buf, 0x00) >= 0 {
-		return true, nil
-	}
-
-	// Heuristic 2: MIME
-	ct := http.DetectContentType(buf)
-	if strings.Contains(ct, "application/octet-stream") ||
-		strings.Contains(ct, "application/x-executable") ||
-		strings.HasPrefix(ct, "image/") ||
-		strings.HasPrefix(ct, "audio/") ||
-		strings.HasPrefix(ct, "video/") ||
-		strings.HasPrefix(ct, "font/") {
-		return true, nil
-	}
-
-	// Heuristic 3: printable ratio
-	var nonPrintable, printable int
-	for _, r := range string(buf) {
-		if r == '\n' || r == '\r' || r == '\t' {
-			printable++
-			continue
-		}
-		if r == '\uFFFD' {
-			nonPrintable++
-			continue
-		}
-		if r < 32 || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
-			nonPrintable++
-		} else {
-			printable++
-		}
-	}
-	if printable == 0 {
-		return true, nil
-	}
-	if float64(nonPrintable)/float64(printable+nonPrintable) > 0.30 {
-		return true, nil
-	}
-	return false, nil
+	return packprompt.IsBinary(head), nil
 }
 
-func parseOctal(s string) (iofs.FileMode, error) {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return 0, fmt.Errorf("empty")
-	}
-	var v uint32
-	for _, ch := range s {
-		if ch < '0' || ch > '7' {
-			return 0, fmt.Errorf("invalid octal %q", s)
-		}
-		v = (v << 3) | uint32(ch-'0')
+// sniffFile returns up to the first packprompt.SniffLen bytes of a file.
+func sniffFile(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
 	}
-	return iofs.FileMode(v), nil
+	defer f.Close()
+
+	buf := make([]byte, packprompt.SniffLen)
+	n, _ := io.ReadAtLeast(f, buf, 1) // read at least 1 byte; don't block for the full sniff
+	return buf[:n], nil
 }
 
 func fatal(err error) {
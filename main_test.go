@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// runMainEnv, set in the environment of a re-run of the test binary, makes
+// it run main with the arguments after "--" instead of the tests.
+const runMainEnv = "PACKPROMPT_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		os.Unsetenv(runMainEnv)
+		for i, a := range os.Args {
+			if a == "--" {
+				os.Args = append([]string{os.Args[0]}, os.Args[i+1:]...)
+				break
+			}
+		}
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// cliResult is what a run of the command line printed and how it exited.
+type cliResult struct {
+	stdout, stderr string
+	code           int
+}
+
+// runCLI runs packprompt with args in dir, isolated from the user's
+// config and environment.
+func runCLI(t *testing.T, dir string, args ...string) cliResult {
+	t.Helper()
+	return runCLIEnv(t, dir, nil, args...)
+}
+
+// runCLIStdin is runCLI reading stdin from stdin.
+func runCLIStdin(t *testing.T, dir string, stdin io.Reader, args ...string) cliResult {
+	t.Helper()
+	return runCLIWith(t, dir, nil, stdin, args...)
+}
+
+// runCLIEnv is runCLI with env (NAME=value) added to the environment.
+func runCLIEnv(t *testing.T, dir string, env []string, args ...string) cliResult {
+	t.Helper()
+	return runCLIWith(t, dir, env, nil, args...)
+}
+
+func runCLIWith(t *testing.T, dir string, env []string, stdin io.Reader, args ...string) cliResult {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^$", "--"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	home := t.TempDir()
+	cmd.Env = []string{runMainEnv + "=1", "HOME=" + home, "XDG_CONFIG_HOME=" + filepath.Join(home, ".config"), "PATH=" + os.Getenv("PATH")}
+	cmd.Env = append(cmd.Env, env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	res := cliResult{stdout: stdout.String(), stderr: stderr.String()}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		res.code = exit.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// writeTree creates files (slash paths to content) under a new directory.
+func writeTree(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestPackMatchesLibrary checks pack with its defaults writes what
+// packprompt.Pack writes for the same tree, and unpack and
+// packprompt.Unpack restore the same files from it.
+func TestPackMatchesLibrary(t *testing.T) {
+	big := strings.Repeat("text\n", 2000) + "\x00" // a NUL past the sniff
+	src := writeTree(t, map[string]string{
+		"a.txt": "alpha\n", "README.md": "# r\n", "cmd/x/main.go": "package main\n", "sub/b.go": "package b\n",
+		"img.bin": "\x00\x01\x02", "big.txt": big, "end.txt": packprompt.EndMark + "\n", "sp ace.txt": "x\n",
+		".git/HEAD": "ref\n", packprompt.SessionDir + "/s.json": "{}\n",
+	})
+	for _, link := range [][2]string{{"a.txt", "link.txt"}, {"sub", "linkdir"}} {
+		if err := os.Symlink(link[0], filepath.Join(src, link[1])); err != nil {
+			t.Skip(err)
+		}
+	}
+	out := filepath.Join(t.TempDir(), "pack.txt")
+	if res := runCLI(t, src, "pack", "--out", out); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	cli, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lib bytes.Buffer
+	if err := packprompt.Pack(packprompt.PackOptions{Root: src, Out: &lib}); err != nil {
+		t.Fatal(err)
+	}
+	if lib.String() != string(cli) {
+		t.Errorf("packprompt.Pack wrote\n%s\npack wrote\n%s", lib.String(), cli)
+	}
+
+	dest := t.TempDir()
+	if res := runCLI(t, src, "unpack", "--in", out, "--dest", dest); res.code != 0 {
+		t.Fatalf("unpack: exit %d: %s", res.code, res.stderr)
+	}
+	libDest := t.TempDir()
+	if err := packprompt.Unpack(packprompt.UnpackOptions{In: bytes.NewReader(cli), Dest: libDest}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"a.txt", "README.md", "cmd/x/main.go", "big.txt", "end.txt"} {
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+		want, libErr := os.ReadFile(filepath.Join(libDest, filepath.FromSlash(rel)))
+		if err != nil || libErr != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: unpack wrote %q (%v), packprompt.Unpack %q (%v)", rel, got, err, want, libErr)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// manifestFormat names the layout of pack --manifest files.
+const manifestFormat = "packprompt-manifest/1"
+
+// manifest records what a pack holds, so a copy of it that went through a
+// model (or anything else lossy) can be checked entry by entry.
+type manifest struct {
+	Format string   `json:"format"`
+	Tool   string   `json:"tool"`
+	Packs  []string `json:"packs"`
+	// Tree and Options are what pack --if-changed compares: the treeHash of
+	// the packed entries and the options they were packed with.
+	Tree    string         `json:"tree,omitempty"`
+	Options string         `json:"options,omitempty"`
+	Files   []manifestFile `json:"files"`
+}
+
+// manifestFile describes one entry; SHA256 is of the content as stored in
+// the pack, between header (and notes) and end mark.
+type manifestFile struct {
+	Path   string `json:"path"`
+	ID     string `json:"id"`
+	Mode   string `json:"mode"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	Pack   string `json:"pack,omitempty"` // with --split-by, the pack holding it
+}
+
+// buildManifest reads back the written packs.
+func buildManifest(packs []string) (*manifest, error) {
+	m := &manifest{Format: manifestFormat, Tool: "packprompt " + toolVersion(), Packs: packs, Files: []manifestFile{}}
+	for _, p := range packs {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		err = readPack(f, func(pf packedFile) error {
+			if pf.attachment {
+				return nil
+			}
+			mf := manifestFile{Path: pf.rel, ID: pf.id(), Mode: pf.mode, Size: len(pf.content), SHA256: contentHash(pf.content)}
+			if len(packs) > 1 {
+				mf.Pack = p
+			}
+			m.Files = append(m.Files, mf)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return m, nil
+}
+
+// unchangedSince reports whether the manifest at path describes packs, all
+// still present, made from the same tree with the same options.
+func unchangedSince(path, tree, options string) bool {
+	m, err := readManifest(path)
+	if err != nil || m.Tree != tree || m.Options != options || len(m.Packs) == 0 {
+		return false
+	}
+	for _, p := range m.Packs {
+		if _, err := os.Stat(p); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func writeManifest(path string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Format != manifestFormat {
+		return nil, fmt.Errorf("%s: not a packprompt manifest (format %q)", path, m.Format)
+	}
+	return &m, nil
+}
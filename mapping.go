@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// parseMapping splits "hostpath=packprefix" and validates the prefix.
+func parseMapping(spec string) (host, prefix string, err error) {
+	i := strings.LastIndex(spec, "=")
+	if i <= 0 || i == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid --map %q: want hostpath=packprefix", spec)
+	}
+	host, prefix = spec[:i], filepath.ToSlash(spec[i+1:])
+	prefix = path.Clean(strings.TrimPrefix(prefix, "/"))
+	if prefix == "." || !packprompt.SafePath(prefix) || strings.HasPrefix(prefix, "../") {
+		return "", "", fmt.Errorf("invalid --map %q: prefix must be a relative path inside the archive", spec)
+	}
+	return host, prefix, nil
+}
+
+// collectMapped walks host (a directory or a single file) and stores its
+// files under prefix in the archive.
+func collectMapped(spec string, excludes []string, opts walkOptions, om *omissions) ([]entry, error) {
+	host, prefix, err := parseMapping(spec)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(host)
+	if err != nil {
+		return nil, fmt.Errorf("--map: %w", err)
+	}
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("--map %s: not a regular file or directory", host)
+		}
+		if bin, err := isBinaryFile(host); err != nil || bin {
+			om.add(prefix, info.Size(), "binary or unreadable")
+			return nil, nil
+		}
+		return []entry{{rel: prefix, src: host, mode: info.Mode().Perm(), size: info.Size(), modTime: info.ModTime()}}, nil
+	}
+	var local omissions
+	entries, err := collectEntries(host, excludes, opts, &local)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].rel = prefix + "/" + entries[i].rel
+	}
+	for _, o := range local.list {
+		om.add(prefix+"/"+o.Path, o.Size, o.Reason)
+	}
+	return entries, nil
+}
+
+// mergeEntries appends extra to entries, dropping (with a warning) any path
+// the archive already holds.
+func mergeEntries(entries, extra []entry, om *omissions) []entry {
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		seen[e.rel] = true
+	}
+	for _, e := range extra {
+		if seen[e.rel] {
+			fmt.Fprintf(os.Stderr, "Warning: %s is already in the pack; ignoring %s\n", e.rel, e.src)
+			om.add(e.rel, e.size, "duplicate path from "+e.src)
+			continue
+		}
+		seen[e.rel] = true
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"runtime/debug"
+)
+
+// perWorkerMemory is what one forEachParallel worker is assumed to hold at
+// once: a file being hashed or counted and its buffers.
+const perWorkerMemory = 32 << 20
+
+// memoryLimit is the --max-memory target in bytes; 0 means none.
+var memoryLimit int64
+
+// setMemoryLimit applies --max-memory: the Go runtime's soft limit, so the
+// collector works harder instead of letting the heap grow past it, and
+// fewer parallel workers. The limit is a target, not a guarantee; content
+// that must be held whole (conversions, archive members, a pack on stdin)
+// still counts.
+func setMemoryLimit(limit int64) {
+	memoryLimit = limit
+	debug.SetMemoryLimit(limit)
+}
+
+// workerCount caps n workers by the memory limit, keeping at least one.
+func workerCount(n int) int {
+	if memoryLimit > 0 {
+		n = min(n, max(1, int(memoryLimit/perWorkerMemory)))
+	}
+	return n
+}
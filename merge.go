@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"strings"
+)
+
+// How apply treats a file whose local copy moved on since it was packed.
+const (
+	staleConflict  = "conflict"  // refuse, unless --force
+	staleOverwrite = "overwrite" // write the response's version over it
+	staleMerge     = "merge"     // merge the local and the response's changes to the packed version
+)
+
+// Outcomes of --on-stale merge, kept on the file.
+const (
+	mergedClean      = "clean"
+	mergedConflicted = "conflicted"
+)
+
+// packBases reads the packs a response answers for the content of each
+// entry, by its sha256, as the bases of three-way merges.
+func packBases(packs []string, ciph *entryCipher) (map[string][]byte, error) {
+	bases := map[string][]byte{}
+	for _, pack := range packs {
+		f, err := os.Open(pack)
+		if err != nil {
+			return nil, err
+		}
+		err = readPack(f, func(pf packedFile) error {
+			if pf.attachment {
+				return nil
+			}
+			content, ok, err := pf.decode(ciph)
+			if err != nil || !ok {
+				return err
+			}
+			bases[contentHash(content)] = content
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bases, nil
+}
+
+// resolveStale settles the whole-file blocks of files whose local copy no
+// longer matches their base, as policy says. Overwritten and cleanly
+// merged files are rebased onto the local copy, so they no longer
+// conflict; a merge that conflicts is written with conflict markers. What
+// cannot be settled (a stale delete, a merge with no packed version to
+// start from) is left to conflict.
+func resolveStale(root string, files []responseFile, policy string, bases map[string][]byte) error {
+	if policy == staleConflict {
+		return nil
+	}
+	for i := range files {
+		f := &files[i]
+		if f.patch {
+			continue // patches find their own way, with fuzz
+		}
+		cur, err := readLocal(root, f.rel)
+		exists := err == nil
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return err
+		}
+		local := newBase
+		if exists {
+			local = contentHash(cur)
+		}
+		if local == f.base {
+			continue
+		}
+		switch {
+		case policy == staleOverwrite:
+			f.base = local
+		case f.deleted || !exists:
+			// nothing to merge into, or a change to something deleted
+		case f.base == newBase:
+			// both sides added the file: merge from nothing
+			f.content, f.merge = mergeLines(nil, cur, f.content)
+			f.base = local
+		default:
+			base, ok := bases[f.base]
+			if !ok {
+				continue
+			}
+			f.content, f.merge = mergeLines(base, cur, f.content)
+			f.base = local
+		}
+	}
+	return nil
+}
+
+// change is a run of base[start:end] that one side replaced with lines.
+type change struct {
+	start, end int
+	lines      []string
+}
+
+// changes lists the runs where other departs from base.
+func changes(base, other []string) []change {
+	var out []change
+	var cur *change
+	ai := 0
+	for _, e := range lineDiff(base, other) {
+		if e.op == ' ' {
+			cur = nil
+			ai = e.ai + 1
+			continue
+		}
+		if cur == nil {
+			out = append(out, change{start: ai, end: ai})
+			cur = &out[len(out)-1]
+		}
+		if e.op == '-' {
+			cur.end = e.ai + 1
+			ai = e.ai + 1
+		} else {
+			cur.lines = append(cur.lines, other[e.bi])
+		}
+	}
+	return out
+}
+
+// mergeLines merges the changes local and theirs each made to base, line
+// by line like git: changes to different parts both apply, the same change
+// made on both sides applies once, and overlapping or touching changes
+// that differ are written between conflict markers.
+func mergeLines(base, local, theirs []byte) ([]byte, string) {
+	b := splitLines(string(base))
+	ours, others := changes(b, splitLines(string(local))), changes(b, splitLines(string(theirs)))
+	var out []string
+	outcome := mergedClean
+	pos := 0
+	for len(ours) > 0 || len(others) > 0 {
+		// gather the next cluster of changes that overlap or touch
+		start, end := 0, 0
+		var mine, yours []change
+		take := func(side *[]change, into *[]change) bool {
+			if len(*side) == 0 || (len(mine)+len(yours) > 0 && (*side)[0].start > end) {
+				return false
+			}
+			c := (*side)[0]
+			if len(mine)+len(yours) == 0 {
+				start, end = c.start, c.end
+			}
+			end = max(end, c.end)
+			*into = append(*into, c)
+			*side = (*side)[1:]
+			return true
+		}
+		if len(others) == 0 || (len(ours) > 0 && ours[0].start <= others[0].start) {
+			take(&ours, &mine)
+		} else {
+			take(&others, &yours)
+		}
+		for take(&ours, &mine) || take(&others, &yours) {
+		}
+		out = append(out, b[pos:start]...)
+		pos = end
+		switch a, t := replay(b, start, end, mine), replay(b, start, end, yours); {
+		case len(yours) == 0:
+			out = append(out, a...)
+		case len(mine) == 0 || strings.Join(a, "\n") == strings.Join(t, "\n"):
+			out = append(out, t...)
+		default:
+			out = append(out, "<<<<<<< local")
+			out = append(out, a...)
+			out = append(out, "=======")
+			out = append(out, t...)
+			out = append(out, ">>>>>>> response")
+			outcome = mergedConflicted
+		}
+	}
+	out = append(out, b[pos:]...)
+	if len(out) == 0 {
+		return nil, outcome
+	}
+	text := strings.Join(out, "\n")
+	if len(local) == 0 || strings.HasSuffix(string(local), "\n") {
+		text += "\n"
+	}
+	return []byte(text), outcome
+}
+
+// replay applies one side's changes within base[start:end].
+func replay(base []string, start, end int, cs []change) []string {
+	var out []string
+	pos := start
+	for _, c := range cs {
+		out = append(out, base[pos:c.start]...)
+		out = append(out, c.lines...)
+		pos = c.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// mergeSummary names the files --on-stale merge left conflict markers in.
+func mergeSummary(files []responseFile) error {
+	var conflicted []string
+	for _, f := range files {
+		if f.merge == mergedConflicted {
+			conflicted = append(conflicted, f.rel)
+		}
+	}
+	if len(conflicted) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s merged with conflicts; resolve the <<<<<<< markers by hand: %s", plural(len(conflicted), "file"), strings.Join(conflicted, ", "))
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+// TestMergeLines checks the three-way merge behind --on-stale merge.
+func TestMergeLines(t *testing.T) {
+	const base = "a\nb\nc\nd\ne\n"
+	for _, c := range []struct {
+		name                string
+		base, local, theirs string
+		want, outcome       string
+	}{
+		{"local only", base, "a\nB\nc\nd\ne\n", base, "a\nB\nc\nd\ne\n", mergedClean},
+		{"theirs only", base, base, "a\nb\nC\nd\ne\n", "a\nb\nC\nd\ne\n", mergedClean},
+		{"apart", base, "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", mergedClean},
+		{"same change", base, "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", mergedClean},
+		{"insert and delete", base, "a\nb\nc\nd\ne\nf\n", "a\nc\nd\ne\n", "a\nc\nd\ne\nf\n", mergedClean},
+		{"both add the same", "", "x\ny\n", "x\ny\n", "x\ny\n", mergedClean},
+		{"theirs empties it", "a\n", "a\n", "", "", mergedClean},
+		{"local's missing newline kept", "a\nb\n", "a\nb", "A\nb\n", "A\nb", mergedClean},
+		{"overlap", base, "a\nX\nc\nd\ne\n", "a\nY\nc\nd\ne\n",
+			"a\n<<<<<<< local\nX\n=======\nY\n>>>>>>> response\nc\nd\ne\n", mergedConflicted},
+		{"touching", base, "a\nB\nc\nd\ne\n", "a\nb\nC\nd\ne\n",
+			"a\n<<<<<<< local\nB\nc\n=======\nb\nC\n>>>>>>> response\nd\ne\n", mergedConflicted},
+		{"insert at the same place", "a\nb\n", "a\nx\nb\n", "a\ny\nb\n",
+			"a\n<<<<<<< local\nx\n=======\ny\n>>>>>>> response\nb\n", mergedConflicted},
+		{"both add differently", "", "x\n", "y\n",
+			"<<<<<<< local\nx\n=======\ny\n>>>>>>> response\n", mergedConflicted},
+		{"conflict beside a clean change", base, "A\nb\nX\nd\ne\n", "a\nb\nY\nd\nE\n",
+			"A\nb\n<<<<<<< local\nX\n=======\nY\n>>>>>>> response\nd\nE\n", mergedConflicted},
+	} {
+		var b []byte
+		if c.base != "" {
+			b = []byte(c.base)
+		}
+		got, outcome := mergeLines(b, []byte(c.local), []byte(c.theirs))
+		if string(got) != c.want || outcome != c.outcome {
+			t.Errorf("%s: got %s %q, want %s %q", c.name, outcome, got, c.outcome, c.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// Metadata lines are the --with-meta trailer: size, modification time and
+// the last commit of the file, written after the content and counted by the
+// meta=N header attribute so readers strip them from the content again.
+const (
+	metaAttr = packprompt.MetaAttr
+	metaMark = packprompt.MetaMark
+)
+
+// fileCommit is the last commit that touched a file.
+type fileCommit struct {
+	hash, author, date, subject string
+}
+
+// gitLastCommits maps each file under dir to the last commit touching it;
+// outside a repository the map is empty.
+func gitLastCommits(dir string) map[string]fileCommit {
+	last := map[string]fileCommit{}
+	out, err := gitOutput(dir, "log", "--no-merges", "--pretty=format:%x00%h%x1f%an <%ae>%x1f%as%x1f%s", "--name-only", "--relative")
+	if err != nil {
+		return last
+	}
+	var c fileCommit
+	for _, l := range strings.Split(out, "\n") {
+		if strings.HasPrefix(l, "\x00") {
+			f := strings.SplitN(l[1:], "\x1f", 4)
+			if len(f) == 4 {
+				c = fileCommit{f[0], f[1], f[2], f[3]}
+			}
+			continue
+		}
+		if l = strings.TrimSpace(l); l == "" {
+			continue
+		}
+		// log is newest first
+		if _, ok := last[l]; !ok {
+			last[l] = c
+		}
+	}
+	return last
+}
+
+// entryMeta builds the trailer of e. The modification time is left out of
+// reproducible packs, where it would differ between checkouts.
+func entryMeta(e entry, commits map[string]fileCommit, reproducible bool) []string {
+	meta := []string{"size: " + humanSize(e.size)}
+	if !reproducible && !e.modTime.IsZero() {
+		meta = append(meta, "modified: "+e.modTime.UTC().Format(time.RFC3339))
+	}
+	if c, ok := commits[e.rel]; ok {
+		meta = append(meta, fmt.Sprintf("last commit: %s %s (%s)", c.hash, strings.Join(strings.Fields(c.subject), " "), c.date),
+			"author: "+c.author)
+	}
+	return meta
+}
+
+func formatMeta(text string) string {
+	return metaMark + text + " ---"
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// Notes are lines the packer attached to an entry with --note. They sit
+// between the entry header, whose notes=N attribute counts them, and the
+// content, so they reach the model first and never end up in unpacked files.
+const (
+	notesAttr = packprompt.NotesAttr
+	noteMark  = packprompt.NoteMark
+)
+
+// entryNote is one --note: text for the entries matching glob.
+type entryNote struct {
+	glob, text string
+}
+
+// parseNotes reads --note values of the form "glob=text".
+func parseNotes(specs []string) ([]entryNote, error) {
+	var notes []entryNote
+	for _, s := range specs {
+		glob, text, ok := strings.Cut(s, "=")
+		glob, text = strings.TrimSpace(glob), strings.Join(strings.Fields(text), " ")
+		if !ok || glob == "" || text == "" {
+			return nil, fmt.Errorf("invalid --note %q: want glob=text", s)
+		}
+		notes = append(notes, entryNote{glob, text})
+	}
+	return notes, nil
+}
+
+// applyNotes attaches each note to the entries its glob matches, in flag
+// order, and warns about notes that match nothing.
+func applyNotes(entries []entry, notes []entryNote) {
+	for _, n := range notes {
+		matched := false
+		for i := range entries {
+			if packprompt.Match(n.glob, entries[i].rel) {
+				entries[i].notes = append(entries[i].notes, n.text)
+				matched = true
+			}
+		}
+		if !matched {
+			fmt.Fprintf(os.Stderr, "warning: --note %q matched no packed file\n", n.glob)
+		}
+	}
+}
+
+func formatNote(text string) string {
+	return noteMark + text + " ---"
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxDocumentXML bounds how much of a document's XML is read, so a zip bomb
+// dressed as a .docx cannot exhaust memory.
+const maxDocumentXML = 64 << 20
+
+// zipMember opens one member of a zip container.
+func zipMember(p, name string) (io.ReadCloser, func() error, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, nil, err
+			}
+			return rc, zr.Close, nil
+		}
+	}
+	zr.Close()
+	return nil, nil, fmt.Errorf("no %s inside", name)
+}
+
+// docWriter assembles markdown from a paragraph-oriented XML stream.
+type docWriter struct {
+	b         strings.Builder
+	para      strings.Builder
+	prefix    string   // heading or list marker for the current paragraph
+	row       []string // cells of the table row being read
+	inCell    bool
+	tableRows int
+}
+
+func (w *docWriter) text(s string) {
+	w.para.WriteString(s)
+}
+
+func (w *docWriter) endPara() {
+	t := strings.TrimSpace(w.para.String())
+	w.para.Reset()
+	if w.inCell {
+		if t != "" {
+			n := len(w.row) - 1
+			w.row[n] = strings.TrimSpace(w.row[n] + " " + t)
+		}
+		return
+	}
+	if t != "" {
+		w.b.WriteString(w.prefix + t + "\n\n")
+	}
+	w.prefix = ""
+}
+
+func (w *docWriter) startCell() {
+	w.row = append(w.row, "")
+	w.inCell = true
+}
+
+func (w *docWriter) endRow() {
+	cells := make([]string, len(w.row))
+	for i, c := range w.row {
+		cells[i] = strings.ReplaceAll(c, "|", `\|`)
+	}
+	w.b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	if w.tableRows == 0 {
+		w.b.WriteString("|" + strings.Repeat(" --- |", len(cells)) + "\n")
+	}
+	w.tableRows++
+	w.row, w.inCell = nil, false
+}
+
+func (w *docWriter) endTable() {
+	w.tableRows = 0
+	w.b.WriteString("\n")
+}
+
+func headingPrefix(level int) string {
+	return strings.Repeat("#", min(max(level, 1), 6)) + " "
+}
+
+// convertDocx extracts word/document.xml: headings, list items, tables
+// and paragraph text.
+func convertDocx(p string) ([]byte, error) {
+	rc, closeZip, err := zipMember(p, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer closeZip()
+	defer rc.Close()
+	dec := xml.NewDecoder(io.LimitReader(rc, maxDocumentXML))
+	var w docWriter
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				w.text("\t")
+			case "br", "cr":
+				w.text("\n")
+			case "pStyle":
+				if v := xmlAttr(t, "val"); strings.HasPrefix(strings.ToLower(v), "heading") {
+					n, _ := strconv.Atoi(v[len("heading"):])
+					w.prefix = headingPrefix(n)
+				} else if strings.EqualFold(v, "title") {
+					w.prefix = "# "
+				}
+			case "numPr":
+				if w.prefix == "" {
+					w.prefix = "- "
+				}
+			case "tc":
+				w.startCell()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				w.endPara()
+			case "tc":
+				w.endPara()
+			case "tr":
+				w.endRow()
+			case "tbl":
+				w.endTable()
+			}
+		case xml.CharData:
+			if inText {
+				w.text(string(t))
+			}
+		}
+	}
+	return tidyText(w.b.String()), nil
+}
+
+// convertODT extracts content.xml of an OpenDocument text file.
+func convertODT(p string) ([]byte, error) {
+	rc, closeZip, err := zipMember(p, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer closeZip()
+	defer rc.Close()
+	dec := xml.NewDecoder(io.LimitReader(rc, maxDocumentXML))
+	var w docWriter
+	depth := 0 // nesting of text:p and text:h, whose character data is text
+	listDepth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "h":
+				n, _ := strconv.Atoi(xmlAttr(t, "outline-level"))
+				w.prefix = headingPrefix(n)
+				depth++
+			case "p":
+				if listDepth > 0 && w.prefix == "" {
+					w.prefix = strings.Repeat("  ", listDepth-1) + "- "
+				}
+				depth++
+			case "list":
+				listDepth++
+			case "s":
+				n, err := strconv.Atoi(xmlAttr(t, "c"))
+				if err != nil {
+					n = 1
+				}
+				w.text(strings.Repeat(" ", n))
+			case "tab":
+				w.text("\t")
+			case "line-break":
+				w.text("\n")
+			case "table-cell":
+				w.startCell()
+			case "note", "annotation":
+				// footnotes and comments would land mid-sentence
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "h", "p":
+				depth--
+				w.endPara()
+			case "list":
+				listDepth--
+			case "table-row":
+				w.endRow()
+			case "table":
+				w.endTable()
+			}
+		case xml.CharData:
+			if depth > 0 {
+				w.text(string(t))
+			}
+		}
+	}
+	return tidyText(w.b.String()), nil
+}
+
+func xmlAttr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
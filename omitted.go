@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// markdownOmittedMark heads the section listing files left out of a
+// markdown pack.
+const markdownOmittedMark = packprompt.MarkdownOmittedMark
+
+// omission is a path left out of the pack and why.
+type omission = packprompt.Omission
+
+// omissions records what the pipeline dropped and why. A nil *omissions
+// records nothing.
+type omissions struct {
+	list     []omission
+	failed   []omission // files that could not be read, also in list
+	failFast bool       // fail returns the error instead
+	mu       sync.Mutex // for fail from parallel readers
+}
+
+// exitPartial is pack's exit status when files could not be read: the pack
+// was written, without them.
+const exitPartial = 3
+
+func (o *omissions) add(rel string, size int64, reason string) {
+	if o != nil {
+		o.list = append(o.list, omission{Path: rel, Size: size, Reason: reason})
+	}
+}
+
+func (o *omissions) addDir(rel, reason string) {
+	o.add(rel+"/", -1, reason)
+}
+
+// fail records that rel could not be read, once, and leaves it out of the
+// pack, or with failFast (or a nil *omissions) returns the error.
+func (o *omissions) fail(rel string, size int64, err error) error {
+	if o == nil || o.failFast {
+		return fmt.Errorf("%s: %w", rel, err)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, f := range o.failed {
+		if f.Path == rel {
+			return nil
+		}
+	}
+	o.failed = append(o.failed, omission{Path: rel, Size: size, Reason: err.Error()})
+	o.add(rel, size, "unreadable: "+err.Error())
+	return nil
+}
+
+// reportFailures names on stderr the files fail recorded, reporting
+// whether there were any.
+func (o *omissions) reportFailures() bool {
+	if len(o.failed) == 0 {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "warning: the pack is partial: %s could not be read (--fail-fast stops at the first):\n", plural(len(o.failed), "path"))
+	for _, f := range o.failed {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Path, f.Reason)
+	}
+	return true
+}
+
+// write emits the omitted section; nothing is written when nothing was dropped.
+func (o *omissions) write(w io.Writer) error {
+	if o == nil {
+		return nil
+	}
+	return packprompt.WriteOmitted(w, o.list)
+}
+
+// writeMarkdown is write for a markdown pack: the section under a heading.
+func (o *omissions) writeMarkdown(w io.Writer) error {
+	if o == nil || len(o.list) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "%s\n\n%s\n\n", markdownOmittedMark, packprompt.OmittedIntro(o.list)); err != nil {
+		return err
+	}
+	return packprompt.WriteOmittedItems(w, o.list)
+}
+
+// writeXML is write for an XML pack: the section in an <omitted> element.
+func (o *omissions) writeXML(w io.Writer) error {
+	if o == nil || len(o.list) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	if err := packprompt.WriteOmittedItems(&b, o.list); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "<%s>\n%s\n%s</%s>\n",
+		packprompt.XMLOmitted, packprompt.OmittedIntro(o.list), packprompt.EscapeXML(b.String()), packprompt.XMLOmitted)
+	return err
+}
+
+// writeSkipReport writes omitted paths with reasons ("path\treason\n") to
+// dest ("-" for stdout), or just NUL-terminated paths when nul is set.
+func writeSkipReport(dest string, o *omissions, nul bool) error {
+	items := make([]string, 0, len(o.list))
+	for _, om := range o.list {
+		if nul {
+			items = append(items, om.Path)
+		} else {
+			items = append(items, om.Path+"\t"+om.Reason)
+		}
+	}
+	if dest == "-" {
+		return writeList(os.Stdout, items, nul)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := writeList(f, items, nul); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// humanSize renders a byte count for people; see packprompt.HumanSize.
+var humanSize = packprompt.HumanSize
+
+// entrySize is the size of a walked file, or 0 when it cannot be read.
+func entrySize(d iofs.DirEntry) int64 {
+	info, err := d.Info()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
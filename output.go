@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"io"
+	"os"
+	"time"
+)
+
+// packWriter writes entries plus the shared trailing sections to one file.
+type packWriter struct {
+	preamble    string // written before the entries, e.g. a tree of the whole selection
+	attachments []entry
+	omitted     *omissions
+	contract    bool      // end with the response contract
+	format      string    // formatJSONL, formatMarkdown, formatXML, formatTar, or the text format
+	gzip        bool      // compress a tar pack
+	mtime       time.Time // of every tar member, for --reproducible; zero keeps each file's
+
+	footer  bool
+	options string
+	env     packEnv
+	key     ed25519.PrivateKey
+}
+
+// write replaces out with a pack of entries. The pack is built in a temp
+// file beside out and renamed into place, under a lock, so readers and
+// concurrent runs never see a half-written pack. Out "-" is stdout.
+func (pw *packWriter) write(out string, entries []entry) (err error) {
+	if out == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := pw.emit(w, entries); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	unlock, err := lockOutput(out)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tmp := out + tmpSuffix
+	outf, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		outf.Close()
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+	w := bufio.NewWriter(outf)
+	if err := pw.emit(w, entries); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := outf.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// emit writes the pack: what render writes, then the footer.
+func (pw *packWriter) emit(w io.Writer, entries []entry) error {
+	body := sha256.New()
+	if err := pw.render(io.MultiWriter(w, body), entries); err != nil {
+		return err
+	}
+	if pw.footer {
+		if _, err := io.WriteString(w, provenanceFooter(body.Sum(nil), pw.options, pw.env, pw.key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeList writes machine-readable items, one per line or, with nul,
+// NUL-terminated so names with spaces or newlines survive xargs -0.
+func writeList(w io.Writer, items []string, nul bool) error {
+	bw := bufio.NewWriter(w)
+	sep := "\n"
+	if nul {
+		sep = "\x00"
+	}
+	for _, it := range items {
+		if _, err := bw.WriteString(it + sep); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// render writes everything the footer digest covers: preamble, entries,
+// attachments, the omitted section and the response contract.
+func (pw *packWriter) render(w io.Writer, entries []entry) error {
+	switch pw.format {
+	case formatJSONL:
+		return pw.renderJSONL(w, entries)
+	case formatMarkdown:
+		return pw.renderMarkdown(w, entries)
+	case formatXML:
+		return pw.renderXML(w, entries)
+	case formatTar:
+		return pw.renderTar(w, entries)
+	}
+	if _, err := io.WriteString(w, pw.preamble); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := writeEntry(w, e); err != nil {
+			return err
+		}
+	}
+	if len(pw.attachments) > 0 {
+		if _, err := io.WriteString(w, attachMark+"\n"); err != nil {
+			return err
+		}
+		for _, e := range pw.attachments {
+			if err := writeEntry(w, e); err != nil {
+				return err
+			}
+		}
+	}
+	if err := pw.omitted.write(w); err != nil {
+		return err
+	}
+	if pw.contract {
+		if _, err := io.WriteString(w, contractText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
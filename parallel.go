@@ -0,0 +1,46 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// forEachParallel calls fn(i) for i in [0, n) on up to GOMAXPROCS workers
+// (fewer under --max-memory). Each call reads and digests one entry, so
+// reading overlaps hashing and token counting instead of alternating with
+// it. fn writes only its own slot of any shared result; the error of the
+// lowest failing index wins, as it would in a plain loop.
+func forEachParallel(n int, fn func(i int) error) error {
+	workers := min(workerCount(runtime.GOMAXPROCS(0)), n)
+	if workers <= 1 {
+		for i := range n {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	errs := make([]error, n)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// benchTree writes a tree of n Go-like source files of about size bytes
+// each, for the benchmarks to pack.
+func benchTree(b *testing.B, n, size int) string {
+	b.Helper()
+	line := "\tif err := fn(i); err != nil { return fmt.Errorf(\"step %d: %w\", i, err) }\n"
+	body := "package bench\n\n" + strings.Repeat(line, size/len(line))
+	files := make(map[string]string, n)
+	for i := range n {
+		files[fmt.Sprintf("pkg%02d/file%03d.go", i%16, i)] = body
+	}
+	return writeTree(b, files)
+}
+
+// benchEntries collects the entries of a benchmark tree.
+func benchEntries(b *testing.B, root string) []entry {
+	b.Helper()
+	entries, err := collectEntries(root, nil, walkOptions{}, &omissions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return entries
+}
+
+// BenchmarkPack packs a tree with and without per-entry hashes and token
+// counts; hashed and counted entries are read on parallel workers, so the
+// extra work should add little to the plain pack.
+func BenchmarkPack(b *testing.B) {
+	root := benchTree(b, 256, 16<<10)
+	est, err := lookupEstimator("claude")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, c := range []struct {
+		name          string
+		hash, measure bool
+	}{
+		{"plain", false, false},
+		{"hashes", true, false},
+		{"tokens", false, true},
+		{"hashes+tokens", true, true},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for b.Loop() {
+				entries := benchEntries(b, root)
+				if c.hash {
+					if entries, err = hashEntries(entries, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if c.measure {
+					if _, err := countEntryTokens(entries, est); err != nil {
+						b.Fatal(err)
+					}
+				}
+				for _, e := range entries {
+					if err := writeEntry(io.Discard, e); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// benchWorkers runs fn as a sub-benchmark on one worker and on all of them.
+func benchWorkers(b *testing.B, fn func(b *testing.B)) {
+	counts := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		counts = append(counts, n)
+	}
+	for _, procs := range counts {
+		b.Run(fmt.Sprintf("workers=%d", procs), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+			fn(b)
+		})
+	}
+}
+
+func BenchmarkHashEntries(b *testing.B) {
+	entries := benchEntries(b, benchTree(b, 256, 16<<10))
+	benchWorkers(b, func(b *testing.B) {
+		for b.Loop() {
+			if _, err := hashEntries(append([]entry(nil), entries...), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkTreeHash(b *testing.B) {
+	entries := benchEntries(b, benchTree(b, 256, 16<<10))
+	benchWorkers(b, func(b *testing.B) {
+		for b.Loop() {
+			if _, err := treeHash(entries); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCountEntryTokens(b *testing.B) {
+	entries := benchEntries(b, benchTree(b, 256, 16<<10))
+	est, err := lookupEstimator("claude")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchWorkers(b, func(b *testing.B) {
+		for b.Loop() {
+			if _, err := countEntryTokens(entries, est); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestForEachParallel checks no index is visited twice, every one before
+// a failure is visited, and the error of the lowest failing index is
+// returned, as from a plain loop.
+func TestForEachParallel(t *testing.T) {
+	seen := make([]int, 100)
+	err := forEachParallel(len(seen), func(i int) error {
+		seen[i]++
+		if i == 40 || i == 70 {
+			return fmt.Errorf("entry %d", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "entry 40" {
+		t.Errorf("err = %v, want entry 40", err)
+	}
+	for i, n := range seen {
+		if n > 1 || i <= 40 && n != 1 {
+			t.Errorf("index %d visited %d times", i, n)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// patchAttr marks a response block whose body is a unified diff against the
+// file as packed (patch=unified) instead of the file's whole new content.
+const (
+	patchAttr    = "patch"
+	patchUnified = "unified"
+	defaultFuzz  = 2
+)
+
+var hunkRe = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// patchHunk is one hunk of a patch block. Its line counts are not trusted,
+// models get them wrong; the lines themselves say what the hunk does.
+type patchHunk struct {
+	header   string // the @@ line, for .rej files
+	oldStart int    // line of the packed file the hunk starts at, 0 before the first
+	lines    []string
+	newNoEOL bool // "\ No newline at end of file" after its last new line
+}
+
+// parsePatch reads the hunks of a patch block. File headers (---, +++,
+// diff, index) before the first hunk are skipped, and an empty line is a
+// blank context line, which is how models often write one.
+func parsePatch(body []byte) ([]patchHunk, error) {
+	var hunks []patchHunk
+	for n, l := range strings.Split(strings.TrimSuffix(string(body), "\n"), "\n") {
+		if m := hunkRe.FindStringSubmatch(l); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, patchHunk{header: l, oldStart: start})
+			continue
+		}
+		if len(hunks) == 0 {
+			if l == "" || strings.HasPrefix(l, "--- ") || strings.HasPrefix(l, "+++ ") ||
+				strings.HasPrefix(l, "diff ") || strings.HasPrefix(l, "index ") {
+				continue
+			}
+			return nil, fmt.Errorf("patch line %d: want a hunk (@@ -L,N +L,N @@), got %q", n+1, l)
+		}
+		h := &hunks[len(hunks)-1]
+		switch {
+		case l == "":
+			h.lines = append(h.lines, " ")
+		case l[0] == ' ' || l[0] == '-' || l[0] == '+':
+			h.lines = append(h.lines, l)
+		case l[0] == '\\':
+			// only the new side's ending changes what is written
+			if k := len(h.lines) - 1; k >= 0 && h.lines[k][0] != '-' {
+				h.newNoEOL = true
+			}
+		default:
+			return nil, fmt.Errorf("patch line %d: not part of a hunk: %q", n+1, l)
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("patch holds no hunks")
+	}
+	for _, h := range hunks {
+		if len(h.lines) == 0 {
+			return nil, fmt.Errorf("hunk %q is empty", h.header)
+		}
+	}
+	return hunks, nil
+}
+
+// sides splits the hunk, less trim context lines at each end, into the
+// lines it expects (from) and the lines it leaves (to), and how many it
+// trimmed from the top. Only context is ever trimmed.
+func (h patchHunk) sides(trim int) (from, to []string, top int, ok bool) {
+	lines := h.lines
+	for ; top < trim && len(lines) > 0 && lines[0][0] == ' '; top++ {
+		lines = lines[1:]
+	}
+	bottom := 0
+	for ; bottom < trim && len(lines) > 0 && lines[len(lines)-1][0] == ' '; bottom++ {
+		lines = lines[:len(lines)-1]
+	}
+	if top < trim && bottom < trim {
+		// no context left to give up: a fuzzier match is the same match
+		return nil, nil, 0, false
+	}
+	for _, l := range lines {
+		if l[0] != '+' {
+			from = append(from, l[1:])
+		}
+		if l[0] != '-' {
+			to = append(to, l[1:])
+		}
+	}
+	return from, to, top, true
+}
+
+// patchResult is what applying a patch block to a file came to.
+type patchResult struct {
+	content  []byte
+	rejected []patchHunk
+	notes    []string // hunks that applied elsewhere than said, or with fuzz
+}
+
+// applyPatch applies hunks to content in order, like patch(1): each hunk
+// is looked for where it says, allowing for the drift of the hunks before
+// it, then ever further away; failing that, with up to fuzz lines of its
+// context at each end ignored. Lines match ignoring trailing whitespace.
+func applyPatch(content []byte, hunks []patchHunk, fuzz int) patchResult {
+	text := string(content)
+	eol := text == "" || strings.HasSuffix(text, "\n")
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	var res patchResult
+	offset := 0 // how far the file has drifted from the line numbers of the hunks
+	for n, h := range hunks {
+		applied := false
+		for f := 0; f <= fuzz && !applied; f++ {
+			from, to, top, ok := h.sides(f)
+			if !ok {
+				break
+			}
+			want := max(h.oldStart-1, 0) + top + offset
+			at := findLines(lines, from, want)
+			if at < 0 {
+				continue
+			}
+			atEnd := at+len(from) == len(lines)
+			lines = append(append(append([]string(nil), lines[:at]...), to...), lines[at+len(from):]...)
+			if atEnd && f == 0 {
+				eol = !h.newNoEOL
+			}
+			if at != want || f > 0 {
+				note := fmt.Sprintf("hunk %d matched at line %d (offset %+d)", n+1, at+1, at-want)
+				if f > 0 {
+					note += fmt.Sprintf(" with fuzz %d", f)
+				}
+				res.notes = append(res.notes, note)
+			}
+			offset += at - want + len(to) - len(from)
+			applied = true
+		}
+		if !applied {
+			res.rejected = append(res.rejected, h)
+		}
+	}
+	if len(lines) > 0 {
+		text = strings.Join(lines, "\n")
+		if eol {
+			text += "\n"
+		}
+	} else {
+		text = ""
+	}
+	res.content = []byte(text)
+	return res
+}
+
+// findLines returns where in lines want occurs nearest to line at, or -1.
+func findLines(lines, want []string, at int) int {
+	last := len(lines) - len(want)
+	if last < 0 {
+		return -1
+	}
+	at = min(max(at, 0), last)
+	for d := 0; at-d >= 0 || at+d <= last; d++ {
+		if at-d >= 0 && sameLines(lines[at-d:at-d+len(want)], want) {
+			return at - d
+		}
+		if d > 0 && at+d <= last && sameLines(lines[at+d:at+d+len(want)], want) {
+			return at + d
+		}
+	}
+	return -1
+}
+
+func sameLines(a, b []string) bool {
+	for i := range b {
+		if a[i] != b[i] && strings.TrimRight(a[i], " \t\r") != strings.TrimRight(b[i], " \t\r") {
+			return false
+		}
+	}
+	return true
+}
+
+// rejectFile renders hunks that did not apply to rel as a .rej file.
+func rejectFile(rel string, hunks []patchHunk) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", rel, rel)
+	for _, h := range hunks {
+		b.WriteString(h.header + "\n")
+		for _, l := range h.lines {
+			b.WriteString(l + "\n")
+		}
+		if h.newNoEOL {
+			b.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParsePatch checks patch blocks are read into hunks, with file headers
+// skipped and a blank line taken as blank context, and malformed ones
+// refused.
+func TestParsePatch(t *testing.T) {
+	hunks, err := parsePatch([]byte("diff --git a/x b/x\nindex 1..2\n--- a/x\n+++ b/x\n@@ -2,3 +2,3 @@\n a\n\n-b\n+B\n\\ No newline at end of file\n@@ -9 +9 @@\n-z\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []patchHunk{
+		{header: "@@ -2,3 +2,3 @@", oldStart: 2, lines: []string{" a", " ", "-b", "+B"}, newNoEOL: true},
+		{header: "@@ -9 +9 @@", oldStart: 9, lines: []string{"-z"}},
+	}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("parsePatch = %+v, want %+v", hunks, want)
+	}
+
+	for body, want := range map[string]string{
+		"hello\n":                 `patch line 1: want a hunk (@@ -L,N +L,N @@), got "hello"`,
+		"--- a/x\n+++ b/x\n":      "patch holds no hunks",
+		"@@ -1 +1 @@\n":           `hunk "@@ -1 +1 @@" is empty`,
+		"@@ -1 +1 @@\n 1\n*bad\n": `patch line 3: not part of a hunk: "*bad"`,
+	} {
+		if _, err := parsePatch([]byte(body)); err == nil || err.Error() != want {
+			t.Errorf("parsePatch(%q) = %v, want %q", body, err, want)
+		}
+	}
+}
+
+// TestApplyPatch checks hunks apply where they say, with drift, with fuzz
+// and ignoring trailing whitespace, and are rejected when they cannot.
+func TestApplyPatch(t *testing.T) {
+	const ten = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	hunk := "@@ -3,5 +3,5 @@\n 3\n 4\n-5\n+five\n 6\n 7\n"
+	for _, c := range []struct {
+		name, content, patch string
+		want                 string
+		notes                []string
+		rejected             int
+	}{
+		{"exact", ten, hunk, strings.Replace(ten, "5\n", "five\n", 1), nil, 0},
+		{"offset", "a\nb\n" + ten, hunk, "a\nb\n" + strings.Replace(ten, "5\n", "five\n", 1),
+			[]string{"hunk 1 matched at line 5 (offset +2)"}, 0},
+		{"fuzz", strings.Replace(ten, "3\n", "three\n", 1), hunk, "1\n2\nthree\n4\nfive\n6\n7\n8\n9\n10\n",
+			[]string{"hunk 1 matched at line 4 (offset +0) with fuzz 1"}, 0},
+		{"trailing whitespace", strings.Replace(ten, "5\n", "5  \n", 1), hunk, strings.Replace(ten, "5\n", "five\n", 1), nil, 0},
+		{"drift from an earlier hunk", ten, "@@ -1,2 +1,3 @@\n 1\n+1.5\n 2\n@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n",
+			"1\n1.5\n2\n3\n4\n5\n6\n7\n8\n9\nten\n", nil, 0},
+		{"no newline at end", ten, "@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n\\ No newline at end of file\n",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\nten", nil, 0},
+		{"into an empty file", "", "@@ -0,0 +1,2 @@\n+a\n+b\n", "a\nb\n", nil, 0},
+		{"rejected", strings.Replace(ten, "5\n", "FIVE\n", 1), hunk, strings.Replace(ten, "5\n", "FIVE\n", 1), nil, 1},
+	} {
+		hunks, err := parsePatch([]byte(c.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		res := applyPatch([]byte(c.content), hunks, defaultFuzz)
+		if string(res.content) != c.want || !reflect.DeepEqual(res.notes, c.notes) || len(res.rejected) != c.rejected {
+			t.Errorf("%s: got %q, notes %q, %d rejected; want %q, notes %q, %d rejected",
+				c.name, res.content, res.notes, len(res.rejected), c.want, c.notes, c.rejected)
+		}
+	}
+}
+
+// TestRejectFile checks the .rej file for hunks that did not apply.
+func TestRejectFile(t *testing.T) {
+	hunks, err := parsePatch([]byte("@@ -2,2 +2,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- a/dir/x.go\n+++ b/dir/x.go\n@@ -2,2 +2,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n"
+	if got := string(rejectFile("dir/x.go", hunks)); got != want {
+		t.Errorf("rejectFile = %q, want %q", got, want)
+	}
+}
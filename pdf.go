@@ -0,0 +1,679 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfNote opens every PDF conversion: only the text layer survives.
+const pdfNote = "> Text extracted from a PDF by packprompt. The conversion is lossy: layout, images, " +
+	"tables and anything drawn rather than typeset are missing or approximate.\n\n"
+
+// maxPDFSize bounds the PDFs that are read into memory for extraction.
+const maxPDFSize = 128 << 20
+
+// pdfDoc is a PDF parsed just far enough to find pages, fonts and content
+// streams; it does not evaluate the cross-reference table, scanning for
+// objects instead, which also copes with slightly damaged files.
+type pdfDoc struct {
+	objs map[int][]byte // object number -> body, dictionary and stream included
+}
+
+var (
+	pdfObjRe     = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRefRe     = regexp.MustCompile(`^\s*(\d+)\s+\d+\s+R`)
+	pdfRefsRe    = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfFontRefRe = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s*(\d+)\s+\d+\s+R`)
+	pdfObjStmRe  = regexp.MustCompile(`/Type\s*/ObjStm`)
+	pdfCatalogRe = regexp.MustCompile(`/Type\s*/Catalog\b`)
+)
+
+func convertPDF(p string) ([]byte, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxPDFSize {
+		return nil, fmt.Errorf("PDF larger than %s", humanSize(maxPDFSize))
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, errors.New("not a PDF")
+	}
+	doc := parsePDF(data)
+	if bytes.Contains(data, []byte("/Encrypt")) && pdfEncrypted(data) {
+		return nil, errors.New("encrypted PDF")
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, errors.New("no pages found")
+	}
+	var b strings.Builder
+	b.WriteString(pdfNote)
+	for i, pg := range pages {
+		if i > 0 {
+			fmt.Fprintf(&b, "\n<!-- page %d -->\n\n", i+1)
+		}
+		b.WriteString(doc.pageText(pg))
+	}
+	out := tidyText(b.String())
+	if strings.TrimSpace(strings.TrimPrefix(string(out), strings.TrimSpace(pdfNote))) == "" {
+		return nil, errors.New("no text layer (scanned PDF?)")
+	}
+	return out, nil
+}
+
+func pdfEncrypted(data []byte) bool {
+	i := bytes.LastIndex(data, []byte("trailer"))
+	if i < 0 {
+		// cross-reference streams carry the trailer keys in their dictionary
+		return regexp.MustCompile(`/Type\s*/XRef[^>]*/Encrypt|/Encrypt[^>]*/Type\s*/XRef`).Match(data)
+	}
+	return bytes.Contains(data[i:], []byte("/Encrypt"))
+}
+
+func parsePDF(data []byte) *pdfDoc {
+	doc := &pdfDoc{objs: map[int][]byte{}}
+	locs := pdfObjRe.FindAllSubmatchIndex(data, -1)
+	for i, m := range locs {
+		n, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		start, limit := m[1], len(data)
+		if i+1 < len(locs) {
+			limit = locs[i+1][0]
+		}
+		// look for endobj after the stream, which may contain the word by chance
+		from := start
+		if s := bytes.Index(data[start:limit], []byte("endstream")); s >= 0 {
+			from = start + s
+		}
+		end := limit
+		if e := bytes.Index(data[from:], []byte("endobj")); e >= 0 {
+			end = from + e
+		}
+		doc.objs[n] = data[start:end]
+	}
+	// objects packed inside object streams (PDF 1.5+)
+	for _, body := range doc.objs {
+		dict := pdfDict(body)
+		if !pdfObjStmRe.MatchString(dict) {
+			continue
+		}
+		stream := pdfStream(doc, body)
+		count, first := pdfInt(dict, "N"), pdfInt(dict, "First")
+		if stream == nil || first <= 0 || first > len(stream) {
+			continue
+		}
+		header := strings.Fields(string(stream[:first]))
+		for k := 0; k+1 < len(header) && k/2 < count; k += 2 {
+			num, err1 := strconv.Atoi(header[k])
+			off, err2 := strconv.Atoi(header[k+1])
+			if err1 != nil || err2 != nil || first+off > len(stream) {
+				continue
+			}
+			end := len(stream)
+			if k+3 < len(header) {
+				if next, err := strconv.Atoi(header[k+3]); err == nil && first+next <= len(stream) && next >= off {
+					end = first + next
+				}
+			}
+			if _, ok := doc.objs[num]; !ok {
+				doc.objs[num] = stream[first+off : end]
+			}
+		}
+	}
+	return doc
+}
+
+// pdfDict returns the dictionary part of an object body (before any stream).
+func pdfDict(body []byte) string {
+	if i := bytes.Index(body, []byte("stream")); i >= 0 {
+		return string(body[:i])
+	}
+	return string(body)
+}
+
+func pdfInt(dict, key string) int {
+	m := regexp.MustCompile(`/` + key + `\s+(\d+)(\s+\d+\s+R)?`).FindStringSubmatch(dict)
+	if m == nil || m[2] != "" {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// pdfValue returns the raw text of key's value in dict: a nested dictionary
+// or array with its brackets, or the token(s) up to the next key.
+func pdfValue(dict, key string) string {
+	re := regexp.MustCompile(`/` + regexp.QuoteMeta(key) + `\b`)
+	for _, loc := range re.FindAllStringIndex(dict, -1) {
+		rest := strings.TrimLeft(dict[loc[1]:], " \t\r\n")
+		switch {
+		case strings.HasPrefix(rest, "<<"):
+			return balanced(rest, "<<", ">>")
+		case strings.HasPrefix(rest, "["):
+			return balanced(rest, "[", "]")
+		case strings.HasPrefix(rest, "/"):
+			if end := strings.IndexAny(rest[1:], " \t\r\n/<>[]()"); end >= 0 {
+				return rest[:end+1]
+			}
+			return rest
+		}
+		if m := pdfRefRe.FindString(rest); m != "" {
+			return m
+		}
+		if end := strings.IndexAny(rest, "/>]"); end >= 0 {
+			return strings.TrimSpace(rest[:end])
+		}
+		return rest
+	}
+	return ""
+}
+
+// balanced returns s up to and including the close matching its opening.
+func balanced(s, open, close string) string {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open) - 1
+		case strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close) - 1
+			if depth == 0 {
+				return s[:i+1]
+			}
+		}
+	}
+	return s
+}
+
+// resolve follows an indirect reference ("12 0 R") to the object's dictionary.
+func (d *pdfDoc) resolve(v string) string {
+	for range 8 {
+		m := pdfRefRe.FindStringSubmatch(v)
+		if m == nil {
+			return v
+		}
+		n, _ := strconv.Atoi(m[1])
+		v = pdfDict(d.objs[n])
+	}
+	return v
+}
+
+// pdfStream decodes the stream of an object body; only FlateDecode (by far
+// the most common text filter) and unfiltered streams are understood.
+func pdfStream(d *pdfDoc, body []byte) []byte {
+	dict := pdfDict(body)
+	i := bytes.Index(body, []byte("stream"))
+	if i < 0 {
+		return nil
+	}
+	raw := body[i+len("stream"):]
+	raw = bytes.TrimPrefix(raw, []byte("\r"))
+	raw = bytes.TrimPrefix(raw, []byte("\n"))
+	length := pdfInt(dict, "Length")
+	if m := regexp.MustCompile(`/Length\s+(\d+)\s+\d+\s+R`).FindStringSubmatch(dict); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		length, _ = strconv.Atoi(strings.TrimSpace(string(d.objs[n])))
+	}
+	if length > 0 && length <= len(raw) {
+		raw = raw[:length]
+	} else if e := bytes.LastIndex(raw, []byte("endstream")); e >= 0 {
+		raw = raw[:e]
+	}
+	filter := pdfValue(dict, "Filter")
+	if filter == "" {
+		return raw
+	}
+	if !strings.Contains(filter, "FlateDecode") || strings.Count(filter, "/") > 1 {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	out, _ := io.ReadAll(io.LimitReader(zr, maxPDFSize)) // keep what decoded before any damage
+	return out
+}
+
+// pdfPage is a page object with the resources it inherits.
+type pdfPage struct {
+	dict      string
+	resources string
+}
+
+// pages walks the page tree from the catalog, in reading order.
+func (d *pdfDoc) pages() []pdfPage {
+	var root string
+	for _, body := range d.objs {
+		dict := pdfDict(body)
+		if pdfCatalogRe.MatchString(dict) {
+			root = d.resolve(pdfValue(dict, "Pages"))
+			break
+		}
+	}
+	var out []pdfPage
+	seen := map[string]bool{}
+	var walk func(node, resources string)
+	walk = func(node, resources string) {
+		if seen[node] || len(out) > 100000 {
+			return
+		}
+		seen[node] = true
+		if r := pdfValue(node, "Resources"); r != "" {
+			resources = d.resolve(r)
+		}
+		if kids := pdfValue(node, "Kids"); kids != "" {
+			for _, m := range pdfRefsRe.FindAllStringSubmatch(kids, -1) {
+				n, _ := strconv.Atoi(m[1])
+				walk(pdfDict(d.objs[n]), resources)
+			}
+			return
+		}
+		out = append(out, pdfPage{dict: node, resources: resources})
+	}
+	if root != "" {
+		walk(root, "")
+	}
+	return out
+}
+
+// pageText extracts the text drawn on one page.
+func (d *pdfDoc) pageText(pg pdfPage) string {
+	fonts := map[string]*pdfCMap{}
+	fontDict := d.resolve(pdfValue(pg.resources, "Font"))
+	for _, m := range pdfFontRefRe.FindAllStringSubmatch(fontDict, -1) {
+		n, _ := strconv.Atoi(m[2])
+		font := pdfDict(d.objs[n])
+		if tu := pdfRefRe.FindStringSubmatch(pdfValue(font, "ToUnicode")); tu != nil {
+			k, _ := strconv.Atoi(tu[1])
+			fonts[m[1]] = parseCMap(pdfStream(d, d.objs[k]))
+		}
+	}
+	var content []byte
+	contents := pdfValue(pg.dict, "Contents")
+	if m := pdfRefRe.FindStringSubmatch(contents); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if body := d.objs[n]; bytes.Contains(body, []byte("stream")) {
+			content = pdfStream(d, body)
+		} else {
+			contents = string(body) // an indirect array of streams
+		}
+	}
+	if content == nil {
+		for _, m := range pdfRefsRe.FindAllStringSubmatch(contents, -1) {
+			n, _ := strconv.Atoi(m[1])
+			content = append(content, pdfStream(d, d.objs[n])...)
+			content = append(content, '\n')
+		}
+	}
+	return pdfContentText(content, fonts)
+}
+
+// pdfCMap maps character codes to text, from a font's ToUnicode CMap.
+type pdfCMap struct {
+	width int // code width in bytes
+	m     map[uint32]string
+}
+
+var (
+	cmapCharRe  = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]*)>`)
+	cmapRangeRe = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*(<[0-9A-Fa-f]*>|\[[^\]]*\])`)
+	cmapHexRe   = regexp.MustCompile(`<([0-9A-Fa-f]*)>`)
+)
+
+func parseCMap(data []byte) *pdfCMap {
+	c := &pdfCMap{width: 1, m: map[uint32]string{}}
+	s := string(data)
+	if m := regexp.MustCompile(`begincodespacerange\s*<([0-9A-Fa-f]+)>`).FindStringSubmatch(s); m != nil {
+		c.width = max(1, len(m[1])/2)
+	}
+	for _, sec := range sections(s, "beginbfchar", "endbfchar") {
+		for _, m := range cmapCharRe.FindAllStringSubmatch(sec, -1) {
+			code, _ := strconv.ParseUint(m[1], 16, 32)
+			c.m[uint32(code)] = utf16Hex(m[2])
+		}
+	}
+	for _, sec := range sections(s, "beginbfrange", "endbfrange") {
+		for _, m := range cmapRangeRe.FindAllStringSubmatch(sec, -1) {
+			lo, _ := strconv.ParseUint(m[1], 16, 32)
+			hi, _ := strconv.ParseUint(m[2], 16, 32)
+			if hi < lo || hi-lo > 0xffff {
+				continue
+			}
+			if strings.HasPrefix(m[3], "[") {
+				for i, h := range cmapHexRe.FindAllStringSubmatch(m[3], -1) {
+					if lo+uint64(i) <= hi {
+						c.m[uint32(lo)+uint32(i)] = utf16Hex(h[1])
+					}
+				}
+				continue
+			}
+			base := []rune(utf16Hex(strings.Trim(m[3], "<>")))
+			if len(base) == 0 {
+				continue
+			}
+			for code := lo; code <= hi; code++ {
+				r := append([]rune(nil), base...)
+				r[len(r)-1] += rune(code - lo)
+				c.m[uint32(code)] = string(r)
+			}
+		}
+	}
+	return c
+}
+
+func sections(s, begin, end string) []string {
+	var out []string
+	for {
+		i := strings.Index(s, begin)
+		if i < 0 {
+			return out
+		}
+		s = s[i+len(begin):]
+		j := strings.Index(s, end)
+		if j < 0 {
+			return append(out, s)
+		}
+		out = append(out, s[:j])
+		s = s[j+len(end):]
+	}
+}
+
+func utf16Hex(h string) string {
+	var units []uint16
+	for i := 0; i+4 <= len(h); i += 4 {
+		v, _ := strconv.ParseUint(h[i:i+4], 16, 16)
+		units = append(units, uint16(v))
+	}
+	if len(h) == 2 {
+		v, _ := strconv.ParseUint(h, 16, 8)
+		units = append(units, uint16(v))
+	}
+	return string(utf16.Decode(units))
+}
+
+func (c *pdfCMap) decode(b []byte) string {
+	if c == nil {
+		// simple fonts without a ToUnicode map: close to Latin-1 for prose
+		r := make([]rune, len(b))
+		for i, x := range b {
+			r[i] = rune(x)
+		}
+		return string(r)
+	}
+	var sb strings.Builder
+	for i := 0; i+c.width <= len(b); i += c.width {
+		var code uint32
+		for _, x := range b[i : i+c.width] {
+			code = code<<8 | uint32(x)
+		}
+		if s, ok := c.m[code]; ok {
+			sb.WriteString(s)
+		} else if c.width == 1 {
+			sb.WriteRune(rune(code))
+		}
+	}
+	return sb.String()
+}
+
+// pdfContentText interprets the text operators of a content stream.
+func pdfContentText(content []byte, fonts map[string]*pdfCMap) string {
+	var b strings.Builder
+	var operands []pdfToken
+	var font *pdfCMap
+	show := func(t pdfToken) {
+		if t.kind == 's' {
+			b.WriteString(font.decode(t.bytes))
+		}
+	}
+	newline := func() {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	lex := pdfLexer{data: content}
+	for {
+		t, ok := lex.next()
+		if !ok {
+			break
+		}
+		if t.kind != 'o' {
+			operands = append(operands, t)
+			continue
+		}
+		switch t.text {
+		case "Tf":
+			if len(operands) >= 2 && operands[len(operands)-2].kind == 'n' {
+				font = fonts[operands[len(operands)-2].text]
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", `"`:
+			newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				for _, e := range operands[len(operands)-1].items {
+					if e.kind == 'd' {
+						// a large negative adjustment is a word gap
+						if v, err := strconv.ParseFloat(e.text, 64); err == nil && v < -180 {
+							b.WriteByte(' ')
+						}
+						continue
+					}
+					show(e)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, err := strconv.ParseFloat(operands[len(operands)-1].text, 64); err == nil && ty != 0 {
+					newline()
+				} else if tx, err := strconv.ParseFloat(operands[len(operands)-2].text, 64); err == nil && tx > 0 {
+					b.WriteByte(' ')
+				}
+			}
+		case "T*", "ET":
+			newline()
+		case "Tm":
+			newline()
+		case "BI":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	return b.String()
+}
+
+// pdfToken is one content-stream token: 'd' number, 'n' name, 's' string,
+// 'a' array, 'o' operator.
+type pdfToken struct {
+	kind  byte
+	text  string
+	bytes []byte
+	items []pdfToken
+}
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return pdfToken{kind: 's', bytes: l.literal()}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			l.pos += 2
+			return pdfToken{kind: 'o', text: "<<"}, true
+		case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return pdfToken{kind: 'o', text: ">>"}, true
+		case c == '<':
+			return pdfToken{kind: 's', bytes: l.hex()}, true
+		case c == '[':
+			l.pos++
+			arr := pdfToken{kind: 'a'}
+			for {
+				t, ok := l.next()
+				if !ok || t.kind == 'o' && t.text == "]" {
+					return arr, true
+				}
+				arr.items = append(arr.items, t)
+			}
+		case c == ']':
+			l.pos++
+			return pdfToken{kind: 'o', text: "]"}, true
+		case c == '/':
+			start := l.pos + 1
+			l.pos++
+			for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+				l.pos++
+			}
+			return pdfToken{kind: 'n', text: string(l.data[start:l.pos])}, true
+		default:
+			start := l.pos
+			for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+				l.pos++
+			}
+			if l.pos == start {
+				l.pos++ // a stray delimiter such as '{'
+				continue
+			}
+			w := string(l.data[start:l.pos])
+			if _, err := strconv.ParseFloat(w, 64); err == nil {
+				return pdfToken{kind: 'd', text: w}, true
+			}
+			return pdfToken{kind: 'o', text: w}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+// literal reads a (string) with escapes and balanced parentheses.
+func (l *pdfLexer) literal() []byte {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			if depth--; depth == 0 {
+				return out
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (l *pdfLexer) hex() []byte {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(v)
+	}
+	return out
+}
+
+// skipInlineImage jumps over the binary data of BI ... ID ... EI.
+func (l *pdfLexer) skipInlineImage() {
+	if i := bytes.Index(l.data[l.pos:], []byte("ID")); i >= 0 {
+		l.pos += i + 2
+	}
+	for l.pos < len(l.data) {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += i + 2
+		if i > 0 && isPDFSpace(l.data[l.pos-3]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPDFContentText checks the text operators of a content stream.
+func TestPDFContentText(t *testing.T) {
+	for _, c := range []struct {
+		name, content, want string
+	}{
+		{"Tj", "BT /F1 12 Tf (Hello) Tj ET", "Hello\n"},
+		{"escapes", `BT (a\(b\)c\\d) Tj (\101\102\n) Tj ET`, "a(b)c\\dAB\n"},
+		{"nested parens", "BT (f(x)) Tj ET", "f(x)\n"},
+		{"line continuation", "BT (one\\\ntwo) Tj ET", "onetwo\n"},
+		{"hex", "BT <48656C6C6F> Tj <616> Tj ET", "Hello" + "a`" + "\n"},
+		{"TJ word gap", "BT [(Hel) -20 (lo) -250 (world)] TJ ET", "Hello world\n"},
+		{"Td new line", "BT (one) Tj 0 -14 Td (two) Tj ET", "one\ntwo\n"},
+		{"Td same line", "BT (one) Tj 20 0 Td (two) Tj ET", "one two\n"},
+		{"T* and quote", "BT (a) Tj T* (b) Tj (c) ' ET", "a\nb\nc\n"},
+		{"comment", "BT % (hidden) Tj\n(shown) Tj ET", "shown\n"},
+		{"inline image", "BT (a) Tj ET BI /W 1 /H 1 ID \x00(x) Tj\x01 EI BT (b) Tj ET", "a\nb\n"},
+		{"unbalanced", "BT (cut off", ""},
+	} {
+		if got := pdfContentText([]byte(c.content), nil); got != c.want {
+			t.Errorf("%s: pdfContentText(%q) = %q, want %q", c.name, c.content, got, c.want)
+		}
+	}
+}
+
+// TestPDFCMap checks ToUnicode maps: bfchar, both forms of bfrange and the
+// code width from the codespace range.
+func TestPDFCMap(t *testing.T) {
+	cmap := parseCMap([]byte(`
+begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar
+<0001> <0048>
+<0002> <D83DDE00>
+endbfchar
+2 beginbfrange
+<0010> <0012> <0061>
+<0020> <0021> [<0058> <00590059>]
+endbfrange`))
+	if cmap.width != 2 {
+		t.Errorf("width = %d, want 2", cmap.width)
+	}
+	for _, c := range []struct {
+		codes []byte
+		want  string
+	}{
+		{[]byte{0, 1}, "H"},
+		{[]byte{0, 2}, "😀"},
+		{[]byte{0, 0x10, 0, 0x11, 0, 0x12}, "abc"},
+		{[]byte{0, 0x20, 0, 0x21}, "XYY"},
+		{[]byte{0, 0x99}, ""},  // unmapped two-byte codes are dropped
+		{[]byte{0, 1, 0}, "H"}, // a trailing half code is ignored
+	} {
+		if got := cmap.decode(c.codes); got != c.want {
+			t.Errorf("decode(% x) = %q, want %q", c.codes, got, c.want)
+		}
+	}
+	if got := (*pdfCMap)(nil).decode([]byte("caf\xe9")); got != "café" {
+		t.Errorf("decode without a map = %q, want Latin-1", got)
+	}
+}
+
+// TestPDFValue checks dictionary values are cut at the right place.
+func TestPDFValue(t *testing.T) {
+	dict := "<< /Type /Page /Resources << /Font << /F1 5 0 R >> >> /Kids [3 0 R 4 0 R] /Contents 6 0 R /Count 2 /TypeX /No >>"
+	for key, want := range map[string]string{
+		"Type":      "/Page",
+		"Resources": "<< /Font << /F1 5 0 R >> >>",
+		"Kids":      "[3 0 R 4 0 R]",
+		"Contents":  "6 0 R",
+		"Count":     "2",
+		"Missing":   "",
+	} {
+		if got := pdfValue(dict, key); got != want {
+			t.Errorf("pdfValue(%s) = %q, want %q", key, got, want)
+		}
+	}
+	if got := pdfInt(dict, "Count"); got != 2 {
+		t.Errorf("pdfInt(Count) = %d, want 2", got)
+	}
+	if got := pdfInt(dict, "Contents"); got != 0 {
+		t.Errorf("pdfInt of a reference = %d, want 0", got)
+	}
+}
+
+// TestConvertPDF builds small PDFs and checks the text convertPDF finds,
+// following the page tree, inherited resources, compressed streams and
+// object streams, and the errors for what it cannot read.
+func TestConvertPDF(t *testing.T) {
+	flate := func(s string) string {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write([]byte(s))
+		zw.Close()
+		return b.String()
+	}
+	stream := func(dict, data string) string {
+		return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+	pdf := func(objs ...string) []byte {
+		var b strings.Builder
+		b.WriteString("%PDF-1.7\n")
+		for i, o := range objs {
+			fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+		}
+		b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+		return []byte(b.String())
+	}
+	catalog := "<< /Type /Catalog /Pages 2 0 R >>"
+	cmap := "begincodespacerange <00> <FF> endcodespacerange 1 beginbfchar <41> <03A9> endbfchar"
+	packed := "<< /Type /Page /Contents 5 0 R >> "
+	header := fmt.Sprintf("7 0 8 %d ", len(packed))
+	objStm := header + packed + "<< /Type /Page /Contents 6 0 R >>"
+
+	for _, c := range []struct {
+		name string
+		data []byte
+		want string // "error: ..." for a failure
+	}{
+		{"two pages", pdf(
+			catalog,
+			"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+			"<< /Type /Page /Contents 5 0 R >>",
+			"<< /Type /Page /Contents [6 0 R] >>",
+			stream("", "BT (first) Tj ET"),
+			stream("/Filter /FlateDecode", flate("BT (second) Tj ET")),
+		), "first\n\n<!-- page 2 -->\n\nsecond\n"},
+		{"inherited ToUnicode", pdf(
+			catalog,
+			"<< /Type /Pages /Kids [3 0 R] /Resources << /Font << /F1 5 0 R >> >> >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			stream("", "BT /F1 12 Tf (AAA) Tj ET"),
+			"<< /Type /Font /ToUnicode 6 0 R >>",
+			stream("/Filter /FlateDecode", flate(cmap)),
+		), "ΩΩΩ\n"},
+		{"object stream", pdf(
+			catalog,
+			"<< /Type /Pages /Kids [7 0 R 8 0 R] >>",
+			stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d", len(header)), objStm),
+			"<< >>",
+			stream("", "BT (packed) Tj ET"),
+			stream("", "BT (away) Tj ET"),
+		), "packed\n\n<!-- page 2 -->\n\naway\n"},
+		{"no text layer", pdf(
+			catalog,
+			"<< /Type /Pages /Kids [3 0 R] >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			stream("", "0 0 m 10 10 l S"),
+		), "error: no text layer (scanned PDF?)"},
+		{"no pages", pdf(catalog, "<< /Type /Pages /Kids [] >>"), "error: no pages found"},
+		{"encrypted", append(pdf(catalog), "trailer\n<< /Encrypt 9 0 R >>\n"...), "error: encrypted PDF"},
+		{"not a PDF", []byte("hello"), "error: not a PDF"},
+	} {
+		p := filepath.Join(t.TempDir(), "doc.pdf")
+		if err := os.WriteFile(p, c.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		out, err := convertPDF(p)
+		got := strings.TrimPrefix(string(out), pdfNote)
+		if err != nil {
+			got = "error: " + err.Error()
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
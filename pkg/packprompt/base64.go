@@ -0,0 +1,37 @@
+package packprompt
+
+import (
+	"bytes"
+	"encoding/base64"
+)
+
+// BinaryExts are the binary types left out by DefaultExcludes that packing
+// binaries base64-encoded takes in: images, the usual small fixtures.
+var BinaryExts = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".ico", ".bin"}
+
+// base64Width is the line length of encoded content, as in MIME.
+const base64Width = 76
+
+// EncodeBase64 encodes raw as entry content: base64 in lines of 76.
+func EncodeBase64(raw []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(raw)
+	var b bytes.Buffer
+	b.Grow(len(enc) + len(enc)/base64Width + 1)
+	for len(enc) > base64Width {
+		b.WriteString(enc[:base64Width] + "\n")
+		enc = enc[base64Width:]
+	}
+	b.WriteString(enc)
+	return b.Bytes()
+}
+
+// DecodeBase64 reverses EncodeBase64, ignoring how the lines are broken.
+func DecodeBase64(content []byte) ([]byte, error) {
+	text := bytes.Join(bytes.Fields(content), nil)
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(raw, text)
+	if err != nil {
+		return nil, err
+	}
+	return raw[:n], nil
+}
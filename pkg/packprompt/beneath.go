@@ -0,0 +1,116 @@
+package packprompt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEscapes is returned for a write that would land outside its
+// destination, through "..", an absolute path or a symlink.
+var ErrEscapes = errors.New("path escapes the destination")
+
+// WriteBeneath replaces the file rel (slash-separated) under dest with
+// data, creating parent directories, so that nothing outside dest is ever
+// written: not through ".." or absolute paths, nor through symlinks inside
+// dest that point out of it. On Linux the kernel enforces this with
+// openat2 and RESOLVE_BENEATH; elsewhere, and on kernels without openat2,
+// every directory on the way is checked before it is used. The file goes
+// through a temp file renamed into place, which replaces a symlink at rel
+// rather than writing through it.
+func WriteBeneath(dest, rel string, data []byte, mode iofs.FileMode) error {
+	if !SafePath(rel) {
+		return fmt.Errorf("%s: %w", rel, ErrEscapes)
+	}
+	if ok, err := writeBeneath(dest, rel, data, mode); ok {
+		return err
+	}
+	return writeChecked(dest, rel, data, mode)
+}
+
+// JoinChunk returns the file a chunk completes: the first Offset bytes of
+// rel under dest, read without leaving dest, followed by content. The
+// first chunk is content alone, and unpacking a chunk again gives the same
+// file, since what follows Offset is replaced.
+func JoinChunk(dest, rel string, c Chunk, content []byte) ([]byte, error) {
+	if c.Index <= 1 {
+		return content, nil
+	}
+	f, err := os.OpenInRoot(dest, filepath.FromSlash(rel))
+	if err != nil {
+		return nil, fmt.Errorf("%s: chunk %d of %d needs the earlier chunks unpacked first: %w", rel, c.Index, c.Count, err)
+	}
+	defer f.Close()
+	prev := make([]byte, c.Offset, c.Offset+int64(len(content)))
+	if _, err := io.ReadFull(f, prev); err != nil {
+		return nil, fmt.Errorf("%s: chunk %d of %d needs the earlier chunks unpacked first (the file is shorter than %d bytes)", rel, c.Index, c.Count, c.Offset)
+	}
+	return append(prev, content...), nil
+}
+
+// writeChecked is WriteBeneath by inspection: each parent is created, or
+// resolved and required to stay under dest when it is a symlink. A tree
+// changed between the check and the write can still get past it.
+func writeChecked(dest, rel string, data []byte, mode iofs.FileMode) error {
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	if realDest, err = filepath.Abs(realDest); err != nil {
+		return err
+	}
+	parts := strings.Split(rel, "/")
+	dir := dest
+	for i, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		switch {
+		case errors.Is(err, iofs.ErrNotExist):
+			if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, iofs.ErrExist) {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		case info.Mode()&iofs.ModeSymlink == 0:
+			continue
+		}
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if real, err = filepath.Abs(real); err != nil {
+			return err
+		}
+		if inside, err := filepath.Rel(realDest, real); err != nil || (inside != "." && !filepath.IsLocal(inside)) {
+			return fmt.Errorf("%s: %w (%s links to %s)", rel, ErrEscapes, strings.Join(parts[:i+1], "/"), real)
+		}
+	}
+	full := filepath.Join(dir, parts[len(parts)-1])
+	f, tmp, err := CreateTemp(full)
+	if err != nil {
+		return err
+	}
+	if err := writeAndClose(f, data, mode); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, full); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func writeAndClose(f *os.File, data []byte, mode iofs.FileMode) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	_ = f.Chmod(mode)
+	return f.Close()
+}
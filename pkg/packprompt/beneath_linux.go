@@ -0,0 +1,114 @@
+package packprompt
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// openat2(2), which the syscall package does not wrap. New system calls
+// share one number on every Linux architecture.
+const (
+	sysOpenat2     = 437
+	resolveBeneath = 0x08
+)
+
+type openHow struct {
+	flags, mode, resolve uint64
+}
+
+// openBeneath opens name relative to dirfd, failing with EXDEV when its
+// resolution, symlinks included, would leave dirfd.
+func openBeneath(dirfd int, name string, flags int, mode uint32) (int, error) {
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return -1, err
+	}
+	how := openHow{flags: uint64(flags | syscall.O_CLOEXEC), mode: uint64(mode), resolve: resolveBeneath}
+	fd, _, errno := syscall.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// writeBeneath is WriteBeneath with the kernel resolving every path under
+// a descriptor for dest. ok is false when openat2 is unavailable (before
+// Linux 5.6, or filtered by a sandbox) and nothing was written.
+func writeBeneath(dest, rel string, data []byte, mode iofs.FileMode) (ok bool, err error) {
+	root, err := syscall.Open(dest, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return true, &os.PathError{Op: "open", Path: dest, Err: err}
+	}
+	defer syscall.Close(root)
+	probe, err := openBeneath(root, ".", syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.EPERM) {
+		return false, nil
+	}
+	if err != nil {
+		return true, &os.PathError{Op: "openat2", Path: dest, Err: err}
+	}
+	syscall.Close(probe)
+
+	escaped := func(sub string, err error) error {
+		if errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("%s: %w (through %s)", rel, ErrEscapes, sub)
+		}
+		return &os.PathError{Op: "openat2", Path: filepath.Join(dest, filepath.FromSlash(sub)), Err: err}
+	}
+	parts := strings.Split(rel, "/")
+	dir := root
+	defer func() {
+		if dir != root {
+			syscall.Close(dir)
+		}
+	}()
+	for i, part := range parts[:len(parts)-1] {
+		// resolve from dest each time, so a symlink anywhere on the way is
+		// followed only while it stays beneath dest
+		sub := strings.Join(parts[:i+1], "/")
+		fd, err := openBeneath(root, sub, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+		if errors.Is(err, syscall.ENOENT) {
+			if err := syscall.Mkdirat(dir, part, 0o755); err != nil && !errors.Is(err, syscall.EEXIST) {
+				return true, &os.PathError{Op: "mkdir", Path: filepath.Join(dest, filepath.FromSlash(sub)), Err: err}
+			}
+			fd, err = openBeneath(root, sub, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+		}
+		if err != nil {
+			return true, escaped(sub, err)
+		}
+		if dir != root {
+			syscall.Close(dir)
+		}
+		dir = fd
+	}
+
+	name := parts[len(parts)-1]
+	var tmp string
+	var fd int
+	for range tempTries {
+		tmp = tempName(name)
+		fd, err = openBeneath(dir, tmp, syscall.O_WRONLY|syscall.O_CREAT|syscall.O_EXCL|syscall.O_NOFOLLOW, 0o600)
+		if !errors.Is(err, syscall.EEXIST) {
+			break
+		}
+	}
+	if err != nil {
+		return true, escaped(path.Join(path.Dir(rel), tmp), err)
+	}
+	if err := writeAndClose(os.NewFile(uintptr(fd), filepath.Join(dest, filepath.FromSlash(path.Dir(rel)), tmp)), data, mode); err != nil {
+		_ = syscall.Unlinkat(dir, tmp)
+		return true, err
+	}
+	if err := syscall.Renameat(dir, tmp, dir, name); err != nil {
+		_ = syscall.Unlinkat(dir, tmp)
+		return true, &os.PathError{Op: "rename", Path: filepath.Join(dest, filepath.FromSlash(rel)), Err: err}
+	}
+	return true, nil
+}
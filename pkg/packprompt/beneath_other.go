@@ -0,0 +1,11 @@
+//go:build !linux
+
+package packprompt
+
+import iofs "io/fs"
+
+// writeBeneath has no kernel support to use here; WriteBeneath falls back
+// to checking each directory.
+func writeBeneath(dest, rel string, data []byte, mode iofs.FileMode) (ok bool, err error) {
+	return false, nil
+}
@@ -0,0 +1,303 @@
+// Package packprompt reads and writes packprompt packs: a directory tree as
+// one text file of entries a language model can read, and back.
+//
+// The packprompt command is built on this package: its walk uses the same
+// exclude, binary, earlier-pack and protected-path rules, key-file order
+// and omission reasons, and its unpack the same readers, chunk joining,
+// modes and confined writes. With default options and no config, Pack
+// writes what packprompt pack writes for a tree, and Unpack restores what
+// packprompt unpack restores. Following links, portable-path rewriting,
+// conversions, budgets, encryption and hooks are the command's alone.
+package packprompt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	iofs "io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Lines that delimit a pack's entries and sections.
+const (
+	StartMark    = "--- FILE"
+	EndMark      = "--- END FILE ---"
+	NoteMark     = "--- NOTE "
+	MetaMark     = "--- META "
+	TreeMark     = "--- TREE ---"
+	AttachMark   = "--- ATTACHMENTS ---"
+	OmittedMark  = "--- OMITTED ---"
+	ContractMark = "--- RESPONSE CONTRACT packprompt/v2 ---"
+	ContractEnd  = "--- END RESPONSE CONTRACT ---"
+	FooterMark   = "--- PACKPROMPT PROVENANCE ---" // the pack ends here
+)
+
+// Header attributes the format itself gives meaning to.
+const (
+	IDAttr        = "id"       // short hash of the path, see EntryID
+	NotesAttr     = "notes"    // count of NOTE lines after the header
+	MetaAttr      = "meta"     // count of META lines before the end mark
+	EncodingAttr  = "encoding" // how the content encodes the file
+	EncryptedAttr = "encrypted"
+	Base64        = "base64" // the one EncodingAttr value
+	ChunkAttr     = "chunk"  // K/N: the Kth of N pieces of a file cut across packs
+	OffsetAttr    = "offset" // where in the file a chunk after the first starts
+	SHA256Attr    = "sha256" // of the file the entry unpacks to
+)
+
+// IDLen is the length of an entry ID in hex digits.
+const IDLen = 8
+
+// DefaultExcludes are the patterns a pack leaves out unless told otherwise.
+var DefaultExcludes = []string{
+	".git", ".svn", ".hg", ".idea", ".vscode", "node_modules", ".venv", ".DS_Store",
+	"*.png", "*.jpg", "*.jpeg", "*.gif", "*.webp", "*.ico",
+	"*.pdf", "*.zip", "*.tar", "*.gz", "*.xz", "*.7z", "*.rar", "*.jar", "*.war",
+	"*.class", "*.so", "*.dll", "*.dylib", "*.bin", "*.exe",
+}
+
+// ProtectedPaths are what Unpack refuses to write unless allowed:
+// version-control internals (hooks there run on the next commit), keys and
+// credentials, and environment files. Each pattern is matched against every
+// path component, so a protected directory covers all below it, wherever
+// it is nested.
+var ProtectedPaths = []string{".git", ".hg", ".svn", ".ssh", ".gnupg", ".env", ".env.local", ".envrc", ".netrc"}
+
+// Protected reports whether rel is in ProtectedPaths, and by which pattern.
+// Components are compared the way case-insensitive filesystems and Windows
+// resolve them: ignoring case, and trailing dots and spaces.
+func Protected(rel string) (string, bool) {
+	for _, part := range strings.Split(rel, "/") {
+		part = strings.ToLower(strings.TrimRight(part, ". "))
+		for _, pat := range ProtectedPaths {
+			if ok, _ := path.Match(strings.ToLower(pat), part); ok {
+				return pat, true
+			}
+		}
+	}
+	return "", false
+}
+
+// EntryID is the ID every header carries, the same for a path in every pack.
+func EntryID(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return hex.EncodeToString(sum[:])[:IDLen]
+}
+
+// UncarriedPath is why a pack leaves out a path CarriesPath rejects.
+const UncarriedPath = "path has whitespace or a control character, which an entry header cannot carry"
+
+// CarriesPath reports whether an entry header can carry rel, which must
+// have no whitespace or control characters.
+func CarriesPath(rel string) bool {
+	return strings.IndexFunc(rel, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) < 0
+}
+
+var headerRe = regexp.MustCompile(`^--- FILE path=([^[:space:]]+) mode=([0-7]{3,4})((?: [a-z0-9-]+=[^[:space:]]*)*) ---$`)
+
+// FormatHeader renders an entry header; attrs ("key=value") follow the mode.
+func FormatHeader(rel string, mode iofs.FileMode, attrs []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s path=%s mode=%04o", StartMark, rel, mode)
+	for _, a := range attrs {
+		b.WriteString(" " + a)
+	}
+	b.WriteString(" ---")
+	return b.String()
+}
+
+// ParseHeader splits an entry header into path, mode and attributes.
+func ParseHeader(line string) (rel, mode string, attrs map[string]string, ok bool) {
+	m := headerRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", nil, false
+	}
+	attrs = map[string]string{}
+	for _, a := range strings.Fields(m[3]) {
+		k, v, _ := strings.Cut(a, "=")
+		attrs[k] = v
+	}
+	return m[1], m[2], attrs, true
+}
+
+// SafePath reports whether a pack path names a file inside the directory
+// it is unpacked into: clean, relative, without ".." and, on Windows,
+// without volume names, backslashes or reserved names.
+func SafePath(rel string) bool {
+	return iofs.ValidPath(rel) && rel != "." && filepath.IsLocal(filepath.FromSlash(rel))
+}
+
+// MatchExclude reports whether rel matches one of the exclude patterns, and
+// which. Patterns without '/' match the base name, others the whole path.
+func MatchExclude(rel string, patterns []string) (string, bool) {
+	base := path.Base(rel)
+	for _, pat := range patterns {
+		pat = strings.TrimSpace(pat)
+		if pat == "" {
+			continue
+		}
+		if strings.Contains(pat, "/") {
+			if ok, _ := path.Match(pat, rel); ok {
+				return pat, true
+			}
+		} else {
+			if ok, _ := path.Match(pat, base); ok {
+				return pat, true
+			}
+			if !strings.ContainsAny(pat, "*?[]") && base == pat {
+				return pat, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SniffLen is how much of a file IsBinary looks at.
+const SniffLen = 8192
+
+// IsBinary classifies a content sniff (up to the first SniffLen bytes of a
+// file).
+func IsBinary(buf []byte) bool {
+	if len(buf) > SniffLen {
+		buf = buf[:SniffLen]
+	}
+	if len(buf) == 0 {
+		return false
+	}
+
+	// Heuristic 1: NUL byte
+	if bytes.IndexByte(buf, 0x00) >= 0 {
+		return true
+	}
+
+	// Heuristic 2: MIME
+	ct := http.DetectContentType(buf)
+	if strings.Contains(ct, "application/octet-stream") ||
+		strings.Contains(ct, "application/x-executable") ||
+		strings.HasPrefix(ct, "image/") ||
+		strings.HasPrefix(ct, "audio/") ||
+		strings.HasPrefix(ct, "video/") ||
+		strings.HasPrefix(ct, "font/") {
+		return true
+	}
+
+	// Heuristic 3: printable ratio
+	var nonPrintable, printable int
+	for _, r := range string(buf) {
+		if r == '\n' || r == '\r' || r == '\t' {
+			printable++
+			continue
+		}
+		if r == '\uFFFD' {
+			nonPrintable++
+			continue
+		}
+		if r < 32 || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			nonPrintable++
+		} else {
+			printable++
+		}
+	}
+	if printable == 0 {
+		return true
+	}
+	if float64(nonPrintable)/float64(printable+nonPrintable) > 0.30 {
+		return true
+	}
+	return false
+}
+
+// IsPackOutput reports whether a content sniff is the start of a pack in
+// any format pack writes, which a walk leaves out rather than nest. A text
+// pack opens with an entry header or the tree, JSON Lines with an object
+// whose first key is path, XML with the <documents> root, markdown with an
+// entry heading and its attributes comment, and a tar pack, gzipped or
+// not, with a member carrying packprompt records.
+func IsPackOutput(head []byte) bool {
+	if IsTar(head) {
+		return isTarPack(head)
+	}
+	first, rest, _ := strings.Cut(strings.TrimPrefix(string(head), "\ufeff"), "\n")
+	first = strings.TrimRight(first, "\r")
+	switch {
+	case strings.HasPrefix(first, StartMark+" path="), first == TreeMark:
+		return true
+	case strings.HasPrefix(first, `{"path":`):
+		return true
+	case first == "<"+XMLRoot+">":
+		return true
+	case strings.HasPrefix(first, MarkdownHeading):
+		return strings.HasPrefix(rest, markdownAttrsOpen)
+	}
+	return false
+}
+
+// HasEndMark reports whether content has a line that reads as EndMark,
+// which would end its entry early in a text pack.
+func HasEndMark(content []byte) bool {
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if string(bytes.TrimRight(line, "\r")) == EndMark {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseMode reads a header's octal mode.
+func ParseMode(s string) (iofs.FileMode, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty")
+	}
+	var v uint32
+	for _, ch := range s {
+		if ch < '0' || ch > '7' {
+			return 0, fmt.Errorf("invalid octal %q", s)
+		}
+		v = (v << 3) | uint32(ch-'0')
+	}
+	return iofs.FileMode(v), nil
+}
+
+// Chunk is where an entry cut across packs sits in its file.
+type Chunk struct {
+	Index, Count int   // the entry is piece Index (from 1) of Count
+	Offset       int64 // bytes of the file in the pieces before it
+}
+
+// ParseChunk reads an entry's chunk attributes; ok is false for an entry
+// holding a whole file.
+func ParseChunk(attrs map[string]string) (c Chunk, ok bool, err error) {
+	v, ok := attrs[ChunkAttr]
+	if !ok {
+		return Chunk{}, false, nil
+	}
+	k, n, _ := strings.Cut(v, "/")
+	c.Index, err = strconv.Atoi(k)
+	if err == nil {
+		c.Count, err = strconv.Atoi(n)
+	}
+	if err == nil && c.Index > 1 {
+		c.Offset, err = strconv.ParseInt(attrs[OffsetAttr], 10, 64)
+	}
+	if err != nil || c.Index < 1 || c.Index > c.Count || c.Offset < 0 {
+		return Chunk{}, true, fmt.Errorf("invalid %s=%s %s=%s", ChunkAttr, v, OffsetAttr, attrs[OffsetAttr])
+	}
+	return c, true, nil
+}
+
+// Attrs renders the chunk as header attributes.
+func (c Chunk) Attrs() []string {
+	attrs := []string{fmt.Sprintf("%s=%d/%d", ChunkAttr, c.Index, c.Count)}
+	if c.Index > 1 {
+		attrs = append(attrs, fmt.Sprintf("%s=%d", OffsetAttr, c.Offset))
+	}
+	return attrs
+}
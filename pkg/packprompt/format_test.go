@@ -0,0 +1,88 @@
+package packprompt
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestProtected(t *testing.T) {
+	for rel, want := range map[string]bool{
+		".git/config":             true,
+		"sub/.git/hooks/pre-push": true,
+		"sub/.GIT/hooks/pre-push": true,
+		".Git/config":             true,
+		".git./config":            true,
+		".git /config":            true,
+		".git. ./config":          true,
+		".ENV":                    true,
+		"home/.SSH/id_ed25519":    true,
+		".gitignore":              false,
+		"src/git/main.go":         false,
+		"docs/.github/CODEOWNERS": false,
+		"environment.env":         false,
+	} {
+		if _, got := Protected(rel); got != want {
+			t.Errorf("Protected(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestIsPackOutput(t *testing.T) {
+	f := File{Path: "a.txt", Mode: "0644", Attrs: map[string]string{IDAttr: EntryID("a.txt")}, Content: []byte("alpha\n")}
+	var jsonl, md, xmlPack, tarPack, tgzPack, plainTar bytes.Buffer
+	if err := WriteJSONL(&jsonl, f); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMarkdown(&md, f, ""); err != nil {
+		t.Fatal(err)
+	}
+	xmlPack.WriteString("<" + XMLRoot + ">\n")
+	if err := WriteXML(&xmlPack, f, 1); err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(&tgzPack)
+	for _, w := range []io.Writer{&tarPack, gz} {
+		tw := tar.NewWriter(w)
+		if err := WriteTar(tw, f, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(&plainTar)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Mode: 0o644, Size: 6}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("alpha\n"))
+	tw.Close()
+
+	for name, c := range map[string]struct {
+		head string
+		want bool
+	}{
+		"text":          {StartMark + " path=a.txt mode=0644 ---\nalpha\n" + EndMark + "\n", true},
+		"text tree":     {TreeMark + "\na.txt\n", true},
+		"jsonl":         {jsonl.String(), true},
+		"markdown":      {md.String(), true},
+		"xml":           {xmlPack.String(), true},
+		"tar":           {tarPack.String(), true},
+		"tgz":           {tgzPack.String(), true},
+		"other tar":     {plainTar.String(), false},
+		"readme":        {"# Title\n\n" + MarkdownHeading + "Usage\n```\ngo run .\n```\n", false},
+		"heading, code": {MarkdownHeading + "Usage\n```\ngo run .\n```\n", false},
+		"json":          {`{"name": "a", "path": "b"}` + "\n", false},
+		"xml document":  {"<?xml version=\"1.0\"?>\n<documents/>\n", false},
+	} {
+		if got := IsPackOutput([]byte(c.head)); got != c.want {
+			t.Errorf("%s: IsPackOutput = %v, want %v", name, got, c.want)
+		}
+	}
+}
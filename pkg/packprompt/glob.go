@@ -0,0 +1,78 @@
+package packprompt
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var globCache sync.Map // pattern -> *regexp.Regexp
+
+// Match matches a slash-separated path against pattern. Patterns without
+// a '/' match the base name, like excludes; otherwise they match the whole
+// path, and "**" spans any number of directories ("cmd/**", "**/testdata/*").
+func Match(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	if !strings.Contains(pattern, "**") {
+		ok, _ := path.Match(pattern, rel)
+		return ok
+	}
+	re, ok := globCache.Load(pattern)
+	if !ok {
+		re, _ = globCache.LoadOrStore(pattern, globRegexp(pattern))
+	}
+	return re.(*regexp.Regexp).MatchString(rel)
+}
+
+func globRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if j := strings.IndexByte(pattern[i:], ']'); j > 0 {
+				class := pattern[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += j
+			} else {
+				b.WriteString(`\[`)
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return regexp.MustCompile(`^$.`) // never matches
+	}
+	return re
+}
+
+// MatchAny reports whether rel matches any of patterns.
+func MatchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if Match(p, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package packprompt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// jsonLine is one entry of a JSON Lines pack: an object per line, with the
+// header attributes the format gives meaning to as fields of their own.
+type jsonLine struct {
+	Path       string            `json:"path"`
+	Mode       string            `json:"mode"`
+	Content    string            `json:"content"`
+	SHA256     string            `json:"sha256,omitempty"`
+	ID         string            `json:"id,omitempty"`
+	Encoding   string            `json:"encoding,omitempty"`
+	Attrs      map[string]string `json:"attrs,omitempty"` // the rest
+	Notes      []string          `json:"notes,omitempty"`
+	Meta       []string          `json:"meta,omitempty"`
+	Attachment bool              `json:"attachment,omitempty"`
+}
+
+// Attributes that have a field of their own in a JSON Lines entry; the
+// notes and meta counts are implied by the arrays.
+var jsonFields = map[string]bool{SHA256Attr: true, IDAttr: true, EncodingAttr: true, NotesAttr: true, MetaAttr: true}
+
+// WriteJSONL writes f as one line of a JSON Lines pack. Content that is
+// not UTF-8, which a JSON string cannot hold, is base64 encoded.
+func WriteJSONL(w io.Writer, f File) error {
+	l := jsonLine{Path: f.Path, Mode: f.Mode, Content: string(f.Content), SHA256: f.Attrs[SHA256Attr], ID: f.Attrs[IDAttr],
+		Encoding: f.Attrs[EncodingAttr], Notes: f.Notes, Meta: f.Meta, Attachment: f.Attachment}
+	for k, v := range f.Attrs {
+		if !jsonFields[k] {
+			if l.Attrs == nil {
+				l.Attrs = map[string]string{}
+			}
+			l.Attrs[k] = v
+		}
+	}
+	if l.Encoding == "" && !utf8.Valid(f.Content) {
+		l.Encoding, l.Content = Base64, string(EncodeBase64(f.Content))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(l)
+}
+
+// ReadJSONL is ReadPack for a JSON Lines pack. Blank lines are skipped.
+func ReadJSONL(rd io.Reader, fn func(File) error) error {
+	r := bufio.NewReader(rd)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var l jsonLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return fmt.Errorf("line %d: not a JSON Lines entry: %w", n, err)
+		}
+		if l.Path == "" {
+			return fmt.Errorf("line %d: entry without a path", n)
+		}
+		if !SafePath(l.Path) {
+			return fmt.Errorf("unsafe path in archive: %q", l.Path)
+		}
+		if l.Mode == "" {
+			l.Mode = "0644"
+		}
+		attrs := map[string]string{}
+		for k, v := range l.Attrs {
+			attrs[k] = v
+		}
+		for k, v := range map[string]string{SHA256Attr: l.SHA256, IDAttr: l.ID, EncodingAttr: l.Encoding} {
+			if v != "" {
+				attrs[k] = v
+			}
+		}
+		f := File{Path: l.Path, Mode: l.Mode, Attrs: attrs, Notes: l.Notes, Meta: l.Meta, Content: []byte(l.Content), Attachment: l.Attachment}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package packprompt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Lines of a markdown pack. Each entry is a heading naming the file, a
+// comment with its mode and attributes, its notes as quoted lines, a
+// fenced code block and its metadata, quoted, after the block.
+const (
+	MarkdownHeading     = "### "
+	MarkdownAttachMark  = "## Attachments"
+	MarkdownOmittedMark = "## Omitted"
+	markdownAttrsOpen   = "<!-- packprompt "
+	markdownAttrsClose  = " -->"
+	markdownQuote       = "> "
+)
+
+// noEOLAttr marks a markdown entry whose content does not end with a
+// newline, which the closing fence needs before it.
+const noEOLAttr = "noeol"
+
+// WriteMarkdown writes f as an entry of a markdown pack, its code block
+// tagged lang. The fence is a run of backticks longer than any in the
+// content, so nothing in it can close the block.
+func WriteMarkdown(w io.Writer, f File, lang string) error {
+	var b strings.Builder
+	b.WriteString(MarkdownHeading + f.Path + "\n")
+	b.WriteString(markdownAttrsOpen + "mode=" + f.Mode)
+	if id, ok := f.Attrs[IDAttr]; ok {
+		b.WriteString(" " + IDAttr + "=" + id) // first, as in a text header
+	}
+	keys := make([]string, 0, len(f.Attrs))
+	for k := range f.Attrs {
+		if k != IDAttr && k != NotesAttr && k != MetaAttr {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(" " + k + "=" + f.Attrs[k])
+	}
+	content := f.Content
+	eol := len(content) == 0 || content[len(content)-1] == '\n'
+	if !eol {
+		b.WriteString(" " + noEOLAttr + "=true")
+	}
+	b.WriteString(markdownAttrsClose + "\n")
+	for _, n := range f.Notes {
+		b.WriteString(markdownQuote + n + "\n")
+	}
+	fence := strings.Repeat("`", max(3, longestRun(content, '`')+1))
+	b.WriteString("\n" + fence + lang + "\n")
+	b.Write(content)
+	if !eol {
+		b.WriteString("\n")
+	}
+	b.WriteString(fence + "\n")
+	for _, m := range f.Meta {
+		b.WriteString(markdownQuote + m + "\n")
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// longestRun is the length of the longest run of c in b.
+func longestRun(b []byte, c byte) int {
+	longest, run := 0, 0
+	for _, x := range b {
+		if x != c {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// ReadMarkdown is ReadPack for a markdown pack. Text outside the entries,
+// such as the omitted section, is skipped.
+func ReadMarkdown(rd io.Reader, fn func(File) error) error {
+	r := bufio.NewReader(rd)
+	inAttachments := false
+	var pending *string // a line read past the end of an entry
+	next := func() (string, error) {
+		if pending != nil {
+			l := *pending
+			pending = nil
+			return l, nil
+		}
+		return readLine(r)
+	}
+	for {
+		line, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == MarkdownAttachMark {
+			inAttachments = true
+			continue
+		}
+		rel, ok := strings.CutPrefix(line, MarkdownHeading)
+		if !ok {
+			continue
+		}
+		rel = strings.TrimSpace(rel)
+		if !SafePath(rel) {
+			return fmt.Errorf("unsafe path in archive: %q", rel)
+		}
+		f := File{Path: rel, Mode: "0644", Attrs: map[string]string{}, Attachment: inAttachments}
+		var fence string
+		for fence == "" {
+			l, err := next()
+			if err != nil {
+				return fmt.Errorf("%s: no fenced block after the heading", rel)
+			}
+			switch {
+			case strings.TrimSpace(l) == "":
+			case strings.HasPrefix(l, markdownAttrsOpen) && strings.HasSuffix(l, markdownAttrsClose):
+				for _, a := range strings.Fields(strings.TrimSuffix(strings.TrimPrefix(l, markdownAttrsOpen), markdownAttrsClose)) {
+					k, v, _ := strings.Cut(a, "=")
+					if k == "mode" {
+						f.Mode = v
+					} else {
+						f.Attrs[k] = v
+					}
+				}
+			case strings.HasPrefix(l, markdownQuote):
+				f.Notes = append(f.Notes, strings.TrimPrefix(l, markdownQuote))
+			case strings.HasPrefix(l, "```"):
+				fence = l[:len(l)-len(strings.TrimLeft(l, "`"))]
+			default:
+				return fmt.Errorf("%s: no fenced block after the heading, found %q", rel, l)
+			}
+		}
+		var buf bytes.Buffer
+		for {
+			// nothing is pending inside a block; content keeps its CRs
+			l, err := readContentLine(r)
+			if err != nil {
+				return fmt.Errorf("%s: unterminated %s block", rel, fence)
+			}
+			if strings.TrimRight(l, " \t\r") == fence {
+				break
+			}
+			buf.WriteString(l + "\n")
+		}
+		for {
+			l, err := next()
+			if err != nil || !strings.HasPrefix(l, markdownQuote) {
+				if err == nil {
+					pending = &l
+				}
+				break
+			}
+			f.Meta = append(f.Meta, strings.TrimPrefix(l, markdownQuote))
+		}
+		f.Content = buf.Bytes()
+		if f.Attrs[noEOLAttr] == "true" {
+			f.Content = bytes.TrimSuffix(f.Content, []byte("\n"))
+			delete(f.Attrs, noEOLAttr)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
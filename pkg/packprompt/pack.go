@@ -0,0 +1,336 @@
+package packprompt
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// PackOptions configures Pack.
+type PackOptions struct {
+	Root    string    // directory to walk; "" means "."
+	Out     io.Writer // where the pack is written
+	Exclude []string  // patterns to leave out; nil means DefaultExcludes
+	Include []string  // if set, only pack files matching one of these globs
+	// Binary is what to do with binary files: "" or "skip" leaves them out,
+	// Base64 packs them encoded with encoding=base64 in their header, and
+	// drops the default excludes for BinaryExts.
+	Binary    string
+	NoOmitted bool // leave out the section listing what was not packed
+	NoPromote bool // keep walk order instead of putting key files first
+}
+
+// SessionDir is where the CLI keeps a multi-round session in a tree;
+// packs never include it.
+const SessionDir = ".packprompt"
+
+// Omission is a path a pack left out and why.
+type Omission struct {
+	Path   string
+	Size   int64 // -1 for directories
+	Reason string
+}
+
+// Pack walks opts.Root and writes a pack of its text files to opts.Out,
+// key files (see KeyFileRank) first and the rest in walk order, ending with
+// the paths it left out. With the default options it writes what
+// packprompt pack writes for a tree without a config.
+func Pack(opts PackOptions) error {
+	if opts.Out == nil {
+		return errors.New("packprompt: PackOptions.Out is nil")
+	}
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	return PackFS(os.DirFS(root), opts.Out, opts)
+}
+
+// PackFS is Pack over any file system: an embed.FS, a zip.Reader, an
+// fstest.MapFS or one in memory. opts.Root and opts.Out are not used.
+// Symlinks are not followed, as on disk; their targets are listed when
+// fsys can read links. Files are classified on their first SniffLen bytes,
+// and paths an entry header cannot carry (see CarriesPath) are left out.
+// Every entry carries the sha256 of its file; one with a line reading as
+// EndMark is packed base64-encoded.
+func PackFS(fsys iofs.FS, w io.Writer, opts PackOptions) error {
+	if opts.Binary != "" && opts.Binary != "skip" && opts.Binary != Base64 {
+		return fmt.Errorf("packprompt: invalid Binary %q: want skip or base64", opts.Binary)
+	}
+	excludes := opts.Exclude
+	if excludes == nil {
+		excludes = DefaultExcludes
+		if opts.Binary == Base64 {
+			excludes = nil
+			for _, pat := range DefaultExcludes {
+				if !strings.HasPrefix(pat, "*.") || !slices.Contains(BinaryExts, pat[1:]) {
+					excludes = append(excludes, pat)
+				}
+			}
+		}
+	}
+	// classify as the walk goes, then read each file again to write it
+	// once the key files are promoted, so a walk holds no file contents
+	type packed struct {
+		rel    string
+		mode   iofs.FileMode
+		binary bool
+	}
+	var files []packed
+	var omitted []Omission
+	err := iofs.WalkDir(fsys, ".", func(rel string, d iofs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if rel == "." {
+			return nil
+		}
+		if pat, ok := MatchExclude(rel, excludes); ok {
+			reason := fmt.Sprintf("excluded by %q", pat)
+			if d.IsDir() {
+				omitted = append(omitted, Omission{rel + "/", -1, reason})
+				return iofs.SkipDir
+			}
+			omitted = append(omitted, Omission{rel, entrySize(d), reason})
+			return nil
+		}
+		if rel == SessionDir && d.IsDir() {
+			omitted = append(omitted, Omission{rel + "/", -1, "packprompt session"})
+			return iofs.SkipDir
+		}
+		switch {
+		case d.Type()&iofs.ModeSymlink != 0:
+			omitted = append(omitted, linkOmission(fsys, rel))
+			return nil
+		case !d.Type().IsRegular():
+			if !d.IsDir() {
+				omitted = append(omitted, Omission{rel, entrySize(d), "not a regular file"})
+			}
+			return nil
+		}
+		if len(opts.Include) > 0 && !MatchAny(opts.Include, rel) {
+			omitted = append(omitted, Omission{rel, entrySize(d), "not matched by an include pattern"})
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			omitted = append(omitted, Omission{rel, 0, "unreadable"})
+			return nil
+		}
+		head, err := sniff(fsys, rel)
+		if err != nil {
+			omitted = append(omitted, Omission{rel, info.Size(), "unreadable"})
+			return nil
+		}
+		switch {
+		case IsPackOutput(head):
+			omitted = append(omitted, Omission{rel, info.Size(), "earlier packprompt output"})
+		case IsBinary(head) && opts.Binary != Base64:
+			omitted = append(omitted, Omission{rel, info.Size(), "binary"})
+		default:
+			files = append(files, packed{rel, fileMode(info), IsBinary(head)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	files = slices.DeleteFunc(files, func(f packed) bool {
+		if CarriesPath(f.rel) {
+			return false
+		}
+		omitted = append(omitted, Omission{f.rel, fileSize(fsys, f.rel), UncarriedPath})
+		return true
+	})
+	if !opts.NoPromote {
+		PromoteKeyFiles(files, func(f packed) string { return f.rel })
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, f := range files {
+		data, err := iofs.ReadFile(fsys, f.rel)
+		if err != nil {
+			omitted = append(omitted, Omission{f.rel, fileSize(fsys, f.rel), "unreadable"})
+			continue
+		}
+		attrs := []string{IDAttr + "=" + EntryID(f.rel)}
+		sum := sha256.Sum256(data)
+		// a line reading as EndMark would end the entry early
+		if f.binary || HasEndMark(data) {
+			data = EncodeBase64(data)
+			attrs = append(attrs, EncodingAttr+"="+Base64)
+		}
+		attrs = append(attrs, SHA256Attr+"="+hex.EncodeToString(sum[:]))
+		if err := writeEntry(bw, f.rel, f.mode, attrs, data); err != nil {
+			return err
+		}
+	}
+	if !opts.NoOmitted {
+		if err := WriteOmitted(bw, omitted); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readLinkFS is the ReadLink method Go 1.25 adds to io/fs, which
+// os.DirFS has from then on.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// LinkReason is why a symlink (or junction, kind) to target was left out.
+func LinkReason(kind, target string) string {
+	return fmt.Sprintf("%s to %s, not followed", kind, target)
+}
+
+// linkOmission lists the symlink rel the way the command does: with its
+// target, and as a directory when that is where it leads.
+func linkOmission(fsys iofs.FS, rel string) Omission {
+	target := "an unreadable target"
+	if rl, ok := fsys.(readLinkFS); ok {
+		if t, err := rl.ReadLink(rel); err == nil {
+			target = t
+		}
+	}
+	reason := LinkReason("symlink", target)
+	info, err := iofs.Stat(fsys, rel)
+	switch {
+	case err != nil:
+		return Omission{rel, 0, reason}
+	case info.IsDir():
+		return Omission{rel + "/", -1, reason}
+	}
+	return Omission{rel, info.Size(), reason}
+}
+
+// sniff returns up to the first SniffLen bytes of a file, which is all
+// binary and earlier-pack detection look at.
+func sniff(fsys iofs.FS, rel string) ([]byte, error) {
+	f, err := fsys.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, SniffLen)
+	n, err := io.ReadAtLeast(f, buf, 1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func fileSize(fsys iofs.FS, rel string) int64 {
+	if info, err := iofs.Stat(fsys, rel); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+// fileMode is the mode a file is packed with. File systems without
+// permissions (embed.FS reports 0444, zip members what the archiver
+// stored, fstest.MapFS zero) get 0644 when they report none.
+func fileMode(info iofs.FileInfo) iofs.FileMode {
+	if m := info.Mode().Perm(); m != 0 {
+		return m
+	}
+	return 0o644
+}
+
+func writeEntry(w io.Writer, rel string, mode iofs.FileMode, attrs []string, data []byte) error {
+	if _, err := io.WriteString(w, FormatHeader(rel, mode, attrs)+"\n"); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n"+EndMark+"\n")
+	return err
+}
+
+// MaxOmittedLines keeps the omitted section compact on huge trees.
+const MaxOmittedLines = 500
+
+// WriteOmitted writes the omitted section listing list; nothing is written
+// when it is empty.
+func WriteOmitted(w io.Writer, list []Omission) error {
+	if len(list) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "%s\n%s\n", OmittedMark, OmittedIntro(list)); err != nil {
+		return err
+	}
+	return WriteOmittedItems(w, list)
+}
+
+// OmittedIntro is the sentence that opens the omitted section. A pack is
+// only called partial when something other than DefaultExcludes left a
+// path out: a .git directory is not missing from it.
+func OmittedIntro(list []Omission) string {
+	left := fmt.Sprintf("%d paths were left out", len(list))
+	if len(list) == 1 {
+		left = "1 path was left out"
+	}
+	for _, om := range list {
+		if !defaultExcluded(om.Reason) {
+			return "This pack is partial; " + left + ":"
+		}
+	}
+	return left + " by the default excludes:"
+}
+
+func defaultExcluded(reason string) bool {
+	for _, pat := range DefaultExcludes {
+		if reason == fmt.Sprintf("excluded by %q", pat) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteOmittedItems lists the omissions, one "- path (size): reason" line
+// each, up to MaxOmittedLines.
+func WriteOmittedItems(w io.Writer, list []Omission) error {
+	for i, om := range list {
+		if i == MaxOmittedLines {
+			_, err := fmt.Fprintf(w, "- ... and %d more\n", len(list)-i)
+			return err
+		}
+		size := "dir"
+		if om.Size >= 0 {
+			size = HumanSize(om.Size)
+		}
+		if _, err := fmt.Fprintf(w, "- %s (%s): %s\n", om.Path, size, om.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HumanSize renders a byte count for people: 512 B, 1.5 KB, 2.0 MB.
+func HumanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func entrySize(d iofs.DirEntry) int64 {
+	if info, err := d.Info(); err == nil {
+		return info.Size()
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package packprompt
+
+import (
+	"bytes"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestPackUnpackEndMark round-trips a file holding a line that reads as
+// the end mark, which must not cut its entry short.
+func TestPackUnpackEndMark(t *testing.T) {
+	content := "before\n" + EndMark + "\nafter\n"
+	fsys := fstest.MapFS{
+		"tricky.txt": {Data: []byte(content)},
+		"plain.txt":  {Data: []byte("plain\n")},
+	}
+	var pack bytes.Buffer
+	if err := PackFS(fsys, &pack, PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(pack.String(), SHA256Attr+"="); n != 2 {
+		t.Errorf("%d entries with a sha256, want 2:\n%s", n, pack.String())
+	}
+	dest := t.TempDir()
+	if err := Unpack(UnpackOptions{In: &pack, Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "tricky.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("unpacked %q, want %q", got, content)
+	}
+}
+
+// TestUnpackVerify checks Unpack refuses content that does not match its
+// sha256, unless told not to check.
+func TestUnpackVerify(t *testing.T) {
+	var pack bytes.Buffer
+	if err := PackFS(fstest.MapFS{"a.txt": {Data: []byte("alpha\n")}}, &pack, PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(pack.String(), "alpha", "omega", 1)
+	err := Unpack(UnpackOptions{In: strings.NewReader(tampered), Dest: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "sha256") {
+		t.Errorf("tampered pack: got %v, want a sha256 mismatch", err)
+	}
+	if err := Unpack(UnpackOptions{In: strings.NewReader(tampered), Dest: t.TempDir(), NoVerify: true}); err != nil {
+		t.Errorf("tampered pack with NoVerify: %v", err)
+	}
+}
+
+// TestPackFSOmits checks the session directory and symlinks are listed in
+// the omitted section rather than packed.
+func TestPackFSOmits(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":                      {Data: []byte("alpha\n")},
+		SessionDir + "/session.json": {Data: []byte("{}\n")},
+		"link":                       {Data: []byte("a.txt"), Mode: iofs.ModeSymlink},
+	}
+	var pack bytes.Buffer
+	if err := PackFS(fsys, &pack, PackOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	out := pack.String()
+	for _, want := range []string{"path=a.txt ", "- " + SessionDir + "/ (dir): packprompt session", "- link (6 B): symlink to a.txt, not followed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("pack lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "path="+SessionDir) || strings.Contains(out, "path=link ") {
+		t.Errorf("packed the session or the link:\n%s", out)
+	}
+}
+
+func TestOmittedIntro(t *testing.T) {
+	git := Omission{".git/", -1, `excluded by ".git"`}
+	big := Omission{"big.log", 1 << 20, "larger than --max-file-size 512KiB"}
+	for _, c := range []struct {
+		list []Omission
+		want string
+	}{
+		{[]Omission{git}, "1 path was left out by the default excludes:"},
+		{[]Omission{git, {"logo.png", 10, `excluded by "*.png"`}}, "2 paths were left out by the default excludes:"},
+		{[]Omission{big}, "This pack is partial; 1 path was left out:"},
+		{[]Omission{git, big}, "This pack is partial; 2 paths were left out:"},
+		{[]Omission{{"a.txt", 6, `excluded by "*.txt"`}}, "This pack is partial; 1 path was left out:"},
+	} {
+		if got := OmittedIntro(c.list); got != c.want {
+			t.Errorf("OmittedIntro(%v) = %q, want %q", c.list, got, c.want)
+		}
+	}
+}
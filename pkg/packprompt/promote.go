@@ -0,0 +1,62 @@
+package packprompt
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// KeyFileRank reports how strongly a file orients a reader to the project.
+// Lower ranks sort first; ok is false for ordinary files.
+func KeyFileRank(rel string) (rank int, ok bool) {
+	base := strings.ToLower(path.Base(rel))
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	dir := path.Dir(rel)
+
+	// docs and manifests only count near the root; vendored READMEs are not an overview
+	nearRoot := strings.Count(rel, "/") <= 1
+	switch {
+	case !nearRoot:
+	case stem == "readme":
+		return 0, true
+	case stem == "architecture" || stem == "design" || stem == "overview":
+		return 1, true
+	case stem == "contributing":
+		return 2, true
+	case base == "makefile" || base == "justfile" || base == "taskfile.yml":
+		return 3, true
+	case base == "go.mod" || base == "package.json" || base == "cargo.toml" || base == "pyproject.toml":
+		return 4, true
+	}
+
+	// main entry points: at the root, under cmd/<name>/, or in src/
+	switch base {
+	case "main.go", "main.py", "__main__.py", "main.rs", "lib.rs", "main.c", "main.cpp",
+		"index.js", "index.ts", "main.js", "main.ts", "app.py", "manage.py":
+		if dir == "." || dir == "src" || (strings.HasPrefix(dir, "cmd/") && strings.Count(dir, "/") == 1) {
+			return 5, true
+		}
+	}
+	return 0, false
+}
+
+// PromoteKeyFiles moves key files to the front of list, whose elements
+// rel names, shallowest first within each rank, and leaves every other
+// element in its original order.
+func PromoteKeyFiles[E any](list []E, rel func(E) string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		pi, pj := rel(list[i]), rel(list[j])
+		ri, oki := KeyFileRank(pi)
+		rj, okj := KeyFileRank(pj)
+		if oki != okj {
+			return oki
+		}
+		if !oki {
+			return false
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		return strings.Count(pi, "/") < strings.Count(pj, "/")
+	})
+}
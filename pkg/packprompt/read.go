@@ -0,0 +1,168 @@
+package packprompt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// File is one entry read back from a pack.
+type File struct {
+	Path       string            // slash-separated, relative to the packed root
+	Mode       string            // octal, as in the header
+	Attrs      map[string]string // header attributes after the mode
+	Notes      []string          // NOTE lines the packer attached
+	Meta       []string          // META trailer lines
+	Content    []byte            // as stored: possibly encoded or encrypted
+	Attachment bool              // listed after the attachments mark
+}
+
+// ReadPack calls fn for every entry of a pack in order. Paths are checked
+// for safety before fn sees them; anything between entries is skipped, and
+// reading stops at the provenance footer, which no signature extends past.
+func ReadPack(rd io.Reader, fn func(File) error) error {
+	r := bufio.NewReader(rd)
+	inAttachments := false
+	for {
+		line, err := readLine(r)
+		if err == io.EOF || line == FooterMark {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == AttachMark {
+			inAttachments = true
+			continue
+		}
+		if line == ContractMark {
+			// its example block is not an entry
+			for line != ContractEnd {
+				if line, err = readLine(r); err != nil {
+					return fmt.Errorf("unterminated response contract: %w", err)
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, StartMark) {
+			continue
+		}
+		rel, mode, attrs, ok := ParseHeader(line)
+		if !ok {
+			return fmt.Errorf("malformed header: %q", line)
+		}
+		if !SafePath(rel) {
+			return fmt.Errorf("unsafe path in archive: %q", rel)
+		}
+		notes, err := readNotes(r, rel, attrs)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		for {
+			l, err := readContentLine(r)
+			if err == io.EOF {
+				return fmt.Errorf("%s: missing %q", rel, EndMark)
+			}
+			if err != nil {
+				return err
+			}
+			if strings.TrimSuffix(l, "\r") == EndMark {
+				break
+			}
+			buf.WriteString(l)
+			buf.WriteString("\n")
+		}
+		content, meta, err := SplitMeta(rel, buf.Bytes(), attrs)
+		if err != nil {
+			return err
+		}
+		// the newline before the end mark belongs to the format
+		content = bytes.TrimSuffix(content, []byte("\n"))
+		f := File{Path: rel, Mode: mode, Attrs: attrs, Notes: notes, Meta: meta, Content: content, Attachment: inAttachments}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// readNotes reads the note lines announced by an entry's notes attribute.
+func readNotes(r *bufio.Reader, rel string, attrs map[string]string) ([]string, error) {
+	v, ok := attrs[NotesAttr]
+	if !ok {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s: invalid %s=%q", rel, NotesAttr, v)
+	}
+	notes := make([]string, 0, n)
+	for range n {
+		l, err := readLine(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading notes: %w", rel, err)
+		}
+		text, prefixed := strings.CutPrefix(l, NoteMark)
+		text, suffixed := strings.CutSuffix(text, " ---")
+		if !prefixed || !suffixed {
+			return nil, fmt.Errorf("%s: malformed note line %q", rel, l)
+		}
+		notes = append(notes, text)
+	}
+	return notes, nil
+}
+
+// SplitMeta cuts the trailer announced by a meta attribute off content,
+// which still ends with the newline before the end mark.
+func SplitMeta(rel string, content []byte, attrs map[string]string) ([]byte, []string, error) {
+	v, ok := attrs[MetaAttr]
+	if !ok {
+		return content, nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, nil, fmt.Errorf("%s: invalid %s=%q", rel, MetaAttr, v)
+	}
+	meta := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		body := strings.TrimSuffix(string(content), "\n")
+		cut := strings.LastIndexByte(body, '\n') + 1
+		text, prefixed := strings.CutPrefix(body[cut:], MetaMark)
+		text, suffixed := strings.CutSuffix(text, " ---")
+		if !prefixed || !suffixed {
+			return nil, nil, fmt.Errorf("%s: malformed metadata line %q", rel, body[cut:])
+		}
+		meta[i] = text
+		content = content[:cut]
+	}
+	return content, meta, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString('\n')
+	if errors.Is(err, io.EOF) && len(s) > 0 {
+		return strings.TrimRight(s, "\r\n"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+// readContentLine is readLine for a line of an entry's content, which
+// keeps its carriage return: that is the file's own line ending, and part
+// of what its sha256 covers.
+func readContentLine(r *bufio.Reader) (string, error) {
+	s, err := r.ReadString('\n')
+	if errors.Is(err, io.EOF) && len(s) > 0 {
+		return strings.TrimSuffix(s, "\n"), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(s, "\n"), nil
+}
@@ -0,0 +1,170 @@
+package packprompt
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TarRecordPrefix starts the PAX records a tar pack keeps an entry's
+// header attributes in, as user.packprompt.* extended attributes: sha256
+// and so on, with notes and meta holding those lines and attachment marking
+// an attachment. tar skips them quietly unless extracting with --xattrs.
+const TarRecordPrefix = "SCHILY.xattr.user.packprompt."
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsTar reports whether head, the start of a pack, is a tar archive or a
+// gzipped one.
+func IsTar(head []byte) bool {
+	return bytes.HasPrefix(head, gzipMagic) || len(head) >= 262 && string(head[257:262]) == "ustar"
+}
+
+// isTarPack reports whether head, the start of a tar or gzipped tar, is a
+// tar pack rather than any other archive: its first member has the
+// records WriteTar stores attributes in.
+func isTarPack(head []byte) bool {
+	var r io.Reader = bytes.NewReader(head)
+	if bytes.HasPrefix(head, gzipMagic) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return false
+		}
+		defer gz.Close()
+		r = gz
+	}
+	h, err := tar.NewReader(r).Next()
+	if err != nil {
+		return false
+	}
+	for k := range h.PAXRecords {
+		if strings.HasPrefix(k, TarRecordPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// TarEnded reports whether the tar pack in data, gzipped or not, ends with
+// the two zero blocks that close an archive. A tar cut off at a block
+// boundary otherwise reads back as complete, one member short.
+func TarEnded(data []byte) (bool, error) {
+	if bytes.HasPrefix(data, gzipMagic) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return false, err
+		}
+		defer gz.Close()
+		if data, err = io.ReadAll(gz); err != nil {
+			return false, err
+		}
+	}
+	const block = 512
+	if len(data) < 2*block || len(data)%block != 0 {
+		return false, nil
+	}
+	for _, b := range data[len(data)-2*block:] {
+		if b != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// WriteTar writes f as a member of a tar pack; modTime is its
+// modification time, zero for the Unix epoch. The content is stored as it
+// is, so a base64 entry should be decoded first and its encoding attribute
+// dropped.
+func WriteTar(tw *tar.Writer, f File, modTime time.Time) error {
+	mode, err := strconv.ParseInt(f.Mode, 8, 64)
+	if err != nil {
+		return fmt.Errorf("%s: bad mode %q", f.Path, f.Mode)
+	}
+	records := map[string]string{}
+	for k, v := range f.Attrs {
+		if k != NotesAttr && k != MetaAttr {
+			records[TarRecordPrefix+k] = v
+		}
+	}
+	if len(f.Notes) > 0 {
+		records[TarRecordPrefix+NotesAttr] = strings.Join(f.Notes, "\n")
+	}
+	if len(f.Meta) > 0 {
+		records[TarRecordPrefix+MetaAttr] = strings.Join(f.Meta, "\n")
+	}
+	if f.Attachment {
+		records[TarRecordPrefix+"attachment"] = "true"
+	}
+	if modTime.IsZero() {
+		modTime = time.Unix(0, 0)
+	}
+	h := &tar.Header{Typeflag: tar.TypeReg, Name: f.Path, Mode: mode, Size: int64(len(f.Content)),
+		ModTime: modTime.Truncate(time.Second), PAXRecords: records, Format: tar.FormatPAX}
+	if err := tw.WriteHeader(h); err != nil {
+		return err
+	}
+	_, err = tw.Write(f.Content)
+	return err
+}
+
+// ReadTar is ReadPack for a tar pack, gzipped or not, including tars
+// other tools wrote. Members other than regular files are skipped; a
+// leading ./ is dropped from names.
+func ReadTar(rd io.Reader, fn func(File) error) error {
+	br := bufio.NewReader(rd)
+	var r io.Reader = br
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not a tar pack: %w", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		rel := strings.TrimPrefix(h.Name, "./")
+		if !SafePath(rel) {
+			return fmt.Errorf("unsafe path in archive: %q", rel)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		f := File{Path: rel, Mode: fmt.Sprintf("%04o", h.Mode&0o777), Attrs: map[string]string{}, Content: content}
+		for k, v := range h.PAXRecords {
+			k, ok := strings.CutPrefix(k, TarRecordPrefix)
+			switch {
+			case !ok:
+			case k == NotesAttr:
+				f.Notes = strings.Split(v, "\n")
+			case k == MetaAttr:
+				f.Meta = strings.Split(v, "\n")
+			case k == "attachment":
+				f.Attachment = v == "true"
+			default:
+				f.Attrs[k] = v
+			}
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package packprompt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tmpSuffix ends the name of the temp file a write goes through before its
+// rename.
+const tmpSuffix = ".tmp~ftp"
+
+// tempTries bounds the names tried before giving up on a directory.
+const tempTries = 10
+
+// tempName is a fresh temp name for the file name: NAME.PID-RANDOM.tmp~ftp,
+// so concurrent writers never share one, and the process that made it can
+// be told.
+func tempName(name string) string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return name + "." + strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(b[:]) + tmpSuffix
+}
+
+// IsTemp reports whether name is the temp file of a write.
+func IsTemp(name string) bool {
+	return strings.HasSuffix(name, tmpSuffix)
+}
+
+// TempOwner returns the pid of the process whose write the temp file name
+// is, and false for a name that is no temp file. Temps from releases that
+// named them NAME.tmp~ftp have pid 0.
+func TempOwner(name string) (pid int, ok bool) {
+	if !IsTemp(name) {
+		return 0, false
+	}
+	stem := strings.TrimSuffix(name, tmpSuffix)
+	i := strings.LastIndex(stem, ".")
+	if i < 0 {
+		return 0, true
+	}
+	p, rnd, found := strings.Cut(stem[i+1:], "-")
+	n, err := strconv.Atoi(p)
+	if !found || err != nil || n <= 0 || len(rnd) != 8 {
+		return 0, true
+	}
+	return n, true
+}
+
+// CreateTemp creates, exclusively, a temp file beside full to write it
+// through, returning it open for writing with its path.
+func CreateTemp(full string) (*os.File, string, error) {
+	for range tempTries {
+		tmp := tempName(full)
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, iofs.ErrExist) {
+			continue
+		}
+		return f, tmp, err
+	}
+	return nil, "", &os.PathError{Op: "create temp", Path: filepath.Dir(full), Err: iofs.ErrExist}
+}
@@ -0,0 +1,94 @@
+package packprompt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// UnpackOptions configures Unpack.
+type UnpackOptions struct {
+	In          io.Reader // the pack
+	Dest        string    // directory to write into; "" means "."
+	Attachments bool      // also write the attached documents
+
+	AllowProtected bool // let entries write into ProtectedPaths
+	NoVerify       bool // do not check entries against their sha256
+}
+
+// ErrProtected is returned for an entry that would write into
+// ProtectedPaths.
+var ErrProtected = errors.New("protected path")
+
+// Unpack writes the entries of the pack read from opts.In under opts.Dest
+// with their modes, decoding base64 entries and joining the chunks of a file
+// cut across packs onto what the earlier ones wrote. Files are written with
+// WriteBeneath, so no entry can land outside opts.Dest, and an entry in
+// ProtectedPaths stops the unpack unless opts.AllowProtected, as does an
+// entry whose content does not match its sha256 unless opts.NoVerify.
+// Encrypted entries are an error: decrypting them needs the CLI's
+// passphrase handling. Pack-time annotations (provenance and coverage
+// comments) are written as packed, so a pack carrying them needs NoVerify.
+func Unpack(opts UnpackOptions) error {
+	if opts.In == nil {
+		return errors.New("packprompt: UnpackOptions.In is nil")
+	}
+	dest := opts.Dest
+	if dest == "" {
+		dest = "."
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return err
+	}
+	return ReadPack(opts.In, func(f File) error {
+		if f.Attachment && !opts.Attachments {
+			return nil
+		}
+		if pat, ok := Protected(f.Path); ok && !opts.AllowProtected {
+			return fmt.Errorf("%s: %w (%s)", f.Path, ErrProtected, pat)
+		}
+		content, err := Decode(f)
+		if err != nil {
+			return err
+		}
+		if want, ok := f.Attrs[SHA256Attr]; ok && !opts.NoVerify {
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != want {
+				return fmt.Errorf("%s: content does not match its sha256", f.Path)
+			}
+		}
+		if c, ok, err := ParseChunk(f.Attrs); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		} else if ok {
+			if content, err = JoinChunk(dest, f.Path, c, content); err != nil {
+				return err
+			}
+		}
+		mode, err := ParseMode(f.Mode)
+		if err != nil {
+			mode = 0o644
+		}
+		return WriteBeneath(dest, f.Path, content, mode)
+	})
+}
+
+// Decode returns the bytes of the file an entry holds, undoing its encoding.
+func Decode(f File) ([]byte, error) {
+	if _, enc := f.Attrs[EncryptedAttr]; enc {
+		return nil, fmt.Errorf("%s: entry is encrypted", f.Path)
+	}
+	scheme, enc := f.Attrs[EncodingAttr]
+	if !enc {
+		return f.Content, nil
+	}
+	if scheme != Base64 {
+		return nil, fmt.Errorf("%s: unsupported encoding %q", f.Path, scheme)
+	}
+	raw, err := DecodeBase64(f.Content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad base64 content: %w", f.Path, err)
+	}
+	return raw, nil
+}
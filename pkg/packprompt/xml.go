@@ -0,0 +1,182 @@
+package packprompt
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Elements of an XML pack, in the document layout models are prompted
+// with: a <documents> root holding a <document> per entry, its content in
+// <document_content>, and the attachments and omitted section in elements
+// of their own.
+const (
+	XMLRoot        = "documents"
+	XMLAttachments = "attachments"
+	XMLOmitted     = "omitted"
+	xmlDocument    = "document"
+)
+
+// xmlEntry is a <document> as read back: index, path and mode are
+// attributes of their own, the header attributes the rest. Documents
+// written by hand in the usual prompt layout name the file in a <source>
+// element instead.
+type xmlEntry struct {
+	Path    string     `xml:"path,attr"`
+	Source  string     `xml:"source"`
+	Mode    string     `xml:"mode,attr"`
+	Index   int        `xml:"index,attr"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Notes   []string   `xml:"note"`
+	Content string     `xml:"document_content"`
+	Meta    []string   `xml:"meta"`
+}
+
+var (
+	xmlText = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	xmlAttr = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// EscapeXML escapes s as element text. Carriage returns become character
+// references, which a parser keeps rather than folding into newlines.
+func EscapeXML(s string) string {
+	return xmlText.Replace(s)
+}
+
+// WriteXML writes f as the index'th <document> of an XML pack. Content
+// XML cannot hold, invalid UTF-8 or control characters, is base64
+// encoded. A newline after the opening tag is not part of the content; one
+// before the closing tag is added when the content lacks it, and marked.
+func WriteXML(w io.Writer, f File, index int) error {
+	attrs := map[string]string{}
+	for k, v := range f.Attrs {
+		if k != NotesAttr && k != MetaAttr {
+			attrs[k] = v
+		}
+	}
+	content := f.Content
+	if attrs[EncodingAttr] == "" && !xmlSafe(content) {
+		attrs[EncodingAttr], content = Base64, EncodeBase64(content)
+	}
+	eol := len(content) == 0 || content[len(content)-1] == '\n'
+	if !eol {
+		attrs[noEOLAttr] = "true"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<%s index="%d" path="%s" mode="%s"`, xmlDocument, index, xmlAttr.Replace(f.Path), xmlAttr.Replace(f.Mode))
+	if id, ok := attrs[IDAttr]; ok {
+		b.WriteString(` ` + IDAttr + `="` + xmlAttr.Replace(id) + `"`) // first, as in a text header
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		if k != IDAttr {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(` ` + k + `="` + xmlAttr.Replace(attrs[k]) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, n := range f.Notes {
+		b.WriteString("<note>" + EscapeXML(n) + "</note>\n")
+	}
+	b.WriteString("<document_content>\n" + EscapeXML(string(content)))
+	if !eol {
+		b.WriteString("\n")
+	}
+	b.WriteString("</document_content>\n")
+	for _, m := range f.Meta {
+		b.WriteString("<meta>" + EscapeXML(m) + "</meta>\n")
+	}
+	b.WriteString("</" + xmlDocument + ">\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// xmlSafe reports whether XML 1.0 can carry b as text.
+func xmlSafe(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadXML is ReadPack for an XML pack. Elements other than the documents,
+// such as the omitted section, are skipped, and so is a <documents> root:
+// documents may stand on their own.
+func ReadXML(rd io.Reader, fn func(File) error) error {
+	dec := xml.NewDecoder(rd)
+	inAttachments := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not an XML pack: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			if t.Name.Local == XMLAttachments {
+				inAttachments = false
+			}
+		case xml.StartElement:
+			switch t.Name.Local {
+			case XMLAttachments:
+				inAttachments = true
+			case XMLOmitted:
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+			case xmlDocument:
+				var x xmlEntry
+				if err := dec.DecodeElement(&x, &t); err != nil {
+					return err
+				}
+				f, err := x.file(inAttachments)
+				if err != nil {
+					return err
+				}
+				if err := fn(f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (x xmlEntry) file(attachment bool) (File, error) {
+	if x.Path == "" {
+		x.Path = strings.TrimSpace(x.Source)
+	}
+	if x.Path == "" {
+		return File{}, fmt.Errorf("document %d: no path", x.Index)
+	}
+	if !SafePath(x.Path) {
+		return File{}, fmt.Errorf("unsafe path in archive: %q", x.Path)
+	}
+	if x.Mode == "" {
+		x.Mode = "0644"
+	}
+	attrs := map[string]string{}
+	for _, a := range x.Attrs {
+		attrs[a.Name.Local] = a.Value
+	}
+	content := strings.TrimPrefix(x.Content, "\n")
+	if attrs[noEOLAttr] == "true" {
+		content = strings.TrimSuffix(content, "\n")
+		delete(attrs, noEOLAttr)
+	}
+	return File{Path: x.Path, Mode: x.Mode, Attrs: attrs, Notes: x.Notes, Meta: x.Meta, Content: []byte(content), Attachment: attachment}, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// pluginPrefix names external subcommands: "packprompt publish" runs the
+// first packprompt-publish on PATH, as git does for git-<name>.
+const pluginPrefix = "packprompt-"
+
+// pluginContext is handed to plugins as JSON in $PACKPROMPT_PLUGIN_CONTEXT,
+// a name no flag maps to, so packprompt run by a plugin ignores it.
+// Stdin, stdout and stderr stay the user's, so plugins can be used in pipes.
+type pluginContext struct {
+	Version     string         `json:"version"`
+	Executable  string         `json:"executable"`
+	Plugin      string         `json:"plugin"`
+	Args        []string       `json:"args"`
+	Dir         string         `json:"dir"`
+	Profile     string         `json:"profile,omitempty"`
+	Config      map[string]any `json:"config"`       // the config section named after the plugin
+	ConfigFiles []string       `json:"config_files"` // files it was merged from
+}
+
+// findPlugin returns the executable for subcommand name, or "" if there is none.
+func findPlugin(name string) string {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, "-") {
+		return ""
+	}
+	p, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return ""
+	}
+	return p
+}
+
+// runPlugin runs an external subcommand and exits with its status.
+func runPlugin(path, name string, args []string) {
+	self, _ := os.Executable()
+	dir, _ := os.Getwd()
+	profile := os.Getenv("PACKPROMPT_PROFILE")
+	ctx := pluginContext{
+		Version:    toolVersion(),
+		Executable: self,
+		Plugin:     name,
+		Args:       args,
+		Dir:        dir,
+		Profile:    profile,
+		Config:     map[string]any{},
+	}
+	cfg, err := loadConfig(os.Getenv("PACKPROMPT_CONFIG"))
+	if err != nil {
+		fatal(err)
+	}
+	opts, err := cfg.options(name, profile)
+	if err != nil {
+		fatal(err)
+	}
+	if opts != nil {
+		ctx.Config = opts
+	}
+	ctx.ConfigFiles = cfg.sources
+	data, err := json.Marshal(ctx)
+	if err != nil {
+		fatal(err)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		"PACKPROMPT_PLUGIN_CONTEXT="+string(data),
+		"PACKPROMPT_BIN="+self,
+		"PACKPROMPT_VERSION="+ctx.Version,
+		"PACKPROMPT_PLUGIN="+name,
+	)
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.ExitCode())
+	}
+	if err != nil {
+		fatal(fmt.Errorf("plugin %s: %w", name, err))
+	}
+	os.Exit(0)
+}
+
+// listPlugins returns the names of the plugins on PATH, sorted; earlier PATH
+// entries shadow later ones.
+func listPlugins() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		ents, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, de := range ents {
+			name, ok := strings.CutPrefix(de.Name(), pluginPrefix)
+			if !ok || de.IsDir() {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				ext := strings.ToLower(filepath.Ext(name))
+				if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+					continue
+				}
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else if info, err := de.Info(); err != nil || info.Mode()&0o111 == 0 {
+				continue
+			}
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// policyName is the unpack policy read from the destination when --policy
+// is not given.
+const policyName = ".packprompt-policy.yaml"
+
+// unpackPolicy is what a destination lets an unpack write:
+//
+//	allow: [src/, docs/]        # path prefixes entries must fall under
+//	deny:                       # globs they must not match
+//	  - .github/workflows/**
+//	max-file-size: 200KB
+//	restore-modes: true         # false writes every file 0644
+//	allow-exec: false           # false drops executable bits
+//	require-signed: true        # only packs signed by a trusted key
+type unpackPolicy struct {
+	name          string
+	allow         []string
+	deny          []string
+	maxFileSize   int64 // 0 means no limit
+	restoreModes  bool
+	allowExec     bool
+	requireSigned bool
+}
+
+// loadPolicy reads the --policy file, or else the destination's policy
+// file; nil means no policy.
+func loadPolicy(explicit, dest string) (*unpackPolicy, error) {
+	p := explicit
+	if p == "" {
+		p = filepath.Join(dest, policyName)
+	}
+	data, err := os.ReadFile(p)
+	if explicit == "" && errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsePolicy(p, data)
+}
+
+// parsePolicy reads the subset of YAML a policy needs: top-level keys with
+// a scalar, a [flow, list] or a block list of "- item" lines, and comments.
+func parsePolicy(name string, data []byte) (*unpackPolicy, error) {
+	pol := &unpackPolicy{name: name, restoreModes: true, allowExec: true}
+	fields := map[string][]string{}
+	var order []string
+	var list string // the key whose block list is being read
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := stripYAMLComment(sc.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		bad := func(format string, a ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, n, fmt.Sprintf(format, a...))
+		}
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok {
+			if list == "" {
+				return nil, bad("list item outside a list")
+			}
+			fields[list] = append(fields[list], yamlScalar(item))
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, bad("unexpected indentation")
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, bad("want key: value")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, dup := fields[key]; dup {
+			return nil, bad("%s given twice", key)
+		}
+		order = append(order, key)
+		list = ""
+		switch {
+		case value == "":
+			list, fields[key] = key, []string{}
+		case strings.HasPrefix(value, "["):
+			inner, ok := strings.CutSuffix(strings.TrimPrefix(value, "["), "]")
+			if !ok {
+				return nil, bad("unterminated list")
+			}
+			fields[key] = []string{}
+			for _, v := range strings.Split(inner, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					fields[key] = append(fields[key], yamlScalar(v))
+				}
+			}
+		default:
+			fields[key] = []string{yamlScalar(value)}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range order {
+		values := fields[key]
+		one := func() (string, error) {
+			if len(values) != 1 {
+				return "", fmt.Errorf("%s: %s wants one value", name, key)
+			}
+			return values[0], nil
+		}
+		flag := func(dst *bool) error {
+			v, err := one()
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(v) {
+			case "yes", "on":
+				v = "true"
+			case "no", "off":
+				v = "false"
+			}
+			if *dst, err = strconv.ParseBool(v); err != nil {
+				return fmt.Errorf("%s: %s wants true or false, got %q", name, key, v)
+			}
+			return nil
+		}
+		var err error
+		switch key {
+		case "allow":
+			pol.allow = values
+		case "deny":
+			pol.deny = values
+		case "max-file-size":
+			var v string
+			if v, err = one(); err == nil {
+				if pol.maxFileSize, err = parseSize(v); err != nil {
+					err = fmt.Errorf("%s: max-file-size: %w", name, err)
+				}
+			}
+		case "restore-modes":
+			err = flag(&pol.restoreModes)
+		case "allow-exec":
+			err = flag(&pol.allowExec)
+		case "require-signed":
+			err = flag(&pol.requireSigned)
+		default:
+			err = fmt.Errorf("%s: unknown key %q (want allow, deny, max-file-size, restore-modes, allow-exec or require-signed)", name, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pol, nil
+}
+
+// stripYAMLComment drops a # comment outside quotes and trailing space.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+func yamlScalar(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// violations lists the rules an entry of size bytes at rel breaks.
+func (p *unpackPolicy) violations(rel string, size int) []string {
+	var out []string
+	if rel == policyName {
+		out = append(out, "would replace the policy itself")
+	}
+	if len(p.allow) > 0 && !underAny(rel, p.allow) {
+		out = append(out, "outside the allowed paths "+strings.Join(p.allow, ", "))
+	}
+	for _, pat := range p.deny {
+		if packprompt.Match(pat, rel) || underAny(rel, []string{pat}) {
+			out = append(out, fmt.Sprintf("denied by %q", pat))
+			break
+		}
+	}
+	if p.maxFileSize > 0 && int64(size) > p.maxFileSize {
+		out = append(out, fmt.Sprintf("%s, over max-file-size %s", humanSize(int64(size)), humanSize(p.maxFileSize)))
+	}
+	return out
+}
+
+// underAny reports whether rel is one of prefixes or inside one, read as
+// directories ("src" and "src/" both take src/main.go).
+func underAny(rel string, prefixes []string) bool {
+	for _, pre := range prefixes {
+		pre = strings.TrimSuffix(pre, "/")
+		if pre == "" || rel == pre || strings.HasPrefix(rel, pre+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// mode is the mode the policy lets an entry be written with.
+func (p *unpackPolicy) mode(m iofs.FileMode) iofs.FileMode {
+	if p == nil {
+		return m
+	}
+	if !p.restoreModes {
+		return 0o644
+	}
+	if !p.allowExec {
+		m &^= 0o111
+	}
+	return m
+}
+
+// unpackChecks are what unpack checks a pack against before writing.
+type unpackChecks struct {
+	dest           string
+	attachments    bool // attachments are unpacked, so checked
+	policy         *unpackPolicy
+	allowProtected bool
+	scan           string // "warn" or "fail" to scan content for secrets, "" not to
+	filter         pathFilter
+	routes         unpackRoutes
+	format         string // of the pack
+	report         string // write the findings here ("-" for stdout), in reportFormat
+	reportFormat   string
+}
+
+// active reports whether there is anything to check.
+func (c unpackChecks) active() bool {
+	return c.policy != nil || !c.allowProtected || c.scan != "" || c.report != ""
+}
+
+// checkUnpack reads the whole pack before anything is written and fails
+// with every entry that is protected, unless allowed, breaks the policy or,
+// scanning with "fail", brings in a secret, so a pack it rejects leaves
+// dest untouched. Secrets already in the file at dest are not reported.
+func checkUnpack(in string, ciph *entryCipher, c unpackChecks) error {
+	f, err := openPack(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var findings []scanFinding
+	err = readPackAs(f, c.format, func(pf packedFile) error {
+		if (pf.attachment && !c.attachments) || !c.filter.keeps(pf.rel) {
+			return nil
+		}
+		dest, rel, ok := c.routes.place(c.dest, pf.rel)
+		if !ok {
+			return nil
+		}
+		name := c.routes.display(dest, rel)
+		if pat, ok := packprompt.Protected(rel); ok && !c.allowProtected {
+			findings = append(findings, scanFinding{rule: "protected-path", title: "protected path", level: "error", path: name,
+				message: fmt.Sprintf("protected path (%s; --allow-protected writes it)", pat)})
+		}
+		if c.policy == nil && c.scan == "" {
+			return nil
+		}
+		content, decoded, err := pf.decode(ciph)
+		if err != nil || !decoded {
+			return err
+		}
+		if c.policy != nil {
+			size := len(content)
+			if ch, ok, _ := packprompt.ParseChunk(pf.attrs); ok {
+				size += int(ch.Offset) // the file the chunk completes
+			}
+			for _, v := range c.policy.violations(rel, size) {
+				findings = append(findings, scanFinding{rule: "policy", title: "unpack policy", level: "error", path: name,
+					message: fmt.Sprintf("%s (policy %s)", v, c.policy.name)})
+			}
+		}
+		if _, binary := pf.attrs[encodingAttr]; c.scan != "" && !binary {
+			level := "warning"
+			if c.scan == "fail" {
+				level = "error"
+			}
+			for _, s := range newSecrets(dest, rel, content) {
+				findings = append(findings, secretScanFinding(name, s, level))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if c.report != "" {
+		if err := writeScanReport(c.report, c.reportFormat, findings); err != nil {
+			return err
+		}
+	}
+	var problems []string
+	for _, f := range findings {
+		if f.level == "error" {
+			problems = append(problems, f.String())
+		} else {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", f)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("nothing unpacked; refusing to write:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// newSecrets are the secrets in content that the file at dest does not
+// hold already.
+func newSecrets(dest, rel string, content []byte) []secretFinding {
+	found := findSecrets(content)
+	if len(found) == 0 {
+		return nil
+	}
+	old, _ := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+	var out []secretFinding
+	for _, s := range found {
+		if !bytes.Contains(old, []byte(s.match)) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
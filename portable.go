@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// How pack treats paths that will not unpack everywhere (--portable-paths).
+const (
+	portableWarn    = "warn"
+	portableRewrite = "rewrite"
+	portableOff     = "off"
+)
+
+// windowsIllegal are the characters Windows does not allow in file names.
+const windowsIllegal = `<>:"|?*\`
+
+// windowsReserved are device names Windows will not create as files, with
+// or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// componentProblems lists why a path component will not unpack on some
+// platform, and the portable name it can be rewritten to. With headers
+// (the text and markdown formats), whitespace and control characters fail
+// everywhere: the entry header cannot carry them.
+func componentProblems(c string, headers bool) (problems []string, fixed string, unpackable bool) {
+	if headers && !packprompt.CarriesPath(c) {
+		problems = append(problems, "whitespace or a control character, which an entry header cannot carry")
+		unpackable = true
+	}
+	fixed = strings.TrimRight(c, " .")
+	if fixed != c {
+		problems = append(problems, "a trailing space or dot, which Windows drops")
+	}
+	for _, r := range windowsIllegal {
+		if strings.ContainsRune(fixed, r) {
+			problems = append(problems, fmt.Sprintf("%q, which Windows does not allow", r))
+		}
+	}
+	fixed = strings.Map(func(r rune) rune {
+		if headers && (unicode.IsSpace(r) || unicode.IsControl(r)) || strings.ContainsRune(windowsIllegal, r) {
+			return '_'
+		}
+		return r
+	}, fixed)
+	if stem, ext, dotted := strings.Cut(fixed, "."); windowsReserved[strings.ToUpper(stem)] {
+		problems = append(problems, "a name Windows reserves for a device")
+		fixed = stem + "_"
+		if dotted {
+			fixed += "." + ext
+		}
+	}
+	if fixed == "" {
+		fixed = "_"
+	}
+	return problems, fixed, unpackable
+}
+
+// portablePaths checks every entry's path for what fails to unpack on
+// other platforms: characters or names Windows refuses, trailing dots and
+// spaces, and paths differing only in case, which collide on Windows and
+// macOS. It warns about each; paths the pack format itself cannot carry
+// are left out. With rewrite, bad names are renamed instead (noting the
+// original name), and case collisions get a ~N suffix.
+func portablePaths(entries []entry, mode, format string, om *omissions) ([]entry, error) {
+	switch mode {
+	case portableOff:
+		return entries, nil
+	case portableWarn, portableRewrite:
+	default:
+		return nil, fmt.Errorf("invalid --portable-paths %q: want warn, rewrite or off", mode)
+	}
+	rewrite := mode == portableRewrite
+	headers := format == formatText || format == formatMarkdown
+	taken := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		taken[e.rel] = true
+	}
+	out := entries[:0]
+	for _, e := range entries {
+		var problems []string
+		parts := strings.Split(e.rel, "/")
+		unpackable := false
+		for i, c := range parts {
+			p, fixed, bad := componentProblems(c, headers)
+			for _, q := range p {
+				if !slices.Contains(problems, q) {
+					problems = append(problems, q)
+				}
+			}
+			unpackable = unpackable || bad
+			parts[i] = fixed
+		}
+		if len(problems) == 0 {
+			out = append(out, e)
+			continue
+		}
+		if !rewrite {
+			if unpackable {
+				fmt.Fprintf(os.Stderr, "warning: leaving out %q: it has %s (--portable-paths rewrite renames it)\n", e.rel, strings.Join(problems, ", "))
+				om.add(e.rel, e.size, "path has "+strings.Join(problems, ", "))
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s will not unpack on Windows: it has %s (--portable-paths rewrite renames it)\n", e.rel, strings.Join(problems, ", "))
+			out = append(out, e)
+			continue
+		}
+		renamed := uniquePath(strings.Join(parts, "/"), taken)
+		fmt.Fprintf(os.Stderr, "warning: packing %q as %s: it has %s\n", e.rel, renamed, strings.Join(problems, ", "))
+		e.notes = append(e.notes, fmt.Sprintf("packed as %s; the file is named %q", renamed, e.rel))
+		delete(taken, e.rel)
+		e.rel = renamed
+		out = append(out, e)
+	}
+
+	byFold := map[string]int{}
+	for i := range out {
+		fold := strings.ToLower(out[i].rel)
+		first, clash := byFold[fold]
+		if !clash {
+			byFold[fold] = i
+			continue
+		}
+		if !rewrite {
+			fmt.Fprintf(os.Stderr, "warning: %s and %s differ only in case; on Windows and macOS one overwrites the other\n", out[first].rel, out[i].rel)
+			continue
+		}
+		renamed := uniqueFold(out[i].rel, byFold)
+		fmt.Fprintf(os.Stderr, "warning: packing %s as %s: it differs from %s only in case\n", out[i].rel, renamed, out[first].rel)
+		out[i].notes = append(out[i].notes, fmt.Sprintf("packed as %s; the file is named %s, which differs from %s only in case", renamed, out[i].rel, out[first].rel))
+		out[i].rel = renamed
+		byFold[strings.ToLower(renamed)] = i
+	}
+	return out, nil
+}
+
+// uniquePath is rel, or rel with a ~N before its extension if another
+// entry has that path already; it is then taken.
+func uniquePath(rel string, taken map[string]bool) string {
+	name := rel
+	for n := 1; taken[name]; n++ {
+		name = withSuffix(rel, fmt.Sprintf("~%d", n))
+	}
+	taken[name] = true
+	return name
+}
+
+// uniqueFold is uniquePath ignoring case.
+func uniqueFold(rel string, byFold map[string]int) string {
+	name := rel
+	for n := 1; ; n++ {
+		if _, ok := byFold[strings.ToLower(name)]; !ok {
+			return name
+		}
+		name = withSuffix(rel, fmt.Sprintf("~%d", n))
+	}
+}
+
+// withSuffix puts s before the extension of rel's last component.
+func withSuffix(rel, s string) string {
+	dir, base := "", rel
+	if i := strings.LastIndex(rel, "/"); i >= 0 {
+		dir, base = rel[:i+1], rel[i+1:]
+	}
+	if i := strings.LastIndex(base, "."); i > 0 {
+		return dir + base[:i] + s + base[i:]
+	}
+	return dir + base + s
+}
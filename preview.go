@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// Preview states of a file an unpack would write.
+const (
+	previewNew       = "new"
+	previewModified  = "modified"
+	previewUnchanged = "unchanged"
+	previewEncrypted = "encrypted, skipped"
+)
+
+var previewStyles = map[string]string{
+	previewNew:       styleGreen,
+	previewModified:  styleYellow,
+	previewUnchanged: styleDim,
+	previewEncrypted: styleRed,
+}
+
+// previewNode is a directory or file of the destination tree.
+type previewNode struct {
+	name     string
+	state    string // files only
+	children map[string]*previewNode
+}
+
+func (n *previewNode) child(name string) *previewNode {
+	if n.children == nil {
+		n.children = map[string]*previewNode{}
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &previewNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+// previewUnpack renders what unpacking in into dest would do as a tree of
+// new, modified and unchanged files, without writing anything. Entries
+// filter leaves out are not shown.
+func previewUnpack(out *humanOutput, in, format, dest string, withAttachments bool, filter pathFilter, ciph *entryCipher) error {
+	f, err := openPack(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	root := &previewNode{name: dest}
+	counts := map[string]int{}
+	err = readPackAs(f, format, func(pf packedFile) error {
+		if (pf.attachment && !withAttachments) || !filter.keeps(pf.rel) {
+			return nil
+		}
+		content, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		state := previewEncrypted
+		if ok {
+			state = previewState(filepath.Join(dest, filepath.FromSlash(pf.rel)), content)
+		}
+		n := root
+		for _, part := range strings.Split(pf.rel, "/") {
+			n = n.child(part)
+		}
+		n.state = state
+		counts[state]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(out, out.paint(styleBold, dest)); err != nil {
+		return err
+	}
+	if err := printPreview(out, root, ""); err != nil {
+		return err
+	}
+	var summary []string
+	for _, s := range []string{previewNew, previewModified, previewUnchanged, previewEncrypted} {
+		if counts[s] > 0 {
+			summary = append(summary, out.paint(previewStyles[s], fmt.Sprintf("%d %s", counts[s], s)))
+		}
+	}
+	if len(summary) == 0 {
+		summary = []string{"no files"}
+	}
+	_, err = fmt.Fprintf(out, "\n%s\n", strings.Join(summary, ", "))
+	return err
+}
+
+// previewState compares an entry's content with the file it would replace.
+func previewState(full string, content []byte) string {
+	cur, err := os.ReadFile(full)
+	switch {
+	case err != nil:
+		return previewNew
+	case bytes.Equal(cur, content):
+		return previewUnchanged
+	}
+	return previewModified
+}
+
+// printPreview draws n's children as an ASCII tree, directories first.
+func printPreview(w *humanOutput, n *previewNode, indent string) error {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := n.children[names[i]], n.children[names[j]]
+		if (a.children != nil) != (b.children != nil) {
+			return a.children != nil
+		}
+		return names[i] < names[j]
+	})
+	for i, name := range names {
+		c := n.children[name]
+		branch, next := "|-- ", "|   "
+		if i == len(names)-1 {
+			branch, next = "`-- ", "    "
+		}
+		line := w.paint(styleBlue, name+"/")
+		if c.children == nil {
+			line = w.paint(previewStyles[c.state], name+" ("+c.state+")")
+		}
+		if _, err := io.WriteString(w, indent+branch+line+"\n"); err != nil {
+			return err
+		}
+		if c.children != nil {
+			if err := printPreview(w, c, indent+next); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dryRunUnpack lists every file unpacking in into dest would create or
+// overwrite, with its size and whether a file is there already, without
+// touching dest. A file the pack changes is marked as onConflict would
+// treat it. With routes, files are listed where they route to.
+func dryRunUnpack(w io.Writer, in, format, dest string, withAttachments bool, filter pathFilter, routes unpackRoutes, onConflict string, ciph *entryCipher) error {
+	type planned struct {
+		name, full string
+		size       int64
+		sum        string // of the whole file, "" when written in chunks
+		encrypted  bool
+	}
+	f, err := openPack(in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var order []*planned
+	plan := map[string]*planned{} // by path on disk
+	unrouted := 0
+	err = readPackAs(f, format, func(pf packedFile) error {
+		if (pf.attachment && !withAttachments) || !filter.keeps(pf.rel) {
+			return nil
+		}
+		to, rel, routed := routes.place(dest, pf.rel)
+		if !routed {
+			unrouted++
+			return nil
+		}
+		content, ok, err := pf.decode(ciph)
+		if err != nil {
+			return err
+		}
+		full := filepath.Join(to, filepath.FromSlash(rel))
+		p := plan[full]
+		if p == nil {
+			p = &planned{name: routes.display(to, rel), full: full}
+			plan[full] = p
+			order = append(order, p)
+		}
+		if !ok {
+			p.encrypted = true
+			return nil
+		}
+		c, chunked, err := packprompt.ParseChunk(pf.attrs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", pf.rel, err)
+		}
+		if chunked {
+			p.size, p.sum = max(p.size, c.Offset+int64(len(content))), ""
+		} else {
+			// a path packed twice is written twice; the last one stays
+			p.size, p.sum, p.encrypted = int64(len(content)), contentHash(content), false
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	created, overwritten := 0, 0
+	var total int64
+	for _, p := range order {
+		if p.encrypted && p.size == 0 {
+			fmt.Fprintf(w, "%-9s %10s  %s (encrypted, no passphrase)\n", "skip", "-", p.name)
+			continue
+		}
+		action, note := "create", ""
+		switch info, err := os.Stat(p.full); {
+		case errors.Is(err, iofs.ErrNotExist):
+			created++
+		case errors.Is(err, syscall.ENOTDIR):
+			note = " (a parent exists as a file; unpack would fail)"
+			created++
+		case err != nil:
+			return err
+		case info.IsDir():
+			action, note = "overwrite", " (exists as a directory; unpack would fail)"
+			overwritten++
+		default:
+			action, note = "overwrite", fmt.Sprintf(" (exists, %s)", humanSize(info.Size()))
+			if cur, err := os.ReadFile(p.full); err == nil && p.sum != "" && contentHash(cur) == p.sum {
+				note = " (exists, same content)"
+			} else if onConflict != conflictOverwrite {
+				action = map[string]string{conflictSkip: "keep", conflictBackup: "backup", conflictPrompt: "ask"}[onConflict]
+			}
+			if action != "keep" {
+				overwritten++
+			}
+		}
+		if action != "keep" {
+			total += p.size
+		}
+		if _, err := fmt.Fprintf(w, "%-9s %10s  %s%s\n", action, humanSize(p.size), p.name, note); err != nil {
+			return err
+		}
+	}
+	if unrouted > 0 {
+		fmt.Fprintf(w, "Would leave out %s no --route matches\n", plural(unrouted, "entry"))
+	}
+	into := dest
+	if len(routes) > 0 {
+		into = strings.Join(routes.dests(), ", ")
+	}
+	_, err = fmt.Fprintf(w, "Would write %s (%s) into %s: %d new, %d overwritten; nothing written (--dry-run)\n",
+		plural(created+overwritten, "file"), humanSize(total), into, created, overwritten)
+	return err
+}
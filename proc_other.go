@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func processAlive(pid int) bool {
+	// outside Unix, FindProcess fails for processes that do not exist
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const provenanceTag = "packprompt:provenance"
+
+// comment delimiters per extension; files with no comment syntax get no banner
+var commentStyles = map[string][2]string{
+	".go": {"//", ""}, ".c": {"//", ""}, ".h": {"//", ""}, ".cc": {"//", ""}, ".cpp": {"//", ""},
+	".hpp": {"//", ""}, ".cs": {"//", ""}, ".java": {"//", ""}, ".kt": {"//", ""}, ".scala": {"//", ""},
+	".swift": {"//", ""}, ".rs": {"//", ""}, ".js": {"//", ""}, ".jsx": {"//", ""}, ".ts": {"//", ""},
+	".tsx": {"//", ""}, ".mjs": {"//", ""}, ".cjs": {"//", ""}, ".dart": {"//", ""}, ".proto": {"//", ""},
+	".php": {"//", ""}, ".groovy": {"//", ""},
+	".py": {"#", ""}, ".rb": {"#", ""}, ".sh": {"#", ""}, ".bash": {"#", ""}, ".zsh": {"#", ""},
+	".pl": {"#", ""}, ".r": {"#", ""}, ".yaml": {"#", ""}, ".yml": {"#", ""}, ".toml": {"#", ""},
+	".tf": {"#", ""}, ".cfg": {"#", ""}, ".conf": {"#", ""}, ".mk": {"#", ""}, ".ps1": {"#", ""},
+	".sql": {"--", ""}, ".lua": {"--", ""}, ".hs": {"--", ""},
+	".ini": {";", ""}, ".el": {";", ""}, ".clj": {";", ""},
+	".css": {"/*", " */"}, ".scss": {"//", ""}, ".less": {"//", ""},
+	".html": {"<!--", " -->"}, ".htm": {"<!--", " -->"}, ".xml": {"<!--", " -->"}, ".svg": {"<!--", " -->"},
+	".md": {"<!--", " -->"}, ".vue": {"<!--", " -->"},
+}
+
+// extensionless files recognised by name
+var commentStylesByName = map[string][2]string{
+	"makefile": {"#", ""}, "dockerfile": {"#", ""}, "gemfile": {"#", ""}, "rakefile": {"#", ""},
+	".gitignore": {"#", ""}, ".dockerignore": {"#", ""}, ".editorconfig": {"#", ""},
+}
+
+var provenanceLineRe = regexp.MustCompile(`^\s*(//|#|--|;|/\*|<!--)\s*` + regexp.QuoteMeta(provenanceTag) + `\s.*$`)
+
+func commentStyle(rel string) ([2]string, bool) {
+	base := strings.ToLower(path.Base(rel))
+	if cs, ok := commentStylesByName[base]; ok {
+		return cs, true
+	}
+	cs, ok := commentStyles[path.Ext(base)]
+	return cs, ok
+}
+
+// provenanceBanner builds the one-line comment inserted at the top of rel,
+// or "" when the file type has no comment syntax.
+func provenanceBanner(rel, commit, when string) string {
+	cs, ok := commentStyle(rel)
+	if !ok {
+		return ""
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	return fmt.Sprintf("%s %s generated-by=packprompt commit=%s time=%s path=%s%s",
+		cs[0], provenanceTag, commit, when, rel, cs[1])
+}
+
+func isProvenanceLine(line string) bool {
+	return provenanceLineRe.MatchString(line)
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoRawTerminal = errors.New("view needs a Unix terminal")
+
+func rawTerminal(fd uintptr) (func(), error) { return nil, errNoRawTerminal }
+
+func terminalSize(fd uintptr) (int, int, error) { return 0, 0, errNoRawTerminal }
+
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Recipe keys that are not pack options.
+const (
+	recipeExtends     = "extends"
+	recipeDescription = "description"
+)
+
+// recipe resolves a named recipe to pack options: the recipes it extends
+// (one name or a list, applied in order), then its own keys on top.
+func (c *config) recipe(name string) (map[string]any, error) {
+	return c.resolveRecipe(name, nil)
+}
+
+func (c *config) resolveRecipe(name string, chain []string) (map[string]any, error) {
+	if contains(chain, name) {
+		return nil, fmt.Errorf("recipe %q extends itself: %s", name, strings.Join(append(chain, name), " -> "))
+	}
+	r, ok := c.recipes[name]
+	if !ok {
+		known := c.recipeNames()
+		if len(known) == 0 {
+			return nil, fmt.Errorf("unknown recipe %q: the config defines no recipes", name)
+		}
+		return nil, fmt.Errorf("unknown recipe %q (known: %s)", name, strings.Join(known, ", "))
+	}
+	var parents []string
+	if v, ok := r[recipeExtends]; ok {
+		var err error
+		if parents, err = configValues(v); err != nil {
+			return nil, fmt.Errorf("recipe %q: extends: %w", name, err)
+		}
+	}
+	opts := map[string]any{}
+	for _, p := range parents {
+		base, err := c.resolveRecipe(p, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+		opts = mergeOptions(opts, base)
+	}
+	own := mergeOptions(nil, r)
+	delete(own, recipeExtends)
+	delete(own, recipeDescription)
+	return mergeOptions(opts, own), nil
+}
+
+func (c *config) recipeNames() []string {
+	var names []string
+	for n := range c.recipes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recipeArgs turns recipe options into pack flags, checked against fs.
+func recipeArgs(name string, opts map[string]any, fs *flag.FlagSet) ([]string, error) {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, k := range keys {
+		if fs.Lookup(k) == nil || k == "config" || k == "profile" {
+			return nil, fmt.Errorf("recipe %q: pack has no option %q", name, k)
+		}
+		values, err := configValues(opts[k])
+		if err != nil {
+			return nil, fmt.Errorf("recipe %q: %s: %w", name, k, err)
+		}
+		for _, v := range values {
+			args = append(args, "--"+k+"="+v)
+		}
+	}
+	return args, nil
+}
+
+// runOptions holds run's flags.
+type runOptions struct {
+	list bool
+}
+
+// runFlags declares run's flags into o.
+func runFlags(o *runOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("run", flag.ExitOnError)
+	flg.BoolVar(&o.list, "list", false, "list the recipes in the config")
+	return flg
+}
+
+// runCmd packs with a recipe from the config. The recipe's options count
+// as given on the command line, so they beat the environment, profiles and
+// the pack section; flags after the recipe name beat the recipe.
+func runCmd(args []string) {
+	var o runOptions
+	flg := runFlags(&o)
+	parseFlags(flg, args)
+	cfgPath, profile := flg.Lookup("config").Value.String(), flg.Lookup("profile").Value.String()
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		fatal(err)
+	}
+	if o.list {
+		for _, n := range cfg.recipeNames() {
+			desc, _ := cfg.recipes[n][recipeDescription].(string)
+			fmt.Printf("%s\t%s\n", n, desc)
+		}
+		return
+	}
+	if flg.NArg() == 0 {
+		fatal(fmt.Errorf("usage: packprompt run RECIPE [pack flags] (or run --list)"))
+	}
+	name := flg.Arg(0)
+	opts, err := cfg.recipe(name)
+	if err != nil {
+		fatal(err)
+	}
+	warnWithheld(cfg.withheldFor("recipes."+name, ""))
+	packArgs, err := recipeArgs(name, opts, commandFlags("pack"))
+	if err != nil {
+		fatal(err)
+	}
+	if cfgPath != "" {
+		packArgs = append(packArgs, "--config="+cfgPath)
+	}
+	if profile != "" {
+		packArgs = append(packArgs, "--profile="+profile)
+	}
+	fmt.Fprintf(os.Stderr, "Recipe %s: pack %s\n", name, strings.Join(packArgs, " "))
+	if packCmd(append(packArgs, flg.Args()[1:]...)) {
+		os.Exit(exitPartial)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters; the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// terms splits text into lower-case search terms. Identifiers also yield
+// their camelCase and snake_case parts, so "parseHTTPHeader" matches "header".
+func terms(text string) []string {
+	var out []string
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, w := range words {
+		parts := splitIdent(w)
+		if len(parts) > 1 {
+			out = append(out, strings.ToLower(w))
+		}
+		for _, p := range parts {
+			if len(p) > 1 {
+				out = append(out, strings.ToLower(p))
+			}
+		}
+	}
+	return out
+}
+
+func splitIdent(w string) []string {
+	var parts []string
+	for _, s := range strings.Split(w, "_") {
+		rs := []rune(s)
+		start := 0
+		for i := 1; i < len(rs); i++ {
+			lowerToUpper := unicode.IsLower(rs[i-1]) && unicode.IsUpper(rs[i])
+			// the last capital of an acronym starts the next word: HTTPHeader -> HTTP Header
+			acronymEnd := i+1 < len(rs) && unicode.IsUpper(rs[i-1]) && unicode.IsUpper(rs[i]) && unicode.IsLower(rs[i+1])
+			if lowerToUpper || acronymEnd {
+				parts = append(parts, string(rs[start:i]))
+				start = i
+			}
+		}
+		if start < len(rs) {
+			parts = append(parts, string(rs[start:]))
+		}
+	}
+	return parts
+}
+
+// relevanceScores scores every entry against query with BM25. The path
+// counts twice so a file named after the topic ranks above one that only
+// mentions it.
+func relevanceScores(entries []entry, query string) ([]float64, error) {
+	q := map[string]bool{}
+	for _, t := range terms(query) {
+		q[t] = true
+	}
+	if len(q) == 0 {
+		return nil, fmt.Errorf("--relevant-to %q has no searchable words", query)
+	}
+	tf := make([]map[string]int, len(entries))
+	lens := make([]int, len(entries))
+	df := map[string]int{}
+	total := 0
+	for i, e := range entries {
+		data, err := readEntry(e)
+		if err != nil {
+			return nil, err
+		}
+		counts := map[string]int{}
+		words := terms(string(data))
+		pathWords := terms(e.rel)
+		words = append(append(words, pathWords...), pathWords...)
+		for _, w := range words {
+			if q[w] {
+				counts[w]++
+			}
+		}
+		for w := range counts {
+			df[w]++
+		}
+		tf[i], lens[i] = counts, len(words)
+		total += len(words)
+	}
+	n := float64(len(entries))
+	avg := float64(total) / math.Max(n, 1)
+	scores := make([]float64, len(entries))
+	for i := range entries {
+		for w, f := range tf[i] {
+			idf := math.Log(1 + (n-float64(df[w])+0.5)/(float64(df[w])+0.5))
+			norm := float64(f) * (bm25K1 + 1) / (float64(f) + bm25K1*(1-bm25B+bm25B*float64(lens[i])/math.Max(avg, 1)))
+			scores[i] += idf * norm
+		}
+	}
+	return scores, nil
+}
+
+// rankByRelevance orders entries by descending score, keeping the existing
+// order among ties. With top > 0 or budget > 0 it keeps only the best files
+// that matched at all, up to top files or budget bytes of content.
+func rankByRelevance(entries []entry, query string, top int, budget int64, om *omissions) ([]entry, error) {
+	scores, err := relevanceScores(entries, query)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return scores[idx[a]] > scores[idx[b]] })
+	ranked := make([]entry, 0, len(entries))
+	var used int64
+	for _, i := range idx {
+		e := entries[i]
+		if top > 0 || budget > 0 {
+			var reason string
+			switch {
+			case scores[i] == 0:
+				reason = "no match for --relevant-to"
+			case top > 0 && len(ranked) >= top:
+				reason = fmt.Sprintf("below the top %d relevant files", top)
+			case budget > 0 && used+e.size > budget:
+				reason = "over the --relevant-budget"
+			}
+			if reason != "" {
+				om.add(e.rel, e.size, reason)
+				continue
+			}
+		}
+		used += e.size
+		ranked = append(ranked, e)
+	}
+	return ranked, nil
+}
+
+// parseSize reads a byte count with an optional k, m or g suffix (powers of 1024).
+func parseSize(s string) (int64, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	t = strings.TrimSuffix(t, "b")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(t, "k"):
+		mult, t = 1<<10, strings.TrimSuffix(t, "k")
+	case strings.HasSuffix(t, "m"):
+		mult, t = 1<<20, strings.TrimSuffix(t, "m")
+	case strings.HasSuffix(t, "g"):
+		mult, t = 1<<30, strings.TrimSuffix(t, "g")
+	}
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: want bytes, e.g. 500k or 2M", s)
+	}
+	return int64(n * float64(mult)), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// maxRemoteBody caps any single HTTP response we are willing to buffer.
+const maxRemoteBody = 64 << 20
+
+// httpGet fetches url with the given headers and returns the body, treating
+// any non-2xx status as an error.
+func httpGet(url string, headers map[string]string) ([]byte, error) {
+	return httpDo(httpClient, http.MethodGet, url, nil, headers)
+}
+
+// httpPost sends body to url and returns the response body like httpGet.
+func httpPost(url string, body []byte, headers map[string]string) ([]byte, error) {
+	return httpDo(httpClient, http.MethodPost, url, body, headers)
+}
+
+func httpDo(client *http.Client, method, url string, reqBody []byte, headers map[string]string) ([]byte, error) {
+	var rd io.Reader
+	if reqBody != nil {
+		rd = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequest(method, url, rd)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "packprompt/"+toolVersion())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteBody {
+		return nil, fmt.Errorf("%s %s: response larger than %d bytes", method, url, maxRemoteBody)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 200 {
+			msg = msg[:200] + "..."
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, msg)
+	}
+	return body, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportPeriods label a time with the period report groups it in; the
+// labels sort in time order.
+var reportPeriods = map[string]func(time.Time) string{
+	"day":   func(t time.Time) string { return t.Format("2006-01-02") },
+	"week":  func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-W%02d", y, w) },
+	"month": func(t time.Time) string { return t.Format("2006-01") },
+}
+
+// reportRow is one period of packprompt report.
+type reportRow struct {
+	period           string
+	packs, responses int
+	files            int
+	bytes            int64
+	sized            int // packs whose size is known
+	tokens           int
+	counted          int // packs still on disk, whose tokens could be counted
+}
+
+func (r *reportRow) avgTokens() int {
+	if r.counted == 0 {
+		return 0
+	}
+	return r.tokens / r.counted
+}
+
+// reportOptions holds report's flags.
+type reportOptions struct {
+	by    string
+	model string
+	plain bool
+}
+
+// reportFlags declares report's flags into o.
+func reportFlags(o *reportOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("report", flag.ExitOnError)
+	flg.StringVar(&o.by, "by", "week", "group packs by day, week or month")
+	flg.StringVar(&o.model, "model", "gpt-4o", "tokenizer family for the token columns: gpt-4o, gpt-4, claude, llama or generic")
+	flg.BoolVar(&o.plain, "plain", false, "no colors and no pager")
+	return flg
+}
+
+// reportCmd summarises packing over time from the session files of the
+// trees given (default: the one the working directory is in). It reads
+// only those files and the packs beside them; nothing is sent anywhere.
+func reportCmd(args []string) {
+	var o reportOptions
+	flg := reportFlags(&o)
+	parseFlags(flg, args)
+
+	period, ok := reportPeriods[o.by]
+	if !ok {
+		fatal(fmt.Errorf("invalid --by %q: want day, week or month", o.by))
+	}
+	est, err := lookupEstimator(o.model)
+	if err != nil {
+		fatal(err)
+	}
+	dirs := flg.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	var names []string
+	rows := map[string]*reportRow{}
+	total := &reportRow{period: "total"}
+	var first, last time.Time
+	for _, d := range dirs {
+		s, err := findSession(d)
+		if err != nil {
+			fatal(err)
+		}
+		names = append(names, s.Name)
+		for _, round := range s.Rounds {
+			key := period(round.Packed.Local())
+			r := rows[key]
+			if r == nil {
+				r = &reportRow{period: key}
+				rows[key] = r
+			}
+			if first.IsZero() || round.Packed.Before(first) {
+				first = round.Packed
+			}
+			if round.Packed.After(last) {
+				last = round.Packed
+			}
+			size, tokens, sized, counted := round.Bytes, 0, round.Bytes > 0, false
+			if data, err := os.ReadFile(s.path(round.Pack)); err == nil {
+				size, tokens, sized, counted = int64(len(data)), est.count(string(data)), true, true
+			}
+			for _, row := range []*reportRow{r, total} {
+				row.packs++
+				row.responses += len(round.Applied)
+				row.files += len(round.Files)
+				if sized {
+					row.bytes += size
+					row.sized++
+				}
+				if counted {
+					row.tokens += tokens
+					row.counted++
+				}
+			}
+		}
+	}
+
+	out := newHumanOutput(o.plain)
+	defer out.close()
+	fmt.Fprintf(out, "%s: %s\n", plural(len(names), "session"), strings.Join(names, ", "))
+	if total.packs == 0 {
+		fmt.Fprintln(out, "Nothing packed yet; run packprompt session pack")
+		return
+	}
+	fmt.Fprintf(out, "%s from %s to %s\n", plural(total.packs, "pack"), first.Local().Format("2006-01-02"), last.Local().Format("2006-01-02"))
+
+	keys := make([]string, 0, len(rows))
+	for k := range rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	table := [][]cell{{
+		{text: strings.ToUpper(o.by), style: styleBold}, {text: "PACKS", style: styleBold, numeric: true},
+		{text: "RESPONSES", style: styleBold, numeric: true}, {text: "AVG FILES", style: styleBold, numeric: true},
+		{text: "AVG SIZE", style: styleBold, numeric: true}, {text: "AVG TOKENS", style: styleBold, numeric: true},
+		{text: "TREND", style: styleBold, numeric: true},
+	}}
+	var prev *reportRow
+	for _, k := range append(keys, total.period) {
+		r, style := rows[k], styleCyan
+		if k == total.period {
+			r, style = total, styleBold
+		}
+		trend := "-"
+		if r != total && prev != nil && prev.avgTokens() > 0 && r.counted > 0 {
+			trend = fmt.Sprintf("%+.0f%%", 100*float64(r.avgTokens()-prev.avgTokens())/float64(prev.avgTokens()))
+		}
+		if r != total && r.counted > 0 {
+			prev = r
+		}
+		size, tokens := "-", "-"
+		if r.sized > 0 {
+			size = humanSize(r.bytes / int64(r.sized))
+		}
+		if r.counted > 0 {
+			tokens = strconv.Itoa(r.avgTokens())
+		}
+		table = append(table, []cell{
+			{text: r.period, style: style},
+			{text: strconv.Itoa(r.packs), numeric: true},
+			{text: strconv.Itoa(r.responses), numeric: true},
+			{text: strconv.Itoa(r.files / r.packs), numeric: true},
+			{text: size, numeric: true},
+			{text: tokens, style: styleYellow, numeric: true},
+			{text: trend, style: styleDim, numeric: true},
+		})
+	}
+	if err := out.table(table); err != nil {
+		fatal(err)
+	}
+	note := "tokens: " + est.label()
+	if missing := total.packs - total.counted; missing > 0 {
+		note += fmt.Sprintf("; %s no longer on disk, left out of the token columns", plural(missing, "pack"))
+	}
+	fmt.Fprintln(out, out.paint(styleDim, note))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// scannedFile is an entry found by scanPack; complete is false when the
+// text ended, or another header began, before its end mark.
+type scannedFile struct {
+	rel, mode string
+	attrs     map[string]string
+	content   []byte
+	complete  bool
+}
+
+// scanPack reads entries like readPack but never gives up on damage: a
+// truncated or interleaved entry is returned incomplete and malformed
+// headers are skipped, so a broken copy yields everything that survived.
+func scanPack(rd io.Reader) ([]scannedFile, error) {
+	r := bufio.NewReader(rd)
+	var files []scannedFile
+	var cur *scannedFile
+	var buf bytes.Buffer
+	finish := func(complete bool) {
+		if cur != nil {
+			data := bytes.Clone(buf.Bytes())
+			if c, _, err := packprompt.SplitMeta(cur.rel, data, cur.attrs); complete && err == nil {
+				data = c
+			}
+			cur.content, cur.complete = bytes.TrimSuffix(data, []byte("\n")), complete
+			files = append(files, *cur)
+		}
+		cur = nil
+		buf.Reset()
+	}
+	skipNotes := 0
+	for {
+		raw, err := readContentLine(r)
+		line := strings.TrimSuffix(raw, "\r")
+		if err == io.EOF || (cur == nil && line == footerStart) {
+			finish(false)
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, startMark) {
+			if rel, mode, attrs, ok := packprompt.ParseHeader(line); ok {
+				finish(false)
+				cur = &scannedFile{rel: rel, mode: mode, attrs: attrs}
+				skipNotes, _ = strconv.Atoi(attrs[notesAttr])
+				continue
+			}
+		}
+		if cur == nil {
+			continue
+		}
+		if line == endMark {
+			finish(true)
+			continue
+		}
+		if skipNotes > 0 && strings.HasPrefix(line, noteMark) {
+			skipNotes--
+			continue
+		}
+		skipNotes = 0
+		buf.WriteString(raw + "\n")
+	}
+}
+
+// damagedEntry is a manifest entry a copy lacks or holds damaged.
+type damagedEntry struct {
+	file   manifestFile
+	reason string
+}
+
+// findDamage compares a copy's entries with the manifest.
+func findDamage(files []scannedFile, m *manifest) []damagedEntry {
+	byPath := map[string]scannedFile{}
+	for _, f := range files {
+		if prev, ok := byPath[f.rel]; !ok || !prev.complete {
+			byPath[f.rel] = f
+		}
+	}
+	var damaged []damagedEntry
+	for _, mf := range m.Files {
+		f, ok := byPath[mf.Path]
+		switch {
+		case !ok:
+			damaged = append(damaged, damagedEntry{mf, "missing"})
+		case !f.complete:
+			damaged = append(damaged, damagedEntry{mf, "cut off before its end line"})
+		case mf.SHA256 != "" && contentHash(f.content) != mf.SHA256:
+			damaged = append(damaged, damagedEntry{mf, "content differs from the original"})
+		}
+	}
+	return damaged
+}
+
+// requestMissingPrompt asks a model to send the damaged entries again.
+func requestMissingPrompt(damaged []damagedEntry, total int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Your previous response was incomplete: %d of the %d files are missing or damaged.\n", len(damaged), total)
+	b.WriteString("Send exactly these files again, each complete and unchanged from the original, and nothing\n")
+	b.WriteString("else: no commentary, no other files, no placeholders for omitted content.\n\n")
+	for _, d := range damaged {
+		fmt.Fprintf(&b, "- %s (id %s): %s\n", d.file.Path, d.file.ID, d.reason)
+	}
+	b.WriteString("\nUse one block per file, in this order, with these header lines exactly:\n\n")
+	for _, d := range damaged {
+		fmt.Fprintf(&b, "%s path=%s mode=%s ---\n", startMark, d.file.Path, d.file.Mode)
+		b.WriteString("(the whole content of the file)\n")
+		b.WriteString(endMark + "\n")
+	}
+	return b.String()
+}
+
+// requestOptions holds request-missing's flags.
+type requestOptions struct {
+	in           string
+	manifestPath string
+	out          string
+}
+
+// requestFlags declares request-missing's flags into o.
+func requestFlags(o *requestOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("request-missing", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "-", "the broken copy of the pack, e.g. a model's truncated response (- for stdin)")
+	flg.StringVar(&o.manifestPath, "manifest", "manifest.json", "manifest written by pack --manifest for the original pack")
+	flg.StringVar(&o.out, "out", "-", "write the follow-up prompt to this file (- for stdout)")
+	return flg
+}
+
+// requestMissingCmd writes the follow-up prompt for a broken copy of a pack.
+// It prints nothing when the copy is complete.
+func requestMissingCmd(args []string) {
+	var o requestOptions
+	flg := requestFlags(&o)
+	parseFlags(flg, args)
+
+	m, err := readManifest(o.manifestPath)
+	if err != nil {
+		fatal(err)
+	}
+	data, err := readPackData(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	files, err := packFiles(bytes.NewReader(data), detectFormat(data[:min(len(data), sniffSize)]))
+	if err != nil {
+		fatal(err)
+	}
+	damaged := findDamage(files, m)
+	if len(damaged) == 0 {
+		fmt.Fprintf(os.Stderr, "All %d files of the manifest are complete\n", len(m.Files))
+		return
+	}
+	prompt := requestMissingPrompt(damaged, len(m.Files))
+	if o.out == "-" {
+		fmt.Print(prompt)
+	} else if err := os.WriteFile(o.out, []byte(prompt), 0o644); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "Requesting %d of %d files again\n", len(damaged), len(m.Files))
+}
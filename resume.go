@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// unpackStateName is the progress file unpack keeps in --dest until it finishes.
+const unpackStateName = ".packprompt-unpack.state"
+
+const unpackStateHeader = "packprompt-unpack-state v1"
+
+// syncEvery bounds how much progress an interrupted run can lose; files
+// recorded but not yet on disk are caught by the hash check on resume.
+const syncEvery = 64
+
+// unpackState records which entries of a pack have been extracted, with
+// the SHA-256 of what was written, so --resume can skip them.
+type unpackState struct {
+	path    string
+	f       *os.File
+	done    map[int]string // entry index -> content hash
+	pending int
+	swept   map[string]bool // directories cleared of orphaned temp files
+}
+
+// packIdentity names a pack file cheaply: hashing a multi-GB pack just to
+// resume would cost as much as the unpack itself. A pack from stdin has no
+// file to name, so it is named by its hash.
+func packIdentity(in string) (string, error) {
+	if in == "-" {
+		data, err := readPackData(in)
+		if err != nil {
+			return "", err
+		}
+		return "pack sha256 " + contentHash(data), nil
+	}
+	info, err := os.Stat(in)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(in)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pack %d %d %s", info.Size(), info.ModTime().UnixNano(), abs), nil
+}
+
+// openUnpackState starts progress tracking in dest. With resume, progress
+// of an earlier run over the same pack is loaded; otherwise any earlier
+// state is discarded.
+func openUnpackState(dest, in string, resume bool) (*unpackState, error) {
+	id, err := packIdentity(in)
+	if err != nil {
+		return nil, err
+	}
+	s := &unpackState{path: filepath.Join(dest, unpackStateName), done: map[int]string{}, swept: map[string]bool{}}
+	if data, err := os.ReadFile(s.path); err == nil {
+		prevID, done := parseUnpackState(string(data))
+		switch {
+		case !resume:
+			fmt.Fprintf(os.Stderr, "warning: an earlier unpack into %s was interrupted; starting over (use --resume to continue it)\n", dest)
+		case prevID != id:
+			fmt.Fprintf(os.Stderr, "warning: %s records progress for a different pack; starting over\n", s.path)
+		default:
+			s.done = done
+		}
+	} else if resume && os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "warning: nothing to resume in %s; unpacking everything\n", dest)
+	}
+
+	s.f, err = os.Create(s.path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(s.f)
+	fmt.Fprintf(w, "%s\n%s\n", unpackStateHeader, id)
+	for i, sum := range s.done {
+		fmt.Fprintf(w, "done %d %s\n", i, sum)
+	}
+	if err := w.Flush(); err != nil {
+		s.f.Close()
+		return nil, err
+	}
+	return s, s.f.Sync()
+}
+
+func parseUnpackState(data string) (id string, done map[int]string) {
+	done = map[int]string{}
+	lines := strings.Split(data, "\n")
+	if len(lines) < 2 || lines[0] != unpackStateHeader {
+		return "", done
+	}
+	for _, l := range lines[2:] {
+		f := strings.Fields(l)
+		// a torn last line from a crash is simply ignored
+		if len(f) != 3 || f[0] != "done" || len(f[2]) != sha256.Size*2 {
+			continue
+		}
+		if i, err := strconv.Atoi(f[1]); err == nil {
+			done[i] = f[2]
+		}
+	}
+	return lines[1], done
+}
+
+// completed reports whether entry i was extracted by an earlier run and
+// the file at full still holds exactly what was written.
+func (s *unpackState) completed(i int, full string) bool {
+	want, ok := s.done[i]
+	if !ok {
+		return false
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(h.Sum(nil)) == want
+}
+
+// sweep removes, the first time unpack writes into rel's directory under
+// dest, the temp files left there by writes of processes that no longer
+// exist, such as an unpack that crashed. Confined, the directory is read
+// without leaving dest.
+func (s *unpackState) sweep(dest, rel string, confine bool) {
+	dir := filepath.FromSlash(path.Dir(rel))
+	if s.swept[filepath.Join(dest, dir)] {
+		return
+	}
+	s.swept[filepath.Join(dest, dir)] = true
+	var entries []os.DirEntry
+	remove := func(name string) error { return os.Remove(filepath.Join(dest, dir, name)) }
+	if confine {
+		root, err := os.OpenRoot(dest)
+		if err != nil {
+			return
+		}
+		defer root.Close()
+		d, err := root.Open(dir)
+		if err != nil {
+			return
+		}
+		entries, _ = d.ReadDir(-1)
+		d.Close()
+		remove = func(name string) error { return root.Remove(filepath.Join(dir, name)) }
+	} else {
+		entries, _ = os.ReadDir(filepath.Join(dest, dir))
+	}
+	for _, e := range entries {
+		pid, ok := packprompt.TempOwner(e.Name())
+		if !ok || !e.Type().IsRegular() || pid == os.Getpid() || (pid > 0 && processAlive(pid)) {
+			continue
+		}
+		if remove(e.Name()) == nil {
+			fmt.Fprintf(os.Stderr, "warning: removed %s, left by an interrupted write\n", filepath.ToSlash(filepath.Join(dest, dir, e.Name())))
+		}
+	}
+}
+
+// record notes that entry i now holds content.
+func (s *unpackState) record(i int, content []byte) error {
+	sum := sha256.Sum256(content)
+	if _, err := fmt.Fprintf(s.f, "done %d %s\n", i, hex.EncodeToString(sum[:])); err != nil {
+		return err
+	}
+	if s.pending++; s.pending >= syncEvery {
+		s.pending = 0
+		return s.f.Sync()
+	}
+	return nil
+}
+
+// finish removes the state file after a complete run.
+func (s *unpackState) finish() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(s.path)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// unpackRoute is one --route PATTERN=DEST: entries matching pattern are
+// unpacked into dest, less the directories the pattern names before its
+// first wildcard, so "infra/**=../infra" writes infra/main.tf as
+// ../infra/main.tf, undoing pack --map ../infra=infra.
+type unpackRoute struct {
+	pattern, dest string
+	strip         string // "infra/"
+}
+
+// unpackRoutes are tried in order; the first match wins.
+type unpackRoutes []unpackRoute
+
+func parseRoute(spec string) (unpackRoute, error) {
+	pattern, dest, ok := strings.Cut(spec, "=")
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if !ok || pattern == "" || dest == "" {
+		return unpackRoute{}, fmt.Errorf("invalid --route %q: want PATTERN=DEST", spec)
+	}
+	r := unpackRoute{pattern: pattern, dest: dest}
+	parts := strings.Split(pattern, "/")
+	for _, p := range parts[:len(parts)-1] {
+		if strings.ContainsAny(p, "*?[\\") {
+			break
+		}
+		r.strip += p + "/"
+	}
+	return r, nil
+}
+
+// place finds where rel goes: the destination directory and its path in
+// it. With no routes everything goes to dest as it is; with routes, an
+// entry no route matches goes nowhere.
+func (rs unpackRoutes) place(dest, rel string) (string, string, bool) {
+	if len(rs) == 0 {
+		return dest, rel, true
+	}
+	for _, r := range rs {
+		if packprompt.Match(r.pattern, rel) {
+			return r.dest, strings.TrimPrefix(rel, r.strip), true
+		}
+	}
+	return "", "", false
+}
+
+// display names rel in the destination it was routed to, for messages.
+func (rs unpackRoutes) display(dest, rel string) string {
+	if len(rs) == 0 {
+		return rel
+	}
+	return filepath.ToSlash(filepath.Join(dest, filepath.FromSlash(rel)))
+}
+
+// dests lists the route destinations, each once, in order.
+func (rs unpackRoutes) dests() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, r := range rs {
+		if !seen[r.dest] {
+			seen[r.dest] = true
+			out = append(out, r.dest)
+		}
+	}
+	return out
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+type rpcServer struct {
+	root string
+	out  *bufio.Writer
+}
+
+// serveOptions holds serve's flags.
+type serveOptions struct {
+	root string
+}
+
+// serveFlags declares serve's flags into o.
+func serveFlags(o *serveOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("serve", flag.ExitOnError)
+	flg.StringVar(&o.root, "root", ".", "workspace root used when a request gives none")
+	return flg
+}
+
+// serveCmd speaks JSON-RPC 2.0 over stdin and stdout so an editor plugin
+// can keep one packprompt running instead of spawning it per action.
+// Messages are framed with LSP-style Content-Length headers or one per
+// line; each reply uses the framing of its request.
+func serveCmd(args []string) {
+	var o serveOptions
+	flg := serveFlags(&o)
+	parseFlags(flg, args)
+
+	s := &rpcServer{root: o.root, out: bufio.NewWriter(os.Stdout)}
+	r := bufio.NewReader(os.Stdin)
+	for {
+		body, framed, err := readRPCMessage(r)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			fatal(err)
+		}
+		if body == nil {
+			continue
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &rpcError{rpcParseError, err.Error()}, framed)
+			continue
+		}
+		if req.Method == "exit" {
+			return
+		}
+		result, rerr := s.call(req.Method, req.Params)
+		if req.ID == nil {
+			continue // a notification gets no reply
+		}
+		s.reply(req.ID, result, rerr, framed)
+	}
+}
+
+// readRPCMessage reads one message, reporting whether it came with
+// Content-Length framing. A blank line yields a nil body.
+func readRPCMessage(r *bufio.Reader) (body []byte, framed bool, err error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if strings.TrimSpace(line) == "" {
+		return nil, false, nil
+	}
+	if !strings.HasPrefix(strings.ToLower(line), "content-length:") {
+		return []byte(line), false, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+	if err != nil || n < 0 || n > maxRemoteBody {
+		return nil, true, fmt.Errorf("bad header %q", line)
+	}
+	for line != "" { // other headers, up to the blank line
+		if line, err = readLine(r); err != nil {
+			return nil, true, err
+		}
+	}
+	body = make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return body, true, err
+}
+
+func (s *rpcServer) reply(id json.RawMessage, result any, rerr *rpcError, framed bool) {
+	msg := map[string]any{"jsonrpc": "2.0", "id": id}
+	if id == nil {
+		msg["id"] = nil
+	}
+	if rerr != nil {
+		msg["error"] = rerr
+	} else {
+		msg["result"] = result
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(map[string]any{"jsonrpc": "2.0", "id": msg["id"], "error": rpcError{rpcServerError, err.Error()}})
+	}
+	if framed {
+		fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(data))
+		s.out.Write(data)
+	} else {
+		s.out.Write(append(data, '\n'))
+	}
+	s.out.Flush()
+}
+
+// packParams are the options shared by the pack methods.
+type packParams struct {
+	Root     string   `json:"root"`
+	Files    []string `json:"files"`
+	Name     string   `json:"name"`
+	Model    string   `json:"model"`
+	Contract bool     `json:"contract"`
+}
+
+type packResult struct {
+	Text    string   `json:"text"`
+	Files   []string `json:"files"`
+	Skipped []string `json:"skipped,omitempty"`
+	Tokens  int      `json:"tokens"`
+	Model   string   `json:"model"`
+}
+
+type symbolDef struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type applyParams struct {
+	Root           string `json:"root"`
+	Text           string `json:"text"`
+	Force          bool   `json:"force"`
+	AllowProtected bool   `json:"allowProtected"` // as apply --allow-protected
+}
+
+type applyResult struct {
+	Applied   bool     `json:"applied"`
+	Conflicts []string `json:"conflicts"`
+	applied
+}
+
+func (s *rpcServer) call(method string, raw json.RawMessage) (any, *rpcError) {
+	invalid := func(err error) *rpcError { return &rpcError{rpcInvalidParams, err.Error()} }
+	failed := func(err error) *rpcError { return &rpcError{rpcServerError, err.Error()} }
+	switch method {
+	case "initialize":
+		return map[string]any{"name": "packprompt", "version": toolVersion(),
+			"methods": []string{"packSelection", "packSymbol", "applyResponse", "shutdown", "exit"}}, nil
+	case "shutdown":
+		return nil, nil
+	case "packSelection":
+		var p packParams
+		if err := decodeParams(raw, &p); err != nil {
+			return nil, invalid(err)
+		}
+		if len(p.Files) == 0 {
+			return nil, invalid(errors.New("files is empty"))
+		}
+		res, err := s.packSelection(p)
+		if err != nil {
+			return nil, failed(err)
+		}
+		return res, nil
+	case "packSymbol":
+		var p packParams
+		if err := decodeParams(raw, &p); err != nil {
+			return nil, invalid(err)
+		}
+		if p.Name == "" {
+			return nil, invalid(errors.New("name is empty"))
+		}
+		res, defs, err := s.packSymbol(p)
+		if err != nil {
+			return nil, failed(err)
+		}
+		return struct {
+			packResult
+			Definitions []symbolDef `json:"definitions"`
+		}{res, defs}, nil
+	case "applyResponse":
+		var p applyParams
+		if err := decodeParams(raw, &p); err != nil {
+			return nil, invalid(err)
+		}
+		files, err := parseResponse(strings.NewReader(p.Text))
+		if err != nil {
+			return nil, failed(err)
+		}
+		if refused := protectedFiles(files); len(refused) > 0 && !p.AllowProtected {
+			return nil, failed(fmt.Errorf("nothing applied; refusing to write (set allowProtected): %s", strings.Join(refused, "; ")))
+		}
+		root := s.rootFor(p.Root)
+		conflicts, err := responseConflicts(root, files)
+		if err != nil {
+			return nil, failed(err)
+		}
+		res := applyResult{Conflicts: append([]string{}, conflicts...),
+			applied: applied{Changed: []string{}, Added: []string{}, Deleted: []string{}, Notes: []string{}, Rejected: []string{}}}
+		if len(conflicts) > 0 && !p.Force {
+			return res, nil
+		}
+		if res.applied, err = applyResponse(root, files, defaultFuzz); err != nil {
+			return nil, failed(err)
+		}
+		res.Applied = true
+		return res, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, "unknown method " + method}
+}
+
+func decodeParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return errors.New("missing params")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func (s *rpcServer) rootFor(root string) string {
+	if root == "" {
+		return s.root
+	}
+	return root
+}
+
+// walk collects the packable files of root as pack would by default.
+func (s *rpcServer) walk(root string) ([]entry, error) {
+	return collectEntries(root, defaultExcludes, walkOptions{}, &omissions{})
+}
+
+func (s *rpcServer) packSelection(p packParams) (packResult, error) {
+	root := s.rootFor(p.Root)
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return packResult{}, err
+	}
+	listed := map[string]bool{}
+	for _, f := range p.Files {
+		if rel, ok := relToRoot(f, absRoot); ok {
+			listed[rel] = true
+		}
+	}
+	var entries []entry
+	if isZipRoot(root) {
+		all, err := s.walk(root)
+		if err != nil {
+			return packResult{}, err
+		}
+		entries = filterEntries(all, nil, "", func(e entry) bool { return listed[e.rel] })
+	} else {
+		entries = listedEntries(root, slices.Collect(maps.Keys(listed)))
+	}
+	res, err := renderForEditor(entries, p)
+	for _, e := range entries {
+		delete(listed, e.rel)
+	}
+	for rel := range listed {
+		res.Skipped = append(res.Skipped, rel)
+	}
+	sort.Strings(res.Skipped)
+	return res, err
+}
+
+// listedEntries stats and classifies just the files rels under root, as
+// the default walk would, in walk order: an editor asking for a few files
+// should not cost a walk of the tree. Those the walk would leave out are
+// not returned.
+func listedEntries(root string, rels []string) []entry {
+	slices.SortFunc(rels, func(a, b string) int {
+		return slices.Compare(strings.Split(a, "/"), strings.Split(b, "/"))
+	})
+	var entries []entry
+	for _, rel := range rels {
+		if e, ok := listedEntry(root, rel); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func listedEntry(root, rel string) (entry, bool) {
+	if strings.HasSuffix(rel, tmpSuffix) || packprompt.IsTemp(rel) {
+		return entry{}, false
+	}
+	// the walk would stop at an excluded or linked directory on the way
+	parts := strings.Split(rel, "/")
+	var info iofs.FileInfo
+	for i := range parts {
+		sub := strings.Join(parts[:i+1], "/")
+		if _, excluded := packprompt.MatchExclude(sub, defaultExcludes); excluded || sub == sessionDir {
+			return entry{}, false
+		}
+		p := filepath.Join(root, filepath.FromSlash(sub))
+		var err error
+		if info, err = os.Lstat(p); err != nil || linkKind(p, iofs.FileInfoToDirEntry(info)) != "" {
+			return entry{}, false
+		}
+	}
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if !info.Mode().IsRegular() {
+		return entry{}, false
+	}
+	head, err := sniffFile(p)
+	if err != nil || packprompt.IsPackOutput(head) || packprompt.IsBinary(head) {
+		return entry{}, false
+	}
+	return entry{rel: rel, src: p, mode: info.Mode().Perm(), size: info.Size(), modTime: info.ModTime()}, true
+}
+
+// maxSymbolFiles bounds how many defining files packSymbol returns.
+const maxSymbolFiles = 50
+
+func (s *rpcServer) packSymbol(p packParams) (packResult, []symbolDef, error) {
+	all, err := s.walk(s.rootFor(p.Root))
+	if err != nil {
+		return packResult{}, nil, err
+	}
+	def := regexp.MustCompile(`^\s*(?:export\s+)?(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:func|type|class|def|interface|struct|enum|trait|fn|const|let|var|module|record|object)\s+(?:\([^)]*\)\s*)?` +
+		regexp.QuoteMeta(p.Name) + `\b`)
+	defs := []symbolDef{}
+	var entries []entry
+	for _, e := range all {
+		data, err := readEntry(e)
+		if err != nil {
+			continue
+		}
+		found := false
+		for i, l := range strings.Split(string(data), "\n") {
+			if def.MatchString(l) {
+				defs = append(defs, symbolDef{Path: e.rel, Line: i + 1, Text: strings.TrimSpace(l)})
+				found = true
+			}
+		}
+		if found {
+			if entries = append(entries, e); len(entries) == maxSymbolFiles {
+				break
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return packResult{}, nil, fmt.Errorf("no definition of %s found", p.Name)
+	}
+	res, err := renderForEditor(entries, p)
+	return res, defs, err
+}
+
+// renderForEditor packs entries in memory.
+func renderForEditor(entries []entry, p packParams) (packResult, error) {
+	model := p.Model
+	if model == "" {
+		model = "gpt-4o"
+	}
+	est, err := lookupEstimator(model)
+	if err != nil {
+		return packResult{}, err
+	}
+	if entries, err = hashEntries(entries, nil); err != nil {
+		return packResult{}, err
+	}
+	pw := packWriter{contract: p.Contract}
+	var b bytes.Buffer
+	if err := pw.render(&b, entries); err != nil {
+		return packResult{}, err
+	}
+	res := packResult{Text: b.String(), Files: []string{}, Tokens: est.count(b.String()), Model: est.name}
+	for _, e := range entries {
+		res.Files = append(res.Files, e.rel)
+	}
+	return res, nil
+}
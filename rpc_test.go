@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestApplyResponseProtected checks the RPC apply refuses a protected path
+// as apply does, unless allowProtected is set.
+func TestApplyResponseProtected(t *testing.T) {
+	text := "--- FILE path=.git/hooks/pre-commit mode=0755 base=new ---\n#!/bin/sh\necho owned\n--- END FILE ---\n"
+	for _, allow := range []bool{false, true} {
+		root := t.TempDir()
+		s := &rpcServer{root: root}
+		raw, err := json.Marshal(applyParams{Text: text, AllowProtected: allow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rpcErr := s.call("applyResponse", raw)
+		_, statErr := os.Stat(filepath.Join(root, ".git", "hooks", "pre-commit"))
+		switch {
+		case !allow && (rpcErr == nil || !strings.Contains(rpcErr.Message, "protected path")):
+			t.Errorf("allowProtected=false: want a protected path error, got %v", rpcErr)
+		case !allow && statErr == nil:
+			t.Error("allowProtected=false: the hook was written")
+		case allow && rpcErr != nil:
+			t.Errorf("allowProtected=true: %v", rpcErr.Message)
+		case allow && statErr != nil:
+			t.Errorf("allowProtected=true: %v", statErr)
+		}
+	}
+}
+
+// TestPackSelection checks packSelection packs the listed files the walk
+// would pack, in walk order, and skips the rest.
+func TestPackSelection(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a.txt": "alpha\n", "a/b.go": "package a\n", ".git/config": "[core]\n", "img.bin": "\x00\x01", "c.txt": "gamma\n",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(root, "link.txt")); err != nil {
+		t.Skip(err)
+	}
+	s := &rpcServer{root: root}
+	res, err := s.packSelection(packParams{Files: []string{"a.txt", filepath.Join(root, "a", "b.go"), ".git/config", "img.bin", "link.txt", "missing.txt", "../out.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(res.Files, " "); got != "a/b.go a.txt" {
+		t.Errorf("files: %s", got)
+	}
+	if got := strings.Join(res.Skipped, " "); got != ".git/config img.bin link.txt missing.txt" {
+		t.Errorf("skipped: %s", got)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// Formats of pack and unpack --scan-report.
+const (
+	reportSARIF  = "sarif"  // SARIF 2.1.0, for code-scanning uploads
+	reportGitHub = "github" // GitHub Actions workflow commands, shown as annotations
+)
+
+// scanFinding is one problem pack's or unpack's checks found in an entry.
+type scanFinding struct {
+	rule    string // "protected-path", "policy", "size", "secret/KIND" or "pii/KIND"
+	title   string // what the rule finds, e.g. "AWS access key"
+	level   string // "error" refuses the unpack, "warning" does not
+	path    string // as unpacked
+	line    int    // 0 for the whole file
+	message string
+}
+
+// String is the finding as checkUnpack reports it.
+func (f scanFinding) String() string {
+	if f.line > 0 {
+		return fmt.Sprintf("%s: line %d: %s", f.path, f.line, f.message)
+	}
+	return fmt.Sprintf("%s: %s", f.path, f.message)
+}
+
+// secretScanFinding is a secret found by --scan as a finding.
+func secretScanFinding(path string, s secretFinding, level string) scanFinding {
+	rule := "secret/"
+	if s.pii {
+		rule = "pii/"
+	}
+	rule += strings.ReplaceAll(strings.ToLower(s.kind), " ", "-")
+	return scanFinding{rule: rule, title: s.kind, level: level, path: path, line: s.line, message: fmt.Sprintf("%s (%s)", s.kind, s.masked())}
+}
+
+// checkPack scans what pack selected before anything is written: with
+// o.scan, each file for secrets, and the files --max-file-size left out or
+// cut. The findings go to o.scanReport; scanning with "fail", a secret
+// fails the pack.
+func checkPack(entries []entry, om *omissions, o *packOptions) error {
+	level := "warning"
+	if o.scan == "fail" {
+		level = "error"
+	}
+	var findings []scanFinding
+	for _, e := range entries {
+		// encrypted entries leave sealed, and encoded ones are binary
+		if o.scan == "" || e.cipher != nil || isEncoded(e) {
+			continue
+		}
+		f, err := e.open()
+		if err != nil {
+			continue // left out when written, as it vanished
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, s := range findSecrets(content) {
+			findings = append(findings, secretScanFinding(e.rel, s, level))
+		}
+	}
+	if o.maxFileSize != "" {
+		for _, m := range om.list {
+			if strings.HasSuffix(m.Reason, maxFileSizeReason(o.maxFileSize)) {
+				findings = append(findings, scanFinding{rule: "size", title: "file over --max-file-size", level: "warning", path: m.Path,
+					message: fmt.Sprintf("%s, %s", packprompt.HumanSize(m.Size), m.Reason)})
+			}
+		}
+	}
+	if o.scanReport != "" {
+		if err := writeScanReport(o.scanReport, o.scanReportFormat, findings); err != nil {
+			return err
+		}
+	}
+	var problems []string
+	for _, f := range findings {
+		if f.level == "error" {
+			problems = append(problems, f.String())
+		} else if f.rule != "size" {
+			// the omitted section lists the size findings
+			fmt.Fprintf(os.Stderr, "warning: %s\n", f)
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("nothing packed; refusing to pack:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func checkReportFormat(format string) error {
+	if format != reportSARIF && format != reportGitHub {
+		return fmt.Errorf("invalid --scan-report-format %q: want sarif or github", format)
+	}
+	return nil
+}
+
+// writeScanReport writes the findings to dest ("-" for stdout) in format.
+// With none, a SARIF report still records the clean run.
+func writeScanReport(dest, format string, findings []scanFinding) error {
+	write := writeSARIF
+	if format == reportGitHub {
+		write = writeAnnotations
+	}
+	if dest == "-" {
+		return write(os.Stdout, findings)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := write(f, findings); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SARIF 2.1.0, as much of it as code-scanning reads.
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysical `json:"physicalLocation"`
+	}
+	sarifPhysical struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           *sarifRegion  `json:"region,omitempty"`
+	}
+	sarifArtifact struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine int `json:"startLine"`
+	}
+)
+
+func writeSARIF(w io.Writer, findings []scanFinding) error {
+	driver := sarifDriver{Name: "packprompt", Version: toolVersion(), InformationURI: "https://github.com/reaandrew/packprompt", Rules: []sarifRule{}}
+	titles := map[string]string{}
+	results := []sarifResult{}
+	for _, f := range findings {
+		titles[f.rule] = f.title
+		loc := sarifLocation{PhysicalLocation: sarifPhysical{ArtifactLocation: sarifArtifact{URI: f.path}}}
+		if f.line > 0 {
+			loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.line}
+		}
+		results = append(results, sarifResult{RuleID: f.rule, Level: f.level, Message: sarifMessage{Text: f.message}, Locations: []sarifLocation{loc}})
+	}
+	for id, title := range titles {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: title}})
+	}
+	sort.Slice(driver.Rules, func(i, j int) bool { return driver.Rules[i].ID < driver.Rules[j].ID })
+	log := sarifLog{Version: "2.1.0", Schema: "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}}}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// writeAnnotations writes a workflow command per finding, which GitHub
+// Actions shows against the file and line.
+func writeAnnotations(w io.Writer, findings []scanFinding) error {
+	prop := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	data := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	for _, f := range findings {
+		where := "file=" + prop.Replace(f.path)
+		if f.line > 0 {
+			where += fmt.Sprintf(",line=%d", f.line)
+		}
+		if _, err := fmt.Fprintf(w, "::%s %s,title=%s::%s\n", f.level, where, prop.Replace("packprompt: "+f.title), data.Replace(f.message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPackScanReport checks pack --scan-report records the secrets --scan
+// finds and the files --max-file-size leaves out, and --scan fail writes
+// no pack.
+func TestPackScanReport(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"a.txt":   "token = ghp_" + strings.Repeat("a1B2", 9) + "\n",
+		"big.txt": strings.Repeat("x", 2048) + "\n",
+		"ok.txt":  "fine\n",
+	})
+	dir := t.TempDir()
+	out, report := filepath.Join(dir, "pack.txt"), filepath.Join(dir, "scan.sarif")
+	res := runCLI(t, src, "pack", "--out", out, "--scan", "warn", "--max-file-size", "1KB", "--scan-report", report)
+	if res.code != 0 || !strings.Contains(res.stderr, "a.txt: line 1: GitHub token") {
+		t.Fatalf("pack --scan warn: exit %d: %s", res.code, res.stderr)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range log.Runs[0].Results {
+		got = append(got, r.RuleID+" "+r.Level+" "+r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+	if want := []string{"secret/github-token warning a.txt", "size warning big.txt"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("report results:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	out = filepath.Join(dir, "refused.txt")
+	res = runCLI(t, src, "pack", "--out", out, "--scan", "fail", "--scan-report", "-", "--scan-report-format", reportGitHub)
+	if res.code != 1 || !strings.Contains(res.stdout, "::error file=a.txt,line=1,") || !strings.Contains(res.stderr, "nothing packed") {
+		t.Errorf("pack --scan fail: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Errorf("pack --scan fail wrote the pack")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// secretRule finds one kind of credential or personal data in file content.
+type secretRule struct {
+	kind string
+	re   *regexp.Regexp
+	// valid, when set, confirms a match of the group at index group (0 for
+	// the whole match), weeding out look-alikes
+	group int
+	valid func(string) bool
+	pii   bool // personal data rather than a credential
+}
+
+var secretRules = []secretRule{
+	{kind: "private key", re: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{kind: "AWS access key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "AWS secret key", re: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`), group: 1},
+	{kind: "GitHub token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})\b`)},
+	{kind: "GitLab token", re: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{kind: "Slack token", re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{kind: "Google API key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{kind: "Stripe key", re: regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{20,}\b`)},
+	{kind: "OpenAI or Anthropic key", re: regexp.MustCompile(`\bsk-(?:proj-|ant-[a-z0-9]+-)?[A-Za-z0-9_-]{32,}`)},
+	{kind: "JSON web token", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{kind: "password in URL", re: regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^/\s:@"']+:([^/\s:@"']{3,})@`), group: 1, valid: notPlaceholder},
+	{kind: "hard-coded secret", re: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret)["']?\s*[:=]\s*["']([^"'\s]{8,})["']`), group: 1, valid: notPlaceholder},
+	{kind: "credit card number", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: cardNumber, pii: true},
+	{kind: "US social security number", re: regexp.MustCompile(`\b(?:00[1-9]|0[1-9]\d|[1-578]\d\d|6[0-57-9]\d|66[0-57-9])-(?:0[1-9]|[1-9]\d)-(?:000[1-9]|00[1-9]\d|0[1-9]\d\d|[1-9]\d{3})\b`), pii: true},
+}
+
+// secretFinding is a match of a secret rule.
+type secretFinding struct {
+	line  int
+	kind  string
+	match string
+	pii   bool
+}
+
+// findSecrets returns the secrets in content, at most one per line and
+// rule; a secret a more specific rule found first is not reported again.
+func findSecrets(content []byte) []secretFinding {
+	var out []secretFinding
+	for n, line := range bytes.Split(content, []byte("\n")) {
+		first := len(out)
+	rules:
+		for _, r := range secretRules {
+			for _, m := range r.re.FindAllSubmatchIndex(line, -1) {
+				s := string(line[m[2*r.group]:m[2*r.group+1]])
+				if r.valid != nil && !r.valid(s) {
+					continue
+				}
+				for _, f := range out[first:] {
+					if strings.Contains(f.match, s) || strings.Contains(s, f.match) {
+						continue rules
+					}
+				}
+				out = append(out, secretFinding{line: n + 1, kind: r.kind, match: s, pii: r.pii})
+				break
+			}
+		}
+	}
+	return out
+}
+
+// masked shows enough of a secret to find it again, not to use it.
+func (f secretFinding) masked() string {
+	keep := min(4, len(f.match)/4)
+	return f.match[:keep] + strings.Repeat("*", min(len(f.match)-keep, 8))
+}
+
+func (f secretFinding) String() string {
+	return fmt.Sprintf("line %d: %s (%s)", f.line, f.kind, f.masked())
+}
+
+// notPlaceholder rejects values that only stand in for a secret:
+// templates, environment lookups and the usual dummies.
+func notPlaceholder(v string) bool {
+	l := strings.ToLower(v)
+	for _, p := range []string{"${", "{{", "<", "%s", "process.env", "os.getenv", "example", "changeme", "change-me", "placeholder", "dummy", "password", "secret", "your", "xxxx", "****", "...."} {
+		if strings.Contains(l, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// cardNumber reports whether s is a plausible payment card number: the
+// length and leading digits of a major network, and a valid Luhn checksum.
+func cardNumber(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	network := false
+	for _, p := range []string{"4", "51", "52", "53", "54", "55", "22", "23", "24", "25", "26", "27", "34", "37", "6011", "65"} {
+		if strings.HasPrefix(digits, p) {
+			network = true
+		}
+	}
+	if !network {
+		return false
+	}
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
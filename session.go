@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// A session lives in .packprompt at the root of the tree: session.json, and
+// the packs and responses of each round beside it.
+const (
+	sessionDir  = packprompt.SessionDir
+	sessionFile = "session.json"
+)
+
+// sessionSubcommands lists session's subcommands for completion.
+var sessionSubcommands = [][2]string{
+	{"start", "start a session at the root of a tree"},
+	{"pack", "pack the tree as the session's next round"},
+	{"apply", "apply a response, merging with what the session applied before"},
+	{"status", "show the rounds so far and what changed since the last pack"},
+}
+
+// session is a conversation's worth of packing and applying, so that each
+// apply knows every version of a file the model has been shown.
+type session struct {
+	Name    string         `json:"name"`
+	Started time.Time      `json:"started"`
+	Rounds  []sessionRound `json:"rounds"`
+
+	root string
+}
+
+// sessionRound is one pack and the responses applied after it.
+type sessionRound struct {
+	Pack    string            `json:"pack"` // relative to the root, in .packprompt
+	SHA256  string            `json:"sha256"`
+	Packed  time.Time         `json:"packed"`
+	Bytes   int64             `json:"bytes,omitempty"` // size of the pack, for report once it is gone
+	Files   map[string]string `json:"files"`           // sha256 of each file as packed: the bases a response names
+	Applied []sessionApply    `json:"applied,omitempty"`
+}
+
+// sessionApply is one response applied, with the sha256 of each file it
+// left, so status can tell its changes from local edits.
+type sessionApply struct {
+	Response string            `json:"response"` // as given
+	Copy     string            `json:"copy"`     // kept in .packprompt, relative to the root
+	SHA256   string            `json:"sha256"`
+	Applied  time.Time         `json:"applied"`
+	Added    []string          `json:"added"`
+	Changed  []string          `json:"changed"`
+	Deleted  []string          `json:"deleted"`
+	Files    map[string]string `json:"files"`
+}
+
+// sessionStartOptions holds the flags of session start.
+type sessionStartOptions struct {
+	root, name string
+	force      bool
+}
+
+// sessionStartFlags declares the flags of session start into o.
+func sessionStartFlags(o *sessionStartOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("session", flag.ExitOnError)
+	flg.StringVar(&o.root, "root", ".", "root of the tree the session works on")
+	flg.StringVar(&o.name, "name", "", "name of the session (default: the root's directory name)")
+	flg.BoolVar(&o.force, "force", false, "replace a session already started there")
+	return flg
+}
+
+// sessionCmd runs the session subcommands.
+func sessionCmd(args []string) {
+	sub := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+	switch sub {
+	case "start":
+		var o sessionStartOptions
+		parseFlags(sessionStartFlags(&o), args)
+		if err := startSession(o.root, o.name, o.force); err != nil {
+			fatal(err)
+		}
+	case "pack":
+		sessionPack(args)
+	case "apply":
+		sessionApplyCmd(args)
+	case "status":
+		parseFlags(flag.NewFlagSet("session", flag.ExitOnError), args)
+		s, err := findSession(".")
+		if err != nil {
+			fatal(err)
+		}
+		if err := s.status(os.Stdout); err != nil {
+			fatal(err)
+		}
+	default:
+		fatal(errors.New("usage: packprompt session start|pack|apply|status [flags]"))
+	}
+}
+
+// startSession creates the session at root.
+func startSession(root, name string, force bool) error {
+	path := filepath.Join(root, sessionDir, sessionFile)
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("a session is already started in %s (--force replaces it)", root)
+	}
+	if name == "" {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		name = filepath.Base(abs)
+	}
+	s := &session{Name: name, Started: time.Now().UTC(), Rounds: []sessionRound{}, root: root}
+	if err := s.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Started session %s in %s\n", name, filepath.Join(root, sessionDir))
+	return nil
+}
+
+// findSession loads the session of the tree dir is in, looking up from dir
+// like git does for .git.
+func findSession(dir string) (*session, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d := abs; ; {
+		data, err := os.ReadFile(filepath.Join(d, sessionDir, sessionFile))
+		if err == nil {
+			s := &session{root: d}
+			if err := json.Unmarshal(data, s); err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Join(d, sessionDir, sessionFile), err)
+			}
+			return s, nil
+		}
+		if !errors.Is(err, iofs.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return nil, fmt.Errorf("no session in %s or above; start one with packprompt session start", abs)
+		}
+		d = parent
+	}
+}
+
+func (s *session) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.root, sessionDir, sessionFile), append(data, '\n'), 0o644)
+}
+
+// path is rel, relative to the root, on disk.
+func (s *session) path(rel string) string {
+	return filepath.Join(s.root, filepath.FromSlash(rel))
+}
+
+// refuseFlags fails when args set one of the flags a session command sets
+// itself.
+func refuseFlags(cmd string, args []string, names ...string) {
+	for _, n := range names {
+		if _, ok := flagArg(args, n); ok {
+			fatal(fmt.Errorf("session %s sets --%s itself", cmd, n))
+		}
+	}
+}
+
+// flagArg finds the last value args give flag name, as -name or --name,
+// with =VALUE or VALUE following.
+func flagArg(args []string, name string) (string, bool) {
+	val, found := "", false
+	for i := 0; i < len(args); i++ {
+		n, v, hasVal := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || n != name {
+			continue
+		}
+		if !hasVal && i+1 < len(args) {
+			i++
+			v = args[i]
+		}
+		val, found = v, true
+	}
+	return val, found
+}
+
+// boolFlagArg reports whether args turn boolean flag name on, as -name,
+// --name or --name=BOOL; the last use wins.
+func boolFlagArg(args []string, name string) bool {
+	on := false
+	for _, a := range args {
+		n, v, hasVal := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !strings.HasPrefix(a, "-") || n != name {
+			continue
+		}
+		on = true
+		if hasVal {
+			on, _ = strconv.ParseBool(v)
+		}
+	}
+	return on
+}
+
+// sessionPack packs the session's tree with --contract, taking any other
+// pack flags, into the next round's pack, and records the sha256 of every
+// file packed. With --dry-run it only lists what the round would pack.
+func sessionPack(args []string) {
+	refuseFlags("pack", args, "root", "out", "split-by", "split-tokens")
+	s, err := findSession(".")
+	if err != nil {
+		fatal(err)
+	}
+	rel := fmt.Sprintf("%s/round-%d.txt", sessionDir, len(s.Rounds)+1)
+	args = append(args, "--root", s.root, "--out", s.path(rel), "--contract")
+	if boolFlagArg(args, "dry-run") {
+		packCmd(args)
+		return
+	}
+	// a dry run set in the environment or config would leave no pack to record
+	partial := packCmd(append(args, "--dry-run=false"))
+
+	data, err := os.ReadFile(s.path(rel))
+	if err != nil {
+		fatal(err)
+	}
+	round := sessionRound{Pack: rel, SHA256: contentHash(data), Packed: time.Now().UTC(), Bytes: int64(len(data)), Files: map[string]string{}}
+	f, err := os.Open(s.path(rel))
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+	err = readPack(f, func(pf packedFile) error {
+		if want, ok := pf.attrs[sha256Attr]; ok && answerable(pf) {
+			round.Files[pf.rel] = want
+		}
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+	s.Rounds = append(s.Rounds, round)
+	if err := s.save(); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Session %s: round %d packed into %s (%s)\n", s.Name, len(s.Rounds), s.path(rel), plural(len(round.Files), "file"))
+	if partial {
+		os.Exit(exitPartial)
+	}
+}
+
+// answerable reports whether pf is the file itself, which a response may
+// change, rather than an attachment or a view derived from it.
+func answerable(pf packedFile) bool {
+	if pf.attachment || strings.Contains(pf.rel, archiveSep) {
+		return false
+	}
+	for _, k := range []string{convertedAttr, transformedAttr, truncatedAttr, packprompt.ChunkAttr} {
+		if _, ok := pf.attrs[k]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionApplyCmd applies a response to the session's tree, taking any
+// other apply flags. Every round's pack is handed to apply for merging and
+// a file changed since it was packed is merged by default, so a response
+// that builds on an earlier one, or answers an earlier round, still applies.
+// A copy of the response is kept, and a response applied before is refused.
+func sessionApplyCmd(args []string) {
+	refuseFlags("apply", args, "root")
+	s, err := findSession(".")
+	if err != nil {
+		fatal(err)
+	}
+	if len(s.Rounds) == 0 {
+		fatal(errors.New("nothing packed in this session yet; run packprompt session pack first"))
+	}
+	in, _ := flagArg(args, "in")
+	if in == "" {
+		in = "-"
+	}
+	var r io.Reader = os.Stdin
+	if in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		fatal(err)
+	}
+	if in == "-" {
+		in = "stdin"
+	}
+	sum := contentHash(data)
+	applied := 0
+	for n, round := range s.Rounds {
+		for _, a := range round.Applied {
+			if a.SHA256 == sum {
+				fatal(fmt.Errorf("%s was already applied in round %d (%s)", in, n+1, a.Applied.Local().Format("2006-01-02 15:04")))
+			}
+		}
+		applied += len(round.Applied)
+	}
+	last := &s.Rounds[len(s.Rounds)-1]
+	copyRel := fmt.Sprintf("%s/response-%d.txt", sessionDir, applied+1)
+	if err := writeFileAtomic(s.path(copyRel), data, 0o644); err != nil {
+		fatal(err)
+	}
+
+	own := []string{"--on-stale", staleMerge}
+	for _, round := range s.Rounds {
+		own = append(own, "--pack", s.path(round.Pack))
+	}
+	rec := applyCmd(append(append(own, args...), "--root", s.root, "--in", s.path(copyRel)))
+	if rec == nil {
+		os.Remove(s.path(copyRel)) // --check: nothing applied
+		return
+	}
+	a := sessionApply{
+		Response: in, Copy: copyRel, SHA256: sum, Applied: time.Now().UTC(),
+		Added: rec.Added, Changed: rec.Changed, Deleted: rec.Deleted, Files: map[string]string{},
+	}
+	for _, rel := range append(append([]string{}, rec.Added...), rec.Changed...) {
+		data, err := os.ReadFile(s.path(rel))
+		if err != nil {
+			fatal(err)
+		}
+		a.Files[rel] = contentHash(data)
+	}
+	last.Applied = append(last.Applied, a)
+	if err := s.save(); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Session %s: recorded response %d in round %d\n", s.Name, applied+1, len(s.Rounds))
+}
+
+// status writes the session's rounds and how the files of the last pack
+// stand now: changed by a response applied since, changed locally, or gone.
+func (s *session) status(w io.Writer) error {
+	fmt.Fprintf(w, "Session %s in %s, started %s\n", s.Name, s.root, s.Started.Local().Format("2006-01-02 15:04"))
+	if len(s.Rounds) == 0 {
+		_, err := fmt.Fprintln(w, "Nothing packed yet; run packprompt session pack")
+		return err
+	}
+	for n, round := range s.Rounds {
+		fmt.Fprintf(w, "Round %d: %s, %s, packed %s\n", n+1, round.Pack, plural(len(round.Files), "file"), round.Packed.Local().Format("2006-01-02 15:04"))
+		for _, a := range round.Applied {
+			fmt.Fprintf(w, "  applied %s: %d changed, %d added, %d deleted\n", a.Response, len(a.Changed), len(a.Added), len(a.Deleted))
+		}
+	}
+
+	last := s.Rounds[len(s.Rounds)-1]
+	byResponse := map[string]string{} // the sha256 the last response to write each file left
+	for _, a := range last.Applied {
+		for rel, h := range a.Files {
+			byResponse[rel] = h
+		}
+		for _, rel := range a.Deleted {
+			byResponse[rel] = ""
+		}
+	}
+	seen := map[string]bool{}
+	var paths []string
+	for _, set := range []map[string]string{last.Files, byResponse} {
+		for rel := range set {
+			if !seen[rel] {
+				seen[rel] = true
+				paths = append(paths, rel)
+			}
+		}
+	}
+	sort.Strings(paths)
+	var lines []string
+	for _, rel := range paths {
+		data, err := os.ReadFile(s.path(rel))
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			return err
+		}
+		cur := ""
+		if err == nil {
+			cur = contentHash(data)
+		}
+		packed, wasPacked := last.Files[rel]
+		if cur == packed && wasPacked {
+			continue
+		}
+		status := "M"
+		switch {
+		case cur == "" && !wasPacked:
+			continue // added by a response, then deleted again
+		case cur == "":
+			status = "D"
+		case !wasPacked:
+			status = "A"
+		}
+		by := "locally"
+		if h, ok := byResponse[rel]; ok && h == cur {
+			by = "by a response"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s (%s)", status, rel, by))
+	}
+	if len(lines) == 0 {
+		_, err := fmt.Fprintf(w, "No changes since round %d\n", len(s.Rounds))
+		return err
+	}
+	fmt.Fprintf(w, "Since round %d:\n", len(s.Rounds))
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSessionPackDryRun checks session pack --dry-run lists the round's
+// paths and records no round, and that a dry run from the environment
+// does not stop a real one.
+func TestSessionPackDryRun(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n"})
+	if res := runCLI(t, src, "session", "start"); res.code != 0 {
+		t.Fatalf("session start: exit %d: %s", res.code, res.stderr)
+	}
+	res := runCLI(t, src, "session", "pack", "--dry-run")
+	if res.code != 0 || strings.TrimSpace(res.stdout) != "a.txt" {
+		t.Errorf("session pack --dry-run: exit %d: %q%s", res.code, res.stdout, res.stderr)
+	}
+	round := filepath.Join(src, sessionDir, "round-1.txt")
+	if _, err := os.Stat(round); err == nil {
+		t.Errorf("session pack --dry-run wrote %s", round)
+	}
+	if res := runCLI(t, src, "session", "status"); !strings.Contains(res.stdout, "Nothing packed yet") {
+		t.Errorf("session status after a dry run: %s", res.stdout)
+	}
+
+	res = runCLIEnv(t, src, []string{"PACKPROMPT_PACK_DRY_RUN=true"}, "session", "pack")
+	if res.code != 0 || !strings.Contains(res.stdout, "round 1 packed") {
+		t.Errorf("session pack: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+	if _, err := os.Stat(round); err != nil {
+		t.Errorf("session pack: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+const (
+	treeMark    = packprompt.TreeMark
+	treeEndMark = "--- END TREE ---"
+)
+
+// rootGroup names the split part holding files at the top of the tree.
+const rootGroup = "_root"
+
+type packPart struct {
+	name    string
+	entries []entry
+}
+
+// splitEntries groups entries for --split-by, keeping entry order within each
+// part and ordering parts by name.
+func splitEntries(entries []entry, by string) ([]packPart, error) {
+	var key func(entry) string
+	switch by {
+	case "dir":
+		key = func(e entry) string {
+			if top, _, ok := strings.Cut(e.rel, "/"); ok {
+				return top
+			}
+			return rootGroup
+		}
+	case "lang":
+		key = func(e entry) string {
+			if l := detectLanguage(e.rel); l != "" {
+				return l
+			}
+			return "other"
+		}
+	default:
+		return nil, fmt.Errorf("invalid --split-by %q: want dir or lang", by)
+	}
+	groups := map[string][]entry{}
+	for _, e := range entries {
+		k := key(e)
+		groups[k] = append(groups[k], e)
+	}
+	var parts []packPart
+	for name, es := range groups {
+		parts = append(parts, packPart{name: name, entries: es})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].name < parts[j].name })
+	return parts, nil
+}
+
+// splitPath derives a part's file name from --out: files-prompt.txt -> files-prompt.cmd.txt.
+func splitPath(out, name string) string {
+	ext := filepath.Ext(out)
+	safe := unsafeNameRe.ReplaceAllString(name, "_")
+	return strings.TrimSuffix(out, ext) + "." + safe + ext
+}
+
+// renderTree draws the selected paths as an indented tree section.
+func renderTree(entries []entry) string {
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		paths = append(paths, e.rel)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	b.WriteString(treeMark + "\n")
+	var prev []string
+	for _, p := range paths {
+		parts := strings.Split(p, "/")
+		// skip directory levels already printed for the previous path
+		common := 0
+		for common < len(parts)-1 && common < len(prev)-1 && parts[common] == prev[common] {
+			common++
+		}
+		for i := common; i < len(parts); i++ {
+			b.WriteString(strings.Repeat("  ", i))
+			b.WriteString(parts[i])
+			if i < len(parts)-1 {
+				b.WriteString("/")
+			}
+			b.WriteString("\n")
+		}
+		prev = parts
+	}
+	b.WriteString(treeEndMark + "\n")
+	return b.String()
+}
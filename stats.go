@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type statRow struct {
+	name                string
+	files, lines, bytes int
+	tokens              int
+}
+
+// statsOptions holds the flags of stats.
+type statsOptions struct {
+	in    string
+	by    string
+	model string
+	plain bool
+}
+
+// statsFlags declares the flags of stats into o.
+func statsFlags(o *statsOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("stats", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file")
+	flg.StringVar(&o.by, "by", "lang", "group files by lang (detected language) or dir (top-level directory)")
+	flg.StringVar(&o.model, "model", "gpt-4o", "tokenizer family for the token column: gpt-4o, gpt-4, claude, llama or generic")
+	flg.BoolVar(&o.plain, "plain", false, "no colors and no pager")
+	return flg
+}
+
+func statsCmd(args []string) {
+	var o statsOptions
+	flg := statsFlags(&o)
+	parseFlags(flg, args)
+
+	if o.by != "lang" && o.by != "dir" {
+		fatal(fmt.Errorf("invalid --by %q: want lang or dir", o.by))
+	}
+	est, err := lookupEstimator(o.model)
+	if err != nil {
+		fatal(err)
+	}
+	f, err := os.Open(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	defer f.Close()
+
+	groups := map[string]*statRow{}
+	total := &statRow{name: "total"}
+	err = readPack(f, func(pf packedFile) error {
+		key := rootGroup
+		switch {
+		case pf.attachment:
+			key = attachDir
+		case o.by == "lang":
+			if key = detectLanguage(pf.rel); key == "" {
+				key = "other"
+			}
+		default:
+			if top, _, ok := strings.Cut(pf.rel, "/"); ok {
+				key = top
+			}
+		}
+		g := groups[key]
+		if g == nil {
+			g = &statRow{name: key}
+			groups[key] = g
+		}
+		// encrypted entries count as stored; that is what reaches the model
+		lines := bytes.Count(pf.content, []byte("\n"))
+		if len(pf.content) > 0 && !bytes.HasSuffix(pf.content, []byte("\n")) {
+			lines++
+		}
+		tokens := est.count(string(pf.content))
+		for _, r := range []*statRow{g, total} {
+			r.files++
+			r.lines += lines
+			r.bytes += len(pf.content)
+			r.tokens += tokens
+		}
+		return nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	rows := make([]*statRow, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, g)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].bytes != rows[j].bytes {
+			return rows[i].bytes > rows[j].bytes
+		}
+		return rows[i].name < rows[j].name
+	})
+
+	out := newHumanOutput(o.plain)
+	defer out.close()
+	head := strings.ToUpper(o.by)
+	table := [][]cell{{
+		{text: head, style: styleBold}, {text: "FILES", style: styleBold, numeric: true},
+		{text: "LINES", style: styleBold, numeric: true}, {text: "SIZE", style: styleBold, numeric: true},
+		{text: "TOKENS", style: styleBold, numeric: true}, {text: "SHARE", style: styleBold, numeric: true},
+	}}
+	for _, r := range append(rows, total) {
+		style := styleCyan
+		if r == total {
+			style = styleBold
+		}
+		share := "-"
+		if total.tokens > 0 {
+			share = fmt.Sprintf("%.1f%%", 100*float64(r.tokens)/float64(total.tokens))
+		}
+		table = append(table, []cell{
+			{text: r.name, style: style},
+			{text: strconv.Itoa(r.files), numeric: true},
+			{text: strconv.Itoa(r.lines), numeric: true},
+			{text: humanSize(int64(r.bytes)), numeric: true},
+			{text: strconv.Itoa(r.tokens), style: styleYellow, numeric: true},
+			{text: share, style: styleDim, numeric: true},
+		})
+	}
+	if err := out.table(table); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintln(out, out.paint(styleDim, "tokens: "+est.label()))
+}
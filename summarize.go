@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// maxCellText keeps one long value from filling a sample table.
+const maxCellText = 80
+
+func sampleCell(s string) string {
+	s = strings.NewReplacer("\r", "", "\n", `\n`, "|", `\|`).Replace(s)
+	if r := []rune(s); len(r) > maxCellText {
+		s = string(r[:maxCellText]) + "…"
+	}
+	return s
+}
+
+func markdownTable(b *strings.Builder, header []string, rows [][]string) {
+	cells := make([]string, len(header))
+	for i, h := range header {
+		cells[i] = sampleCell(h)
+	}
+	b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+	for _, r := range rows {
+		cells := make([]string, len(header))
+		for i := range cells {
+			if i < len(r) {
+				cells[i] = sampleCell(r[i])
+			}
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+}
+
+// summarizeCSV describes a large CSV or TSV file by its header, size, the
+// inferred type of each column and a few sample rows.
+func summarizeCSV(p string, ds dataSummary) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= ds.csvOver {
+		return nil, errNotConverted
+	}
+	r := csv.NewReader(bufio.NewReaderSize(f, 1<<16))
+	if strings.HasSuffix(strings.ToLower(p), ".tsv") {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("no CSV header: %w", err)
+	}
+	header = append([]string(nil), header...)
+	kinds := make([]string, len(header))
+	var samples [][]string
+	rows, ragged := 0, 0
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows++
+		if len(rec) != len(header) {
+			ragged++
+		}
+		for i := range min(len(rec), len(kinds)) {
+			kinds[i] = widenKind(kinds[i], rec[i])
+		}
+		if len(samples) < ds.rows {
+			samples = append(samples, append([]string(nil), rec...))
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "> Summary of a %s CSV file by packprompt: its shape and %d sample rows, not the data.\n\n", humanSize(info.Size()), len(samples))
+	fmt.Fprintf(&b, "%d rows, %d columns", rows, len(header))
+	if ragged > 0 {
+		fmt.Fprintf(&b, " (%d rows with a different number of fields)", ragged)
+	}
+	b.WriteString("\n\n## Columns\n\n")
+	for i, h := range header {
+		k := kinds[i]
+		if k == "" {
+			k = "empty"
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", sampleCell(h), k)
+	}
+	b.WriteString("\n## Sample rows\n\n")
+	markdownTable(&b, header, samples)
+	return []byte(b.String()), nil
+}
+
+// widenKind folds one value into a column's type: integer, number, boolean
+// or text, where any mix widens towards text. Empty values do not count.
+func widenKind(kind, v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || kind == "text" {
+		return kind
+	}
+	var k string
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		k = "integer"
+	} else if _, err := strconv.ParseFloat(v, 64); err == nil {
+		k = "number"
+	} else if lv := strings.ToLower(v); lv == "true" || lv == "false" {
+		k = "boolean"
+	} else {
+		k = "text"
+	}
+	switch {
+	case kind == "" || kind == k:
+		return k
+	case kind == "integer" && k == "number", kind == "number" && k == "integer":
+		return "number"
+	}
+	return "text"
+}
+
+// sqliteFile reads the b-trees of a SQLite 3 database directly, enough to
+// list its schema and sample table rows.
+type sqliteFile struct {
+	f        *os.File
+	pageSize int
+	usable   int
+	pages    int
+	encoding int // 1 UTF-8, 2 UTF-16le, 3 UTF-16be
+	visited  int
+}
+
+// maxSQLitePages bounds the pages read when counting rows, so summaries of
+// huge databases stay quick; counts past it are reported as lower bounds.
+const maxSQLitePages = 200_000
+
+var errSQLiteCorrupt = errors.New("malformed SQLite database")
+
+func openSQLite(p string) (*sqliteFile, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, 100)
+	if _, err := io.ReadFull(f, hdr); err != nil || string(hdr[:16]) != "SQLite format 3\x00" {
+		f.Close()
+		return nil, errors.New("not a SQLite 3 database")
+	}
+	db := &sqliteFile{f: f, pageSize: int(binary.BigEndian.Uint16(hdr[16:18]))}
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	if db.pageSize < 512 || db.pageSize&(db.pageSize-1) != 0 {
+		f.Close()
+		return nil, errSQLiteCorrupt
+	}
+	db.usable = db.pageSize - int(hdr[20])
+	db.encoding = int(binary.BigEndian.Uint32(hdr[56:60]))
+	if info, err := f.Stat(); err == nil {
+		db.pages = int(info.Size() / int64(db.pageSize))
+	}
+	return db, nil
+}
+
+func (db *sqliteFile) page(n int) ([]byte, error) {
+	if n < 1 || n > db.pages {
+		return nil, errSQLiteCorrupt
+	}
+	buf := make([]byte, db.pageSize)
+	if _, err := db.f.ReadAt(buf, int64(n-1)*int64(db.pageSize)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v, len(b)
+}
+
+// walkTable visits the rows of the table b-tree rooted at page root in
+// rowid order until fn returns false; with fn nil it only counts rows.
+func (db *sqliteFile) walkTable(root int, fn func(rowid int64, payload []byte) bool) (count int, complete bool, err error) {
+	var walk func(n, depth int) (bool, error)
+	walk = func(n, depth int) (bool, error) {
+		if depth > 40 {
+			return false, errSQLiteCorrupt
+		}
+		if db.visited++; db.visited > maxSQLitePages {
+			return false, nil
+		}
+		pg, err := db.page(n)
+		if err != nil {
+			return false, err
+		}
+		h := 0
+		if n == 1 {
+			h = 100
+		}
+		if h+8 > len(pg) {
+			return false, errSQLiteCorrupt
+		}
+		kind := pg[h]
+		cells := int(binary.BigEndian.Uint16(pg[h+3:]))
+		switch kind {
+		case 0x0d: // table leaf
+			if fn == nil {
+				count += cells
+				return true, nil
+			}
+			for i := range cells {
+				off := int(binary.BigEndian.Uint16(pg[h+8+2*i:]))
+				if off >= len(pg) {
+					return false, errSQLiteCorrupt
+				}
+				payload, rowid, err := db.leafCell(pg, off)
+				if err != nil {
+					return false, err
+				}
+				count++
+				if !fn(rowid, payload) {
+					return false, nil
+				}
+			}
+			return true, nil
+		case 0x05: // table interior
+			if h+12 > len(pg) {
+				return false, errSQLiteCorrupt
+			}
+			for i := range cells {
+				off := int(binary.BigEndian.Uint16(pg[h+12+2*i:]))
+				if off+4 > len(pg) {
+					return false, errSQLiteCorrupt
+				}
+				if ok, err := walk(int(binary.BigEndian.Uint32(pg[off:])), depth+1); !ok || err != nil {
+					return false, err
+				}
+			}
+			return walk(int(binary.BigEndian.Uint32(pg[h+8:])), depth+1)
+		}
+		return false, errSQLiteCorrupt
+	}
+	complete, err = walk(root, 0)
+	return count, complete, err
+}
+
+// leafCell returns the payload and rowid of a table leaf cell, following
+// overflow pages.
+func (db *sqliteFile) leafCell(pg []byte, off int) ([]byte, int64, error) {
+	size, n := sqliteVarint(pg[off:])
+	off += n
+	rowid, n := sqliteVarint(pg[off:])
+	off += n
+	p, u := int(size), db.usable
+	local := p
+	if maxLocal := u - 35; p > maxLocal {
+		minLocal := (u-12)*32/255 - 23
+		local = minLocal + (p-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if off+local > len(pg) {
+		return nil, 0, errSQLiteCorrupt
+	}
+	payload := append([]byte(nil), pg[off:off+local]...)
+	if local < p {
+		if off+local+4 > len(pg) {
+			return nil, 0, errSQLiteCorrupt
+		}
+		next := int(binary.BigEndian.Uint32(pg[off+local:]))
+		for len(payload) < p && next != 0 {
+			ov, err := db.page(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			next = int(binary.BigEndian.Uint32(ov))
+			payload = append(payload, ov[4:min(u, 4+p-len(payload))]...)
+		}
+	}
+	return payload, int64(rowid), nil
+}
+
+// record decodes a SQLite record into display strings (nil for NULL).
+func (db *sqliteFile) record(payload []byte) []*string {
+	hsize, n := sqliteVarint(payload)
+	if int(hsize) > len(payload) {
+		return nil
+	}
+	var types []uint64
+	for i := n; i < int(hsize); {
+		t, k := sqliteVarint(payload[i:])
+		types = append(types, t)
+		i += k
+	}
+	body := payload[hsize:]
+	out := make([]*string, len(types))
+	for i, t := range types {
+		var s string
+		var size int
+		switch {
+		case t == 0:
+			continue
+		case t <= 6:
+			size = []int{0, 1, 2, 3, 4, 6, 8}[t]
+			if size > len(body) {
+				return out
+			}
+			var v int64
+			for _, c := range body[:size] {
+				v = v<<8 | int64(c)
+			}
+			v = v << (64 - 8*size) >> (64 - 8*size) // sign-extend
+			s = strconv.FormatInt(v, 10)
+		case t == 7:
+			size = 8
+			if size > len(body) {
+				return out
+			}
+			s = strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(body)), 'g', -1, 64)
+		case t == 8 || t == 9:
+			s = strconv.Itoa(int(t - 8))
+		case t >= 12 && t%2 == 0:
+			size = int(t-12) / 2
+			s = fmt.Sprintf("<blob, %d bytes>", size)
+		case t >= 13:
+			size = int(t-13) / 2
+			if size > len(body) {
+				return out
+			}
+			s = db.text(body[:size])
+		}
+		if size > len(body) {
+			return out
+		}
+		body = body[size:]
+		out[i] = &s
+	}
+	return out
+}
+
+func (db *sqliteFile) text(b []byte) string {
+	if db.encoding != 2 && db.encoding != 3 {
+		return string(b)
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if db.encoding == 2 {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		} else {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// sqliteObject is a row of sqlite_schema.
+type sqliteObject struct {
+	kind, name, sql string
+	root            int
+}
+
+// tableColumns pulls column names from a CREATE TABLE statement, and which
+// one (if any) aliases the rowid.
+func tableColumns(sql string) (names []string, rowidCol int) {
+	rowidCol = -1
+	open, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if open < 0 || end < open {
+		return nil, -1
+	}
+	var defs []string
+	depth, start := 0, open+1
+	for i := open + 1; i < end; i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, sql[start:i])
+				start = i + 1
+			}
+		}
+	}
+	defs = append(defs, sql[start:end])
+	for _, d := range defs {
+		name, quoted, rest := columnName(strings.TrimSpace(d))
+		if name == "" {
+			continue
+		}
+		if !quoted {
+			switch strings.ToUpper(name) {
+			case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+				continue
+			}
+		}
+		if f := strings.Fields(strings.ToUpper(rest)); len(f) > 0 && f[0] == "INTEGER" && strings.Contains(strings.Join(f, " "), "PRIMARY KEY") {
+			rowidCol = len(names)
+		}
+		names = append(names, name)
+	}
+	return names, rowidCol
+}
+
+// columnName splits a column definition into its name, which may be
+// quoted ("a b", `a b`, [a b] or 'a b') and have spaces, and the rest.
+func columnName(def string) (name string, quoted bool, rest string) {
+	if def == "" {
+		return "", false, ""
+	}
+	if q := strings.IndexByte("\"`['", def[0]); q >= 0 {
+		if i := strings.IndexByte(def[1:], "\"`]'"[q]); i >= 0 {
+			return def[1 : i+1], true, def[i+2:]
+		}
+	}
+	i := strings.IndexFunc(def, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+	if i < 0 {
+		return def, false, ""
+	}
+	return def[:i], false, def[i:]
+}
+
+// summarizeSQLite lists a database's schema, then each table's row count
+// and first rows.
+func summarizeSQLite(p string, rows int) ([]byte, error) {
+	db, err := openSQLite(p)
+	if err != nil {
+		return nil, err
+	}
+	defer db.f.Close()
+	var objs []sqliteObject
+	if _, _, err := db.walkTable(1, func(_ int64, payload []byte) bool {
+		rec := db.record(payload)
+		if len(rec) < 5 || rec[0] == nil || rec[1] == nil {
+			return true
+		}
+		o := sqliteObject{kind: *rec[0], name: *rec[1]}
+		if rec[3] != nil {
+			o.root, _ = strconv.Atoi(*rec[3])
+		}
+		if rec[4] != nil {
+			o.sql = *rec[4]
+		}
+		objs = append(objs, o)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "> Summary of a SQLite database by packprompt: its schema and up to %d sample rows per table, not the data.\n\n", rows)
+	b.WriteString("## Schema\n\n```sql\n")
+	for _, o := range objs {
+		if o.sql != "" {
+			b.WriteString(strings.TrimSpace(o.sql) + ";\n")
+		}
+	}
+	b.WriteString("```\n")
+	for _, o := range objs {
+		if o.kind != "table" || o.root == 0 || strings.HasPrefix(o.name, "sqlite_") {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", o.name)
+		if strings.Contains(strings.ToUpper(o.sql), "WITHOUT ROWID") {
+			b.WriteString("WITHOUT ROWID table; rows are not sampled.\n")
+			continue
+		}
+		cols, rowidCol := tableColumns(o.sql)
+		var sample [][]string
+		db.visited = 0
+		_, _, err := db.walkTable(o.root, func(rowid int64, payload []byte) bool {
+			if len(sample) >= rows {
+				return false
+			}
+			rec := db.record(payload)
+			row := make([]string, max(len(cols), len(rec)))
+			for i, v := range rec {
+				switch {
+				case v != nil:
+					row[i] = *v
+				case i == rowidCol:
+					row[i] = strconv.FormatInt(rowid, 10)
+				default:
+					row[i] = "NULL"
+				}
+			}
+			sample = append(sample, row)
+			return true
+		})
+		if err != nil {
+			fmt.Fprintf(&b, "Could not read rows: %v\n", err)
+			continue
+		}
+		db.visited = 0
+		count, complete, err := db.walkTable(o.root, nil)
+		switch {
+		case err != nil:
+			b.WriteString("Row count unavailable.\n\n")
+		case !complete:
+			fmt.Fprintf(&b, "At least %d rows.\n\n", count)
+		default:
+			fmt.Fprintf(&b, "%d rows.\n\n", count)
+		}
+		if len(sample) > 0 {
+			header := cols
+			for len(header) < len(sample[0]) {
+				header = append(header, fmt.Sprintf("col%d", len(header)+1))
+			}
+			markdownTable(&b, header, sample)
+		}
+	}
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSQLiteVarint checks varints of each length, including the 9-byte
+// form whose last byte carries 8 bits.
+func TestSQLiteVarint(t *testing.T) {
+	for _, c := range []struct {
+		in   []byte
+		want uint64
+		n    int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f, 0xff}, 127, 1},
+		{[]byte{0x81, 0x00}, 128, 2},
+		{[]byte{0x82, 0x80, 0x01}, 1<<15 | 1, 3},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, math.MaxUint64, 9},
+		{[]byte{0x81}, 1, 1}, // cut off: what there is
+	} {
+		if v, n := sqliteVarint(c.in); v != c.want || n != c.n {
+			t.Errorf("sqliteVarint(% x) = %d, %d; want %d, %d", c.in, v, n, c.want, c.n)
+		}
+	}
+}
+
+// TestSQLiteRecord checks each serial type decodes to its display string.
+func TestSQLiteRecord(t *testing.T) {
+	db := &sqliteFile{encoding: 1}
+	rec := db.record(sqliteTestRecord(nil, int64(-2), int64(300), int64(1)<<40, 2.5, int64(0), int64(1), "héllo", []byte{1, 2, 3}))
+	var got []string
+	for _, v := range rec {
+		if v == nil {
+			got = append(got, "NULL")
+		} else {
+			got = append(got, *v)
+		}
+	}
+	want := []string{"NULL", "-2", "300", "1099511627776", "2.5", "0", "1", "héllo", "<blob, 3 bytes>"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("record = %q, want %q", got, want)
+	}
+
+	utf16 := &sqliteFile{encoding: 2}
+	if rec := utf16.record([]byte{2, 13 + 2*4, 'h', 0, 'i', 0}); len(rec) != 1 || rec[0] == nil || *rec[0] != "hi" {
+		t.Errorf("UTF-16le record = %v", rec)
+	}
+	if rec := db.record([]byte{9, 1}); rec != nil {
+		t.Errorf("a header longer than the record decoded to %v", rec)
+	}
+	if rec := db.record([]byte{3, 13 + 2*5, 1, 'a', 'b'}); len(rec) != 2 || rec[0] != nil || rec[1] != nil {
+		t.Errorf("a cut-off body decoded past its end: %v", rec)
+	}
+}
+
+// TestTableColumns checks column names and the rowid alias are read from
+// CREATE TABLE statements.
+func TestTableColumns(t *testing.T) {
+	for sql, want := range map[string]struct {
+		names []string
+		rowid int
+	}{
+		"CREATE TABLE t(id INTEGER PRIMARY KEY, name TEXT)":                          {[]string{"id", "name"}, 0},
+		"CREATE TABLE t (a, b DECIMAL(10, 2), \"c d\" TEXT, PRIMARY KEY (a, b))":     {[]string{"a", "b", "c d"}, -1},
+		"CREATE TABLE t(`x` TEXT, [id] integer primary key autoincrement, CHECK(x))": {[]string{"x", "id"}, 1},
+		"CREATE TABLE t(id INT PRIMARY KEY, CONSTRAINT u UNIQUE (id))":               {[]string{"id"}, -1},
+		"CREATE VIRTUAL TABLE v USING fts5":                                          {nil, -1},
+	} {
+		names, rowid := tableColumns(sql)
+		if !reflect.DeepEqual(names, want.names) || rowid != want.rowid {
+			t.Errorf("tableColumns(%q) = %q, %d; want %q, %d", sql, names, rowid, want.names, want.rowid)
+		}
+	}
+}
+
+// TestSummarizeSQLite reads a database laid out by hand: a schema on page
+// 1, a table whose b-tree has an interior page over two leaves, and a row
+// spilling onto an overflow page.
+func TestSummarizeSQLite(t *testing.T) {
+	const pageSize = 512
+	long := strings.Repeat("x", 600)
+	schema := "CREATE TABLE people(id INTEGER PRIMARY KEY, name TEXT, score REAL, photo BLOB)"
+	pages := [][]byte{
+		sqliteTestLeaf(true, sqliteTestCell(1, sqliteTestRecord("table", "people", "people", int64(2), schema))),
+		sqliteTestInterior(4, 3, 2),
+		sqliteTestLeaf(false,
+			sqliteTestCell(1, sqliteTestRecord(nil, "ada", 9.5, nil)),
+			sqliteTestCell(2, sqliteTestRecord(nil, "bob", nil, []byte{0xff}))),
+		nil, // page 4 is filled in once the overflow page number is known
+		nil,
+	}
+	// a payload too big for a 512-byte page keeps the minimum local part
+	// plus the remainder on the leaf, and the rest on page 5
+	payload := sqliteTestRecord(nil, long, int64(7), nil)
+	cell := append(sqliteTestVarint(uint64(len(payload))), sqliteTestVarint(3)...)
+	local := 39 + (len(payload)-39)%(pageSize-4)
+	if local > pageSize-35 {
+		local = 39
+	}
+	cell = append(cell, payload[:local]...)
+	cell = binary.BigEndian.AppendUint32(cell, 5)
+	pages[3] = sqliteTestLeaf(false, cell)
+	overflow := make([]byte, pageSize)
+	copy(overflow[4:], payload[local:])
+	pages[4] = overflow
+
+	p := filepath.Join(t.TempDir(), "app.db")
+	if err := os.WriteFile(p, sqliteTestFile(pageSize, pages), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := summarizeSQLite(p, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"```sql\n" + schema + ";\n```\n",
+		"## people\n\n3 rows.\n\n",
+		"| id | name | score | photo |",
+		"| 1 | ada | 9.5 | NULL |",
+		"| 2 | bob | NULL | <blob, 1 bytes> |",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("summary lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "| 3 |") {
+		t.Errorf("summary sampled more than 2 rows:\n%s", out)
+	}
+
+	db, err := openSQLite(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.f.Close()
+	var last []*string
+	if _, _, err := db.walkTable(2, func(_ int64, payload []byte) bool { last = db.record(payload); return true }); err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 4 || last[1] == nil || *last[1] != long {
+		t.Errorf("the overflowing row did not read back whole: %v", last)
+	}
+
+	pages[1][0] = 0x02 // an index page where a table page should be
+	if err := os.WriteFile(p, sqliteTestFile(pageSize, pages), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := summarizeSQLite(p, 2); err != nil || !strings.Contains(string(out), "Could not read rows: "+errSQLiteCorrupt.Error()) {
+		t.Errorf("a corrupt table: %v\n%s", err, out)
+	}
+}
+
+// sqliteTestFile lays pages out after a database header; page 1 already
+// leaves room for it.
+func sqliteTestFile(pageSize int, pages [][]byte) []byte {
+	var out []byte
+	for _, pg := range pages {
+		out = append(out, pg...)
+	}
+	copy(out, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(out[16:], uint16(pageSize))
+	out[18], out[19], out[21], out[22], out[23] = 1, 1, 64, 32, 32
+	binary.BigEndian.PutUint32(out[24:], 1)
+	binary.BigEndian.PutUint32(out[28:], uint32(len(pages)))
+	binary.BigEndian.PutUint32(out[44:], 4)
+	binary.BigEndian.PutUint32(out[56:], 1)
+	binary.BigEndian.PutUint32(out[92:], 1)
+	binary.BigEndian.PutUint32(out[96:], 3045000)
+	return out
+}
+
+// sqliteTestLeaf is a 512-byte table leaf page holding cells; on page 1
+// its header follows the database header.
+func sqliteTestLeaf(first bool, cells ...[]byte) []byte {
+	return sqliteTestPage(first, 0x0d, 8, cells)
+}
+
+// sqliteTestInterior is a table interior page with one cell pointing left
+// of key at left, and right as its right-most child.
+func sqliteTestInterior(right, left uint32, key uint64) []byte {
+	pg := sqliteTestPage(false, 0x05, 12, [][]byte{append(binary.BigEndian.AppendUint32(nil, left), sqliteTestVarint(key)...)})
+	binary.BigEndian.PutUint32(pg[8:], right)
+	return pg
+}
+
+func sqliteTestPage(first bool, kind byte, headerLen int, cells [][]byte) []byte {
+	pg := make([]byte, 512)
+	h := 0
+	if first {
+		h = 100
+	}
+	pg[h] = kind
+	binary.BigEndian.PutUint16(pg[h+3:], uint16(len(cells)))
+	end := len(pg)
+	for i, c := range cells {
+		end -= len(c)
+		copy(pg[end:], c)
+		binary.BigEndian.PutUint16(pg[h+headerLen+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(pg[h+5:], uint16(end))
+	return pg
+}
+
+func sqliteTestCell(rowid uint64, payload []byte) []byte {
+	return append(append(sqliteTestVarint(uint64(len(payload))), sqliteTestVarint(rowid)...), payload...)
+}
+
+// sqliteTestRecord encodes values (nil, int64, float64, string or []byte)
+// as a record; integers use the 1-, 2- or 6-byte forms, or 8 and 9 for 0
+// and 1.
+func sqliteTestRecord(vals ...any) []byte {
+	var types, body []byte
+	for _, v := range vals {
+		switch v := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case int64:
+			switch {
+			case v == 0 || v == 1:
+				types = append(types, byte(8+v))
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				types, body = append(types, 1), append(body, byte(v))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				types, body = append(types, 2), binary.BigEndian.AppendUint16(body, uint16(v))
+			default:
+				types, body = append(types, 5), append(body, binary.BigEndian.AppendUint64(nil, uint64(v))[2:]...)
+			}
+		case float64:
+			types, body = append(types, 7), binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		case string:
+			types, body = append(types, sqliteTestVarint(uint64(13+2*len(v)))...), append(body, v...)
+		case []byte:
+			types, body = append(types, sqliteTestVarint(uint64(12+2*len(v)))...), append(body, v...)
+		}
+	}
+	hsize := len(types) + 1
+	if hsize > 127 {
+		hsize++
+	}
+	return append(append(sqliteTestVarint(uint64(hsize)), types...), body...)
+}
+
+// sqliteTestVarint encodes v, which must be below 1<<56.
+func sqliteTestVarint(v uint64) []byte {
+	out := []byte{byte(v & 0x7f)}
+	for v >>= 7; v > 0; v >>= 7 {
+		out = append([]byte{byte(v&0x7f) | 0x80}, out...)
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI styles used by human-facing output.
+const (
+	styleBold   = "1"
+	styleDim    = "2"
+	styleRed    = "31"
+	styleGreen  = "32"
+	styleYellow = "33"
+	styleBlue   = "34"
+	styleCyan   = "36"
+)
+
+// humanOutput is stdout for people: colored and piped through a pager when
+// it is a terminal, plain bytes otherwise. NO_COLOR, TERM=dumb and --plain
+// turn both off.
+type humanOutput struct {
+	w     io.Writer
+	color bool
+	pager *exec.Cmd
+	pipe  io.WriteCloser
+}
+
+func newHumanOutput(plain bool) *humanOutput {
+	h := &humanOutput{w: os.Stdout}
+	if plain || !isTerminal(os.Stdout) || os.Getenv("TERM") == "dumb" {
+		return h
+	}
+	_, noColor := os.LookupEnv("NO_COLOR")
+	h.color = !noColor
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -FRX"
+	}
+	if pager == "cat" {
+		return h
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// like git: unless told otherwise, less keeps colors and quits when the output fits
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	pipe, err := cmd.StdinPipe()
+	if err != nil {
+		return h
+	}
+	if cmd.Start() != nil {
+		return h
+	}
+	h.w, h.pager, h.pipe = pipe, cmd, pipe
+	return h
+}
+
+// Write lets a humanOutput be used as an io.Writer.
+func (h *humanOutput) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// close flushes to the pager and waits until the user quits it.
+func (h *humanOutput) close() {
+	if h.pager == nil {
+		return
+	}
+	_ = h.pipe.Close()
+	_ = h.pager.Wait()
+}
+
+// paint wraps s in an ANSI style when color is on.
+func (h *humanOutput) paint(style, s string) string {
+	if !h.color || style == "" || s == "" {
+		return s
+	}
+	return "\x1b[" + style + "m" + s + "\x1b[0m"
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// cell is one table cell; numeric cells are right-aligned.
+type cell struct {
+	text    string
+	style   string
+	numeric bool
+}
+
+// table prints rows with columns aligned on visible width, so colors do not
+// throw the layout off the way they do with text/tabwriter.
+func (h *humanOutput) table(rows [][]cell) error {
+	var widths []int
+	for _, row := range rows {
+		for i, c := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(c.text))
+		}
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for i, c := range row {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.text))
+			text := h.paint(c.style, c.text)
+			if c.numeric {
+				text = pad + text
+			} else if i < len(row)-1 {
+				text += pad
+			}
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			b.WriteString(text)
+		}
+		b.WriteString("\n")
+		if _, err := io.WriteString(h, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
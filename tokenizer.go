@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Pre-tokenizer patterns of the tiktoken encodings, as RE2 has them: the
+// \s+(?!\S) alternative loses its lookahead and bpeVocab.count gives the
+// last space of a run back to the word after it instead.
+const (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`
+	o200kPattern  = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`
+)
+
+var (
+	o200kVocab  = &bpeVocab{encoding: "o200k_base", file: "o200k_base.tiktoken", pattern: o200kPattern}
+	cl100kVocab = &bpeVocab{encoding: "cl100k_base", file: "cl100k_base.tiktoken", pattern: cl100kPattern}
+	llama3Vocab = &bpeVocab{encoding: "llama3", file: "llama3.tiktoken", pattern: cl100kPattern}
+)
+
+// modelVocabs are the tokenizers models are counted with when their
+// vocabulary is installed, keyed like tokenEstimators and modelAliases.
+// Claude's tokenizer is not published, so claude is always estimated.
+var modelVocabs = map[string]*bpeVocab{
+	"gpt-4o": o200kVocab, "gpt-4o-mini": o200kVocab, "gpt-4.1": o200kVocab, "gpt-5": o200kVocab,
+	"o1": o200kVocab, "o3": o200kVocab, "o4-mini": o200kVocab, "gpt": o200kVocab,
+	"gpt-4": cl100kVocab, "gpt-4-turbo": cl100kVocab, "gpt-3.5-turbo": cl100kVocab,
+	"llama": llama3Vocab, "llama3": llama3Vocab, "llama-3": llama3Vocab,
+}
+
+// tokenizerDir holds the tiktoken vocabularies: $PACKPROMPT_TOKENIZERS, or
+// packprompt/tokenizers under the user cache directory.
+func tokenizerDir() string {
+	if dir := os.Getenv("PACKPROMPT_TOKENIZERS"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "packprompt", "tokenizers")
+}
+
+// bpeVocab is a byte-pair-encoding tokenizer read from a .tiktoken file
+// (one base64 token and its merge rank per line) on first use.
+type bpeVocab struct {
+	encoding, file, pattern string
+
+	once  sync.Once
+	ranks map[string]int
+	pre   *regexp.Regexp
+
+	mu    sync.Mutex
+	cache map[string]int // tokens per piece
+}
+
+// bpeCacheSize bounds the pieces whose token counts are remembered.
+const bpeCacheSize = 1 << 17
+
+// loaded reports whether the vocabulary is installed, loading it if need
+// be; a file that cannot be read is warned about and counting falls back
+// to the estimate.
+func (v *bpeVocab) loaded() bool {
+	if v == nil {
+		return false
+	}
+	v.once.Do(func() {
+		dir := tokenizerDir()
+		if dir == "" {
+			return
+		}
+		p := filepath.Join(dir, v.file)
+		ranks, err := readTiktoken(p)
+		if errors.Is(err, iofs.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v; estimating tokens instead\n", err)
+			return
+		}
+		v.ranks, v.cache = ranks, map[string]int{}
+		v.pre = regexp.MustCompile(`^(?:` + v.pattern + `)`)
+	})
+	return v.ranks != nil
+}
+
+func readTiktoken(p string) (map[string]int, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ranks := make(map[string]int, 200_000)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		tok, rank, ok := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		if tok == "" && !ok {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(tok)
+		r, rerr := strconv.Atoi(rank)
+		if !ok || err != nil || rerr != nil {
+			return nil, fmt.Errorf("%s:%d: not a tiktoken vocabulary line", p, n)
+		}
+		ranks[string(raw)] = r
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", p)
+	}
+	return ranks, nil
+}
+
+// count returns the number of tokens the encoding splits text into.
+func (v *bpeVocab) count(text string) int {
+	n := 0
+	for len(text) > 0 {
+		loc := v.pre.FindStringIndex(text)
+		if loc == nil {
+			// every character matches some alternative; be safe anyway
+			return n + v.pieceTokens(text)
+		}
+		end := loc[1]
+		if end < len(text) && end > 1 && !isSpace(text[end]) && isSpaceRun(text[:end]) {
+			// \s+(?!\S): a run of spaces leaves its last one to what follows
+			end--
+		}
+		n += v.pieceTokens(text[:end])
+		text = text[end:]
+	}
+	return n
+}
+
+// isSpaceRun reports whether s is blanks or tabs only, the \s+ runs that
+// do not end a line.
+func isSpaceRun(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != ' ' && c != '\t' && c != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// pieceTokens counts one pre-tokenized piece, from the cache when it has
+// been seen before.
+func (v *bpeVocab) pieceTokens(piece string) int {
+	if _, ok := v.ranks[piece]; ok {
+		return 1
+	}
+	v.mu.Lock()
+	n, ok := v.cache[piece]
+	v.mu.Unlock()
+	if ok {
+		return n
+	}
+	// merging is quadratic in the piece; a huge one (a minified line of
+	// punctuation) is merged in slices
+	const most = 4096
+	for p := piece; len(p) > 0; {
+		cut := min(len(p), most)
+		n += v.merge(p[:cut])
+		p = p[cut:]
+	}
+	v.mu.Lock()
+	if len(v.cache) < bpeCacheSize {
+		v.cache[piece] = n
+	}
+	v.mu.Unlock()
+	return n
+}
+
+// merge runs byte-pair merging on piece, always joining the adjacent pair
+// of lowest rank, and returns how many tokens are left.
+func (v *bpeVocab) merge(piece string) int {
+	const none = math.MaxInt
+	bounds := make([]int, len(piece)+1) // part i is piece[bounds[i]:bounds[i+1]]
+	for i := range bounds {
+		bounds[i] = i
+	}
+	pair := func(i int) int {
+		if r, ok := v.ranks[piece[bounds[i]:bounds[i+2]]]; ok {
+			return r
+		}
+		return none
+	}
+	ranks := make([]int, max(len(piece)-1, 0)) // ranks[i] joins parts i and i+1
+	for i := range ranks {
+		ranks[i] = pair(i)
+	}
+	for len(ranks) > 0 {
+		at := 0
+		for i, r := range ranks {
+			if r < ranks[at] {
+				at = i
+			}
+		}
+		if ranks[at] == none {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+		ranks = append(ranks[:at], ranks[at+1:]...)
+		if at < len(ranks) {
+			ranks[at] = pair(at)
+		}
+		if at > 0 {
+			ranks[at-1] = pair(at - 1)
+		}
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenEstimator counts a model family's tokens. With the family's
+// vocabulary installed (see tokenizerDir) it runs the real tokenizer;
+// otherwise it approximates it: text is pre-split the way those tokenizers
+// split it (words, digit groups, punctuation, whitespace runs) and each
+// piece is charged by its length. Good enough to tell whether a pack fits a
+// context window; not a substitute for the real tokenizer.
+type tokenEstimator struct {
+	name          string
+	charsPerToken float64 // letters per token inside a word part
+	digitGroup    int     // digits merged into one token
+	punctGroup    int     // punctuation characters merged into one token
+	runesPerToken float64 // non-ASCII letters (CJK, Cyrillic, ...) per token
+	accuracy      string
+	bpe           *bpeVocab // the real tokenizer, when installed
+}
+
+var tokenEstimators = map[string]tokenEstimator{
+	// o200k_base (gpt-4o, gpt-4.1, o-series)
+	"gpt-4o": {name: "gpt-4o", charsPerToken: 5.0, digitGroup: 3, punctGroup: 2, runesPerToken: 1.4, accuracy: "±10%"},
+	// cl100k_base (gpt-4, gpt-3.5)
+	"gpt-4":  {name: "gpt-4", charsPerToken: 4.4, digitGroup: 3, punctGroup: 2, runesPerToken: 0.9, accuracy: "±10%"},
+	"claude": {name: "claude", charsPerToken: 4.0, digitGroup: 1, punctGroup: 2, runesPerToken: 0.9, accuracy: "±15%"},
+	// sentencepiece/tiktoken-style llama vocabularies split every digit
+	"llama": {name: "llama", charsPerToken: 3.8, digitGroup: 1, punctGroup: 1, runesPerToken: 0.8, accuracy: "±15%"},
+	// four bytes per token, the usual rule of thumb
+	"generic": {name: "generic", accuracy: "±25%"},
+}
+
+// modelAliases maps common model names onto an estimator.
+var modelAliases = map[string]string{
+	"gpt-4o-mini": "gpt-4o", "gpt-4.1": "gpt-4o", "gpt-5": "gpt-4o", "o1": "gpt-4o", "o3": "gpt-4o", "o4-mini": "gpt-4o",
+	"gpt-4-turbo": "gpt-4", "gpt-3.5-turbo": "gpt-4", "gpt": "gpt-4o",
+	"claude-3": "claude", "claude-4": "claude", "sonnet": "claude", "opus": "claude", "haiku": "claude",
+	"llama2": "llama", "llama3": "llama", "llama-3": "llama", "mistral": "llama", "qwen": "llama", "gemma": "llama",
+}
+
+// lookupEstimator resolves a --model name; prefixes such as
+// "claude-sonnet-4" or "llama3.1:8b" resolve to their family.
+func lookupEstimator(model string) (tokenEstimator, error) {
+	m := strings.ToLower(strings.TrimSpace(model))
+	best, fam := "", ""
+	if _, ok := tokenEstimators[m]; ok {
+		best, fam = m, m
+	} else if f, ok := modelAliases[m]; ok {
+		best, fam = m, f
+	} else {
+		// longest known prefix wins: gpt-4o-2024-08-06 is gpt-4o, not gpt-4
+		for k := range tokenEstimators {
+			if strings.HasPrefix(m, k) && len(k) > len(best) {
+				best, fam = k, k
+			}
+		}
+		for k, f := range modelAliases {
+			if strings.HasPrefix(m, k) && len(k) > len(best) {
+				best, fam = k, f
+			}
+		}
+	}
+	if fam != "" {
+		t := tokenEstimators[fam]
+		t.bpe = modelVocabs[best]
+		return t, nil
+	}
+	return tokenEstimator{}, fmt.Errorf("unknown --model %q: want one of %s", model, strings.Join(estimatorNames(), ", "))
+}
+
+func estimatorNames() []string {
+	var names []string
+	for k := range tokenEstimators {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// label describes the count for reports, e.g. "gpt-4o, o200k_base
+// tokenizer" or "claude, offline estimate ±15%".
+func (t tokenEstimator) label() string {
+	if t.bpe.loaded() {
+		return fmt.Sprintf("%s, %s tokenizer", t.name, t.bpe.encoding)
+	}
+	return fmt.Sprintf("%s, offline estimate %s", t.name, t.accuracy)
+}
+
+// count estimates the tokens in text.
+func (t tokenEstimator) count(text string) int {
+	if t.bpe.loaded() {
+		return t.bpe.count(text)
+	}
+	if t.charsPerToken == 0 {
+		return (len(text) + 3) / 4
+	}
+	n := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		j := i + size
+		switch {
+		case r == ' ' && j < len(text) && text[j] != ' ' && text[j] != '\n':
+			// a single space is folded into the following piece
+		case unicode.IsSpace(r):
+			for j < len(text) && (text[j] == ' ' || text[j] == '\t' || text[j] == '\n' || text[j] == '\r') {
+				j++
+			}
+			n++
+		case unicode.IsDigit(r):
+			for j < len(text) && text[j] >= '0' && text[j] <= '9' {
+				j++
+			}
+			n += ceilDiv(j-i, t.digitGroup)
+		case unicode.IsLetter(r):
+			for j < len(text) {
+				r2, s2 := utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsLetter(r2) {
+					break
+				}
+				j += s2
+			}
+			n += t.word(text[i:j])
+		default:
+			for j < len(text) {
+				r2, s2 := utf8.DecodeRuneInString(text[j:])
+				if unicode.IsLetter(r2) || unicode.IsDigit(r2) || unicode.IsSpace(r2) {
+					break
+				}
+				j += s2
+			}
+			n += ceilDiv(utf8.RuneCountInString(text[i:j]), t.punctGroup)
+		}
+		i = j
+	}
+	return n
+}
+
+// word charges a run of letters; camelCase parts are charged separately
+// since vocabularies rarely hold whole identifiers.
+func (t tokenEstimator) word(w string) int {
+	n := 0
+	for _, part := range splitIdent(w) {
+		ascii, other := 0, 0
+		for _, r := range part {
+			if r < utf8.RuneSelf {
+				ascii++
+			} else {
+				other++
+			}
+		}
+		if ascii > 0 {
+			n += max(1, int(float64(ascii)/t.charsPerToken+0.5))
+		}
+		if other > 0 {
+			n += max(1, int(float64(other)/t.runesPerToken+0.5))
+		}
+	}
+	return n
+}
+
+// tokenChunk is how much text a tokenStream holds before counting it.
+const tokenChunk = 64 << 10
+
+// tokenStream counts the tokens of text written to it without holding the
+// whole text: it counts up to the last point where a piece boundary cannot
+// depend on what follows, so the total equals count on the whole text.
+// Only a run of megabytes without such a point is cut blindly.
+type tokenStream struct {
+	est   tokenEstimator
+	buf   []byte
+	bytes int
+	n     int
+}
+
+func newTokenStream(est tokenEstimator) *tokenStream {
+	return &tokenStream{est: est}
+}
+
+func (s *tokenStream) Write(p []byte) (int, error) {
+	s.bytes += len(p)
+	if s.est.charsPerToken == 0 {
+		return len(p), nil // generic: bytes are all it needs
+	}
+	s.buf = append(s.buf, p...)
+	if len(s.buf) < tokenChunk {
+		return len(p), nil
+	}
+	cut := safeTokenCut(s.buf)
+	if s.est.bpe.loaded() {
+		cut = safeLineCut(s.buf)
+	}
+	if cut <= 0 && len(s.buf) >= 16*tokenChunk {
+		// before the last rune, which may be incomplete
+		for cut = len(s.buf) - 1; cut > 0 && !utf8.RuneStart(s.buf[cut]); cut-- {
+		}
+	}
+	if cut > 0 {
+		s.n += s.est.count(string(s.buf[:cut]))
+		s.buf = append(s.buf[:0], s.buf[cut:]...)
+	}
+	return len(p), nil
+}
+
+// total counts what is left and returns the count of everything written.
+func (s *tokenStream) total() int {
+	if s.est.charsPerToken == 0 {
+		return (s.bytes + 3) / 4
+	}
+	s.n += s.est.count(string(s.buf))
+	s.buf = s.buf[:0]
+	return s.n
+}
+
+// countReader estimates the tokens read from r.
+func (t tokenEstimator) countReader(r io.Reader) (int, error) {
+	s := newTokenStream(t)
+	if _, err := io.Copy(s, r); err != nil {
+		return 0, err
+	}
+	return s.total(), nil
+}
+
+// countFile estimates the tokens of the file at p.
+func (t tokenEstimator) countFile(p string) (int, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return t.countReader(f)
+}
+
+// safeTokenCut finds the last index where count ends one piece and starts
+// the next whatever follows: between two ASCII characters of different
+// classes (letter, digit, punctuation) or after a newline before a
+// non-space. 0 when there is none.
+func safeTokenCut(b []byte) int {
+	class := func(c byte) int {
+		switch {
+		case c >= utf8.RuneSelf:
+			return -1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			return 0
+		case c >= '0' && c <= '9':
+			return 1
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			return 2
+		}
+		return 3
+	}
+	for p := len(b) - 1; p > 0; p-- {
+		prev, cur := class(b[p-1]), class(b[p])
+		if cur <= 0 {
+			continue
+		}
+		if b[p-1] == '\n' || (prev > 0 && prev != cur) {
+			return p
+		}
+	}
+	return 0
+}
+
+// safeLineCut finds the last line start before a non-space, where the
+// tiktoken pre-tokenizers always start a new piece. 0 when there is none.
+func safeLineCut(b []byte) int {
+	for p := len(b) - 1; p > 0; p-- {
+		if b[p-1] == '\n' && !isSpace(b[p]) {
+			return p
+		}
+	}
+	return 0
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// estimateTokens approximates the token count of text with the generic
+// estimator (about four bytes per token).
+func estimateTokens(text string) int {
+	return tokenEstimators["generic"].count(text)
+}
+
+// tokenReport renders " (~N tokens; label)" for a written pack, with how
+// it compares to model's context window when that is known, or "" when est
+// is nil.
+func tokenReport(p string, est *tokenEstimator, model string) string {
+	if est == nil {
+		return ""
+	}
+	n, err := est.countFile(p)
+	if err != nil {
+		return ""
+	}
+	approx := "~"
+	if est.bpe.loaded() {
+		approx = ""
+	}
+	fit := ""
+	if window := knownContext(model); window > 0 {
+		if n <= window {
+			fit = fmt.Sprintf("; %d%% of the %d-token window of %s", ceilDiv(n*100, window), window, model)
+		} else {
+			fit = fmt.Sprintf("; over the %d-token window of %s by %d", window, model, n-window)
+		}
+	}
+	return fmt.Sprintf(" (%s%d tokens; %s%s)", approx, n, est.label(), fit)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// splitByTokens cuts entries, in order, into parts whose packs as pw
+// renders them (the tree in the first part only; attachments, the omitted
+// list, the contract and the footer in every one) stay within limit
+// tokens. An entry too big for a part of its own is an error, or with
+// force is cut at line boundaries into chunks across consecutive parts.
+func splitByTokens(pw *packWriter, entries []entry, limit int, force bool, est tokenEstimator) ([]packPart, error) {
+	first, err := partOverhead(pw, true, est)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := partOverhead(pw, false, est)
+	if err != nil {
+		return nil, err
+	}
+	if limit-first <= 0 || limit-rest <= 0 {
+		return nil, fmt.Errorf("--split-tokens %d leaves no room for files: the tree, attachments and other sections of a part take ~%d tokens", limit, max(first, rest))
+	}
+	costs, err := renderedTokens(entries, est)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []packPart
+	cur, room := packPart{}, limit-first
+	next := func() {
+		parts = append(parts, cur)
+		cur, room = packPart{}, limit-rest
+	}
+	for i, e := range entries {
+		if costs[i] > room && len(cur.entries) > 0 && costs[i] <= limit-rest {
+			next()
+		}
+		if costs[i] <= room {
+			cur.entries = append(cur.entries, e)
+			room -= costs[i]
+			continue
+		}
+		if !force {
+			return nil, fmt.Errorf("%s is ~%d tokens, more than a part of %d holds; raise --split-tokens, leave it out, or give --split-force to cut it across parts", e.rel, costs[i], limit)
+		}
+		chunks, err := chunkEntry(e, room, limit-rest, est)
+		if err != nil {
+			return nil, err
+		}
+		for j, c := range chunks {
+			if len(c.entries) == 0 {
+				next()
+				continue
+			}
+			if j > 0 && len(chunks[j-1].entries) > 0 {
+				next()
+			}
+			cur.entries = append(cur.entries, c.entries...)
+			room -= c.tokens
+		}
+	}
+	if len(cur.entries) > 0 || len(parts) == 0 {
+		parts = append(parts, cur)
+	}
+	for i := range parts {
+		parts[i].name = fmt.Sprintf("part%d", i+1)
+	}
+	return parts, nil
+}
+
+// partOverhead counts the tokens of a part with no entries.
+func partOverhead(pw *packWriter, first bool, est tokenEstimator) (int, error) {
+	trial := *pw
+	if !first {
+		trial.preamble = ""
+	}
+	s := newTokenStream(est)
+	if err := trial.render(s, nil); err != nil {
+		return 0, err
+	}
+	n := s.total()
+	if pw.footer {
+		n += est.count(provenanceFooter(make([]byte, 32), pw.options, pw.env, pw.key))
+	}
+	return n, nil
+}
+
+// renderedTokens counts each entry as written: header, notes, banners,
+// encryption and all.
+func renderedTokens(entries []entry, est tokenEstimator) ([]int, error) {
+	counts := make([]int, len(entries))
+	err := forEachParallel(len(entries), func(i int) error {
+		s := newTokenStream(est)
+		if err := writeEntry(s, entries[i]); err != nil {
+			return err
+		}
+		counts[i] = s.total()
+		return nil
+	})
+	return counts, err
+}
+
+// entryChunk is one piece of a cut entry and its rendered size. An empty
+// one means the first piece did not fit what was left of the part.
+type entryChunk struct {
+	entries []entry
+	tokens  int
+}
+
+// chunkEntryMark is the widest chunk attribute, charged while sizing the
+// chunks since their count is known only at the end.
+var chunkEntryMark = packprompt.Chunk{Index: 9999, Count: 9999, Offset: 1 << 40}.Attrs()
+
+// chunkEntry cuts e into pieces of whole lines, the first fitting room
+// tokens and the others full, each rendered with the chunk attributes
+// unpack joins them by. A line longer than a whole part is cut too.
+func chunkEntry(e entry, room, full int, est tokenEstimator) ([]entryChunk, error) {
+	data, err := readEntry(e)
+	if err != nil {
+		return nil, err
+	}
+	encoded := isEncoded(e)
+	var units []string
+	for _, l := range strings.SplitAfter(string(data), "\n") {
+		if l == "" {
+			continue
+		}
+		// a quarter of a part keeps every cut line well inside one
+		for n := est.count(l); n > full/4 && len(l) > 1 && !encoded; n = est.count(l) {
+			cut := max(1, len(l)*(full/4)/n)
+			for cut > 1 && !utf8.RuneStart(l[cut]) {
+				cut--
+			}
+			units = append(units, l[:cut])
+			l = l[cut:]
+		}
+		units = append(units, l)
+	}
+
+	piece := func(index int, text string) entry {
+		c := e
+		c.src, c.data, c.size = "", []byte(text), int64(len(text))
+		c.attrs = append(append([]string(nil), e.attrs...), chunkEntryMark...)
+		if index > 1 {
+			c.banners, c.notes = nil, nil
+		}
+		return c
+	}
+	cost := func(c entry) (int, error) {
+		counts, err := renderedTokens([]entry{c}, est)
+		if err != nil {
+			return 0, err
+		}
+		return counts[0], nil
+	}
+
+	var chunks []entryChunk
+	avail := room
+	for len(units) > 0 {
+		// take the units that fit, then shrink until the rendered chunk,
+		// which encryption or encoding can make larger, does too
+		take := 0
+		for total := 0; take < len(units); take++ {
+			total += est.count(units[take])
+			if total > avail {
+				break
+			}
+		}
+		var c entry
+		var n int
+		for ; take > 0; take = take * avail / max(n, avail+1) {
+			c = piece(len(chunks)+1, strings.Join(units[:take], ""))
+			if n, err = cost(c); err != nil {
+				return nil, err
+			}
+			if n <= avail {
+				break
+			}
+		}
+		if take == 0 {
+			if avail < full {
+				// nothing fits what is left of this part; start the next
+				chunks = append(chunks, entryChunk{})
+				avail = full
+				continue
+			}
+			return nil, fmt.Errorf("%s: cannot cut it into parts of %d tokens", e.rel, full)
+		}
+		chunks = append(chunks, entryChunk{entries: []entry{c}, tokens: n})
+		units = units[take:]
+		avail = full
+	}
+
+	var pieces []*entry
+	for i := range chunks {
+		for j := range chunks[i].entries {
+			pieces = append(pieces, &chunks[i].entries[j])
+		}
+	}
+	var offset int64
+	for i, c := range pieces {
+		if i == len(pieces)-1 {
+			// META lines close the file, so they go with its last piece
+			c.meta = e.meta
+		} else {
+			c.meta = nil
+		}
+		ch := packprompt.Chunk{Index: i + 1, Count: len(pieces), Offset: offset}
+		raw := decodedChunk(*c, encoded)
+		c.attrs = rehashed(append(c.attrs[:len(c.attrs)-len(chunkEntryMark)], ch.Attrs()...), raw)
+		offset += int64(len(raw))
+	}
+	return chunks, nil
+}
+
+// decodedChunk is the bytes of the file a chunk holds.
+func decodedChunk(c entry, encoded bool) []byte {
+	if !encoded {
+		return c.data
+	}
+	raw, err := packprompt.DecodeBase64(c.data)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// removeStaleParts deletes the parts after the first n that an earlier
+// split of out left behind, so the parts on disk are one pack. Only files
+// that are packs are removed.
+func removeStaleParts(out string, n int) {
+	for i := n + 1; ; i++ {
+		p := splitPath(out, fmt.Sprintf("part%d", i))
+		head, err := sniffFile(p)
+		if err != nil || !packprompt.IsPackOutput(head) {
+			return
+		}
+		if err := os.Remove(p); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			return
+		}
+		fmt.Printf("Removed %s, left from an earlier split\n", p)
+	}
+}
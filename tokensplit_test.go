@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSplitTokensReport checks --split-tokens reports each part's file
+// count in the singular when it holds one file.
+func TestSplitTokensReport(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": strings.Repeat("alpha ", 400), "b.txt": strings.Repeat("beta ", 400)})
+	res := runCLI(t, src, "pack", "--out", t.TempDir()+"/out.txt", "--split-tokens", "600")
+	if res.code != 0 || !strings.Contains(res.stdout, "Packed 1 file to ") || strings.Contains(res.stdout, "1 files") {
+		t.Errorf("pack --split-tokens: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// transformedAttr lists the --auto-transform rewrites applied to an entry;
+// its content then differs from the file on disk.
+const transformedAttr = "transformed"
+
+// transform rewrites one kind of file to be cheaper to read in a prompt.
+// apply reports false when it leaves the content alone.
+type transform struct {
+	name  string
+	exts  []string
+	apply func(data []byte) ([]byte, bool)
+}
+
+// transforms is the --auto-transform registry, tried in order.
+var transforms = []transform{
+	{"json-pretty", []string{".json", ".map", ".har"}, prettyJSON},
+	{"yaml-blobs", []string{".yaml", ".yml"}, collapseYAMLBlobs},
+	{"strip-ansi", []string{".log", ".out", ".ansi"}, stripANSI},
+}
+
+func transformNames() []string {
+	names := make([]string, len(transforms))
+	for i, t := range transforms {
+		names[i] = t.name
+	}
+	return names
+}
+
+// autoTransform applies the matching transforms to each entry.
+func autoTransform(entries []entry) error {
+	for i := range entries {
+		e := &entries[i]
+		if isEncoded(*e) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(e.rel))
+		var data []byte
+		var applied []string
+		for _, t := range transforms {
+			if !contains(t.exts, ext) {
+				continue
+			}
+			if data == nil {
+				var err error
+				if data, err = readEntry(*e); err != nil {
+					return err
+				}
+			}
+			if out, ok := t.apply(data); ok {
+				data = out
+				applied = append(applied, t.name)
+			}
+		}
+		if len(applied) > 0 {
+			e.data, e.size = data, int64(len(data))
+			e.attrs = append(e.attrs, transformedAttr+"="+strings.Join(applied, "+"))
+		}
+	}
+	return nil
+}
+
+// minifiedLine is the line length past which JSON counts as minified.
+const minifiedLine = 300
+
+// prettyJSON indents minified JSON; hand-formatted files are left as they are.
+func prettyJSON(data []byte) ([]byte, bool) {
+	longest := 0
+	for _, l := range bytes.Split(data, []byte("\n")) {
+		longest = max(longest, len(l))
+	}
+	if longest < minifiedLine || !json.Valid(data) {
+		return nil, false
+	}
+	var b bytes.Buffer
+	if err := json.Indent(&b, bytes.TrimSpace(data), "", "  "); err != nil {
+		return nil, false
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), true
+}
+
+// minBlob is the length from which a base64 value is collapsed.
+const minBlob = 200
+
+var (
+	// key: base64 on one line, optionally quoted
+	yamlInlineBlobRe = regexp.MustCompile(`^(\s*(?:- )?[^\s:#][^:#]*:\s+)(["']?)([A-Za-z0-9+/_-]{` + fmt.Sprint(minBlob) + `,}={0,2})(["']?)\s*$`)
+	// key: | or key: >- opening a block scalar
+	yamlBlockStartRe = regexp.MustCompile(`^(\s*(?:- )?[^\s:#][^:#]*:\s+)[|>][-+]?\s*$`)
+	base64LineRe     = regexp.MustCompile(`^\s*[A-Za-z0-9+/_-]+={0,2}\s*$`)
+)
+
+func blobNote(n int) string {
+	return fmt.Sprintf("<base64, %d bytes, collapsed by packprompt>", n*3/4)
+}
+
+// collapseYAMLBlobs replaces long base64 values (inline or block scalars,
+// as in Kubernetes secrets and Helm values) with a short placeholder.
+func collapseYAMLBlobs(data []byte) ([]byte, bool) {
+	lines := strings.SplitAfter(string(data), "\n")
+	var b strings.Builder
+	changed := false
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		if m := yamlInlineBlobRe.FindStringSubmatch(strings.TrimRight(l, "\r\n")); m != nil && m[2] == m[4] {
+			b.WriteString(m[1] + `"` + blobNote(len(m[3])) + `"` + "\n")
+			changed = true
+			continue
+		}
+		if m := yamlBlockStartRe.FindStringSubmatch(strings.TrimRight(l, "\r\n")); m != nil {
+			indent := len(l) - len(strings.TrimLeft(l, " "))
+			j, n := i+1, 0
+			for j < len(lines) {
+				body := lines[j]
+				if strings.TrimSpace(body) == "" || len(body)-len(strings.TrimLeft(body, " ")) <= indent || !base64LineRe.MatchString(body) {
+					break
+				}
+				n += len(strings.TrimSpace(body))
+				j++
+			}
+			if n >= minBlob {
+				b.WriteString(m[1] + `"` + blobNote(n) + `"` + "\n")
+				i = j - 1
+				changed = true
+				continue
+			}
+		}
+		b.WriteString(l)
+	}
+	if !changed {
+		return nil, false
+	}
+	return []byte(b.String()), true
+}
+
+// ansiRe matches CSI sequences (colors, cursor movement) and OSC sequences
+// (titles, hyperlinks).
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripANSI removes terminal escape codes from captured output.
+func stripANSI(data []byte) ([]byte, bool) {
+	if bytes.IndexByte(data, 0x1b) < 0 {
+		return nil, false
+	}
+	return ansiRe.ReplaceAll(data, nil), true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHashMatchesPack checks hash prints the tree hash pack records in its
+// manifest, under the same filters.
+func TestHashMatchesPack(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n", "b.go": "package b\n", "skip/c.txt": "gamma\n"})
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	if res := runCLI(t, src, "pack", "--exclude", "skip", "--out", filepath.Join(dir, "pack.txt"), "--manifest", manifest); res.code != 0 {
+		t.Fatalf("pack: exit %d: %s", res.code, res.stderr)
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct{ Tree string }
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	res := runCLI(t, src, "hash", "--exclude", "skip")
+	if res.code != 0 || strings.TrimSpace(res.stdout) != m.Tree {
+		t.Errorf("hash: exit %d: %q, want %q: %s", res.code, res.stdout, m.Tree, res.stderr)
+	}
+	if res := runCLI(t, src, "hash"); strings.TrimSpace(res.stdout) == m.Tree {
+		t.Errorf("hash without the exclude matched: %s", res.stdout)
+	}
+}
+
+// TestHashSideEffects checks hash fetches no attachments, writes no skip
+// report and still prints the hash with --dry-run.
+func TestHashSideEffects(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n"})
+	report := filepath.Join(t.TempDir(), "skipped.txt")
+	want := runCLI(t, src, "hash").stdout
+	res := runCLI(t, src, "hash", "--attach", filepath.Join(src, "missing.md"), "--skip-report", report, "--dry-run")
+	if res.code != 0 || res.stdout != want || !strings.HasPrefix(want, treeHashScheme) {
+		t.Errorf("hash: exit %d: %q, want %q: %s", res.code, res.stdout, want, res.stderr)
+	}
+	if _, err := os.Stat(report); err == nil {
+		t.Errorf("hash wrote --skip-report")
+	}
+}
+
+// TestIfChangedInTreeManifest checks --if-changed skips a second pack of
+// an unchanged tree when the pack and manifest are written into it.
+func TestIfChangedInTreeManifest(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n"})
+	args := []string{"pack", "--out", "pack.txt", "--manifest", "manifest.json", "--if-changed"}
+	if res := runCLI(t, src, args...); res.code != 0 || strings.Contains(res.stdout, "Unchanged") {
+		t.Fatalf("first pack: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+	if res := runCLI(t, src, args...); res.code != 0 || !strings.Contains(res.stdout, "Unchanged") {
+		t.Errorf("second pack: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("omega\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res := runCLI(t, src, args...); res.code != 0 || strings.Contains(res.stdout, "Unchanged") {
+		t.Errorf("pack after a change: exit %d: %s%s", res.code, res.stdout, res.stderr)
+	}
+}
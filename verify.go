@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/reaandrew/packprompt/pkg/packprompt"
+)
+
+// packCheck collects what verify finds: problems fail it, warnings and
+// notes are reported alongside.
+type packCheck struct {
+	entries, checked, sealed int
+	problems, warnings       []string
+	notes                    []string
+	byEntry                  bool   // place findings by entry number, for formats without lines to count
+	signer                   string // the keyring key the footer is signed with, once it verifies
+	unsigned                 string // else why the pack does not count as signed
+}
+
+func (c *packCheck) problem(line int, format string, a ...any) {
+	c.problems = append(c.problems, c.where(line)+fmt.Sprintf(format, a...))
+}
+
+func (c *packCheck) warn(line int, format string, a ...any) {
+	c.warnings = append(c.warnings, c.where(line)+fmt.Sprintf(format, a...))
+}
+
+func (c *packCheck) where(n int) string {
+	if c.byEntry {
+		return fmt.Sprintf("entry %d: ", n)
+	}
+	return fmt.Sprintf("line %d: ", n)
+}
+
+// verifyOptions holds verify's flags.
+type verifyOptions struct {
+	in            string
+	manifestPath  string
+	passFile      string
+	keyring       string
+	requireSigned bool
+}
+
+// verifyFlags declares verify's flags into o.
+func verifyFlags(o *verifyOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("verify", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "pack to check (- for stdin)")
+	flg.StringVar(&o.manifestPath, "manifest", "", "also check every file of this manifest (from pack --manifest) is present and intact")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "decrypt encrypted entries to check them, with the passphrase in this file (default: $PACKPROMPT_PASSPHRASE)")
+	flg.StringVar(&o.keyring, "keyring", defaultKeyring(), "keyring whose keys a signed footer is checked against")
+	flg.BoolVar(&o.requireSigned, "require-signed", false, "fail unless the footer is signed by a key in --keyring")
+	return flg
+}
+
+// verifyCmd checks a pack for truncation and mangling, exiting 1 when it
+// finds either.
+func verifyCmd(args []string) {
+	var o verifyOptions
+	flg := verifyFlags(&o)
+	parseFlags(flg, args)
+
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+	var rd io.Reader = os.Stdin
+	if o.in != "-" || o.manifestPath != "" {
+		// the manifest check reads the pack again, so stdin is then kept whole
+		f, err := openPack(o.in)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		rd = f
+	}
+	rd, format, err := sniffReader(rd)
+	if err != nil {
+		fatal(err)
+	}
+	var c *packCheck
+	if format == formatText {
+		c = verifyPack(rd, ciph, o.keyring)
+	} else {
+		c = verifyEntries(rd, format, ciph)
+	}
+	if o.manifestPath != "" {
+		m, err := readManifest(o.manifestPath)
+		if err != nil {
+			fatal(err)
+		}
+		f, err := openPack(o.in)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		files, err := packFiles(f, format)
+		if err != nil {
+			fatal(err)
+		}
+		for _, d := range findDamage(files, m) {
+			c.problems = append(c.problems, fmt.Sprintf("%s: %s (manifest %s)", d.file.Path, d.reason, o.manifestPath))
+		}
+		c.notes = append(c.notes, fmt.Sprintf("all %d files of %s checked", len(m.Files), o.manifestPath))
+	}
+
+	for _, w := range c.warnings {
+		fmt.Fprintln(os.Stderr, "warning: "+w)
+	}
+	for _, p := range c.problems {
+		fmt.Println(p)
+	}
+	summary := fmt.Sprintf("%s, %d with checksums", plural(c.entries, "entry"), c.checked)
+	if c.sealed > 0 {
+		summary += fmt.Sprintf(", %d encrypted left unchecked", c.sealed)
+	}
+	for _, n := range c.notes {
+		summary += "; " + n
+	}
+	if len(c.problems) > 0 {
+		fmt.Printf("CORRUPT: %s in %s (%s)\n", plural(len(c.problems), "problem"), o.in, summary)
+		os.Exit(1)
+	}
+	if o.requireSigned && c.signer == "" {
+		fmt.Printf("UNTRUSTED: %s is not signed by a key in %s: %s (%s)\n", o.in, o.keyring, c.unsigned, summary)
+		os.Exit(1)
+	}
+	fmt.Printf("OK: %s (%s)\n", o.in, summary)
+}
+
+// packLines reads a text pack a line at a time for verify, with a line of
+// lookahead and the SHA-256 of every line taken so far, which is what a
+// footer's digest covers once its first line is next.
+type packLines struct {
+	r      *bufio.Reader
+	n      int    // lines taken
+	next   string // the line peek read, with its newline
+	peeked bool
+	err    error // other than io.EOF
+	body   hash.Hash
+}
+
+func newPackLines(r io.Reader) *packLines {
+	return &packLines{r: bufio.NewReader(r), body: sha256.New()}
+}
+
+// peek returns the next line, with its newline, without taking it; ok is
+// false at the end of the pack.
+func (p *packLines) peek() (string, bool) {
+	if !p.peeked {
+		var err error
+		p.next, err = p.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			p.next, p.err = "", err
+		}
+		p.peeked = true
+	}
+	return p.next, p.next != ""
+}
+
+// take returns the next line and moves past it.
+func (p *packLines) take() (string, bool) {
+	l, ok := p.peek()
+	if ok {
+		p.peeked = false
+		p.n++
+		io.WriteString(p.body, l)
+	}
+	return l, ok
+}
+
+// lineText is a pack line without its line ending.
+func lineText(l string) string {
+	return strings.TrimRight(l, "\r\n")
+}
+
+// verifyPack reads a pack line by line and checks every header, note and
+// metadata count, end mark, encoding, encryption tag and checksum, and the
+// footer's digest and signature. Only an entry at a time is held.
+func verifyPack(r io.Reader, ciph *entryCipher, keyring string) *packCheck {
+	c := &packCheck{}
+	lines := newPackLines(r)
+	seen := map[string]int{}
+	for {
+		l, ok := lines.peek()
+		if !ok {
+			break
+		}
+		line := lineText(l)
+		if line == footerStart {
+			verifyFooter(c, lines, keyring)
+			return c
+		}
+		lines.take()
+		switch {
+		case line == contractMark:
+			start := lines.n
+			for {
+				l, ok := lines.take()
+				if !ok {
+					c.problem(start, "the response contract has no end line; the pack is cut off")
+					break
+				}
+				if lineText(l) == contractEnd {
+					break
+				}
+			}
+		case strings.HasPrefix(line, startMark):
+			verifyEntry(c, lines, line, ciph, seen)
+		}
+	}
+	if lines.err != nil {
+		c.problem(lines.n+1, "reading the pack: %v", lines.err)
+	}
+	c.notes = append(c.notes, "no footer")
+	c.unsigned = "it has no footer"
+	return c
+}
+
+// verifyEntry checks the entry whose header, just taken, is header.
+func verifyEntry(c *packCheck, lines *packLines, header string, ciph *entryCipher, seen map[string]int) {
+	start := lines.n
+	rel, mode, attrs, ok := packprompt.ParseHeader(header)
+	if !ok {
+		c.problem(start, "malformed header %q", header)
+		return
+	}
+	c.entries++
+	if !packprompt.SafePath(rel) {
+		c.problem(start, "%s: unsafe path", rel)
+	}
+	if _, chunk, err := packprompt.ParseChunk(attrs); err != nil {
+		c.problem(start, "%s: %v", rel, err)
+	} else if prev, dup := seen[rel]; dup && !chunk {
+		c.warn(start, "%s is packed again (first at line %d); unpack keeps the last", rel, prev)
+	}
+	if _, dup := seen[rel]; !dup {
+		seen[rel] = start
+	}
+	if v, has := attrs[notesAttr]; has {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.problem(start, "%s: invalid %s=%q", rel, notesAttr, v)
+			n = 0
+		}
+		for k := 0; k < n; k++ {
+			if l, ok := lines.peek(); !ok || !strings.HasPrefix(lineText(l), noteMark) {
+				c.problem(lines.n+1, "%s: %d note lines announced, %d found", rel, n, k)
+				break
+			}
+			lines.take()
+		}
+	}
+	var body strings.Builder
+	for {
+		l, ok := lines.take()
+		if !ok {
+			c.problem(lines.n, "%s: no %q; the pack is cut off", rel, endMark)
+			return
+		}
+		t := lineText(l)
+		if t == endMark {
+			break
+		}
+		if other, _, _, ok := packprompt.ParseHeader(t); ok {
+			c.warn(lines.n, "the header of %s is inside the content of %s, which may have lost its end line", other, rel)
+		}
+		// the content keeps its own CRs
+		body.WriteString(strings.TrimSuffix(l, "\n") + "\n")
+	}
+	content, _, err := packprompt.SplitMeta(rel, []byte(body.String()), attrs)
+	if err != nil {
+		c.problem(start, "%v", err)
+		return
+	}
+	pf := packedFile{rel: rel, mode: mode, attrs: attrs, content: bytes.TrimSuffix(content, []byte("\n"))}
+	checkContent(c, start, pf, ciph)
+}
+
+// checkContent decodes pf, found at line (or entry) n, and checks it
+// against its sha256.
+func checkContent(c *packCheck, n int, pf packedFile, ciph *entryCipher) {
+	decoded, ok, err := pf.decode(ciph)
+	switch {
+	case err != nil:
+		c.problem(n, "%v", err)
+	case !ok:
+		c.sealed++
+	default:
+		if want, has := pf.attrs[sha256Attr]; has {
+			c.checked++
+			if got := contentHash(decoded); got != want {
+				c.problem(n, "%s: content does not match its sha256 (%s, header %s)", pf.rel, got[:12], shortHash(want))
+			}
+		} else if _, enc := pf.attrs[encryptedAttr]; enc {
+			c.checked++ // the cipher's tag vouches for it
+		}
+	}
+}
+
+// verifyEntries checks a pack in one of the structured formats, which
+// have no end marks to lose and carry no footer: every entry must read
+// back and match its sha256.
+func verifyEntries(r io.Reader, format string, ciph *entryCipher) *packCheck {
+	c := &packCheck{byEntry: true}
+	var data []byte
+	if format == formatTar {
+		// whether it ends in its end-of-archive blocks takes all of it
+		var err error
+		if data, err = io.ReadAll(r); err != nil {
+			c.problem(1, "%v", err)
+			return c
+		}
+		r = bytes.NewReader(data)
+	}
+	seen := map[string]int{}
+	err := readPackAs(r, format, func(pf packedFile) error {
+		c.entries++
+		if _, chunk, err := packprompt.ParseChunk(pf.attrs); err != nil {
+			c.problem(c.entries, "%s: %v", pf.rel, err)
+		} else if prev, dup := seen[pf.rel]; dup && !chunk {
+			c.warn(c.entries, "%s is packed again (first as entry %d); unpack keeps the last", pf.rel, prev)
+		}
+		if _, dup := seen[pf.rel]; !dup {
+			seen[pf.rel] = c.entries
+		}
+		checkContent(c, c.entries, pf, ciph)
+		return nil
+	})
+	if err != nil {
+		c.problem(c.entries+1, "%v", err)
+	} else if format == formatTar {
+		if ended, err := packprompt.TarEnded(data); err == nil && !ended {
+			c.problem(c.entries+1, "no end-of-archive blocks; the pack is cut off")
+		}
+	}
+	c.notes = append(c.notes, format+" format, no footer")
+	c.unsigned = "a " + format + " pack carries no footer"
+	return c
+}
+
+// packFiles reads the entries of a pack for a manifest check: text packs
+// through scanPack, so damaged entries still count, others as they read.
+func packFiles(r io.Reader, format string) ([]scannedFile, error) {
+	if format == formatText {
+		return scanPack(r)
+	}
+	var files []scannedFile
+	err := readPackAs(r, format, func(pf packedFile) error {
+		files = append(files, scannedFile{rel: pf.rel, mode: pf.mode, attrs: pf.attrs, content: pf.content, complete: true})
+		return nil
+	})
+	return files, err
+}
+
+// plural renders n of a noun: "1 entry", "2 entries", "2 patches".
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+	case strings.HasSuffix(noun, "y"):
+		noun = strings.TrimSuffix(noun, "y") + "ies"
+	case strings.HasSuffix(noun, "ch") || strings.HasSuffix(noun, "s"):
+		noun += "es"
+	default:
+		noun += "s"
+	}
+	return fmt.Sprintf("%d %s", n, noun)
+}
+
+// checkWritten reads back the file unpack wrote at full and checks its bytes
+// from offset (past earlier chunks) against want.
+func checkWritten(full string, offset int64, want string) error {
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return err
+	}
+	if offset > int64(len(data)) {
+		return fmt.Errorf("shorter than the %d bytes of its earlier chunks", offset)
+	}
+	if got := contentHash(data[offset:]); got != want {
+		return fmt.Errorf("written content does not match its sha256 (%s, header %s)", shortHash(got), shortHash(want))
+	}
+	return nil
+}
+
+func shortHash(h string) string {
+	return h[:min(len(h), 12)]
+}
+
+// verifyFooter checks the provenance footer, the next of lines, against
+// the digest of everything before it.
+func verifyFooter(c *packCheck, lines *packLines, keyring string) {
+	body := hex.EncodeToString(lines.body.Sum(nil))
+	start := lines.n + 1
+	fields := map[string]string{}
+	var signed strings.Builder
+	end, after := false, 0
+	for {
+		l, ok := lines.take()
+		if !ok {
+			break
+		}
+		if end {
+			if strings.TrimSpace(l) != "" {
+				after = lines.n
+				break
+			}
+			continue
+		}
+		t := lineText(l)
+		if t == footerEnd {
+			end = true
+			continue
+		}
+		k, v, _ := strings.Cut(t, "=")
+		if k == "signature" {
+			fields[k] = v
+			continue
+		}
+		if _, sig := fields["signature"]; !sig {
+			signed.WriteString(t + "\n")
+		}
+		fields[k] = v
+	}
+	if !end {
+		c.problem(start, "the footer has no end line; the pack is cut off")
+	}
+	_, hasSig := fields["signature"]
+	if after > 0 && hasSig {
+		// nothing after the footer is signed, and readers ignore it
+		c.problem(after, "text after the signed footer, which the signature does not cover")
+		c.unsigned = "there is text after the signed footer"
+		return
+	}
+	if after > 0 {
+		c.warn(after, "text after the footer; readers ignore it")
+	}
+	intact := fields["sha256"] == body
+	if !intact {
+		c.problem(start, "the body does not match the footer's sha256: the pack was changed after it was written")
+		c.unsigned = "the body does not match the signed digest"
+	} else {
+		c.notes = append(c.notes, "footer digest matches")
+	}
+	sig, ok := strings.CutPrefix(fields["signature"], "ed25519:")
+	if !ok {
+		if intact {
+			c.unsigned = "the footer has no signature"
+		}
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		c.problem(start, "unreadable footer signature")
+		c.unsigned = "unreadable footer signature"
+		return
+	}
+	keys, err := readKeyring(keyring)
+	if err != nil {
+		c.warn(start, "keyring: %v", err)
+	}
+	for _, k := range keys {
+		if k.fingerprint == fields["key"] {
+			if !ed25519.Verify(k.pub, []byte(signed.String()), raw) {
+				c.problem(start, "the footer signature does not verify with %s (%s)", k.name, k.fingerprint)
+				c.unsigned = "the signature does not verify"
+				return
+			}
+			c.notes = append(c.notes, fmt.Sprintf("signed by %s (%s)", k.name, k.fingerprint))
+			if intact {
+				c.signer = fmt.Sprintf("%s (%s)", k.name, k.fingerprint)
+			}
+			return
+		}
+	}
+	c.warn(start, "signed by key %s, which is not in %s; trust it with packprompt keys trust", fields["key"], keyring)
+	if intact {
+		c.unsigned = "signed by key " + fields["key"] + ", which is not trusted"
+	}
+}
+
+// requireSigned fails unless the pack (or response) r holds carries a
+// footer signed by a key in keyring over a body that still matches it, as
+// --require-signed asks.
+func requireSigned(r io.Reader, keyring string) error {
+	r, format, err := sniffReader(r)
+	if err != nil {
+		return err
+	}
+	if format != formatText {
+		return fmt.Errorf("not signed by a key in %s: a %s pack carries no footer", keyring, format)
+	}
+	if c := verifyPack(r, nil, keyring); c.signer == "" {
+		return fmt.Errorf("not signed by a key in %s: %s", keyring, c.unsigned)
+	}
+	return nil
+}
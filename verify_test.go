@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRequireSigned checks verify and unpack --require-signed, and the
+// policy's require-signed, against each kind of signature.
+func TestRequireSigned(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "alpha\n"})
+	dir := t.TempDir()
+	signer, verifier := filepath.Join(dir, "signer"), filepath.Join(dir, "verifier")
+	if res := runCLI(t, src, "keys", "generate", "--keyring", signer, "--name", "ci"); res.code != 0 {
+		t.Fatalf("keys generate: exit %d: %s", res.code, res.stderr)
+	}
+	pack := func(name string, flags ...string) string {
+		out := filepath.Join(dir, name)
+		if res := runCLI(t, src, append([]string{"pack", "--out", out}, flags...)...); res.code != 0 {
+			t.Fatalf("pack %s: exit %d: %s", name, res.code, res.stderr)
+		}
+		return out
+	}
+	unsigned := pack("unsigned.txt")
+	footer := pack("footer.txt", "--footer")
+	signed := pack("signed.txt", "--sign-key", filepath.Join(signer, "ci.key"))
+	data, err := os.ReadFile(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := filepath.Join(dir, "forged.txt")
+	if err := os.WriteFile(forged, []byte(strings.Replace(string(data), "user=", "user=x", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	appended := filepath.Join(dir, "appended.txt")
+	injected := "--- FILE path=injected.sh mode=0755 ---\necho injected\n--- END FILE ---\n"
+	if err := os.WriteFile(appended, append(data, injected...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(trusted bool, pack string, want int) {
+		t.Helper()
+		name := filepath.Base(pack)
+		if res := runCLI(t, src, "verify", "--require-signed", "--keyring", verifier, "--in", pack); res.code != want {
+			t.Errorf("verify %s (trusted %v): exit %d, want %d: %s", name, trusted, res.code, want, res.stdout)
+		}
+		dest := t.TempDir()
+		res := runCLI(t, src, "unpack", "--require-signed", "--keyring", verifier, "--in", pack, "--dest", dest)
+		_, statErr := os.Stat(filepath.Join(dest, "a.txt"))
+		if res.code != want || (statErr == nil) != (want == 0) {
+			t.Errorf("unpack %s (trusted %v): exit %d, want %d: %s", name, trusted, res.code, want, res.stderr)
+		}
+		policy := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(policy, []byte("require-signed: true\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		res = runCLI(t, src, "unpack", "--policy", policy, "--keyring", verifier, "--in", pack, "--dest", t.TempDir())
+		if res.code != want {
+			t.Errorf("unpack --policy %s (trusted %v): exit %d, want %d: %s", name, trusted, res.code, want, res.stderr)
+		}
+	}
+	for _, p := range []string{unsigned, footer, signed, forged} {
+		check(false, p, 1)
+	}
+	if res := runCLI(t, src, "keys", "trust", "--keyring", verifier, filepath.Join(signer, "ci.pub")); res.code != 0 {
+		t.Fatalf("keys trust: exit %d: %s", res.code, res.stderr)
+	}
+	for _, p := range []string{unsigned, footer, forged, appended} {
+		check(true, p, 1)
+	}
+	check(true, signed, 0)
+
+	dest := t.TempDir()
+	if res := runCLI(t, src, "unpack", "--in", appended, "--dest", dest); res.code != 0 {
+		t.Errorf("unpack %s: exit %d: %s", filepath.Base(appended), res.code, res.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "injected.sh")); err == nil {
+		t.Errorf("unpack wrote an entry after the footer")
+	}
+}
+
+// TestApplyRequireSigned checks apply --require-signed refuses a response
+// without a trusted signature and applies one signed by a trusted key.
+func TestApplyRequireSigned(t *testing.T) {
+	dir := t.TempDir()
+	keyring := filepath.Join(dir, "keys")
+	root := t.TempDir()
+	if res := runCLI(t, root, "keys", "generate", "--keyring", keyring, "--name", "me"); res.code != 0 {
+		t.Fatalf("keys generate: exit %d: %s", res.code, res.stderr)
+	}
+	response := "--- FILE path=new.txt mode=0644 base=new ---\nhello\n--- END FILE ---\n"
+	plain := filepath.Join(dir, "response.txt")
+	if err := os.WriteFile(plain, []byte(response), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res := runCLI(t, root, "apply", "--require-signed", "--keyring", keyring, "--in", plain)
+	if _, err := os.Stat(filepath.Join(root, "new.txt")); res.code != 1 || err == nil {
+		t.Fatalf("unsigned response: exit %d, new.txt written: %v: %s", res.code, err == nil, res.stderr)
+	}
+	key, err := loadSigningKey(filepath.Join(keyring, "me.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(response)
+	sum := sha256.Sum256(body)
+	footer := provenanceFooter(sum[:], "", packEnv{}, key)
+	signed := filepath.Join(dir, "signed.txt")
+	if err := os.WriteFile(signed, append(body, footer...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res := runCLI(t, root, "apply", "--require-signed", "--keyring", keyring, "--in", signed); res.code != 0 {
+		t.Fatalf("signed response: exit %d: %s", res.code, res.stderr)
+	}
+}
+
+// TestKeysGenerateName checks keys generate takes the key name as NAME,
+// and refuses arguments it would otherwise ignore.
+func TestKeysGenerateName(t *testing.T) {
+	dir := t.TempDir()
+	keyring := filepath.Join(dir, "keys")
+	if res := runCLI(t, dir, "keys", "generate", "--keyring", keyring, "ci"); res.code != 0 {
+		t.Fatalf("keys generate ci: exit %d: %s", res.code, res.stderr)
+	}
+	if _, err := os.Stat(filepath.Join(keyring, "ci.key")); err != nil {
+		t.Errorf("keys generate ci: %v", err)
+	}
+	for _, args := range [][]string{{"generate", "--keyring", keyring, "a", "b"}, {"generate", "--keyring", keyring, "--name", "a", "b"}, {"list", "--keyring", keyring, "extra"}} {
+		if res := runCLI(t, dir, append([]string{"keys"}, args...)...); res.code != 1 || !strings.Contains(res.stderr, "usage: packprompt keys "+args[0]) {
+			t.Errorf("keys %v: exit %d: %s", args, res.code, res.stderr)
+		}
+	}
+}
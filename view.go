@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type viewFile struct {
+	rel   string
+	lines []string
+	note  string   // shown instead of content, e.g. for encrypted entries
+	notes []string // --note lines from the packer, shown in the status line
+}
+
+type treeRow struct {
+	text string
+	file int // index into viewer.files, -1 for directories
+}
+
+// viewer is the state of `packprompt view`: a tree pane on the left, the
+// selected file on the right and a status line at the bottom.
+type viewer struct {
+	files []viewFile
+	rows  []treeRow
+	hl    map[int][][]span // highlighted lines per file, built on first display
+
+	row           int // selected tree row (always a file)
+	treeTop       int
+	top           int // first content line shown
+	focusTree     bool
+	width, height int // terminal size
+
+	prompt  bool // typing a search
+	query   string
+	matches []viewMatch
+	match   int
+	message string
+}
+
+type viewMatch struct{ row, line int }
+
+// viewOptions holds view's flags.
+type viewOptions struct {
+	in       string
+	passFile string
+}
+
+// viewFlags declares view's flags into o.
+func viewFlags(o *viewOptions) *flag.FlagSet {
+	flg := flag.NewFlagSet("view", flag.ExitOnError)
+	flg.StringVar(&o.in, "in", "files-prompt.txt", "input prompt file")
+	flg.StringVar(&o.passFile, "passphrase-file", "", "read the passphrase for encrypted entries from this file (default: $PACKPROMPT_PASSPHRASE)")
+	return flg
+}
+
+func viewCmd(args []string) {
+	var o viewOptions
+	flg := viewFlags(&o)
+	parseFlags(flg, args)
+
+	var ciph *entryCipher
+	if pass, err := loadPassphrase(o.passFile); err != nil {
+		fatal(err)
+	} else if pass != "" {
+		ciph = &entryCipher{passphrase: pass}
+	}
+	f, err := os.Open(o.in)
+	if err != nil {
+		fatal(err)
+	}
+	var files []viewFile
+	err = readPack(f, func(pf packedFile) error {
+		vf := viewFile{rel: pf.rel, notes: pf.notes}
+		content, ok, err := pf.decode(ciph)
+		switch {
+		case err != nil:
+			vf.note = err.Error()
+		case !ok:
+			vf.note = "encrypted; set PACKPROMPT_PASSPHRASE or --passphrase-file to view"
+		default:
+			vf.lines = strings.Split(strings.ReplaceAll(string(content), "\t", "    "), "\n")
+		}
+		files = append(files, vf)
+		return nil
+	})
+	f.Close()
+	if err != nil {
+		fatal(err)
+	}
+	if len(files) == 0 {
+		fatal(fmt.Errorf("%s: no entries to view", o.in))
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		fatal(fmt.Errorf("view needs an interactive terminal; use stats or unpack instead"))
+	}
+	restore, err := rawTerminal(os.Stdin.Fd())
+	if err != nil {
+		fatal(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	// alternate screen, hidden cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+		out.Flush()
+		restore()
+	}()
+
+	v := newViewer(files)
+	keys := make(chan string)
+	go readKeys(keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	for {
+		v.width, v.height, err = terminalSize(os.Stdout.Fd())
+		if err != nil || v.width < 20 || v.height < 4 {
+			v.width, v.height = 80, 24
+		}
+		v.draw(out)
+		out.Flush()
+		select {
+		case k, ok := <-keys:
+			if !ok || !v.key(k) {
+				return
+			}
+		case <-resize:
+		}
+	}
+}
+
+func newViewer(files []viewFile) *viewer {
+	v := &viewer{files: files, hl: map[int][][]span{}, focusTree: true}
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return files[order[a]].rel < files[order[b]].rel })
+	var prev []string
+	for _, i := range order {
+		parts := strings.Split(files[i].rel, "/")
+		common := 0
+		for common < len(parts)-1 && common < len(prev)-1 && parts[common] == prev[common] {
+			common++
+		}
+		for d := common; d < len(parts)-1; d++ {
+			v.rows = append(v.rows, treeRow{text: strings.Repeat("  ", d) + parts[d] + "/", file: -1})
+		}
+		v.rows = append(v.rows, treeRow{text: strings.Repeat("  ", len(parts)-1) + parts[len(parts)-1], file: i})
+		prev = parts
+	}
+	v.row = -1
+	v.moveSelection(1)
+	return v
+}
+
+// readKeys turns raw terminal input into key names: printable text as is,
+// escape sequences as "up", "pgdn", ...
+func readKeys(keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	seqs := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdn", "\x1b[H": "home", "\x1b[F": "end",
+		"\x1b[1~": "home", "\x1b[4~": "end", "\x1bOH": "home", "\x1bOF": "end",
+	}
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		s := string(buf[:n])
+		if name, ok := seqs[s]; ok {
+			keys <- name
+			continue
+		}
+		if strings.HasPrefix(s, "\x1b") {
+			keys <- "esc"
+			continue
+		}
+		for _, r := range s {
+			switch r {
+			case '\r', '\n':
+				keys <- "enter"
+			case '\t':
+				keys <- "tab"
+			case 0x7f, 0x08:
+				keys <- "backspace"
+			case 0x03:
+				keys <- "ctrl-c"
+			default:
+				keys <- string(r)
+			}
+		}
+	}
+}
+
+func (v *viewer) current() int { return v.rows[v.row].file }
+
+func (v *viewer) paneHeight() int { return v.height - 1 }
+
+// moveSelection moves by delta files in the tree, skipping directory rows.
+func (v *viewer) moveSelection(delta int) {
+	step := 1
+	if delta < 0 {
+		step, delta = -1, -delta
+	}
+	r := v.row
+	for ; delta > 0; delta-- {
+		next := r + step
+		for next >= 0 && next < len(v.rows) && v.rows[next].file < 0 {
+			next += step
+		}
+		if next < 0 || next >= len(v.rows) {
+			break
+		}
+		r = next
+	}
+	if r != v.row && r >= 0 {
+		v.row, v.top = r, 0
+	}
+}
+
+func (v *viewer) scroll(delta int) {
+	n := len(v.files[v.current()].lines)
+	v.top = max(0, min(v.top+delta, n-v.paneHeight()))
+}
+
+// key handles one key press; it returns false to quit.
+func (v *viewer) key(k string) bool {
+	v.message = ""
+	if v.prompt {
+		switch k {
+		case "enter":
+			v.prompt = false
+			v.search()
+		case "esc", "ctrl-c":
+			v.prompt, v.query = false, ""
+		case "backspace":
+			if v.query != "" {
+				_, size := utf8.DecodeLastRuneInString(v.query)
+				v.query = v.query[:len(v.query)-size]
+			}
+		default:
+			if utf8.RuneCountInString(k) == 1 {
+				v.query += k
+			}
+		}
+		return true
+	}
+	page := v.paneHeight()
+	switch k {
+	case "q", "ctrl-c":
+		return false
+	case "tab", "left", "right", "h", "l":
+		v.focusTree = !v.focusTree
+		if k == "left" || k == "h" {
+			v.focusTree = true
+		} else if k == "right" || k == "l" {
+			v.focusTree = false
+		}
+	case "enter":
+		v.focusTree = false
+	case "down", "j":
+		if v.focusTree {
+			v.moveSelection(1)
+		} else {
+			v.scroll(1)
+		}
+	case "up", "k":
+		if v.focusTree {
+			v.moveSelection(-1)
+		} else {
+			v.scroll(-1)
+		}
+	case "pgdn", " ":
+		if v.focusTree {
+			v.moveSelection(page)
+		} else {
+			v.scroll(page)
+		}
+	case "pgup", "b":
+		if v.focusTree {
+			v.moveSelection(-page)
+		} else {
+			v.scroll(-page)
+		}
+	case "home", "g":
+		if v.focusTree {
+			v.row = -1
+			v.moveSelection(1)
+		} else {
+			v.top = 0
+		}
+	case "end", "G":
+		if v.focusTree {
+			v.row = len(v.rows)
+			v.moveSelection(-1)
+		} else {
+			v.scroll(len(v.files[v.current()].lines))
+		}
+	case "/":
+		v.prompt, v.query = true, ""
+	case "n":
+		v.jump(1)
+	case "N":
+		v.jump(-1)
+	}
+	return true
+}
+
+// search collects case-insensitive matches of the query in paths and
+// content, in tree order, and jumps to the first one after the selection.
+func (v *viewer) search() {
+	v.matches = nil
+	q := strings.ToLower(v.query)
+	if q == "" {
+		return
+	}
+	for r, row := range v.rows {
+		if row.file < 0 {
+			continue
+		}
+		f := v.files[row.file]
+		if strings.Contains(strings.ToLower(f.rel), q) {
+			v.matches = append(v.matches, viewMatch{r, -1})
+		}
+		for i, l := range f.lines {
+			if strings.Contains(strings.ToLower(l), q) {
+				v.matches = append(v.matches, viewMatch{r, i})
+			}
+		}
+	}
+	if len(v.matches) == 0 {
+		v.message = "no match for " + v.query
+		return
+	}
+	v.match = -1
+	for i, m := range v.matches {
+		if m.row > v.row || (m.row == v.row && m.line > v.top) {
+			v.match = i - 1
+			break
+		}
+	}
+	v.jump(1)
+}
+
+func (v *viewer) jump(delta int) {
+	if len(v.matches) == 0 {
+		v.message = "no search; press / to search"
+		return
+	}
+	v.match = ((v.match+delta)%len(v.matches) + len(v.matches)) % len(v.matches)
+	m := v.matches[v.match]
+	v.row = m.row
+	v.top = 0
+	if m.line >= 0 {
+		v.top = max(0, m.line-v.paneHeight()/3)
+		v.focusTree = false
+	}
+	v.message = fmt.Sprintf("match %d/%d", v.match+1, len(v.matches))
+}
+
+func (v *viewer) highlighted(i int) [][]span {
+	if hl, ok := v.hl[i]; ok {
+		return hl
+	}
+	h := newHighlighter(v.files[i].rel)
+	hl := make([][]span, len(v.files[i].lines))
+	for n, l := range v.files[i].lines {
+		hl[n] = h.spans(l)
+	}
+	v.hl[i] = hl
+	return hl
+}
+
+func (v *viewer) draw(w *bufio.Writer) {
+	height := v.paneHeight()
+	treeW := max(20, min(48, v.width/3))
+	textW := v.width - treeW - 1
+	if v.row < v.treeTop {
+		v.treeTop = v.row
+	} else if v.row >= v.treeTop+height {
+		v.treeTop = v.row - height + 1
+	}
+	cur := v.current()
+	f := v.files[cur]
+	hl := v.highlighted(cur)
+	gutter := len(fmt.Sprint(len(f.lines)))
+	matched := map[int]bool{}
+	for _, m := range v.matches {
+		if m.row == v.row {
+			matched[m.line] = true
+		}
+	}
+
+	w.WriteString("\x1b[H")
+	for y := 0; y < height; y++ {
+		// tree pane
+		if r := v.treeTop + y; r < len(v.rows) {
+			text := clip(v.rows[r].text, treeW-1)
+			pad := strings.Repeat(" ", treeW-1-utf8.RuneCountInString(text))
+			switch {
+			case r == v.row && v.focusTree:
+				w.WriteString("\x1b[7m " + text + pad + "\x1b[0m")
+			case r == v.row:
+				w.WriteString("\x1b[1m " + text + pad + "\x1b[0m")
+			case v.rows[r].file < 0:
+				w.WriteString("\x1b[34m " + text + pad + "\x1b[0m")
+			default:
+				w.WriteString(" " + text + pad)
+			}
+		} else {
+			w.WriteString(strings.Repeat(" ", treeW))
+		}
+		w.WriteString("\x1b[2m│\x1b[0m")
+		// content pane
+		n := v.top + y
+		switch {
+		case f.note != "" && y == 0:
+			w.WriteString(" \x1b[33m" + clip(f.note, textW-1) + "\x1b[0m")
+		case f.note == "" && n < len(f.lines):
+			num := fmt.Sprintf("%*d ", gutter, n+1)
+			if matched[n] {
+				w.WriteString("\x1b[33;1m" + num + "\x1b[0m")
+			} else {
+				w.WriteString("\x1b[2m" + num + "\x1b[0m")
+			}
+			w.WriteString(renderSpans(hl[n], textW-len(num)))
+		}
+		w.WriteString("\x1b[K\r\n")
+	}
+
+	// status line
+	var status string
+	switch {
+	case v.prompt:
+		status = "/" + v.query + "\x1b[7m \x1b[0m"
+	default:
+		pos := ""
+		if len(f.lines) > 0 {
+			pos = fmt.Sprintf("  %d-%d/%d", v.top+1, min(v.top+height, len(f.lines)), len(f.lines))
+		}
+		help := "q quit  tab pane  ↑↓ move  / search  n/N next"
+		switch {
+		case v.message != "":
+			help = v.message
+		case len(f.notes) > 0:
+			help = "note: " + strings.Join(f.notes, "; ")
+		}
+		status = "\x1b[7m " + clip(f.rel+pos, v.width/2) + " \x1b[0m  " + clip(help, v.width/2-4)
+	}
+	w.WriteString(status + "\x1b[K")
+}
+
+// renderSpans paints spans, cut to width visible columns.
+func renderSpans(spans []span, width int) string {
+	var b strings.Builder
+	for _, s := range spans {
+		if width <= 0 {
+			break
+		}
+		text := clip(s.text, width)
+		width -= utf8.RuneCountInString(text)
+		if s.style != "" {
+			b.WriteString("\x1b[" + s.style + "m" + text + "\x1b[0m")
+		} else {
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
+
+// clip cuts s to at most n runes; control characters are shown as '?' so
+// they cannot move the cursor.
+func clip(s string, n int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if n <= 0 {
+			break
+		}
+		if r < 0x20 || r == 0x7f {
+			r = '?'
+		}
+		b.WriteRune(r)
+		n--
+	}
+	return b.String()
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// workspace is one member of a monorepo: a Go module in go.work, a JS package
+// in a pnpm/npm/yarn/Nx workspace, or a crate in a Cargo workspace.
+type workspace struct {
+	name string
+	dir  string   // slash-separated, relative to the repo root
+	deps []string // names of other members this one depends on
+}
+
+// root-level files kept alongside the selected workspaces for context
+var workspaceRootFiles = map[string]bool{
+	"go.work": true, "pnpm-workspace.yaml": true, "package.json": true, "Cargo.toml": true,
+	"nx.json": true, "turbo.json": true, "lerna.json": true, "tsconfig.base.json": true,
+}
+
+// discoverWorkspaces finds every workspace definition under root.
+func discoverWorkspaces(root string) ([]workspace, error) {
+	var all []workspace
+	for _, find := range []func(string) ([]workspace, error){goWorkspaces, jsWorkspaces, cargoWorkspaces} {
+		ws, err := find(root)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, ws...)
+	}
+	return all, nil
+}
+
+// selectWorkspace returns the directories of the named workspace (matched by
+// name or directory) and everything it transitively depends on.
+func selectWorkspace(all []workspace, name string) ([]string, error) {
+	byName := make(map[string]workspace, len(all))
+	var start *workspace
+	for i, w := range all {
+		byName[w.name] = w
+		if w.name == name || w.dir == strings.Trim(filepath.ToSlash(name), "/") {
+			start = &all[i]
+		}
+	}
+	if start == nil {
+		var names []string
+		for _, w := range all {
+			names = append(names, w.name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("workspace %q not found: no go.work, pnpm-workspace.yaml, package.json workspaces or Cargo workspace under root", name)
+		}
+		return nil, fmt.Errorf("workspace %q not found; available: %s", name, strings.Join(names, ", "))
+	}
+
+	seen := map[string]bool{}
+	var dirs []string
+	queue := []workspace{*start}
+	for len(queue) > 0 {
+		w := queue[0]
+		queue = queue[1:]
+		if seen[w.name] {
+			continue
+		}
+		seen[w.name] = true
+		dirs = append(dirs, w.dir)
+		for _, d := range w.deps {
+			if dep, ok := byName[d]; ok && !seen[d] {
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// inWorkspaces reports whether rel lies in one of dirs or is a root-level
+// workspace definition file.
+func inWorkspaces(rel string, dirs []string) bool {
+	if workspaceRootFiles[rel] {
+		return true
+	}
+	for _, d := range dirs {
+		if d == "." || rel == d || strings.HasPrefix(rel, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Go (go.work) ---
+
+var (
+	goModuleRe  = regexp.MustCompile(`^module\s+(\S+)`)
+	goRequireRe = regexp.MustCompile(`^(?:require\s+)?([^\s()]+)\s+v\S+`)
+)
+
+func goWorkspaces(root string) ([]workspace, error) {
+	data, err := os.ReadFile(filepath.Join(root, "go.work"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	inUse := false
+	for _, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimSpace(stripLineComment(l, "//"))
+		switch {
+		case l == "use (":
+			inUse = true
+		case inUse && l == ")":
+			inUse = false
+		case inUse && l != "":
+			dirs = append(dirs, strings.Trim(l, `"`))
+		case strings.HasPrefix(l, "use "):
+			dirs = append(dirs, strings.Trim(strings.TrimSpace(l[4:]), `"`))
+		}
+	}
+
+	var ws []workspace
+	for _, d := range dirs {
+		mod, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(d), "go.mod"))
+		if err != nil {
+			continue
+		}
+		w := workspace{dir: cleanRel(d)}
+		for _, l := range strings.Split(string(mod), "\n") {
+			l = strings.TrimSpace(stripLineComment(l, "//"))
+			if m := goModuleRe.FindStringSubmatch(l); m != nil {
+				w.name = m[1]
+			} else if m := goRequireRe.FindStringSubmatch(l); m != nil {
+				w.deps = append(w.deps, m[1])
+			}
+		}
+		if w.name != "" {
+			ws = append(ws, w)
+		}
+	}
+	return ws, nil
+}
+
+// --- JavaScript (pnpm, npm/yarn workspaces, Turbo, Nx) ---
+
+type packageJSON struct {
+	Name                 string            `json:"name"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	Workspaces           json.RawMessage   `json:"workspaces"`
+}
+
+func jsWorkspaces(root string) ([]workspace, error) {
+	var patterns []string
+	if data, err := os.ReadFile(filepath.Join(root, "pnpm-workspace.yaml")); err == nil {
+		patterns = append(patterns, yamlList(string(data), "packages")...)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+		var pj packageJSON
+		if err := json.Unmarshal(data, &pj); err != nil {
+			return nil, fmt.Errorf("package.json: %w", err)
+		}
+		var list []string
+		var obj struct {
+			Packages []string `json:"packages"`
+		}
+		if json.Unmarshal(pj.Workspaces, &list) == nil {
+			patterns = append(patterns, list...)
+		} else if json.Unmarshal(pj.Workspaces, &obj) == nil {
+			patterns = append(patterns, obj.Packages...)
+		}
+	}
+	// Nx keeps projects under apps/ and libs/ by convention, often without package.json
+	if _, err := os.Stat(filepath.Join(root, "nx.json")); err == nil {
+		patterns = append(patterns, "apps/*", "libs/*", "packages/*")
+	}
+
+	dirs := expandWorkspaceGlobs(root, patterns)
+	var ws []workspace
+	for _, d := range dirs {
+		w, ok := jsPackage(root, d)
+		if ok {
+			ws = append(ws, w)
+		}
+	}
+	return ws, nil
+}
+
+func jsPackage(root, dir string) (workspace, bool) {
+	w := workspace{dir: dir}
+	abs := filepath.Join(root, filepath.FromSlash(dir))
+	if data, err := os.ReadFile(filepath.Join(abs, "package.json")); err == nil {
+		var pj packageJSON
+		if json.Unmarshal(data, &pj) == nil {
+			w.name = pj.Name
+			for _, m := range []map[string]string{pj.Dependencies, pj.DevDependencies, pj.PeerDependencies, pj.OptionalDependencies} {
+				for dep := range m {
+					w.deps = append(w.deps, dep)
+				}
+			}
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(abs, "project.json")); err == nil {
+		var pj struct {
+			Name                 string   `json:"name"`
+			ImplicitDependencies []string `json:"implicitDependencies"`
+		}
+		if json.Unmarshal(data, &pj) == nil {
+			if w.name == "" {
+				w.name = pj.Name
+			}
+			w.deps = append(w.deps, pj.ImplicitDependencies...)
+		}
+	}
+	if w.name == "" {
+		return w, false
+	}
+	sort.Strings(w.deps)
+	return w, true
+}
+
+// expandWorkspaceGlobs resolves workspace patterns ("packages/*", "apps/**",
+// "tools/cli") to existing directories; "!pattern" removes matches.
+func expandWorkspaceGlobs(root string, patterns []string) []string {
+	set := map[string]bool{}
+	for _, p := range patterns {
+		neg := strings.HasPrefix(p, "!")
+		p = strings.TrimSuffix(strings.TrimPrefix(p, "!"), "/")
+		// "**" in workspace globs means "any depth"; one level covers the common layouts
+		p = strings.ReplaceAll(p, "**", "*")
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(p)))
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || !info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(root, m)
+			if err != nil {
+				continue
+			}
+			if neg {
+				delete(set, filepath.ToSlash(rel))
+			} else {
+				set[filepath.ToSlash(rel)] = true
+			}
+		}
+	}
+	var out []string
+	for d := range set {
+		out = append(out, d)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// yamlList reads a top-level block list such as
+//
+//	packages:
+//	  - 'packages/*'
+func yamlList(doc, key string) []string {
+	var out []string
+	in := false
+	sc := bufio.NewScanner(strings.NewReader(doc))
+	for sc.Scan() {
+		line := stripLineComment(sc.Text(), "#")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			in = strings.TrimSpace(strings.TrimSuffix(trimmed, ":")) == key && strings.HasSuffix(trimmed, ":")
+			continue
+		}
+		if in && strings.HasPrefix(trimmed, "- ") {
+			out = append(out, strings.Trim(strings.TrimSpace(trimmed[2:]), `'"`))
+		}
+	}
+	return out
+}
+
+// --- Rust (Cargo workspace) ---
+
+func cargoWorkspaces(root string) ([]workspace, error) {
+	data, err := os.ReadFile(filepath.Join(root, "Cargo.toml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	members := tomlArray(string(data), "workspace", "members")
+	if len(members) == 0 {
+		return nil, nil
+	}
+	var ws []workspace
+	for _, d := range expandWorkspaceGlobs(root, members) {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(d), "Cargo.toml"))
+		if err != nil {
+			continue
+		}
+		doc := string(data)
+		w := workspace{dir: d, name: tomlString(doc, "package", "name")}
+		for _, sec := range []string{"dependencies", "dev-dependencies", "build-dependencies"} {
+			w.deps = append(w.deps, tomlKeys(doc, sec)...)
+		}
+		if w.name != "" {
+			ws = append(ws, w)
+		}
+	}
+	return ws, nil
+}
+
+// tomlSection returns the lines of [name], excluding the header.
+func tomlSection(doc, name string) []string {
+	var out []string
+	in := false
+	for _, l := range strings.Split(doc, "\n") {
+		t := strings.TrimSpace(stripLineComment(l, "#"))
+		if strings.HasPrefix(t, "[") {
+			in = t == "["+name+"]"
+			continue
+		}
+		if in && t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func tomlString(doc, section, key string) string {
+	for _, l := range tomlSection(doc, section) {
+		if k, v, ok := strings.Cut(l, "="); ok && strings.TrimSpace(k) == key {
+			return strings.Trim(strings.TrimSpace(v), `"'`)
+		}
+	}
+	return ""
+}
+
+func tomlKeys(doc, section string) []string {
+	var out []string
+	for _, l := range tomlSection(doc, section) {
+		if k, _, ok := strings.Cut(l, "="); ok {
+			out = append(out, strings.Trim(strings.TrimSpace(k), `"`))
+		}
+	}
+	return out
+}
+
+// tomlArray reads a string array that may span several lines.
+func tomlArray(doc, section, key string) []string {
+	lines := tomlSection(doc, section)
+	for i, l := range lines {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		buf := v
+		for j := i + 1; !strings.Contains(buf, "]") && j < len(lines); j++ {
+			buf += lines[j]
+		}
+		buf = strings.TrimSpace(buf)
+		buf = strings.TrimSuffix(strings.TrimPrefix(buf, "["), "]")
+		var out []string
+		for _, item := range strings.Split(buf, ",") {
+			if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+				out = append(out, item)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func stripLineComment(line, marker string) string {
+	if i := strings.Index(line, marker); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func cleanRel(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}